@@ -1,20 +1,103 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 
-	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
 )
 
-func GetPaperAccount(w http.ResponseWriter, r *http.Request) {
-	account := utils.GetPaperAccount()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(account)
+// AccountHandler serves the account endpoints
+type AccountHandler struct {
+	brokers *trading.Registry
 }
 
-func GetLiveAccount(w http.ResponseWriter, r *http.Request) {
-	account := utils.GetLiveAccount()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(account)
+// NewAccountHandler creates an account handler backed by the given brokers
+func NewAccountHandler(brokers *trading.Registry) *AccountHandler {
+	return &AccountHandler{brokers: brokers}
+}
+
+// AccountSummary is the state of one account in the accounts listing
+type AccountSummary struct {
+	Name        string           `json:"name"`
+	Paper       bool             `json:"paper"`
+	Status      string           `json:"status,omitempty"`
+	Equity      *decimal.Decimal `json:"equity,omitempty"`
+	BuyingPower *decimal.Decimal `json:"buying_power,omitempty"`
+	Cash        *decimal.Decimal `json:"cash,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// GetAccounts lists every account the caller may use with its equity, buying
+// power and status. An account that cannot be fetched is listed with its error.
+func (h *AccountHandler) GetAccounts(c *gin.Context) {
+	p := principal(c)
+	summaries := []AccountSummary{}
+
+	for _, info := range h.brokers.Accounts() {
+		if !p.Allows(auth.AccountScope(info.Name)) {
+			continue
+		}
+
+		summary := AccountSummary{Name: info.Name, Paper: info.Paper}
+		account, err := h.fetch(info.Name)
+		if err != nil {
+			summary.Error = err.Error()
+		} else {
+			summary.Status = account.Status
+			summary.Equity = &account.Equity
+			summary.BuyingPower = &account.BuyingPower
+			summary.Cash = &account.Cash
+		}
+		summaries = append(summaries, summary)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": summaries})
+}
+
+// GetAccount retrieves the account named in the path
+func (h *AccountHandler) GetAccount(c *gin.Context) {
+	h.getAccount(c, c.Param("name"))
+}
+
+// GetPaperAccount retrieves the paper trading account
+func (h *AccountHandler) GetPaperAccount(c *gin.Context) {
+	h.getAccount(c, h.brokers.Resolve(true))
+}
+
+// GetLiveAccount retrieves the live trading account
+func (h *AccountHandler) GetLiveAccount(c *gin.Context) {
+	h.getAccount(c, h.brokers.Resolve(false))
+}
+
+func (h *AccountHandler) fetch(name string) (*alpaca.Account, error) {
+	broker, err := h.brokers.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return trading.GetAccount(broker)
+}
+
+func (h *AccountHandler) getAccount(c *gin.Context, name string) {
+	setAccountHeader(c, name)
+	if !authorizeAccount(c, name) {
+		return
+	}
+
+	broker, err := h.brokers.Get(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := trading.GetAccount(broker)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
 }
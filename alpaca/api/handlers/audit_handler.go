@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/audit"
+)
+
+// CallerKey is the context key holding the identity of the caller, recorded
+// with every audited request
+const CallerKey = "caller"
+
+// maxAuditedBytes caps how much of a request or response body is audited
+const maxAuditedBytes = 64 << 10
+
+// maxRequestBytes caps the body of an audited request, which is read into
+// memory whole. No order or strategy request comes close; larger bodies are
+// refused with 413.
+const maxRequestBytes = 1 << 20
+
+// AuditHandler records mutating API calls and serves the audit log
+type AuditHandler struct {
+	log *audit.Log
+}
+
+// NewAuditHandler creates an audit handler writing to and reading from l
+func NewAuditHandler(l *audit.Log) *AuditHandler {
+	return &AuditHandler{log: l}
+}
+
+// Record is middleware that writes an audit entry for the request it wraps,
+// with the caller, the request body, the response and how long it took
+func (h *AuditHandler) Record(c *gin.Context) {
+	start := time.Now()
+
+	// Read the body for the record and put it back for the handler
+	var body []byte
+	if c.Request.Body != nil {
+		data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxRequestBytes))
+		if err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		body = data
+	}
+
+	writer := &auditWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	c.Next()
+
+	caller := c.GetString(CallerKey)
+	if caller == "" {
+		caller = "anonymous"
+	}
+	account := c.Writer.Header().Get(AccountHeader)
+	if account == "" {
+		account = c.Param("account")
+	}
+
+	entry := audit.Entry{
+		At:        start,
+		Caller:    caller,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetHeader("X-Request-ID"),
+		Account:   account,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.RequestURI(),
+		Route:     c.FullPath(),
+		Body:      auditedJSON(body),
+		Status:    c.Writer.Status(),
+		Result:    auditedJSON(writer.body.Bytes()),
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if _, err := h.log.Append(entry); err != nil {
+		log.Printf("Warning: failed to write audit entry for %s %s: %v", entry.Method, entry.Path, err)
+	}
+}
+
+// GetEntries pages through the audit log, newest first. Passing the lowest
+// seq of a page as before fetches the page after it.
+func (h *AuditHandler) GetEntries(c *gin.Context) {
+	filter := audit.Filter{
+		Caller:  c.Query("caller"),
+		Account: c.Query("account"),
+		Method:  c.Query("method"),
+	}
+
+	var err error
+	if s := c.Query("before"); s != "" {
+		if filter.Before, err = strconv.ParseUint(s, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before, must be a sequence number"})
+			return
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		if filter.Limit, err = strconv.Atoi(s); err != nil || filter.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	entries, err := h.log.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	page := gin.H{"entries": entries}
+	if len(entries) > 0 && entries[len(entries)-1].Seq > 1 {
+		page["next_before"] = entries[len(entries)-1].Seq
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// Verify checks the hash chain of the whole audit log
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.log.Verify()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// auditedJSON keeps a body as JSON when it is, and as a JSON string when it is
+// not, truncating it to maxAuditedBytes
+func auditedJSON(data []byte) json.RawMessage {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) <= maxAuditedBytes && json.Valid(data) {
+		return data
+	}
+
+	truncated, err := json.Marshal(string(data[:min(len(data), maxAuditedBytes)]))
+	if err != nil {
+		return nil
+	}
+	return truncated
+}
+
+// auditWriter keeps a copy of the response for the audit log
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < maxAuditedBytes+1 {
+		w.body.Write(data[:min(len(data), maxAuditedBytes+1-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
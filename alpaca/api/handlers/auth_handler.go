@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+)
+
+const (
+	// APIKeyHeader carries the API key, as an alternative to a bearer token
+	APIKeyHeader = "X-API-Key"
+	// PrincipalKey is the context key holding the authenticated auth.Principal
+	PrincipalKey = "principal"
+)
+
+// Authenticator checks the API key of each request against the configured
+// keys and the scopes a route requires
+type Authenticator struct {
+	keys *auth.KeyStore
+}
+
+// NewAuthenticator creates an authenticator for keys. A nil key store
+// disables authentication, treating every request as auth.Anonymous.
+func NewAuthenticator(keys *auth.KeyStore) *Authenticator {
+	return &Authenticator{keys: keys}
+}
+
+// Require is middleware that authenticates a request and checks the caller
+// has at least one of scopes. With no scopes any authenticated caller passes.
+func (a *Authenticator) Require(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := a.authenticate(c)
+		if !ok {
+			return
+		}
+		if len(scopes) > 0 && !principal.AllowsAny(scopes...) {
+			authError(c, http.StatusForbidden, fmt.Sprintf("key %q lacks the %s scope", principal.Name, strings.Join(scopes, " or ")))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireTrading is middleware that authenticates a request and checks the
+// caller may use at least one trading account. Handlers check the account a
+// request acts on with authorizeAccount.
+func (a *Authenticator) RequireTrading() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := a.authenticate(c)
+		if !ok {
+			return
+		}
+		if !principal.CanTrade() {
+			authError(c, http.StatusForbidden, fmt.Sprintf("key %q lacks a trading scope", principal.Name))
+			return
+		}
+		c.Next()
+	}
+}
+
+// Identify is middleware that authenticates a request presenting a valid
+// key and lets any other request through unauthenticated, for routes that
+// serve everyone but tell callers apart with authenticated
+func (a *Authenticator) Identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.keys == nil {
+			setPrincipal(c, auth.Anonymous)
+		} else if principal, err := a.keys.Authenticate(requestKey(c)); err == nil {
+			setPrincipal(c, principal)
+		}
+		c.Next()
+	}
+}
+
+// GetPrincipal retrieves the caller the request was authenticated as
+func (a *Authenticator) GetPrincipal(c *gin.Context) {
+	c.JSON(http.StatusOK, principal(c))
+}
+
+// authenticate resolves the caller from the X-API-Key header or a bearer
+// token and stores it on the context, writing a 401 when it cannot
+func (a *Authenticator) authenticate(c *gin.Context) (auth.Principal, bool) {
+	if a.keys == nil {
+		setPrincipal(c, auth.Anonymous)
+		return auth.Anonymous, true
+	}
+
+	principal, err := a.keys.Authenticate(requestKey(c))
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer realm="investment-trader"`)
+		authError(c, http.StatusUnauthorized, err.Error())
+		return auth.Principal{}, false
+	}
+
+	setPrincipal(c, principal)
+	return principal, true
+}
+
+// requestKey returns the key from the X-API-Key header or a bearer token
+func requestKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func setPrincipal(c *gin.Context, principal auth.Principal) {
+	c.Set(PrincipalKey, principal)
+	c.Set(CallerKey, principal.Name)
+}
+
+// principal returns the caller of an authenticated request. Requests that
+// never passed the authenticator get a principal with no scopes.
+func principal(c *gin.Context) auth.Principal {
+	if value, ok := c.Get(PrincipalKey); ok {
+		if p, ok := value.(auth.Principal); ok {
+			return p
+		}
+	}
+	return auth.Principal{}
+}
+
+// authenticated reports whether the request passed the authenticator
+func authenticated(c *gin.Context) bool {
+	_, ok := c.Get(PrincipalKey)
+	return ok
+}
+
+// authorizeAccount checks the caller may use an account, writing a 403 when
+// it may not
+func authorizeAccount(c *gin.Context, account string) bool {
+	p := principal(c)
+	if !p.Allows(auth.AccountScope(account)) {
+		authError(c, http.StatusForbidden, fmt.Sprintf("key %q lacks the %s scope", p.Name, auth.AccountScope(account)))
+		return false
+	}
+	return true
+}
+
+// authError aborts a request with the error body shared by every
+// authentication and authorization failure
+func authError(c *gin.Context, status int, message string) {
+	code := "forbidden"
+	if status == http.StatusUnauthorized {
+		code = "unauthorized"
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": message, "code": code})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/backtest"
+)
+
+// BacktestHandler serves the backtest endpoints
+type BacktestHandler struct {
+	runner *backtest.Runner
+}
+
+// NewBacktestHandler creates a backtest handler submitting to runner
+func NewBacktestHandler(runner *backtest.Runner) *BacktestHandler {
+	return &BacktestHandler{runner: runner}
+}
+
+// SubmitBacktest queues a backtest and returns it with status 202. Poll
+// GetBacktest for the result.
+func (h *BacktestHandler) SubmitBacktest(c *gin.Context) {
+	var req backtest.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := h.runner.Submit(req)
+	if errors.Is(err, backtest.ErrQueueFull) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// GetBacktests lists the recent backtests, newest first, with their summaries
+func (h *BacktestHandler) GetBacktests(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"backtests": h.runner.List()})
+}
+
+// GetBacktest retrieves a backtest with its equity curve, fills, trades and
+// summary statistics
+func (h *BacktestHandler) GetBacktest(c *gin.Context) {
+	run, err := h.runner.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
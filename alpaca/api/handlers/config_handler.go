@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/config"
+)
+
+// ConfigHandler serves the configuration the server was started with
+type ConfigHandler struct {
+	cfg config.Config
+}
+
+// NewConfigHandler creates a config handler for cfg
+func NewConfigHandler(cfg config.Config) *ConfigHandler {
+	return &ConfigHandler{cfg: cfg}
+}
+
+// GetConfig retrieves the configuration with credentials and tokens redacted
+func (h *ConfigHandler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.cfg.Redacted())
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/health"
+)
+
+// HealthHandler serves the state of the server and its components
+type HealthHandler struct {
+	monitor *health.Monitor
+}
+
+// NewHealthHandler creates a health handler reporting from monitor
+func NewHealthHandler(monitor *health.Monitor) *HealthHandler {
+	return &HealthHandler{monitor: monitor}
+}
+
+// GetHealth reports whether the server is ok or degraded and the state of
+// each component. A degraded server is still serving, so the status code is
+// 200 either way. Component details are only shown to authenticated callers.
+func (h *HealthHandler) GetHealth(c *gin.Context) {
+	report := h.monitor.Report()
+	if !authenticated(c) {
+		report = report.Redacted()
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/journal"
+)
+
+// JournalHandler serves the order and fill journal
+type JournalHandler struct {
+	journal *journal.Journal
+}
+
+// NewJournalHandler creates a journal handler reading from j
+func NewJournalHandler(j *journal.Journal) *JournalHandler {
+	return &JournalHandler{journal: j}
+}
+
+// GetRecords retrieves journal records, newest first, filtered by account,
+// symbol, strategy, status, kind and date range
+func (h *JournalHandler) GetRecords(c *gin.Context) {
+	filter := journal.Filter{
+		Account:  c.Query("account"),
+		Symbol:   c.Query("symbol"),
+		Strategy: c.Query("strategy"),
+		Status:   c.Query("status"),
+		Kind:     c.Query("kind"),
+		OrderID:  c.Query("order_id"),
+	}
+
+	var err error
+	if s := c.Query("start"); s != "" {
+		if filter.Start, err = parseJournalTime(s, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start, must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+	}
+	if s := c.Query("end"); s != "" {
+		if filter.End, err = parseJournalTime(s, true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end, must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		if filter.Limit, err = strconv.Atoi(s); err != nil || filter.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	records, err := h.journal.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+// GetOrderHistory retrieves every journal record of a single order, newest
+// first
+func (h *JournalHandler) GetOrderHistory(c *gin.Context) {
+	records, err := h.journal.Query(journal.Filter{OrderID: c.Param("id")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+// parseJournalTime accepts an RFC3339 timestamp or a date. A date used as the
+// end of a range covers the whole day.
+func parseJournalTime(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	alpacamd "github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/indicators"
 	"github.com/nathgoh/investment-trader/alpaca/internal/marketdata"
 )
 
@@ -40,3 +44,180 @@ func GetStockQuote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(quotes)
 }
+
+// GetStockBars retrieves historical bars for a symbol
+func GetStockBars(c *gin.Context) {
+	symbol := c.Param("symbol")
+
+	q, ok := parseBarsQuery(c)
+	if !ok {
+		return
+	}
+
+	bars, err := marketdata.GetStockBars(symbol, q.timeframe, q.start, q.end, q.adjustment, q.feed, q.limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, bars)
+}
+
+// GetIndicator computes a technical indicator over a symbol's bars. The
+// indicator is chosen with the name parameter and every other parameter that
+// is not a bars parameter is one of its own, such as period. Bars before start
+// are fetched to warm the indicator up, so its values do not depend on where
+// the range starts.
+func GetIndicator(c *gin.Context) {
+	symbol := c.Param("symbol")
+
+	name := strings.ToLower(c.Query("name"))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name parameter is required"})
+		return
+	}
+	params := indicators.Params{}
+	for key, values := range c.Request.URL.Query() {
+		if key == "name" || barsParams[key] {
+			continue
+		}
+		v, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s parameter", key)})
+			return
+		}
+		params[key] = v
+	}
+	spec, err := indicators.NewSpec(name, params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	q, ok := parseBarsQuery(c)
+	if !ok {
+		return
+	}
+
+	warmup, err := marketdata.GetStockBarsBefore(symbol, q.timeframe, q.start, spec.Warmup(), q.adjustment, q.feed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	bars, err := marketdata.GetStockBars(symbol, q.timeframe, q.start, q.end, q.adjustment, q.feed, q.limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	values := []indicators.Point{}
+	for _, point := range spec.Compute(append(warmup, bars...)) {
+		if !point.Timestamp.Before(q.start) {
+			values = append(values, point)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":    symbol,
+		"timeframe": c.DefaultQuery("timeframe", "1Day"),
+		"indicator": spec,
+		"values":    values,
+	})
+}
+
+// barsParams are the query parameters parseBarsQuery reads
+var barsParams = map[string]bool{
+	"timeframe": true, "adjustment": true, "feed": true, "start": true, "end": true, "limit": true,
+}
+
+// barsQuery is the range and options of a request for bars
+type barsQuery struct {
+	timeframe  alpacamd.TimeFrame
+	adjustment alpacamd.Adjustment
+	feed       alpacamd.Feed
+	start, end time.Time
+	limit      int
+}
+
+// parseBarsQuery reads the timeframe, adjustment, feed, start, end and limit
+// parameters, writing an error response when one is invalid. The range
+// defaults to the 30 days before now.
+func parseBarsQuery(c *gin.Context) (barsQuery, bool) {
+	var q barsQuery
+
+	var err error
+	q.timeframe, err = marketdata.ParseTimeFrame(c.DefaultQuery("timeframe", "1Day"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return q, false
+	}
+
+	q.adjustment, err = marketdata.ParseAdjustment(c.DefaultQuery("adjustment", "raw"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return q, false
+	}
+
+	if f := c.Query("feed"); f != "" {
+		if q.feed, err = marketdata.ParseFeed(f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return q, false
+		}
+	}
+
+	q.end = time.Now()
+	if e := c.Query("end"); e != "" {
+		if q.end, err = time.Parse(time.RFC3339, e); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end, must be RFC3339"})
+			return q, false
+		}
+	}
+
+	q.start = q.end.AddDate(0, 0, -30)
+	if s := c.Query("start"); s != "" {
+		if q.start, err = time.Parse(time.RFC3339, s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start, must be RFC3339"})
+			return q, false
+		}
+	}
+
+	if l := c.Query("limit"); l != "" {
+		if q.limit, err = strconv.Atoi(l); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+			return q, false
+		}
+	}
+
+	return q, true
+}
+
+// GetStockSnapshots retrieves snapshots for a comma separated list of symbols
+func GetStockSnapshots(c *gin.Context) {
+	var symbols []string
+	for _, s := range strings.Split(c.Query("symbols"), ",") {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" {
+			symbols = append(symbols, s)
+		}
+	}
+	if len(symbols) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbols parameter is required"})
+		return
+	}
+
+	var feed string
+	if f := c.Query("feed"); f != "" {
+		var err error
+		if feed, err = marketdata.ParseFeed(f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	snapshots, err := marketdata.GetStockSnapshots(symbols, feed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshots)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/performance"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// PerformanceHandler serves the portfolio performance endpoint
+type PerformanceHandler struct {
+	analyzer *performance.Analyzer
+	brokers  *trading.Registry
+}
+
+// NewPerformanceHandler creates a performance handler reporting on the
+// accounts of brokers
+func NewPerformanceHandler(analyzer *performance.Analyzer, brokers *trading.Registry) *PerformanceHandler {
+	return &PerformanceHandler{analyzer: analyzer, brokers: brokers}
+}
+
+// GetPerformance reports an account's performance over a period, the default
+// paper account over a month when none are given, compared with a benchmark
+// symbol (default SPY)
+func (h *PerformanceHandler) GetPerformance(c *gin.Context) {
+	name := c.Query("account")
+	if name == "" {
+		name = h.brokers.Resolve(true)
+	}
+	period, err := performance.ParsePeriod(c.DefaultQuery("period", "1M"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setAccountHeader(c, name)
+	if !authorizeAccount(c, name) {
+		return
+	}
+	broker, err := h.brokers.Get(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.analyzer.Report(name, broker, period, c.DefaultQuery("benchmark", "SPY"))
+	if errors.Is(err, trading.ErrNoPortfolioHistory) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error(), "account": name})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+	"github.com/nathgoh/investment-trader/alpaca/internal/risk"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// RiskHandler serves the pre-trade risk and kill switch endpoints
+type RiskHandler struct {
+	engine  *risk.Engine
+	brokers *trading.Registry
+	gate    *trading.LiveGate
+}
+
+// NewRiskHandler creates a risk handler for the given engine and brokers.
+// Halts that cancel orders or close positions on the live account are
+// guarded by gate.
+func NewRiskHandler(engine *risk.Engine, brokers *trading.Registry, gate *trading.LiveGate) *RiskHandler {
+	return &RiskHandler{engine: engine, brokers: brokers, gate: gate}
+}
+
+// GetLimits retrieves the limits orders are checked against
+func (h *RiskHandler) GetLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, h.engine.Limits())
+}
+
+// GetRejections retrieves the orders rejected by the risk checks on the
+// accounts the caller may use, most recent first, optionally filtered by
+// account
+func (h *RiskHandler) GetRejections(c *gin.Context) {
+	caller := principal(c)
+	account := c.Query("account")
+
+	rejections := []risk.Rejection{}
+	for _, r := range h.engine.Rejections() {
+		if (account == "" || r.Account == account) && caller.Allows(auth.AccountScope(r.Account)) {
+			rejections = append(rejections, r)
+		}
+	}
+
+	c.JSON(http.StatusOK, rejections)
+}
+
+// GetStatuses retrieves the session P&L and halt state of every account the
+// caller may use
+func (h *RiskHandler) GetStatuses(c *gin.Context) {
+	caller := principal(c)
+
+	statuses := []risk.AccountStatus{}
+	for _, name := range h.brokers.Names() {
+		if !caller.Allows(auth.AccountScope(name)) {
+			continue
+		}
+		broker, err := h.brokers.Get(name)
+		if err != nil {
+			continue
+		}
+		status, err := h.engine.Refresh(name, broker)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(http.StatusOK, statuses)
+}
+
+// GetStatus retrieves the session P&L and halt state of an account
+func (h *RiskHandler) GetStatus(c *gin.Context) {
+	account := c.Param("account")
+	setAccountHeader(c, account)
+	if !authorizeAccount(c, account) {
+		return
+	}
+	broker, err := h.brokers.Get(account)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.engine.Refresh(account, broker)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Halt stops new orders on an account, optionally cancelling its orders and
+// closing its positions
+func (h *RiskHandler) Halt(c *gin.Context) {
+	account := c.Param("account")
+	setAccountHeader(c, account)
+	if !authorizeAccount(c, account) {
+		return
+	}
+	broker, err := h.brokers.Get(account)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req risk.HaltRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Halting alone is always allowed, but cleaning up touches the account
+	if req.CancelOrders || req.ClosePositions {
+		info, err := h.brokers.Info(account)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := h.gate.Authorize(info, c.GetHeader(LiveTokenHeader)); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "account": account})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, h.engine.Halt(account, broker, req))
+}
+
+// Resume lifts the halt on an account
+func (h *RiskHandler) Resume(c *gin.Context) {
+	account := c.Param("account")
+	setAccountHeader(c, account)
+	if _, err := h.brokers.Get(account); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.engine.Resume(account))
+}
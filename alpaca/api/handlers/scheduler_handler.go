@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/scheduler"
+)
+
+// SchedulerHandler serves the scheduled jobs
+type SchedulerHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+// NewSchedulerHandler creates a scheduler handler reporting on s
+func NewSchedulerHandler(s *scheduler.Scheduler) *SchedulerHandler {
+	return &SchedulerHandler{scheduler: s}
+}
+
+// GetJobs lists the scheduled jobs with their last and next runs, and why
+// the market calendar could not be loaded when it could not
+func (h *SchedulerHandler) GetJobs(c *gin.Context) {
+	resp := gin.H{"jobs": h.scheduler.Jobs()}
+	if err := h.scheduler.Err(); err != nil {
+		resp["calendar_error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
+)
+
+// SimHandler serves the controls of accounts backed by the simulated broker
+type SimHandler struct {
+	brokers *trading.Registry
+}
+
+// NewSimHandler creates a handler for the simulated accounts among brokers
+func NewSimHandler(brokers *trading.Registry) *SimHandler {
+	return &SimHandler{brokers: brokers}
+}
+
+// SetPricesRequest is the body of a simulated price update
+type SetPricesRequest struct {
+	Prices map[string]decimal.Decimal `json:"prices" binding:"required"`
+}
+
+// SetPrices moves the prices of a simulated account's feed, filling the
+// working orders that become marketable
+func (h *SimHandler) SetPrices(c *gin.Context) {
+	name := c.Param("account")
+	setAccountHeader(c, name)
+	if !authorizeAccount(c, name) {
+		return
+	}
+
+	var req SetPricesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	broker, err := h.brokers.Get(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sim, ok := trading.Simulator(broker)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("account %q does not use the simulated broker", name)})
+		return
+	}
+
+	// Check every price before moving any
+	for symbol, price := range req.Prices {
+		if !price.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("price of %s must be positive", symbol)})
+			return
+		}
+	}
+	for symbol, price := range req.Prices {
+		if err := sim.SetPrice(symbol, price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"account": name, "prices": req.Prices})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// StrategyHandler serves the endpoints that start and control live strategy
+// instances
+type StrategyHandler struct {
+	runner  *strategy.Runner
+	brokers *trading.Registry
+	gate    *trading.LiveGate
+}
+
+// NewStrategyHandler creates a strategy handler for runner. Starting or
+// resuming an instance on the live account is guarded by gate.
+func NewStrategyHandler(runner *strategy.Runner, brokers *trading.Registry, gate *trading.LiveGate) *StrategyHandler {
+	return &StrategyHandler{runner: runner, brokers: brokers, gate: gate}
+}
+
+// GetStrategies lists the strategies that can be started and the instances
+// on the accounts the caller may use, newest first
+func (h *StrategyHandler) GetStrategies(c *gin.Context) {
+	caller := principal(c)
+
+	instances := []strategy.Instance{}
+	for _, inst := range h.runner.List() {
+		if caller.Allows(auth.AccountScope(inst.Request.Account)) {
+			instances = append(instances, inst)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"available": strategy.Names(), "instances": instances})
+}
+
+// StartStrategy starts a strategy instance on an account, the default paper
+// account when none is given
+func (h *StrategyHandler) StartStrategy(c *gin.Context) {
+	var req strategy.StartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Account == "" {
+		req.Account = h.brokers.Resolve(true)
+	}
+	if !h.authorize(c, req.Account) {
+		return
+	}
+
+	inst, err := h.runner.Start(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, inst)
+}
+
+// GetStrategy retrieves an instance with its stats and the strategy's state
+func (h *StrategyHandler) GetStrategy(c *gin.Context) {
+	inst, ok := h.instance(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, inst)
+}
+
+// PauseStrategy stops an instance receiving market data until it is resumed
+func (h *StrategyHandler) PauseStrategy(c *gin.Context) {
+	if _, ok := h.instance(c); !ok {
+		return
+	}
+
+	inst, err := h.runner.Pause(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, inst)
+}
+
+// ResumeStrategy delivers market data to a paused instance again
+func (h *StrategyHandler) ResumeStrategy(c *gin.Context) {
+	inst, ok := h.instance(c)
+	if !ok || !h.authorize(c, inst.Request.Account) {
+		return
+	}
+
+	inst, err := h.runner.Resume(inst.Name)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, inst)
+}
+
+// StopStrategy stops an instance once its OnStop hook returns. Its open
+// orders are left working.
+func (h *StrategyHandler) StopStrategy(c *gin.Context) {
+	if _, ok := h.instance(c); !ok {
+		return
+	}
+
+	inst, err := h.runner.Stop(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, inst)
+}
+
+// instance looks up the instance named in the path, writing an error
+// response when it does not exist or the caller may not use its account
+func (h *StrategyHandler) instance(c *gin.Context) (strategy.Instance, bool) {
+	inst, err := h.runner.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return inst, false
+	}
+
+	setAccountHeader(c, inst.Request.Account)
+	if !authorizeAccount(c, inst.Request.Account) {
+		return inst, false
+	}
+	return inst, true
+}
+
+// authorize checks the caller may trade an account, including the live gate,
+// writing an error response when it may not
+func (h *StrategyHandler) authorize(c *gin.Context, name string) bool {
+	setAccountHeader(c, name)
+	if !authorizeAccount(c, name) {
+		return false
+	}
+
+	account, err := h.brokers.Info(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := h.gate.Authorize(account, c.GetHeader(LiveTokenHeader)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "account": name})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+	"github.com/nathgoh/investment-trader/alpaca/internal/streaming"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// StreamRequest changes the symbols a streaming client is subscribed to
+type StreamRequest struct {
+	Action string   `json:"action"` // "subscribe" or "unsubscribe"
+	Trades []string `json:"trades"`
+	Quotes []string `json:"quotes"`
+	Bars   []string `json:"bars"`
+}
+
+// StreamHandler serves the real-time market data and order update streams
+type StreamHandler struct {
+	hub            *streaming.Hub
+	tracker        *trading.OrderTracker
+	originPatterns []string
+	shutdown       <-chan struct{}
+}
+
+// NewStreamHandler creates a stream handler that fans out the hub's market
+// data and the tracker's order events. originPatterns lists the browser
+// origins allowed to open WebSockets. Open streams end when shutdown is
+// closed.
+func NewStreamHandler(hub *streaming.Hub, tracker *trading.OrderTracker, originPatterns []string, shutdown <-chan struct{}) *StreamHandler {
+	return &StreamHandler{hub: hub, tracker: tracker, originPatterns: originPatterns, shutdown: shutdown}
+}
+
+// MarketDataWebSocket streams market data over a WebSocket. Clients send
+// StreamRequest messages to subscribe and unsubscribe by symbol.
+func (h *StreamHandler) MarketDataWebSocket(c *gin.Context) {
+	clearWriteDeadline(c)
+	conn, err := websocket.Accept(c.Writer, c.Request, &websocket.AcceptOptions{
+		OriginPatterns: h.originPatterns,
+	})
+	if err != nil {
+		// Accept has already written the error response
+		return
+	}
+	defer conn.CloseNow()
+
+	sub := h.hub.NewSubscriber(principal(c).Name)
+	defer h.hub.Remove(sub)
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	go func() {
+		defer cancel()
+		for {
+			var req StreamRequest
+			if err := wsjson.Read(ctx, conn, &req); err != nil {
+				return
+			}
+
+			reply := streaming.Message{Type: "subscription"}
+			if err := h.apply(sub, req); err != nil {
+				reply = streaming.Message{Type: "error", Data: err.Error()}
+			} else {
+				reply.Data = sub.Subscriptions()
+			}
+			if err := wsjson.Write(ctx, conn, reply); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-sub.Messages():
+			if err := wsjson.Write(ctx, conn, msg); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+		case <-h.shutdown:
+			conn.Close(websocket.StatusGoingAway, "server shutting down")
+			return
+		}
+	}
+}
+
+// MarketDataSSE streams market data as Server-Sent Events. Initial symbols
+// come from the trades, quotes and bars query parameters; the first event
+// carries the subscriber ID used to change subscriptions afterwards.
+func (h *StreamHandler) MarketDataSSE(c *gin.Context) {
+	sub := h.hub.NewSubscriber(principal(c).Name)
+	defer h.hub.Remove(sub)
+
+	err := h.apply(sub, StreamRequest{
+		Action: "subscribe",
+		Trades: splitList(c.Query("trades")),
+		Quotes: splitList(c.Query("quotes")),
+		Bars:   splitList(c.Query("bars")),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clearWriteDeadline(c)
+	c.SSEvent("subscription", gin.H{"id": sub.ID, "subscriptions": sub.Subscriptions()})
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case msg := <-sub.Messages():
+			c.SSEvent(msg.Type, msg)
+			return true
+		case <-sub.Done():
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		case <-h.shutdown:
+			return false
+		}
+	})
+}
+
+// UpdateSubscriptions changes the symbols of an open SSE subscriber. Only
+// the key that opened the stream may change it; to any other the subscriber
+// does not exist.
+func (h *StreamHandler) UpdateSubscriptions(c *gin.Context) {
+	sub, err := h.hub.Subscriber(c.Param("id"))
+	if err == nil && sub.Owner != principal(c).Name {
+		err = fmt.Errorf("subscriber %q not found", c.Param("id"))
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req StreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The stream may close between the lookup and the change
+	err = h.apply(sub, req)
+	if errors.Is(err, streaming.ErrSubscriberRemoved) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("subscriber %q not found", sub.ID)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub.Subscriptions())
+}
+
+// OrderEvents streams order lifecycle events as Server-Sent Events, optionally
+// filtered to the accounts and event types given in the query
+func (h *StreamHandler) OrderEvents(c *gin.Context) {
+	accounts := make(map[string]bool)
+	for _, a := range splitList(c.Query("account")) {
+		accounts[strings.TrimSpace(a)] = true
+	}
+	events := make(map[string]bool)
+	for _, e := range splitList(c.Query("events")) {
+		events[strings.ToLower(strings.TrimSpace(e))] = true
+	}
+
+	caller := principal(c)
+
+	ch, unsubscribe := h.tracker.Events().Subscribe(256)
+	defer unsubscribe()
+
+	clearWriteDeadline(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			if !caller.Allows(auth.AccountScope(event.Account)) {
+				return true
+			}
+			if (len(accounts) == 0 || accounts[event.Account]) && (len(events) == 0 || events[event.Event]) {
+				c.SSEvent(event.Event, event)
+			}
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-h.shutdown:
+			return false
+		}
+	})
+}
+
+func (h *StreamHandler) apply(sub *streaming.Subscriber, req StreamRequest) error {
+	subs := streaming.Subscriptions{
+		Trades: normalizeSymbols(req.Trades),
+		Quotes: normalizeSymbols(req.Quotes),
+		Bars:   normalizeSymbols(req.Bars),
+	}
+
+	switch strings.ToLower(req.Action) {
+	case "subscribe":
+		return h.hub.Subscribe(sub, subs)
+	case "unsubscribe":
+		h.hub.Unsubscribe(sub, subs)
+	default:
+		return fmt.Errorf("invalid action %q, must be 'subscribe' or 'unsubscribe'", req.Action)
+	}
+
+	return nil
+}
+
+// clearWriteDeadline lifts the server's write timeout from a stream, which
+// stays open far longer than any response
+func clearWriteDeadline(c *gin.Context) {
+	// Writers that cannot change the deadline have none to lift
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func normalizeSymbols(symbols []string) []string {
+	var normalized []string
+	for _, s := range symbols {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" {
+			normalized = append(normalized, s)
+		}
+	}
+	return normalized
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -9,32 +10,142 @@ import (
 
 	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
 	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/risk"
 	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
 	"github.com/shopspring/decimal"
 )
 
+// TradingHandler serves the order, position, asset and market info endpoints
+type TradingHandler struct {
+	brokers *trading.Registry
+	gate    *trading.LiveGate
+}
+
+// NewTradingHandler creates a trading handler backed by the given brokers,
+// with changes to the live account guarded by gate
+func NewTradingHandler(brokers *trading.Registry, gate *trading.LiveGate) *TradingHandler {
+	return &TradingHandler{brokers: brokers, gate: gate}
+}
+
+// accountName picks the account a request acts on: the account it names, or
+// for clients that only send is_paper, the paper or live account
+func (h *TradingHandler) accountName(account string, isPaper bool) string {
+	if account != "" {
+		return account
+	}
+	return h.brokers.Resolve(isPaper)
+}
+
+// queryAccount picks the account named by the account or is_paper query
+// parameters
+func (h *TradingHandler) queryAccount(c *gin.Context) string {
+	return h.accountName(c.Query("account"), c.Query("is_paper") == "true")
+}
+
+// broker resolves the account broker for a request, writing an error response
+// when the account is not configured
+func (h *TradingHandler) broker(c *gin.Context, name string) (trading.Broker, bool) {
+	setAccountHeader(c, name)
+	if !authorizeAccount(c, name) {
+		return nil, false
+	}
+
+	broker, err := h.brokers.Get(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return broker, true
+}
+
+// tradingBroker resolves the account broker for a request that changes the
+// account, writing an error response when the live gate refuses it
+func (h *TradingHandler) tradingBroker(c *gin.Context, name string) (trading.Broker, bool) {
+	broker, ok := h.broker(c, name)
+	if !ok {
+		return nil, false
+	}
+
+	account, err := h.brokers.Info(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := h.gate.Authorize(account, c.GetHeader(LiveTokenHeader)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "account": name})
+		return nil, false
+	}
+	return trading.WithMeta(broker, requestMeta(c, "")), true
+}
+
+// defaultBroker resolves the broker used for account-independent queries
+func (h *TradingHandler) defaultBroker(c *gin.Context) (trading.Broker, bool) {
+	broker, err := h.brokers.Default()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return broker, true
+}
+
+const (
+	// AccountHeader is set on responses to the account the request acted on
+	AccountHeader = "X-Trading-Account"
+	// LiveTokenHeader carries the token required to change the live account
+	LiveTokenHeader = "X-Live-Trading-Token"
+)
+
 // PlaceOrderRequest represents the request body for placing an order
 type PlaceOrderRequest struct {
-	Symbol      string  `json:"symbol" binding:"required"`
-	Qty         float64 `json:"qty" binding:"required"`
-	Side        string  `json:"side" binding:"required"` // "buy" or "sell"
-	Type        string  `json:"type" binding:"required"` // "market", "limit", "stop", "stop_limit"
-	TimeInForce string  `json:"time_in_force" binding:"required"` // "day", "gtc", "opg", "cls", "ioc", "fok"
-	LimitPrice  *float64 `json:"limit_price,omitempty"`
-	StopPrice   *float64 `json:"stop_price,omitempty"`
-	IsPaper     bool    `json:"is_paper"`
+	Symbol        string             `json:"symbol" binding:"required"`
+	Qty           *float64           `json:"qty,omitempty"`                    // whole or fractional shares
+	Notional      *float64           `json:"notional,omitempty"`               // dollar amount, instead of qty
+	Side          string             `json:"side" binding:"required"`          // "buy" or "sell"
+	Type          string             `json:"type" binding:"required"`          // "market", "limit", "stop", "stop_limit", "trailing_stop"
+	TimeInForce   string             `json:"time_in_force" binding:"required"` // "day", "gtc", "opg", "cls", "ioc", "fok"
+	LimitPrice    *float64           `json:"limit_price,omitempty"`
+	StopPrice     *float64           `json:"stop_price,omitempty"`
+	TrailPrice    *float64           `json:"trail_price,omitempty"`
+	TrailPercent  *float64           `json:"trail_percent,omitempty"`
+	OrderClass    string             `json:"order_class,omitempty"`     // "simple", "bracket", "oco", "oto"
+	ClientOrderID string             `json:"client_order_id,omitempty"` // idempotency key, also accepted as the Idempotency-Key header
+	Strategy      string             `json:"strategy,omitempty"`        // strategy the order belongs to, recorded in the journal
+	TakeProfit    *TakeProfitRequest `json:"take_profit,omitempty"`
+	StopLoss      *StopLossRequest   `json:"stop_loss,omitempty"`
+	Account       string             `json:"account,omitempty"` // account name, instead of is_paper
+	IsPaper       bool               `json:"is_paper"`
+}
+
+// TakeProfitRequest is the take-profit leg of a bracket, oco or oto order
+type TakeProfitRequest struct {
+	LimitPrice float64 `json:"limit_price" binding:"required"`
+}
+
+// StopLossRequest is the stop-loss leg of a bracket, oco or oto order. Setting
+// limit_price makes the leg a stop limit order.
+type StopLossRequest struct {
+	StopPrice  float64  `json:"stop_price" binding:"required"`
+	LimitPrice *float64 `json:"limit_price,omitempty"`
 }
 
 // PlaceOrder handles placing a new order
-func PlaceOrder(c *gin.Context) {
+func (h *TradingHandler) PlaceOrder(c *gin.Context) {
 	var req PlaceOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Convert qty to decimal
-	qty := decimal.NewFromFloat(req.Qty)
+	// The Idempotency-Key header doubles as the client order ID, so a retried
+	// request finds the order placed by the first attempt
+	clientOrderID := req.ClientOrderID
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		if clientOrderID != "" && clientOrderID != key {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key header and client_order_id do not match"})
+			return
+		}
+		clientOrderID = key
+	}
 
 	// Convert side
 	var side alpaca.Side
@@ -59,45 +170,125 @@ func PlaceOrder(c *gin.Context) {
 		orderType = alpaca.Stop
 	case "stop_limit":
 		orderType = alpaca.StopLimit
+	case "trailing_stop":
+		orderType = alpaca.TrailingStop
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order type"})
 		return
 	}
 
 	// Convert time in force
-	var timeInForce alpaca.TimeInForce
-	switch strings.ToLower(req.TimeInForce) {
-	case "day":
-		timeInForce = alpaca.Day
-	case "gtc":
-		timeInForce = alpaca.GTC
-	case "opg":
-		timeInForce = alpaca.OPG
-	case "cls":
-		timeInForce = alpaca.CLS
-	case "ioc":
-		timeInForce = alpaca.IOC
-	case "fok":
-		timeInForce = alpaca.FOK
-	default:
+	timeInForce, ok := parseTimeInForce(req.TimeInForce)
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid time_in_force"})
 		return
 	}
 
-	// Convert prices to decimal if provided
-	var limitPrice, stopPrice *decimal.Decimal
-	if req.LimitPrice != nil {
-		lp := decimal.NewFromFloat(*req.LimitPrice)
-		limitPrice = &lp
+	// Convert order class
+	var orderClass alpaca.OrderClass
+	switch strings.ToLower(req.OrderClass) {
+	case "":
+	case "simple":
+		orderClass = alpaca.Simple
+	case "bracket":
+		orderClass = alpaca.Bracket
+	case "oco":
+		orderClass = alpaca.OCO
+	case "oto":
+		orderClass = alpaca.OTO
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order_class, must be 'simple', 'bracket', 'oco' or 'oto'"})
+		return
+	}
+
+	orderReq := alpaca.PlaceOrderRequest{
+		Symbol:        req.Symbol,
+		Qty:           decimalPtr(req.Qty),
+		Notional:      decimalPtr(req.Notional),
+		Side:          side,
+		Type:          orderType,
+		TimeInForce:   timeInForce,
+		LimitPrice:    decimalPtr(req.LimitPrice),
+		StopPrice:     decimalPtr(req.StopPrice),
+		TrailPrice:    decimalPtr(req.TrailPrice),
+		TrailPercent:  decimalPtr(req.TrailPercent),
+		OrderClass:    orderClass,
+		ClientOrderID: clientOrderID,
+	}
+	if req.TakeProfit != nil {
+		orderReq.TakeProfit = &alpaca.TakeProfit{
+			LimitPrice: decimalPtr(&req.TakeProfit.LimitPrice),
+		}
+	}
+	if req.StopLoss != nil {
+		orderReq.StopLoss = &alpaca.StopLoss{
+			StopPrice:  decimalPtr(&req.StopLoss.StopPrice),
+			LimitPrice: decimalPtr(req.StopLoss.LimitPrice),
+		}
 	}
-	if req.StopPrice != nil {
-		sp := decimal.NewFromFloat(*req.StopPrice)
-		stopPrice = &sp
+
+	broker, ok := h.tradingBroker(c, h.accountName(req.Account, req.IsPaper))
+	if !ok {
+		return
 	}
+	broker = trading.WithMeta(broker, requestMeta(c, req.Strategy))
 
-	order, err := trading.PlaceOrder(req.IsPaper, req.Symbol, qty, side, orderType, timeInForce, limitPrice, stopPrice)
+	order, err := trading.PlaceOrder(broker, orderReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		orderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ReplaceOrderRequest represents the request body for replacing an order.
+// Only the fields that are set are changed.
+type ReplaceOrderRequest struct {
+	Qty         *float64 `json:"qty,omitempty"`
+	LimitPrice  *float64 `json:"limit_price,omitempty"`
+	StopPrice   *float64 `json:"stop_price,omitempty"`
+	Trail       *float64 `json:"trail,omitempty"` // new trail_price or trail_percent of a trailing stop
+	TimeInForce string   `json:"time_in_force,omitempty"`
+	Account     string   `json:"account,omitempty"` // account name, instead of is_paper
+	IsPaper     bool     `json:"is_paper"`
+}
+
+// ReplaceOrder modifies a working order. The response is the new order, whose
+// replaces field holds the ID of the order it replaced.
+func (h *TradingHandler) ReplaceOrder(c *gin.Context) {
+	orderID := c.Param("id")
+
+	var req ReplaceOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var timeInForce alpaca.TimeInForce
+	if req.TimeInForce != "" {
+		var ok bool
+		timeInForce, ok = parseTimeInForce(req.TimeInForce)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid time_in_force"})
+			return
+		}
+	}
+
+	broker, ok := h.tradingBroker(c, h.accountName(req.Account, req.IsPaper))
+	if !ok {
+		return
+	}
+
+	order, err := trading.ReplaceOrder(broker, orderID, alpaca.ReplaceOrderRequest{
+		Qty:         decimalPtr(req.Qty),
+		LimitPrice:  decimalPtr(req.LimitPrice),
+		StopPrice:   decimalPtr(req.StopPrice),
+		Trail:       decimalPtr(req.Trail),
+		TimeInForce: timeInForce,
+	})
+	if err != nil {
+		orderError(c, err)
 		return
 	}
 
@@ -105,9 +296,12 @@ func PlaceOrder(c *gin.Context) {
 }
 
 // GetOrders retrieves orders with optional filters
-func GetOrders(c *gin.Context) {
-	isPaper := c.Query("is_paper") == "true"
-	
+func (h *TradingHandler) GetOrders(c *gin.Context) {
+	broker, ok := h.broker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
+
 	// Parse query parameters
 	var status, direction, symbols *string
 	var limit *int
@@ -144,7 +338,7 @@ func GetOrders(c *gin.Context) {
 		}
 	}
 
-	orders, err := trading.GetOrders(isPaper, status, limit, after, until, direction, nested, symbols)
+	orders, err := trading.GetOrders(broker, status, limit, after, until, direction, nested, symbols)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -154,12 +348,33 @@ func GetOrders(c *gin.Context) {
 }
 
 // GetOrder retrieves a single order by ID
-func GetOrder(c *gin.Context) {
+func (h *TradingHandler) GetOrder(c *gin.Context) {
 	orderID := c.Param("id")
-	isPaper := c.Query("is_paper") == "true"
+	broker, ok := h.broker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
+
 	nested := c.Query("nested") == "true"
 
-	order, err := trading.GetOrder(isPaper, orderID, nested)
+	order, err := trading.GetOrder(broker, orderID, nested)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// GetOrderByClientOrderID retrieves a single order by its client order ID
+func (h *TradingHandler) GetOrderByClientOrderID(c *gin.Context) {
+	clientOrderID := c.Param("client_order_id")
+	broker, ok := h.broker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
+
+	order, err := trading.GetOrderByClientOrderID(broker, clientOrderID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -169,11 +384,14 @@ func GetOrder(c *gin.Context) {
 }
 
 // CancelOrder cancels an order by ID
-func CancelOrder(c *gin.Context) {
+func (h *TradingHandler) CancelOrder(c *gin.Context) {
 	orderID := c.Param("id")
-	isPaper := c.Query("is_paper") == "true"
+	broker, ok := h.tradingBroker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
 
-	err := trading.CancelOrder(isPaper, orderID)
+	err := trading.CancelOrder(broker, orderID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -183,10 +401,13 @@ func CancelOrder(c *gin.Context) {
 }
 
 // CancelAllOrders cancels all open orders
-func CancelAllOrders(c *gin.Context) {
-	isPaper := c.Query("is_paper") == "true"
+func (h *TradingHandler) CancelAllOrders(c *gin.Context) {
+	broker, ok := h.tradingBroker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
 
-	err := trading.CancelAllOrders(isPaper)
+	err := trading.CancelAllOrders(broker)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -196,10 +417,13 @@ func CancelAllOrders(c *gin.Context) {
 }
 
 // GetPositions retrieves all positions
-func GetPositions(c *gin.Context) {
-	isPaper := c.Query("is_paper") == "true"
+func (h *TradingHandler) GetPositions(c *gin.Context) {
+	broker, ok := h.broker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
 
-	positions, err := trading.GetPositions(isPaper)
+	positions, err := trading.GetPositions(broker)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -209,11 +433,14 @@ func GetPositions(c *gin.Context) {
 }
 
 // GetPosition retrieves a single position by symbol
-func GetPosition(c *gin.Context) {
+func (h *TradingHandler) GetPosition(c *gin.Context) {
 	symbol := c.Param("symbol")
-	isPaper := c.Query("is_paper") == "true"
+	broker, ok := h.broker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
 
-	position, err := trading.GetPosition(isPaper, symbol)
+	position, err := trading.GetPosition(broker, symbol)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -226,13 +453,14 @@ func GetPosition(c *gin.Context) {
 type ClosePositionRequest struct {
 	Qty        *float64 `json:"qty,omitempty"`
 	Percentage *float64 `json:"percentage,omitempty"`
+	Account    string   `json:"account,omitempty"` // account name, instead of is_paper
 	IsPaper    bool     `json:"is_paper"`
 }
 
 // ClosePosition closes a position for a symbol
-func ClosePosition(c *gin.Context) {
+func (h *TradingHandler) ClosePosition(c *gin.Context) {
 	symbol := c.Param("symbol")
-	
+
 	var req ClosePositionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -249,7 +477,12 @@ func ClosePosition(c *gin.Context) {
 		percentage = &p
 	}
 
-	order, err := trading.ClosePosition(req.IsPaper, symbol, qty, percentage)
+	broker, ok := h.tradingBroker(c, h.accountName(req.Account, req.IsPaper))
+	if !ok {
+		return
+	}
+
+	order, err := trading.ClosePosition(broker, symbol, qty, percentage)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -259,11 +492,15 @@ func ClosePosition(c *gin.Context) {
 }
 
 // CloseAllPositions closes all positions
-func CloseAllPositions(c *gin.Context) {
-	isPaper := c.Query("is_paper") == "true"
+func (h *TradingHandler) CloseAllPositions(c *gin.Context) {
+	broker, ok := h.tradingBroker(c, h.queryAccount(c))
+	if !ok {
+		return
+	}
+
 	cancelOrders := c.Query("cancel_orders") == "true"
 
-	responses, err := trading.CloseAllPositions(isPaper, cancelOrders)
+	responses, err := trading.CloseAllPositions(broker, cancelOrders)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -273,7 +510,7 @@ func CloseAllPositions(c *gin.Context) {
 }
 
 // GetAssets retrieves all assets
-func GetAssets(c *gin.Context) {
+func (h *TradingHandler) GetAssets(c *gin.Context) {
 	var status, assetClass *string
 
 	if s := c.Query("status"); s != "" {
@@ -283,7 +520,12 @@ func GetAssets(c *gin.Context) {
 		assetClass = &ac
 	}
 
-	assets, err := trading.GetAssets(status, assetClass)
+	broker, ok := h.defaultBroker(c)
+	if !ok {
+		return
+	}
+
+	assets, err := trading.GetAssets(broker, status, assetClass)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -293,10 +535,15 @@ func GetAssets(c *gin.Context) {
 }
 
 // GetAsset retrieves a single asset by symbol
-func GetAsset(c *gin.Context) {
+func (h *TradingHandler) GetAsset(c *gin.Context) {
 	symbol := c.Param("symbol")
 
-	asset, err := trading.GetAsset(symbol)
+	broker, ok := h.defaultBroker(c)
+	if !ok {
+		return
+	}
+
+	asset, err := trading.GetAsset(broker, symbol)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -306,8 +553,13 @@ func GetAsset(c *gin.Context) {
 }
 
 // GetClock retrieves the market clock
-func GetClock(c *gin.Context) {
-	clock, err := trading.GetClock()
+func (h *TradingHandler) GetClock(c *gin.Context) {
+	broker, ok := h.defaultBroker(c)
+	if !ok {
+		return
+	}
+
+	clock, err := trading.GetClock(broker)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -317,7 +569,7 @@ func GetClock(c *gin.Context) {
 }
 
 // GetCalendar retrieves the market calendar
-func GetCalendar(c *gin.Context) {
+func (h *TradingHandler) GetCalendar(c *gin.Context) {
 	var start, end *time.Time
 
 	if s := c.Query("start"); s != "" {
@@ -331,34 +583,18 @@ func GetCalendar(c *gin.Context) {
 		}
 	}
 
-	calendar, err := trading.GetCalendar(start, end)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	broker, ok := h.defaultBroker(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, calendar)
-}
-
-// Legacy handlers for account endpoints (using net/http)
-func GetPaperAccountGin(c *gin.Context) {
-	client := trading.GetClient(true)
-	account, err := client.GetAccount()
+	calendar, err := trading.GetCalendar(broker, start, end)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, account)
-}
 
-func GetLiveAccountGin(c *gin.Context) {
-	client := trading.GetClient(false)
-	account, err := client.GetAccount()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, account)
+	c.JSON(http.StatusOK, calendar)
 }
 
 // GetStockQuoteGin is a Gin wrapper for the existing GetStockQuote handler
@@ -368,11 +604,71 @@ func GetStockQuoteGin(c *gin.Context) {
 	GetStockQuote(w, c.Request)
 }
 
+// requestMeta describes the API request an order came from
+func requestMeta(c *gin.Context, strategy string) trading.OrderMeta {
+	return trading.OrderMeta{
+		Strategy:  strategy,
+		Source:    "api",
+		RequestID: c.GetHeader("X-Request-ID"),
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// setAccountHeader echoes the account a request acts on, so clients can
+// confirm which account they reached
+func setAccountHeader(c *gin.Context, account string) {
+	c.Header(AccountHeader, account)
+}
+
+// orderError writes the response for a failed order submission: invalid
+// orders are the client's fault and risk rejections list every reason
+func orderError(c *gin.Context, err error) {
+	var rejection *risk.RejectionError
+	switch {
+	case errors.Is(err, trading.ErrInvalidOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.As(err, &rejection):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "reasons": rejection.Violations})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// parseTimeInForce converts a time_in_force value from a request body
+func parseTimeInForce(s string) (alpaca.TimeInForce, bool) {
+	switch strings.ToLower(s) {
+	case "day":
+		return alpaca.Day, true
+	case "gtc":
+		return alpaca.GTC, true
+	case "opg":
+		return alpaca.OPG, true
+	case "cls":
+		return alpaca.CLS, true
+	case "ioc":
+		return alpaca.IOC, true
+	case "fok":
+		return alpaca.FOK, true
+	default:
+		return "", false
+	}
+}
+
+// decimalPtr converts an optional float to an optional decimal
+func decimalPtr(f *float64) *decimal.Decimal {
+	if f == nil {
+		return nil
+	}
+	d := decimal.NewFromFloat(*f)
+	return &d
+}
+
 // ginResponseWriter wraps gin.Context to implement http.ResponseWriter
 type ginResponseWriter struct {
-	c *gin.Context
+	c          *gin.Context
 	statusCode int
-	written bool
+	written    bool
 }
 
 func (w *ginResponseWriter) Header() http.Header {
@@ -387,14 +683,14 @@ func (w *ginResponseWriter) Write(data []byte) (int, error) {
 		}
 		w.c.Status(w.statusCode)
 	}
-	
+
 	// Parse JSON and re-encode through Gin for consistency
 	var jsonData interface{}
 	if err := json.Unmarshal(data, &jsonData); err == nil {
 		w.c.JSON(w.statusCode, jsonData)
 		return len(data), nil
 	}
-	
+
 	return w.c.Writer.Write(data)
 }
 
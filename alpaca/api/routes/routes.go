@@ -2,56 +2,184 @@ package routes
 
 import (
 	"context"
-	"net/http"
+	"net/url"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/nathgoh/investment-trader/alpaca/api/handlers"
+	"github.com/nathgoh/investment-trader/alpaca/internal/audit"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+	"github.com/nathgoh/investment-trader/alpaca/internal/backtest"
+	"github.com/nathgoh/investment-trader/alpaca/internal/config"
+	"github.com/nathgoh/investment-trader/alpaca/internal/health"
+	"github.com/nathgoh/investment-trader/alpaca/internal/journal"
+	"github.com/nathgoh/investment-trader/alpaca/internal/performance"
+	"github.com/nathgoh/investment-trader/alpaca/internal/risk"
+	"github.com/nathgoh/investment-trader/alpaca/internal/scheduler"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/nathgoh/investment-trader/alpaca/internal/streaming"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
 	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
 )
 
-func Handler(ctx context.Context) *gin.Engine {
+// Services are the long-lived parts of the server the routes are served from.
+// Their background work is run by the caller.
+type Services struct {
+	Brokers *trading.Registry
+	Risk    *risk.Engine
+	Journal *journal.Journal
+	Audit   *audit.Log
+	// Keys authenticates API keys; nil disables authentication, which the
+	// configuration only allows on a loopback address
+	Keys    *auth.KeyStore
+	Hub     *streaming.Hub
+	Tracker *trading.OrderTracker
+	Health  *health.Monitor
+	// Backtests runs backtests submitted through the API
+	Backtests *backtest.Runner
+	// Strategies runs the live strategy instances started through the API
+	Strategies *strategy.Runner
+	// Scheduler runs the configured jobs
+	Scheduler *scheduler.Scheduler
+}
+
+// Handler builds the router. Open streams end when ctx is cancelled.
+func Handler(ctx context.Context, cfg config.Config, svc Services) *gin.Engine {
 
 	// Router setup with CORS middleware
 	router := gin.Default()
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{
-		"http://localhost:8501",
-	}
-	router.Use(cors.New(config))
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = cfg.Server.CORSOrigins
+	corsConfig.AddAllowHeaders("Idempotency-Key", handlers.LiveTokenHeader, handlers.APIKeyHeader)
+	corsConfig.AddExposeHeaders(handlers.AccountHeader)
+	router.Use(cors.New(corsConfig))
+
+	// Changes to the live account stay disabled unless enabled at startup
+	liveGate := trading.NewLiveGate(cfg.Live.TradingEnabled, cfg.Live.Token)
+
+	// Every endpoint but the health check requires an API key with the right
+	// scope. Mutating endpoints are audited once the key is checked, so
+	// requests without a valid key never reach the audit log.
+	authenticator := handlers.NewAuthenticator(svc.Keys)
+	marketData := authenticator.Require(auth.ScopeMarketData)
+	trader := authenticator.RequireTrading()
+	admin := authenticator.Require(auth.ScopeAdmin)
 
-	// Health check
-	router.GET(utils.API_URL_PATH+"/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	healthHandler := handlers.NewHealthHandler(svc.Health)
+	accountHandler := handlers.NewAccountHandler(svc.Brokers)
+	tradingHandler := handlers.NewTradingHandler(svc.Brokers, liveGate)
+	journalHandler := handlers.NewJournalHandler(svc.Journal)
+	auditHandler := handlers.NewAuditHandler(svc.Audit)
+	configHandler := handlers.NewConfigHandler(cfg)
+	riskHandler := handlers.NewRiskHandler(svc.Risk, svc.Brokers, liveGate)
+	backtestHandler := handlers.NewBacktestHandler(svc.Backtests)
+	strategyHandler := handlers.NewStrategyHandler(svc.Strategies, svc.Brokers, liveGate)
+	schedulerHandler := handlers.NewSchedulerHandler(svc.Scheduler)
+	simHandler := handlers.NewSimHandler(svc.Brokers)
+	performanceHandler := handlers.NewPerformanceHandler(performance.NewAnalyzer(svc.Journal), svc.Brokers)
+	streamHandler := handlers.NewStreamHandler(svc.Hub, svc.Tracker, originPatterns(cfg.Server.CORSOrigins), ctx.Done())
+
+	// Health check, with component details for callers presenting a key
+	router.GET(utils.API_URL_PATH+"/health", authenticator.Identify(), healthHandler.GetHealth)
+
+	// Auth endpoints
+	router.GET(utils.API_URL_PATH+"/auth/principal", authenticator.Require(), authenticator.GetPrincipal)
 
 	// Account endpoints
-	router.GET(utils.API_URL_PATH+"/account/paper", handlers.GetPaperAccountGin)
-	router.GET(utils.API_URL_PATH+"/account/live", handlers.GetLiveAccountGin)
+	router.GET(utils.API_URL_PATH+"/accounts", trader, accountHandler.GetAccounts)
+	router.GET(utils.API_URL_PATH+"/accounts/:name", trader, accountHandler.GetAccount)
+	router.GET(utils.API_URL_PATH+"/account/paper", trader, accountHandler.GetPaperAccount)
+	router.GET(utils.API_URL_PATH+"/account/live", trader, accountHandler.GetLiveAccount)
 
 	// Market data endpoints
-	router.GET(utils.API_URL_PATH+"/marketdata/quotes/:symbol", handlers.GetStockQuoteGin)
+	router.GET(utils.API_URL_PATH+"/marketdata/quotes/:symbol", marketData, handlers.GetStockQuoteGin)
+	router.GET(utils.API_URL_PATH+"/marketdata/bars/:symbol", marketData, handlers.GetStockBars)
+	router.GET(utils.API_URL_PATH+"/marketdata/snapshots", marketData, handlers.GetStockSnapshots)
+	router.GET(utils.API_URL_PATH+"/marketdata/indicators/:symbol", marketData, handlers.GetIndicator)
+
+	// Backtest endpoints. Running one takes a queue slot and fetches market
+	// data, so it needs a trading key; results can be read with market data
+	// access.
+	router.POST(utils.API_URL_PATH+"/backtests", trader, auditHandler.Record, backtestHandler.SubmitBacktest)
+	router.GET(utils.API_URL_PATH+"/backtests", marketData, backtestHandler.GetBacktests)
+	router.GET(utils.API_URL_PATH+"/backtests/:id", marketData, backtestHandler.GetBacktest)
+
+	// Strategy endpoints
+	router.GET(utils.API_URL_PATH+"/strategies", trader, strategyHandler.GetStrategies)
+	router.POST(utils.API_URL_PATH+"/strategies", trader, auditHandler.Record, strategyHandler.StartStrategy)
+	router.GET(utils.API_URL_PATH+"/strategies/:name", trader, strategyHandler.GetStrategy)
+	router.POST(utils.API_URL_PATH+"/strategies/:name/pause", trader, auditHandler.Record, strategyHandler.PauseStrategy)
+	router.POST(utils.API_URL_PATH+"/strategies/:name/resume", trader, auditHandler.Record, strategyHandler.ResumeStrategy)
+	router.POST(utils.API_URL_PATH+"/strategies/:name/stop", trader, auditHandler.Record, strategyHandler.StopStrategy)
+
+	// Streaming endpoints
+	router.GET(utils.API_URL_PATH+"/stream/marketdata", marketData, streamHandler.MarketDataWebSocket)
+	router.GET(utils.API_URL_PATH+"/stream/marketdata/sse", marketData, streamHandler.MarketDataSSE)
+	router.POST(utils.API_URL_PATH+"/stream/marketdata/subscribers/:id", marketData, streamHandler.UpdateSubscriptions)
+	router.GET(utils.API_URL_PATH+"/stream/orders", trader, streamHandler.OrderEvents)
 
 	// Trading - Order endpoints
-	router.POST(utils.API_URL_PATH+"/orders", handlers.PlaceOrder)
-	router.GET(utils.API_URL_PATH+"/orders", handlers.GetOrders)
-	router.GET(utils.API_URL_PATH+"/orders/:id", handlers.GetOrder)
-	router.DELETE(utils.API_URL_PATH+"/orders/:id", handlers.CancelOrder)
-	router.DELETE(utils.API_URL_PATH+"/orders", handlers.CancelAllOrders)
+	router.POST(utils.API_URL_PATH+"/orders", trader, auditHandler.Record, tradingHandler.PlaceOrder)
+	router.GET(utils.API_URL_PATH+"/orders", trader, tradingHandler.GetOrders)
+	router.GET(utils.API_URL_PATH+"/orders/:id", trader, tradingHandler.GetOrder)
+	router.GET(utils.API_URL_PATH+"/orders/client/:client_order_id", trader, tradingHandler.GetOrderByClientOrderID)
+	router.PATCH(utils.API_URL_PATH+"/orders/:id", trader, auditHandler.Record, tradingHandler.ReplaceOrder)
+	router.DELETE(utils.API_URL_PATH+"/orders/:id", trader, auditHandler.Record, tradingHandler.CancelOrder)
+	router.DELETE(utils.API_URL_PATH+"/orders", trader, auditHandler.Record, tradingHandler.CancelAllOrders)
 
 	// Trading - Position endpoints
-	router.GET(utils.API_URL_PATH+"/positions", handlers.GetPositions)
-	router.GET(utils.API_URL_PATH+"/positions/:symbol", handlers.GetPosition)
-	router.DELETE(utils.API_URL_PATH+"/positions/:symbol", handlers.ClosePosition)
-	router.DELETE(utils.API_URL_PATH+"/positions", handlers.CloseAllPositions)
+	router.GET(utils.API_URL_PATH+"/positions", trader, tradingHandler.GetPositions)
+	router.GET(utils.API_URL_PATH+"/positions/:symbol", trader, tradingHandler.GetPosition)
+	router.DELETE(utils.API_URL_PATH+"/positions/:symbol", trader, auditHandler.Record, tradingHandler.ClosePosition)
+	router.DELETE(utils.API_URL_PATH+"/positions", trader, auditHandler.Record, tradingHandler.CloseAllPositions)
+
+	// Portfolio endpoints
+	router.GET(utils.API_URL_PATH+"/portfolio/performance", trader, performanceHandler.GetPerformance)
+
+	// Risk endpoints
+	router.GET(utils.API_URL_PATH+"/risk/limits", trader, riskHandler.GetLimits)
+	router.GET(utils.API_URL_PATH+"/risk/rejections", trader, riskHandler.GetRejections)
+	router.GET(utils.API_URL_PATH+"/risk/status", trader, riskHandler.GetStatuses)
+	router.GET(utils.API_URL_PATH+"/risk/status/:account", trader, riskHandler.GetStatus)
+	router.POST(utils.API_URL_PATH+"/risk/halt/:account", trader, auditHandler.Record, riskHandler.Halt)
+	router.POST(utils.API_URL_PATH+"/risk/resume/:account", admin, auditHandler.Record, riskHandler.Resume)
+
+	// Journal endpoints
+	router.GET(utils.API_URL_PATH+"/journal", admin, journalHandler.GetRecords)
+	router.GET(utils.API_URL_PATH+"/journal/orders/:id", admin, journalHandler.GetOrderHistory)
+
+	// Simulated broker endpoints
+	router.PUT(utils.API_URL_PATH+"/sim/:account/prices", admin, auditHandler.Record, simHandler.SetPrices)
+
+	// Scheduler endpoints
+	router.GET(utils.API_URL_PATH+"/scheduler/jobs", admin, schedulerHandler.GetJobs)
+
+	// Config endpoints
+	router.GET(utils.API_URL_PATH+"/config", admin, configHandler.GetConfig)
+
+	// Audit endpoints
+	router.GET(utils.API_URL_PATH+"/audit", admin, auditHandler.GetEntries)
+	router.GET(utils.API_URL_PATH+"/audit/verify", admin, auditHandler.Verify)
 
 	// Asset endpoints
-	router.GET(utils.API_URL_PATH+"/assets", handlers.GetAssets)
-	router.GET(utils.API_URL_PATH+"/assets/:symbol", handlers.GetAsset)
+	router.GET(utils.API_URL_PATH+"/assets", marketData, tradingHandler.GetAssets)
+	router.GET(utils.API_URL_PATH+"/assets/:symbol", marketData, tradingHandler.GetAsset)
 
 	// Market info endpoints
-	router.GET(utils.API_URL_PATH+"/clock", handlers.GetClock)
-	router.GET(utils.API_URL_PATH+"/calendar", handlers.GetCalendar)
+	router.GET(utils.API_URL_PATH+"/clock", marketData, tradingHandler.GetClock)
+	router.GET(utils.API_URL_PATH+"/calendar", marketData, tradingHandler.GetCalendar)
 
 	return router
 }
+
+// originPatterns turns CORS origins into the host patterns WebSocket
+// connections are accepted from
+func originPatterns(origins []string) []string {
+	patterns := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			patterns = append(patterns, u.Host)
+		}
+	}
+	return patterns
+}
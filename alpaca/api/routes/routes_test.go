@@ -0,0 +1,1036 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	alpacamd "github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/gin-gonic/gin"
+	"github.com/nathgoh/investment-trader/alpaca/internal/audit"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+	"github.com/nathgoh/investment-trader/alpaca/internal/backtest"
+	"github.com/nathgoh/investment-trader/alpaca/internal/config"
+	"github.com/nathgoh/investment-trader/alpaca/internal/health"
+	"github.com/nathgoh/investment-trader/alpaca/internal/journal"
+	"github.com/nathgoh/investment-trader/alpaca/internal/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/risk"
+	"github.com/nathgoh/investment-trader/alpaca/internal/scheduler"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/nathgoh/investment-trader/alpaca/internal/streaming"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+// The API keys of the test server, one per kind of caller
+const (
+	marketKey = "market-key"
+	paperKey  = "paper-key"
+	liveKey   = "live-key"
+	adminKey  = "admin-key"
+)
+
+var testKeys = []auth.KeyConfig{
+	{Name: "market", Key: marketKey, Scopes: []string{auth.ScopeMarketData}},
+	{Name: "paper", Key: paperKey, Scopes: []string{auth.ScopeMarketData, auth.ScopePaper}},
+	{Name: "live", Key: liveKey, Scopes: []string{auth.ScopeMarketData, auth.ScopeLive}},
+	{Name: "admin", Key: adminKey, Scopes: []string{auth.ScopeAdmin}},
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// testServer is the API served from a paper and a live account, both backed
+// by the simulated broker with AAPL at 100 and SPY at 500
+type testServer struct {
+	router http.Handler
+	svc    Services
+	paper  *trading.SimBroker
+	live   *trading.SimBroker
+}
+
+// newTestServer builds the router the way the server does, with the journal
+// and audit log in a temporary directory. configure, when set, changes the
+// configuration first.
+func newTestServer(t *testing.T, configure func(*config.Config)) *testServer {
+	t.Helper()
+
+	cfg := config.Default()
+	dir := t.TempDir()
+	cfg.Journal.Path = filepath.Join(dir, "journal.db")
+	cfg.Audit.Dir = filepath.Join(dir, "audit")
+	cfg.Backtest.DataDir = filepath.Join(dir, "data")
+	cfg.Backtest.CacheDir = filepath.Join(dir, "cache")
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	prices := map[string]decimal.Decimal{"AAPL": decimal.NewFromInt(100), "SPY": decimal.NewFromInt(500)}
+	s := &testServer{
+		paper: trading.NewSimBroker(trading.NewStaticPriceFeed(prices), decimal.NewFromInt(100000)),
+		live:  trading.NewSimBroker(trading.NewStaticPriceFeed(prices), decimal.NewFromInt(100000)),
+	}
+	brokers := trading.NewRegistry()
+	brokers.Register(trading.AccountInfo{Name: "paper", Paper: true}, s.paper)
+	brokers.Register(trading.AccountInfo{Name: "live"}, s.live)
+
+	riskEngine := risk.NewEngine(cfg.Risk, risk.QuotePrices{})
+	riskEngine.Install(brokers)
+
+	orderJournal, err := journal.Open(cfg.Journal.Path)
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	t.Cleanup(func() { orderJournal.Close() })
+	brokers.Wrap(orderJournal.Wrap)
+
+	auditLog, err := audit.Open(cfg.Audit.Dir, cfg.Audit.MaxBytes)
+	if err != nil {
+		t.Fatalf("audit.Open() error = %v", err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	keys, err := auth.NewKeyStore(testKeys)
+	if err != nil {
+		t.Fatalf("auth.NewKeyStore() error = %v", err)
+	}
+
+	calendar := func(start, end time.Time) ([]alpaca.CalendarDay, error) {
+		return trading.GetCalendar(s.paper, &start, &end)
+	}
+	hub := streaming.NewHub("", "", cfg.Alpaca.DataFeed)
+	tracker := trading.NewOrderTracker(brokers)
+	backtests := backtest.NewRunner(backtest.RunnerOptions{
+		DataDir:       cfg.Backtest.DataDir,
+		CacheDir:      cfg.Backtest.CacheDir,
+		MaxConcurrent: cfg.Backtest.MaxConcurrent,
+		MaxQueued:     cfg.Backtest.MaxQueued,
+		Calendar:      calendar,
+	})
+	t.Cleanup(backtests.Stop)
+	strategies := strategy.NewRunner(brokers, hub, tracker.Events())
+	t.Cleanup(strategies.Close)
+
+	s.svc = Services{
+		Brokers:    brokers,
+		Risk:       riskEngine,
+		Journal:    orderJournal,
+		Audit:      auditLog,
+		Keys:       keys,
+		Hub:        hub,
+		Tracker:    tracker,
+		Health:     health.NewMonitor(),
+		Backtests:  backtests,
+		Strategies: strategies,
+		Scheduler:  scheduler.New(calendar),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s.router = Handler(ctx, cfg, s.svc)
+	return s
+}
+
+// do serves a request with the API key and headers given, encoding body as
+// JSON when it is not nil
+func (s *testServer) do(t *testing.T, method, path, key string, body any, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, utils.API_URL_PATH+path, reader)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode unmarshals a response body into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+}
+
+// routeTest is a single request and the response it should get
+type routeTest struct {
+	name       string
+	method     string
+	path       string
+	key        string
+	body       any
+	header     http.Header
+	wantStatus int
+	wantBody   string
+}
+
+// run serves each request in turn, checking the status and that the body
+// contains wantBody
+func (s *testServer) run(t *testing.T, tests []routeTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, tt.method, tt.path, tt.key, tt.body, tt.header)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("%s %s status = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s body = %s, want it to contain %q", tt.method, tt.path, rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAccountRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	s.run(t, []routeTest{
+		{name: "paper account", method: http.MethodGet, path: "/account/paper", key: paperKey, wantStatus: http.StatusOK, wantBody: `"status":"ACTIVE"`},
+		{name: "live account", method: http.MethodGet, path: "/account/live", key: liveKey, wantStatus: http.StatusOK, wantBody: `"status":"ACTIVE"`},
+		{name: "clock", method: http.MethodGet, path: "/clock", key: marketKey, wantStatus: http.StatusOK, wantBody: `"is_open"`},
+		{name: "calendar", method: http.MethodGet, path: "/calendar?start=2024-11-25&end=2024-11-26", key: marketKey, wantStatus: http.StatusOK, wantBody: `"2024-11-25"`},
+		{name: "asset", method: http.MethodGet, path: "/assets/AAPL", key: marketKey, wantStatus: http.StatusOK, wantBody: `"symbol":"AAPL"`},
+	})
+}
+
+func TestOrderRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	buy := map[string]any{"symbol": "AAPL", "qty": 10, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true}
+	rec := s.do(t, http.MethodPost, "/orders", paperKey, buy, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /orders status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var order alpaca.Order
+	decode(t, rec, &order)
+	if order.Status != trading.OrderStatusFilled {
+		t.Errorf("POST /orders status = %q, want %q", order.Status, trading.OrderStatusFilled)
+	}
+
+	s.run(t, []routeTest{
+		{name: "get order", method: http.MethodGet, path: "/orders/" + order.ID + "?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantBody: order.ID},
+		{name: "list orders", method: http.MethodGet, path: "/orders?is_paper=true&status=closed", key: paperKey, wantStatus: http.StatusOK, wantBody: order.ID},
+		{name: "position", method: http.MethodGet, path: "/positions/AAPL?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantBody: `"qty":"10"`},
+		{
+			name:       "invalid side",
+			method:     http.MethodPost,
+			path:       "/orders",
+			key:        paperKey,
+			body:       map[string]any{"symbol": "AAPL", "qty": 1, "side": "hold", "type": "market", "time_in_force": "day", "is_paper": true},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "invalid side",
+		},
+		{
+			name:       "invalid time in force",
+			method:     http.MethodPost,
+			path:       "/orders",
+			key:        paperKey,
+			body:       map[string]any{"symbol": "AAPL", "qty": 1, "side": "buy", "type": "market", "time_in_force": "week", "is_paper": true},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "invalid time_in_force",
+		},
+		{name: "close position", method: http.MethodDelete, path: "/positions/AAPL", key: paperKey, body: map[string]any{"is_paper": true}, wantStatus: http.StatusOK, wantBody: `"side":"sell"`},
+		{name: "no positions left", method: http.MethodGet, path: "/positions?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantBody: "[]"},
+	})
+}
+
+func TestSimRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	limit := map[string]any{"symbol": "AAPL", "qty": 5, "side": "buy", "type": "limit", "limit_price": 95, "time_in_force": "gtc", "is_paper": true}
+	rec := s.do(t, http.MethodPost, "/orders", paperKey, limit, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /orders status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var order alpaca.Order
+	decode(t, rec, &order)
+
+	s.run(t, []routeTest{
+		{name: "paper key", method: http.MethodPut, path: "/sim/paper/prices", key: paperKey, body: map[string]any{"prices": map[string]any{"AAPL": 90}}, wantStatus: http.StatusForbidden, wantBody: `"code":"forbidden"`},
+		{name: "missing prices", method: http.MethodPut, path: "/sim/paper/prices", key: adminKey, body: map[string]any{}, wantStatus: http.StatusBadRequest},
+		{name: "negative price", method: http.MethodPut, path: "/sim/paper/prices", key: adminKey, body: map[string]any{"prices": map[string]any{"AAPL": -1}}, wantStatus: http.StatusBadRequest, wantBody: "must be positive"},
+		{name: "unknown account", method: http.MethodPut, path: "/sim/ira/prices", key: adminKey, body: map[string]any{"prices": map[string]any{"AAPL": 90}}, wantStatus: http.StatusBadRequest, wantBody: "ira"},
+		{name: "move price", method: http.MethodPut, path: "/sim/paper/prices", key: adminKey, body: map[string]any{"prices": map[string]any{"AAPL": 90}}, wantStatus: http.StatusOK, wantBody: `"account":"paper"`},
+		{name: "limit order filled", method: http.MethodGet, path: "/orders/" + order.ID + "?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantBody: `"status":"filled"`},
+	})
+
+	// The live account has its own feed
+	if price, _ := s.live.LastPrice("AAPL"); !price.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("live AAPL price = %s, want 100", price)
+	}
+}
+
+// newDataServer points the market data client at a fake data API serving
+// handler
+func newDataServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	marketdata.Configure("key", "secret", server.URL, alpacamd.IEX)
+}
+
+// writeJSON writes v as the response of a fake API
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestBarsRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	var limit string
+	newDataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		limit = r.URL.Query().Get("limit")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"bars": map[string]any{
+				"AAPL": []map[string]any{{"t": "2024-11-25T05:00:00Z", "o": 231.5, "h": 233.2, "l": 229.7, "c": 232.9, "v": 90152832}},
+			},
+		})
+	})
+
+	s.run(t, []routeTest{
+		{name: "no key", method: http.MethodGet, path: "/marketdata/bars/AAPL", wantStatus: http.StatusUnauthorized, wantBody: `"code":"unauthorized"`},
+		{name: "invalid timeframe", method: http.MethodGet, path: "/marketdata/bars/AAPL?timeframe=2Hour", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid timeframe"},
+		{name: "invalid adjustment", method: http.MethodGet, path: "/marketdata/bars/AAPL?adjustment=none", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid adjustment"},
+		{name: "invalid feed", method: http.MethodGet, path: "/marketdata/bars/AAPL?feed=nasdaq", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid feed"},
+		{name: "invalid start", method: http.MethodGet, path: "/marketdata/bars/AAPL?start=2024-11-25", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid start"},
+		{name: "invalid end", method: http.MethodGet, path: "/marketdata/bars/AAPL?end=yesterday", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid end"},
+		{name: "invalid limit", method: http.MethodGet, path: "/marketdata/bars/AAPL?limit=ten", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid limit"},
+		{name: "bars", method: http.MethodGet, path: "/marketdata/bars/AAPL?start=2024-11-25T00:00:00Z&end=2024-11-26T00:00:00Z&limit=1", key: marketKey, wantStatus: http.StatusOK, wantBody: `"c":232.9`},
+	})
+
+	if limit != "1" {
+		t.Errorf("bars requested with limit %q, want 1", limit)
+	}
+}
+
+func TestSnapshotsRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	var symbols string
+	newDataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		symbols = r.URL.Query().Get("symbols")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"AAPL": map[string]any{"latestTrade": map[string]any{"t": "2024-11-25T20:59:59Z", "p": 232.87, "s": 100}},
+		})
+	})
+
+	s.run(t, []routeTest{
+		{name: "no symbols", method: http.MethodGet, path: "/marketdata/snapshots?symbols=,", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "symbols parameter is required"},
+		{name: "invalid feed", method: http.MethodGet, path: "/marketdata/snapshots?symbols=AAPL&feed=nasdaq", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid feed"},
+		{name: "snapshots", method: http.MethodGet, path: "/marketdata/snapshots?symbols=aapl,%20zzzz", key: marketKey, wantStatus: http.StatusOK, wantBody: `"invalid":["ZZZZ"]`},
+	})
+
+	if symbols != "AAPL,ZZZZ" {
+		t.Errorf("snapshots requested for %q, want AAPL,ZZZZ", symbols)
+	}
+}
+
+func TestStreamSubscriberRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	sub := s.svc.Hub.NewSubscriber("paper")
+	t.Cleanup(func() { s.svc.Hub.Remove(sub) })
+	path := "/stream/marketdata/subscribers/" + sub.ID
+
+	s.run(t, []routeTest{
+		{name: "other key", method: http.MethodPost, path: path, key: marketKey, body: map[string]any{"action": "subscribe", "trades": []string{"AAPL"}}, wantStatus: http.StatusNotFound, wantBody: "not found"},
+		{name: "unknown subscriber", method: http.MethodPost, path: "/stream/marketdata/subscribers/missing", key: paperKey, body: map[string]any{"action": "subscribe"}, wantStatus: http.StatusNotFound},
+		{name: "invalid action", method: http.MethodPost, path: path, key: paperKey, body: map[string]any{"action": "replace", "trades": []string{"AAPL"}}, wantStatus: http.StatusBadRequest, wantBody: "invalid action"},
+		{name: "subscribe", method: http.MethodPost, path: path, key: paperKey, body: map[string]any{"action": "subscribe", "trades": []string{" aapl"}, "bars": []string{"SPY"}}, wantStatus: http.StatusOK, wantBody: `"trades":["AAPL"]`},
+		{name: "unsubscribe", method: http.MethodPost, path: path, key: paperKey, body: map[string]any{"action": "unsubscribe", "trades": []string{"AAPL"}}, wantStatus: http.StatusOK, wantBody: `"bars":["SPY"]`},
+	})
+
+	if got := sub.Subscriptions(); len(got.Trades) != 0 || len(got.Bars) != 1 {
+		t.Errorf("Subscriptions() = %+v, want only the SPY bars", got)
+	}
+}
+
+func TestOrderStreamRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+	server := httptest.NewServer(s.router)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+utils.API_URL_PATH+"/stream/orders?events=fill", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", paperKey)
+
+	// The stream subscribes once the request arrives, so events are
+	// published until one comes through. The live fill and the paper new
+	// order must never be sent to a paper key streaming fills.
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			for _, event := range []trading.OrderEvent{
+				{Account: "live", Event: trading.EventFill},
+				{Account: "paper", Event: trading.EventNew},
+				{Account: "paper", Event: trading.EventFill},
+			} {
+				s.svc.Tracker.Events().Publish(event)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /stream/orders error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stream/orders status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var name string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if after, ok := strings.CutPrefix(line, "event:"); ok {
+			name = after
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+
+		var event trading.OrderEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("decode event %s: %v", data, err)
+		}
+		if name != trading.EventFill || event.Account != "paper" || event.Event != trading.EventFill {
+			t.Errorf("first event = %s %+v, want a paper fill", name, event)
+		}
+		return
+	}
+	t.Fatalf("stream ended without an event: %v", scanner.Err())
+}
+
+func TestReplaceOrderRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	place := func(body map[string]any) alpaca.Order {
+		t.Helper()
+		rec := s.do(t, http.MethodPost, "/orders", paperKey, body, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /orders status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var order alpaca.Order
+		decode(t, rec, &order)
+		return order
+	}
+	working := place(map[string]any{"symbol": "AAPL", "qty": 5, "side": "buy", "type": "limit", "limit_price": 90, "time_in_force": "day", "is_paper": true})
+	filled := place(map[string]any{"symbol": "AAPL", "qty": 5, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true})
+
+	s.run(t, []routeTest{
+		{name: "invalid time in force", method: http.MethodPatch, path: "/orders/" + working.ID, key: paperKey, body: map[string]any{"time_in_force": "week", "is_paper": true}, wantStatus: http.StatusBadRequest, wantBody: "invalid time_in_force"},
+		{name: "nothing to change", method: http.MethodPatch, path: "/orders/" + working.ID, key: paperKey, body: map[string]any{"is_paper": true}, wantStatus: http.StatusBadRequest},
+		{name: "filled order", method: http.MethodPatch, path: "/orders/" + filled.ID, key: paperKey, body: map[string]any{"limit_price": 95, "is_paper": true}, wantStatus: http.StatusBadRequest},
+		{name: "live account", method: http.MethodPatch, path: "/orders/" + working.ID, key: liveKey, body: map[string]any{"limit_price": 95}, wantStatus: http.StatusForbidden},
+		{name: "replace", method: http.MethodPatch, path: "/orders/" + working.ID, key: paperKey, body: map[string]any{"qty": 3, "limit_price": 95, "is_paper": true}, wantStatus: http.StatusOK, wantBody: `"replaces":"` + working.ID + `"`},
+		{name: "original replaced", method: http.MethodGet, path: "/orders/" + working.ID + "?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantBody: `"status":"replaced"`},
+	})
+}
+
+func TestIdempotentOrderRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	buy := map[string]any{"symbol": "AAPL", "qty": 2, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true}
+	key := http.Header{"Idempotency-Key": {"retry-1"}}
+
+	var first alpaca.Order
+	decode(t, s.do(t, http.MethodPost, "/orders", paperKey, buy, key), &first)
+	var retried alpaca.Order
+	decode(t, s.do(t, http.MethodPost, "/orders", paperKey, buy, key), &retried)
+	if first.ID == "" || retried.ID != first.ID {
+		t.Errorf("retried order ID = %q, want the first order %q", retried.ID, first.ID)
+	}
+	if first.ClientOrderID != "retry-1" {
+		t.Errorf("client order ID = %q, want the Idempotency-Key", first.ClientOrderID)
+	}
+
+	mismatch := map[string]any{"symbol": "AAPL", "qty": 2, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true, "client_order_id": "other"}
+	s.run(t, []routeTest{
+		{name: "key and client order ID differ", method: http.MethodPost, path: "/orders", key: paperKey, body: mismatch, header: key, wantStatus: http.StatusBadRequest, wantBody: "do not match"},
+		{name: "by client order ID", method: http.MethodGet, path: "/orders/client/retry-1?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantBody: first.ID},
+		{name: "position bought once", method: http.MethodGet, path: "/positions/AAPL?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantBody: `"qty":"2"`},
+		{name: "retry journaled as a duplicate", method: http.MethodGet, path: "/journal?account=paper&kind=response&limit=1", key: adminKey, wantStatus: http.StatusOK, wantBody: `"duplicate":true`},
+	})
+}
+
+func TestRiskRoutes(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Risk.DeniedSymbols = []string{"TSLA"}
+		cfg.Risk.MaxOrderNotional = decimal.NewFromInt(5000)
+	})
+
+	order := func(symbol string, qty int) map[string]any {
+		return map[string]any{"symbol": symbol, "qty": qty, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true}
+	}
+
+	s.run(t, []routeTest{
+		{name: "limits", method: http.MethodGet, path: "/risk/limits", key: paperKey, wantStatus: http.StatusOK, wantBody: `"denied_symbols":["TSLA"]`},
+		{name: "denied symbol", method: http.MethodPost, path: "/orders", key: paperKey, body: order("TSLA", 1), wantStatus: http.StatusUnprocessableEntity, wantBody: `"rule":"symbol_list"`},
+		{name: "order too large", method: http.MethodPost, path: "/orders", key: paperKey, body: order("AAPL", 100), wantStatus: http.StatusUnprocessableEntity, wantBody: `"rule":"max_order_notional"`},
+		{name: "order within limits", method: http.MethodPost, path: "/orders", key: paperKey, body: order("AAPL", 10), wantStatus: http.StatusOK, wantBody: `"status":"filled"`},
+		{name: "rejections", method: http.MethodGet, path: "/risk/rejections?account=paper", key: paperKey, wantStatus: http.StatusOK, wantBody: `"symbol":"TSLA"`},
+		{name: "rejections of other accounts", method: http.MethodGet, path: "/risk/rejections", key: liveKey, wantStatus: http.StatusOK, wantBody: "[]"},
+	})
+
+	if got := len(s.svc.Risk.Rejections()); got != 2 {
+		t.Errorf("Rejections() has %d entries, want 2", got)
+	}
+}
+
+func TestHaltRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	buy := map[string]any{"symbol": "AAPL", "qty": 1, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true}
+
+	s.run(t, []routeTest{
+		{name: "status", method: http.MethodGet, path: "/risk/status/paper", key: paperKey, wantStatus: http.StatusOK, wantBody: `"halted":false`},
+		{name: "status of another account", method: http.MethodGet, path: "/risk/status/live", key: paperKey, wantStatus: http.StatusForbidden},
+		{name: "halt unknown account", method: http.MethodPost, path: "/risk/halt/ira", key: adminKey, wantStatus: http.StatusNotFound},
+		{name: "halt", method: http.MethodPost, path: "/risk/halt/paper", key: paperKey, body: map[string]any{"reason": "maintenance"}, wantStatus: http.StatusOK, wantBody: `"reason":"maintenance"`},
+		{name: "order while halted", method: http.MethodPost, path: "/orders", key: paperKey, body: buy, wantStatus: http.StatusUnprocessableEntity, wantBody: `"rule":"halted"`},
+		{name: "statuses", method: http.MethodGet, path: "/risk/status", key: paperKey, wantStatus: http.StatusOK, wantBody: `"halted":true`},
+		{name: "resume without admin", method: http.MethodPost, path: "/risk/resume/paper", key: paperKey, wantStatus: http.StatusForbidden},
+		{name: "resume", method: http.MethodPost, path: "/risk/resume/paper", key: adminKey, wantStatus: http.StatusOK, wantBody: `"halted":false`},
+		{name: "order after resume", method: http.MethodPost, path: "/orders", key: paperKey, body: buy, wantStatus: http.StatusOK},
+	})
+}
+
+func TestLiveGate(t *testing.T) {
+	buy := map[string]any{"symbol": "AAPL", "qty": 1, "side": "buy", "type": "market", "time_in_force": "day", "account": "live"}
+	token := func(token string) http.Header {
+		return http.Header{"X-Live-Trading-Token": {token}}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		s := newTestServer(t, nil)
+		s.run(t, []routeTest{
+			{name: "live order", method: http.MethodPost, path: "/orders", key: liveKey, body: buy, header: token("secret"), wantStatus: http.StatusForbidden, wantBody: "live trading is disabled"},
+			{name: "paper order", method: http.MethodPost, path: "/orders", key: adminKey, body: map[string]any{"symbol": "AAPL", "qty": 1, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true}, wantStatus: http.StatusOK},
+			{name: "live halt", method: http.MethodPost, path: "/risk/halt/live", key: liveKey, wantStatus: http.StatusOK, wantBody: `"halted":true`},
+			{name: "live halt cancelling orders", method: http.MethodPost, path: "/risk/halt/live", key: liveKey, body: map[string]any{"cancel_orders": true}, header: token("secret"), wantStatus: http.StatusForbidden},
+		})
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		s := newTestServer(t, func(cfg *config.Config) {
+			cfg.Live.TradingEnabled = true
+			cfg.Live.Token = "secret"
+		})
+		s.run(t, []routeTest{
+			{name: "no token", method: http.MethodPost, path: "/orders", key: liveKey, body: buy, wantStatus: http.StatusForbidden, wantBody: `"account":"live"`},
+			{name: "wrong token", method: http.MethodPost, path: "/orders", key: liveKey, body: buy, header: token("guess"), wantStatus: http.StatusForbidden, wantBody: "valid live trading token"},
+			{name: "token", method: http.MethodPost, path: "/orders", key: liveKey, body: buy, header: token("secret"), wantStatus: http.StatusOK, wantBody: `"status":"filled"`},
+			{name: "close without token", method: http.MethodDelete, path: "/positions/AAPL", key: liveKey, body: map[string]any{"account": "live"}, wantStatus: http.StatusForbidden},
+			{name: "halt closing positions without token", method: http.MethodPost, path: "/risk/halt/live", key: liveKey, body: map[string]any{"close_positions": true}, wantStatus: http.StatusForbidden},
+			{name: "halt closing positions", method: http.MethodPost, path: "/risk/halt/live", key: liveKey, body: map[string]any{"close_positions": true}, header: token("secret"), wantStatus: http.StatusOK, wantBody: `"halted":true`},
+		})
+
+		positions, err := s.live.GetPositions()
+		if err != nil || len(positions) != 0 {
+			t.Errorf("live positions after the halt = %v, %v, want none", positions, err)
+		}
+	})
+}
+
+func TestJournalRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	buy := map[string]any{"symbol": "AAPL", "qty": 1, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true, "strategy": "manual"}
+	var order alpaca.Order
+	decode(t, s.do(t, http.MethodPost, "/orders", paperKey, buy, nil), &order)
+
+	s.run(t, []routeTest{
+		{name: "trading key", method: http.MethodGet, path: "/journal", key: paperKey, wantStatus: http.StatusForbidden},
+		{name: "invalid start", method: http.MethodGet, path: "/journal?start=monday", key: adminKey, wantStatus: http.StatusBadRequest, wantBody: "invalid start"},
+		{name: "invalid limit", method: http.MethodGet, path: "/journal?limit=0", key: adminKey, wantStatus: http.StatusBadRequest, wantBody: "invalid limit"},
+		{name: "by strategy", method: http.MethodGet, path: "/journal?account=paper&strategy=manual", key: adminKey, wantStatus: http.StatusOK, wantBody: order.ID},
+		{name: "other strategy", method: http.MethodGet, path: "/journal?strategy=momentum", key: adminKey, wantStatus: http.StatusOK, wantBody: "[]"},
+		{name: "order history", method: http.MethodGet, path: "/journal/orders/" + order.ID, key: adminKey, wantStatus: http.StatusOK, wantBody: `"symbol":"AAPL"`},
+	})
+}
+
+func TestAuditRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	buy := map[string]any{"symbol": "AAPL", "qty": 1, "side": "buy", "type": "market", "time_in_force": "day", "is_paper": true}
+	s.do(t, http.MethodPost, "/orders", paperKey, buy, http.Header{"X-Request-Id": {"req-1"}})
+	s.do(t, http.MethodGet, "/positions?is_paper=true", paperKey, nil, nil)
+	s.do(t, http.MethodPost, "/risk/halt/paper", paperKey, nil, nil)
+
+	// Requests refused for their key or their size are not audited
+	s.run(t, []routeTest{
+		{name: "no key", method: http.MethodPost, path: "/orders", body: buy, wantStatus: http.StatusUnauthorized},
+		{name: "market data key", method: http.MethodPost, path: "/orders", key: marketKey, body: buy, wantStatus: http.StatusForbidden},
+		{name: "oversized body", method: http.MethodPost, path: "/orders", key: paperKey, body: map[string]any{"symbol": strings.Repeat("A", 2<<20)}, wantStatus: http.StatusRequestEntityTooLarge},
+	})
+
+	rec := s.do(t, http.MethodGet, "/audit", adminKey, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /audit status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var page struct {
+		Entries []audit.Entry `json:"entries"`
+	}
+	decode(t, rec, &page)
+
+	// Only the order and the halt by the trading key are audited, newest
+	// first
+	if len(page.Entries) != 2 {
+		t.Fatalf("GET /audit returned %d entries, want 2: %s", len(page.Entries), rec.Body.String())
+	}
+	halt, order := page.Entries[0], page.Entries[1]
+	if halt.Route != utils.API_URL_PATH+"/risk/halt/:account" || halt.Account != "paper" {
+		t.Errorf("halt entry = %+v, want the halt of the paper account", halt)
+	}
+	if order.Method != http.MethodPost || order.Status != http.StatusOK || order.RequestID != "req-1" || order.Account != "paper" {
+		t.Errorf("order entry = %+v, want the paper order with its request ID", order)
+	}
+	if !strings.Contains(string(order.Body), `"symbol":"AAPL"`) || !strings.Contains(string(order.Result), `"status":"filled"`) {
+		t.Errorf("order entry body = %s, result = %s, want the request and the filled order", order.Body, order.Result)
+	}
+
+	s.run(t, []routeTest{
+		{name: "trading key", method: http.MethodGet, path: "/audit", key: paperKey, wantStatus: http.StatusForbidden},
+		{name: "invalid before", method: http.MethodGet, path: "/audit?before=last", key: adminKey, wantStatus: http.StatusBadRequest, wantBody: "invalid before"},
+		{name: "page", method: http.MethodGet, path: "/audit?limit=1", key: adminKey, wantStatus: http.StatusOK, wantBody: `"next_before":`},
+		{name: "verify", method: http.MethodGet, path: "/audit/verify", key: adminKey, wantStatus: http.StatusOK, wantBody: `"valid":true`},
+	})
+}
+
+func TestScopes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	// Each route is tried with the keys that may not use it and the weakest
+	// key that may
+	tests := []struct {
+		method  string
+		path    string
+		denied  []string
+		allowed string
+	}{
+		{method: http.MethodGet, path: "/auth/principal", allowed: marketKey},
+		{method: http.MethodGet, path: "/clock", allowed: marketKey},
+		{method: http.MethodGet, path: "/assets/AAPL", allowed: marketKey},
+		{method: http.MethodGet, path: "/accounts", denied: []string{marketKey}, allowed: paperKey},
+		{method: http.MethodGet, path: "/account/paper", denied: []string{marketKey, liveKey}, allowed: paperKey},
+		{method: http.MethodGet, path: "/account/live", denied: []string{marketKey, paperKey}, allowed: liveKey},
+		{method: http.MethodGet, path: "/accounts/live", denied: []string{marketKey, paperKey}, allowed: liveKey},
+		{method: http.MethodGet, path: "/orders?account=paper", denied: []string{marketKey, liveKey}, allowed: paperKey},
+		{method: http.MethodGet, path: "/positions?account=live", denied: []string{marketKey, paperKey}, allowed: liveKey},
+		{method: http.MethodGet, path: "/risk/limits", denied: []string{marketKey}, allowed: paperKey},
+		{method: http.MethodGet, path: "/risk/status/paper", denied: []string{marketKey, liveKey}, allowed: paperKey},
+		{method: http.MethodGet, path: "/strategies", denied: []string{marketKey}, allowed: paperKey},
+		{method: http.MethodGet, path: "/backtests", allowed: marketKey},
+		{method: http.MethodPost, path: "/backtests", denied: []string{marketKey}, allowed: paperKey},
+		{method: http.MethodGet, path: "/portfolio/performance?account=live", denied: []string{marketKey, paperKey}, allowed: adminKey},
+		{method: http.MethodPost, path: "/risk/resume/paper", denied: []string{marketKey, paperKey, liveKey}, allowed: adminKey},
+		{method: http.MethodGet, path: "/journal", denied: []string{marketKey, paperKey, liveKey}, allowed: adminKey},
+		{method: http.MethodGet, path: "/audit", denied: []string{marketKey, paperKey, liveKey}, allowed: adminKey},
+		{method: http.MethodGet, path: "/config", denied: []string{marketKey, paperKey, liveKey}, allowed: adminKey},
+		{method: http.MethodGet, path: "/scheduler/jobs", denied: []string{marketKey, paperKey, liveKey}, allowed: adminKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if rec := s.do(t, tt.method, tt.path, "", nil, nil); rec.Code != http.StatusUnauthorized {
+				t.Errorf("without a key status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if rec := s.do(t, tt.method, tt.path, "unknown-key", nil, nil); rec.Code != http.StatusUnauthorized {
+				t.Errorf("with an unknown key status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			for _, key := range tt.denied {
+				if rec := s.do(t, tt.method, tt.path, key, nil, nil); rec.Code != http.StatusForbidden {
+					t.Errorf("with %s status = %d, want %d: %s", key, rec.Code, http.StatusForbidden, rec.Body.String())
+				}
+			}
+			if rec := s.do(t, tt.method, tt.path, tt.allowed, nil, nil); rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden {
+				t.Errorf("with %s status = %d, want it allowed: %s", tt.allowed, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPrincipalRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	s.run(t, []routeTest{
+		{name: "api key header", method: http.MethodGet, path: "/auth/principal", key: paperKey, wantStatus: http.StatusOK, wantBody: `"name":"paper"`},
+		{name: "bearer token", method: http.MethodGet, path: "/auth/principal", header: http.Header{"Authorization": {"Bearer " + liveKey}}, wantStatus: http.StatusOK, wantBody: `"scopes":["marketdata:read","trading:live"]`},
+		{name: "unknown bearer token", method: http.MethodGet, path: "/auth/principal", header: http.Header{"Authorization": {"Bearer guess"}}, wantStatus: http.StatusUnauthorized, wantBody: "invalid API key"},
+	})
+}
+
+func TestConfigRoute(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Accounts = []config.AccountConfig{{Name: "live", APIKey: "AKLIVEKEY", APISecret: "live-secret"}}
+		cfg.Live.Token = "live-token"
+	})
+
+	rec := s.do(t, http.MethodGet, "/config", adminKey, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /config status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	for _, secret := range []string{"AKLIVEKEY", "live-secret", "live-token"} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("GET /config body contains %q: %s", secret, rec.Body.String())
+		}
+	}
+
+	var got struct {
+		Accounts []config.AccountConfig `json:"accounts"`
+	}
+	decode(t, rec, &got)
+	if len(got.Accounts) != 1 || got.Accounts[0].Name != "live" || got.Accounts[0].APIKey != "[redacted]" {
+		t.Errorf("GET /config accounts = %+v, want the live account with its key redacted", got.Accounts)
+	}
+}
+
+func TestNamedAccountRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	s.run(t, []routeTest{
+		{name: "accounts of a paper key", method: http.MethodGet, path: "/accounts", key: paperKey, wantStatus: http.StatusOK, wantBody: `{"accounts":[{"name":"paper","paper":true,"status":"ACTIVE"`},
+		{name: "named account", method: http.MethodGet, path: "/accounts/live", key: adminKey, wantStatus: http.StatusOK, wantBody: `"status":"ACTIVE"`},
+		{name: "unknown account", method: http.MethodGet, path: "/accounts/ira", key: adminKey, wantStatus: http.StatusBadRequest, wantBody: "ira"},
+	})
+
+	rec := s.do(t, http.MethodGet, "/accounts", adminKey, nil, nil)
+	var got struct {
+		Accounts []struct {
+			Name string `json:"name"`
+		} `json:"accounts"`
+	}
+	decode(t, rec, &got)
+	if len(got.Accounts) != 2 {
+		t.Errorf("GET /accounts as admin = %s, want both accounts", rec.Body.String())
+	}
+}
+
+func TestAccountHeader(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	buy := func(account string, paper bool) map[string]any {
+		return map[string]any{"symbol": "AAPL", "qty": 1, "side": "buy", "type": "market", "time_in_force": "day", "account": account, "is_paper": paper}
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		key         string
+		body        any
+		wantStatus  int
+		wantAccount string
+	}{
+		{name: "is_paper query", method: http.MethodGet, path: "/orders?is_paper=true", key: paperKey, wantStatus: http.StatusOK, wantAccount: "paper"},
+		{name: "default is live", method: http.MethodGet, path: "/positions", key: liveKey, wantStatus: http.StatusOK, wantAccount: "live"},
+		{name: "account query wins", method: http.MethodGet, path: "/positions?account=paper&is_paper=false", key: paperKey, wantStatus: http.StatusOK, wantAccount: "paper"},
+		{name: "account in body", method: http.MethodPost, path: "/orders", key: paperKey, body: buy("paper", false), wantStatus: http.StatusOK, wantAccount: "paper"},
+		{name: "is_paper in body", method: http.MethodPost, path: "/orders", key: paperKey, body: buy("", true), wantStatus: http.StatusOK, wantAccount: "paper"},
+		{name: "forbidden account", method: http.MethodGet, path: "/orders?account=live", key: paperKey, wantStatus: http.StatusForbidden, wantAccount: "live"},
+		{name: "gated account", method: http.MethodPost, path: "/orders", key: liveKey, body: buy("live", false), wantStatus: http.StatusForbidden, wantAccount: "live"},
+		{name: "named account", method: http.MethodGet, path: "/accounts/paper", key: paperKey, wantStatus: http.StatusOK, wantAccount: "paper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, tt.method, tt.path, tt.key, tt.body, nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("%s %s status = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("X-Trading-Account"); got != tt.wantAccount {
+				t.Errorf("%s %s X-Trading-Account = %q, want %q", tt.method, tt.path, got, tt.wantAccount)
+			}
+		})
+	}
+}
+
+func TestHealthRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.svc.Health.OK("journal")
+
+	s.run(t, []routeTest{
+		{name: "ok", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK, wantBody: `"status":"ok"`},
+	})
+
+	// A degraded server is still serving
+	s.svc.Health.Degraded("account:live", errors.New("account blocked"))
+	s.run(t, []routeTest{
+		{name: "degraded", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK, wantBody: `"status":"degraded"`},
+		{name: "details with a key", method: http.MethodGet, path: "/health", key: marketKey, wantStatus: http.StatusOK, wantBody: `"detail":"account blocked"`},
+	})
+
+	// Callers without a valid key see only each component's status
+	for _, key := range []string{"", "unknown-key"} {
+		rec := s.do(t, http.MethodGet, "/health", key, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /health with key %q status = %d, want %d", key, rec.Code, http.StatusOK)
+		}
+		var report health.Report
+		decode(t, rec, &report)
+		if got := report.Components["account:live"]; got.Status != health.StatusDegraded || got.Detail != "" {
+			t.Errorf("GET /health with key %q account:live = %+v, want degraded without detail", key, got)
+		}
+	}
+}
+
+func TestBacktestRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	request := func(symbol, source string) map[string]any {
+		return map[string]any{
+			"strategy": "buy_and_hold",
+			"symbols":  []string{symbol},
+			"start":    "2024-01-01T00:00:00Z",
+			"end":      "2024-02-01T00:00:00Z",
+			"source":   source,
+		}
+	}
+
+	s.run(t, []routeTest{
+		{name: "market data key", method: http.MethodPost, path: "/backtests", key: marketKey, body: request("AAPL", "file"), wantStatus: http.StatusForbidden, wantBody: "lacks a trading scope"},
+		{name: "missing strategy", method: http.MethodPost, path: "/backtests", key: paperKey, body: map[string]any{"symbols": []string{"AAPL"}}, wantStatus: http.StatusBadRequest, wantBody: "strategy is required"},
+		{name: "invalid symbol", method: http.MethodPost, path: "/backtests", key: paperKey, body: request("../AAPL", "file"), wantStatus: http.StatusBadRequest, wantBody: "invalid symbol"},
+		{name: "invalid source", method: http.MethodPost, path: "/backtests", key: paperKey, body: request("AAPL", "ftp"), wantStatus: http.StatusBadRequest, wantBody: "invalid source"},
+		{name: "unknown backtest", method: http.MethodGet, path: "/backtests/missing", key: marketKey, wantStatus: http.StatusNotFound},
+	})
+
+	// A runner with one slot and room for one more run, whose calendar holds
+	// the first run until released
+	dir := t.TempDir()
+	csv := "date,open,high,low,close,volume\n2024-01-02,100,101,99,100,1000\n"
+	if err := os.WriteFile(filepath.Join(dir, "AAPL_1Day.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	runner := backtest.NewRunner(backtest.RunnerOptions{
+		DataDir:       dir,
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		Calendar: func(start, end time.Time) ([]alpaca.CalendarDay, error) {
+			started <- struct{}{}
+			<-release
+			return []alpaca.CalendarDay{{Date: "2024-01-02", Open: "09:30", Close: "16:00"}}, nil
+		},
+	})
+	t.Cleanup(runner.Stop)
+	s.svc.Backtests = runner
+	s.router = Handler(context.Background(), config.Default(), s.svc)
+
+	var first backtest.Run
+	rec := s.do(t, http.MethodPost, "/backtests", paperKey, request("AAPL", "file"), nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /backtests status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+	decode(t, rec, &first)
+	<-started
+
+	s.run(t, []routeTest{
+		{name: "queued", method: http.MethodPost, path: "/backtests", key: paperKey, body: request("AAPL", "file"), wantStatus: http.StatusAccepted, wantBody: `"status":"queued"`},
+		{name: "queue full", method: http.MethodPost, path: "/backtests", key: paperKey, body: request("AAPL", "file"), wantStatus: http.StatusTooManyRequests, wantBody: "try again later"},
+	})
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var run backtest.Run
+		decode(t, s.do(t, http.MethodGet, "/backtests/"+first.ID, marketKey, nil, nil), &run)
+		if run.Status == backtest.StatusCompleted {
+			if run.Result == nil {
+				t.Errorf("GET /backtests/%s = %+v, want the result", first.ID, run)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backtest %s is still %s", first.ID, run.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.run(t, []routeTest{
+		{name: "list", method: http.MethodGet, path: "/backtests", key: marketKey, wantStatus: http.StatusOK, wantBody: first.ID},
+	})
+}
+
+func TestStrategyRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	// Strategies need a hub with credentials; it is never run, so nothing
+	// is streamed
+	s.svc.Hub = streaming.NewHub("key", "secret", alpacamd.IEX)
+	s.svc.Strategies = strategy.NewRunner(s.svc.Brokers, s.svc.Hub, s.svc.Tracker.Events())
+	t.Cleanup(s.svc.Strategies.Close)
+	s.router = Handler(context.Background(), config.Default(), s.svc)
+
+	start := func(name, strategy, account string) map[string]any {
+		return map[string]any{"name": name, "strategy": strategy, "account": account, "symbols": []string{"AAPL"}}
+	}
+
+	s.run(t, []routeTest{
+		{name: "unknown strategy", method: http.MethodPost, path: "/strategies", key: paperKey, body: start("x", "martingale", "paper"), wantStatus: http.StatusBadRequest},
+		{name: "live account", method: http.MethodPost, path: "/strategies", key: liveKey, body: start("live-bh", "buy_and_hold", "live"), wantStatus: http.StatusForbidden, wantBody: "live trading is disabled"},
+		{name: "another key's account", method: http.MethodPost, path: "/strategies", key: liveKey, body: start("bh", "buy_and_hold", "paper"), wantStatus: http.StatusForbidden},
+		{name: "start", method: http.MethodPost, path: "/strategies", key: paperKey, body: start("bh", "buy_and_hold", ""), wantStatus: http.StatusCreated, wantBody: `"account":"paper"`},
+		{name: "duplicate name", method: http.MethodPost, path: "/strategies", key: paperKey, body: start("bh", "buy_and_hold", "paper"), wantStatus: http.StatusBadRequest},
+		{name: "list", method: http.MethodGet, path: "/strategies", key: paperKey, wantStatus: http.StatusOK, wantBody: `"name":"bh"`},
+		{name: "list of another key", method: http.MethodGet, path: "/strategies", key: liveKey, wantStatus: http.StatusOK, wantBody: `"instances":[]`},
+		{name: "get of another key", method: http.MethodGet, path: "/strategies/bh", key: liveKey, wantStatus: http.StatusForbidden},
+		{name: "unknown instance", method: http.MethodGet, path: "/strategies/missing", key: paperKey, wantStatus: http.StatusNotFound},
+		{name: "pause", method: http.MethodPost, path: "/strategies/bh/pause", key: paperKey, wantStatus: http.StatusOK, wantBody: `"status":"paused"`},
+		{name: "pause twice", method: http.MethodPost, path: "/strategies/bh/pause", key: paperKey, wantStatus: http.StatusConflict},
+		{name: "resume", method: http.MethodPost, path: "/strategies/bh/resume", key: paperKey, wantStatus: http.StatusOK, wantBody: `"status":"running"`},
+		{name: "stop", method: http.MethodPost, path: "/strategies/bh/stop", key: paperKey, wantStatus: http.StatusOK, wantBody: `"status":"stopped"`},
+		{name: "get stopped", method: http.MethodGet, path: "/strategies/bh", key: paperKey, wantStatus: http.StatusOK, wantBody: `"stopped_at"`},
+	})
+}
+
+func TestSchedulerRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+	if err := s.svc.Scheduler.Add("close_report", "15m before close", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	s.run(t, []routeTest{
+		{name: "jobs", method: http.MethodGet, path: "/scheduler/jobs", key: adminKey, wantStatus: http.StatusOK, wantBody: `"name":"close_report"`},
+	})
+
+	// A calendar that cannot be loaded is reported with the jobs
+	s.svc.Scheduler = scheduler.New(func(start, end time.Time) ([]alpaca.CalendarDay, error) {
+		return nil, errors.New("calendar unavailable")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.svc.Scheduler.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for s.svc.Scheduler.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the scheduler never tried to load the calendar")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.router = Handler(context.Background(), config.Default(), s.svc)
+
+	s.run(t, []routeTest{
+		{name: "calendar error", method: http.MethodGet, path: "/scheduler/jobs", key: adminKey, wantStatus: http.StatusOK, wantBody: `"calendar_error":"load market calendar: calendar unavailable"`},
+	})
+}
+
+func TestIndicatorRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	// The warm-up request is sorted newest first and ends before the range
+	var warmupLimit string
+	newDataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		bars := []map[string]any{
+			{"t": "2024-11-25T05:00:00Z", "o": 20, "h": 20, "l": 20, "c": 20, "v": 100},
+			{"t": "2024-11-26T05:00:00Z", "o": 30, "h": 30, "l": 30, "c": 30, "v": 100},
+		}
+		if r.URL.Query().Get("sort") == "desc" {
+			warmupLimit = r.URL.Query().Get("limit")
+			bars = []map[string]any{{"t": "2024-11-22T05:00:00Z", "o": 10, "h": 10, "l": 10, "c": 10, "v": 100}}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"bars": map[string]any{"AAPL": bars}})
+	})
+
+	path := "/marketdata/indicators/AAPL?start=2024-11-25T00:00:00Z&end=2024-11-27T00:00:00Z"
+	s.run(t, []routeTest{
+		{name: "no name", method: http.MethodGet, path: path, key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "name parameter is required"},
+		{name: "unknown indicator", method: http.MethodGet, path: path + "&name=ichimoku", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "unknown indicator"},
+		{name: "invalid parameter", method: http.MethodGet, path: path + "&name=sma&period=long", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid period parameter"},
+		{name: "unknown parameter", method: http.MethodGet, path: path + "&name=sma&fast=3", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "does not take parameter fast"},
+		{name: "invalid period", method: http.MethodGet, path: path + "&name=sma&period=0", key: marketKey, wantStatus: http.StatusBadRequest},
+		{name: "invalid timeframe", method: http.MethodGet, path: path + "&name=sma&timeframe=2Hour", key: marketKey, wantStatus: http.StatusBadRequest, wantBody: "invalid timeframe"},
+		{name: "warmed up", method: http.MethodGet, path: path + "&name=SMA&period=2", key: marketKey, wantStatus: http.StatusOK, wantBody: `"values":[{"timestamp":"2024-11-25T05:00:00Z","values":{"sma":15}},{"timestamp":"2024-11-26T05:00:00Z","values":{"sma":25}}]`},
+	})
+
+	if warmupLimit != "1" {
+		t.Errorf("warm-up bars requested with limit %q, want 1", warmupLimit)
+	}
+}
+
+// historyBroker is a simulated broker that also keeps a portfolio history
+type historyBroker struct {
+	*trading.SimBroker
+	history alpaca.PortfolioHistory
+}
+
+func (b historyBroker) GetPortfolioHistory(req alpaca.GetPortfolioHistoryRequest) (*alpaca.PortfolioHistory, error) {
+	return &b.history, nil
+}
+
+func TestPerformanceRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	day := func(d int) int64 {
+		return time.Date(2024, 11, d, 16, 0, 0, 0, utils.NewYork).Unix()
+	}
+	s.svc.Brokers.Register(trading.AccountInfo{Name: "history", Paper: true}, historyBroker{
+		SimBroker: trading.NewSimBroker(trading.NewStaticPriceFeed(nil), decimal.NewFromInt(100000)),
+		history: alpaca.PortfolioHistory{
+			Timestamp:  []int64{day(25), day(26), day(27)},
+			Equity:     []decimal.Decimal{decimal.NewFromInt(100000), decimal.NewFromInt(101000), decimal.NewFromInt(102010)},
+			ProfitLoss: []decimal.Decimal{decimal.Zero, decimal.NewFromInt(1000), decimal.NewFromInt(1010)},
+		},
+	})
+
+	s.run(t, []routeTest{
+		{name: "invalid period", method: http.MethodGet, path: "/portfolio/performance?period=2W", key: paperKey, wantStatus: http.StatusBadRequest, wantBody: "invalid period"},
+		{name: "another key's account", method: http.MethodGet, path: "/portfolio/performance?account=live", key: paperKey, wantStatus: http.StatusForbidden},
+		{name: "no history", method: http.MethodGet, path: "/portfolio/performance", key: paperKey, wantStatus: http.StatusNotImplemented, wantBody: `"account":"paper"`},
+		{name: "report", method: http.MethodGet, path: "/portfolio/performance?account=history&period=1m&benchmark=", key: adminKey, wantStatus: http.StatusOK, wantBody: `"ending_equity":"102010"`},
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/health"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// accountCheckInterval is how often accounts are checked after startup, so
+// the health report follows accounts that recover or fail
+const accountCheckInterval = time.Minute
+
+// checkAccounts fetches every account in parallel to confirm the broker can
+// be reached with its credentials, marking the ones that fail degraded
+func checkAccounts(ctx context.Context, brokers *trading.Registry, timeout time.Duration, monitor *health.Monitor) {
+	var wg sync.WaitGroup
+	for _, name := range brokers.Names() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			component := "account:" + name
+			err := checkAccount(ctx, brokers, name, timeout)
+			if err != nil {
+				if monitor.Report().Components[component].Status != health.StatusDegraded {
+					log.Printf("Warning: account %q is degraded: %v", name, err)
+				}
+				monitor.Degraded(component, err)
+				return
+			}
+			if monitor.Report().Components[component].Status == health.StatusDegraded {
+				log.Printf("Account %q has recovered", name)
+			}
+			monitor.OK(component)
+		}()
+	}
+	wg.Wait()
+}
+
+// monitorAccounts checks every account each accountCheckInterval until ctx is
+// cancelled
+func monitorAccounts(ctx context.Context, brokers *trading.Registry, timeout time.Duration, monitor *health.Monitor) {
+	ticker := time.NewTicker(accountCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkAccounts(ctx, brokers, timeout, monitor)
+		}
+	}
+}
+
+// checkAccount fetches an account, failing when it takes longer than timeout
+// or the account cannot trade
+func checkAccount(ctx context.Context, brokers *trading.Registry, name string, timeout time.Duration) error {
+	broker, err := brokers.Get(name)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		account *alpaca.Account
+		err     error
+	}
+	// The broker call cannot be cancelled, so a slow one is left to finish
+	// in the background
+	done := make(chan result, 1)
+	go func() {
+		account, err := broker.GetAccount()
+		done <- result{account, err}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case r := <-done:
+		switch {
+		case r.err != nil:
+			return r.err
+		case r.account.Status != "ACTIVE":
+			return fmt.Errorf("account status is %s", r.account.Status)
+		case r.account.TradingBlocked:
+			return errors.New("trading is blocked on the account")
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no response within %s", timeout)
+	}
+}
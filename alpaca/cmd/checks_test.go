@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/health"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// accountBroker is a broker whose account is fixed, or that fails or never
+// answers
+type accountBroker struct {
+	trading.Broker
+	account *alpaca.Account
+	err     error
+	hang    chan struct{}
+}
+
+func (b *accountBroker) GetAccount() (*alpaca.Account, error) {
+	if b.hang != nil {
+		<-b.hang
+	}
+	return b.account, b.err
+}
+
+func TestCheckAccounts(t *testing.T) {
+	hang := make(chan struct{})
+	t.Cleanup(func() { close(hang) })
+
+	brokers := trading.NewRegistry()
+	brokers.Register(trading.AccountInfo{Name: "active", Paper: true}, &accountBroker{account: &alpaca.Account{Status: "ACTIVE"}})
+	brokers.Register(trading.AccountInfo{Name: "unreachable"}, &accountBroker{err: errors.New("forbidden")})
+	brokers.Register(trading.AccountInfo{Name: "closed"}, &accountBroker{account: &alpaca.Account{Status: "ACCOUNT_CLOSED"}})
+	brokers.Register(trading.AccountInfo{Name: "blocked"}, &accountBroker{account: &alpaca.Account{Status: "ACTIVE", TradingBlocked: true}})
+	brokers.Register(trading.AccountInfo{Name: "slow"}, &accountBroker{hang: hang})
+
+	monitor := health.NewMonitor()
+	checkAccounts(context.Background(), brokers, 20*time.Millisecond, monitor)
+
+	tests := []struct {
+		account    string
+		wantStatus string
+		wantDetail string
+	}{
+		{account: "active", wantStatus: health.StatusOK},
+		{account: "unreachable", wantStatus: health.StatusDegraded, wantDetail: "forbidden"},
+		{account: "closed", wantStatus: health.StatusDegraded, wantDetail: "account status is ACCOUNT_CLOSED"},
+		{account: "blocked", wantStatus: health.StatusDegraded, wantDetail: "trading is blocked on the account"},
+		{account: "slow", wantStatus: health.StatusDegraded, wantDetail: "no response within 20ms"},
+	}
+
+	report := monitor.Report()
+	if report.Status != health.StatusDegraded {
+		t.Errorf("Report().Status = %q, want %q", report.Status, health.StatusDegraded)
+	}
+	for _, tt := range tests {
+		t.Run(tt.account, func(t *testing.T) {
+			got := report.Components["account:"+tt.account]
+			if got.Status != tt.wantStatus || got.Detail != tt.wantDetail {
+				t.Errorf("account:%s = %+v, want status %q and detail %q", tt.account, got, tt.wantStatus, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestCheckAccountsRecovery(t *testing.T) {
+	broker := &accountBroker{err: errors.New("service unavailable")}
+	brokers := trading.NewRegistry()
+	brokers.Register(trading.AccountInfo{Name: "live"}, broker)
+
+	monitor := health.NewMonitor()
+	checkAccounts(context.Background(), brokers, time.Second, monitor)
+	if got := monitor.Report().Components["account:live"].Status; got != health.StatusDegraded {
+		t.Fatalf("account:live after a failed check = %q, want %q", got, health.StatusDegraded)
+	}
+
+	broker.account, broker.err = &alpaca.Account{Status: "ACTIVE"}, nil
+	checkAccounts(context.Background(), brokers, time.Second, monitor)
+	if report := monitor.Report(); report.Status != health.StatusOK || report.Components["account:live"].Detail != "" {
+		t.Errorf("Report() after the account recovered = %+v, want ok", report)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/config"
+	"github.com/nathgoh/investment-trader/alpaca/internal/risk"
+	"github.com/nathgoh/investment-trader/alpaca/internal/scheduler"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+// dailyReport is what a report job writes for an account
+type dailyReport struct {
+	Account     string            `json:"account"`
+	Date        string            `json:"date"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Equity      decimal.Decimal   `json:"equity"`
+	LastEquity  decimal.Decimal   `json:"last_equity"`
+	Change      decimal.Decimal   `json:"change"`
+	Cash        decimal.Decimal   `json:"cash"`
+	BuyingPower decimal.Decimal   `json:"buying_power"`
+	Positions   []alpaca.Position `json:"positions"`
+	// Orders are the orders submitted since midnight in New York
+	Orders []alpaca.Order `json:"orders"`
+}
+
+// scheduleJobs adds the configured jobs to sched. Their orders go through the
+// wrapped brokers tagged with the job name, so they pass the risk checks and
+// are journaled. Jobs that change a live account run only while live trading
+// is enabled. They need no live token, which guards changes made through the
+// API, since they come from the server's own configuration.
+func scheduleJobs(sched *scheduler.Scheduler, cfg config.Config, brokers *trading.Registry, riskEngine *risk.Engine) error {
+	for _, job := range cfg.Scheduler.Jobs {
+		err := sched.Add(job.Name, job.Schedule, func(ctx context.Context) error {
+			account, err := brokers.Info(job.Account)
+			if err != nil {
+				return err
+			}
+			if job.Action != config.JobReport && !account.Paper && !cfg.Live.TradingEnabled {
+				return trading.ErrLiveTradingDisabled
+			}
+			broker, err := brokers.Get(job.Account)
+			if err != nil {
+				return err
+			}
+			broker = trading.WithMeta(broker, trading.OrderMeta{Strategy: job.Name, Source: "scheduler"})
+
+			return runJob(job, broker, cfg.Scheduler.ReportDir, riskEngine)
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Scheduled job %q (%s on account %q) %s", job.Name, job.Action, job.Account, job.Schedule)
+	}
+	return nil
+}
+
+// runJob takes a job's action on its account's broker
+func runJob(job config.JobConfig, broker trading.Broker, reportDir string, riskEngine *risk.Engine) error {
+	switch job.Action {
+	case config.JobFlatten:
+		orders, err := trading.CloseAllPositions(broker, true)
+		if err != nil {
+			return err
+		}
+		log.Printf("Job %q closed %d positions on account %q", job.Name, len(orders), job.Account)
+
+	case config.JobCancelOrders:
+		return trading.CancelAllOrders(broker)
+
+	case config.JobRebalance:
+		orders, err := trading.Rebalance(broker, job.Targets, func(symbol string) (decimal.Decimal, error) {
+			return riskEngine.LastPrice(broker, symbol)
+		})
+		if len(orders) > 0 {
+			log.Printf("Job %q placed %d rebalancing orders on account %q", job.Name, len(orders), job.Account)
+		}
+		return err
+
+	case config.JobReport:
+		path, err := writeReport(reportDir, job.Account, broker)
+		if err != nil {
+			return err
+		}
+		log.Printf("Job %q wrote %s", job.Name, path)
+
+	default:
+		return fmt.Errorf("unknown action %q", job.Action)
+	}
+	return nil
+}
+
+// writeReport writes the day's report of an account to
+// dir/<account>/<date>.json, replacing an earlier report of the same day
+func writeReport(dir, account string, broker trading.Broker) (string, error) {
+	now := time.Now().In(utils.NewYork)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, utils.NewYork)
+
+	acct, err := trading.GetAccount(broker)
+	if err != nil {
+		return "", err
+	}
+	positions, err := trading.GetPositions(broker)
+	if err != nil {
+		return "", err
+	}
+	status, limit := "all", 500
+	orders, err := trading.GetOrders(broker, &status, &limit, &midnight, nil, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	report := dailyReport{
+		Account:     account,
+		Date:        now.Format("2006-01-02"),
+		GeneratedAt: now,
+		Equity:      acct.Equity,
+		LastEquity:  acct.LastEquity,
+		Change:      acct.Equity.Sub(acct.LastEquity),
+		Cash:        acct.Cash,
+		BuyingPower: acct.BuyingPower,
+		Positions:   positions,
+		Orders:      orders,
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, account, report.Date+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("create report directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", fmt.Errorf("write report: %w", err)
+	}
+	return path, os.Rename(tmp, path)
+}
@@ -2,13 +2,324 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
 	"github.com/nathgoh/investment-trader/alpaca/api/routes"
+	"github.com/nathgoh/investment-trader/alpaca/internal/audit"
+	"github.com/nathgoh/investment-trader/alpaca/internal/auth"
+	"github.com/nathgoh/investment-trader/alpaca/internal/backtest"
+	"github.com/nathgoh/investment-trader/alpaca/internal/config"
+	"github.com/nathgoh/investment-trader/alpaca/internal/health"
+	"github.com/nathgoh/investment-trader/alpaca/internal/journal"
+	"github.com/nathgoh/investment-trader/alpaca/internal/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/risk"
+	"github.com/nathgoh/investment-trader/alpaca/internal/scheduler"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/nathgoh/investment-trader/alpaca/internal/streaming"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
 )
 
 func main() {
-	ctx := context.Background()
+	configPath := flag.String("config", "", "YAML config file (default: $TRADER_CONFIG)")
+	envFile := flag.String("env-file", "../.env", "file of environment variables to load")
+	listenAddr := flag.String("listen", "", "address to listen on, overriding the config")
+	broker := flag.String("broker", "", `"alpaca" or "sim" for every paper account, overriding the config`)
+	flag.Parse()
 
-	router := routes.Handler(ctx)
-	router.Run(":8080")
+	// Defaults, then the config file, then the environment, then flags
+	cfg, err := config.Load(*envFile, *configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration:\n%v", err)
+	}
+	if *listenAddr != "" {
+		cfg.Server.ListenAddr = *listenAddr
+	}
+	if *broker != "" {
+		cfg.UseBroker(*broker)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the API until SIGINT or SIGTERM, then drains in-flight requests,
+// stops the background workers and closes the journal and audit log
+func run(cfg config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	monitor := health.NewMonitor()
+
+	// Market data comes from the keys of a paper account where there is one
+	dataAccount, ok := cfg.MarketDataAccount()
+	if ok {
+		marketdata.Configure(dataAccount.APIKey, dataAccount.APISecret, cfg.Alpaca.DataBaseURL, cfg.Alpaca.DataFeed)
+	} else {
+		log.Println("Warning: no Alpaca account has an API key and secret, market data is disabled")
+	}
+
+	brokers := newRegistry(cfg)
+	if len(brokers.Names()) == 0 {
+		log.Println("Warning: no trading accounts are configured")
+	}
+
+	// Accounts that cannot be reached are reported as degraded rather than
+	// stopping the server
+	checkAccounts(ctx, brokers, time.Duration(cfg.Server.StartupCheckTimeout), monitor)
+
+	// Every order passes the pre-trade risk checks before reaching a broker
+	riskEngine := risk.NewEngine(cfg.Risk, risk.QuotePrices{})
+	riskEngine.Install(brokers)
+
+	// Every order call and its outcome is journaled, including risk rejections
+	orderJournal, err := journal.Open(cfg.Journal.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open order journal: %w", err)
+	}
+	defer func() {
+		if err := orderJournal.Close(); err != nil {
+			log.Printf("Warning: failed to close order journal: %v", err)
+		}
+	}()
+	brokers.Wrap(orderJournal.Wrap)
+	monitor.OK("journal")
+
+	// Every mutating API call is written to the hash-chained audit log
+	auditLog, err := audit.Open(cfg.Audit.Dir, cfg.Audit.MaxBytes)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() {
+		if err := auditLog.Close(); err != nil {
+			log.Printf("Warning: failed to close audit log: %v", err)
+		}
+	}()
+	monitor.OK("audit")
+
+	// API keys and their scopes. Validation only lets the API run without
+	// them on a loopback address.
+	var keys *auth.KeyStore
+	if cfg.Auth.Disabled {
+		log.Printf("Warning: API authentication is disabled, serving on %s only", cfg.Server.ListenAddr)
+		monitor.Disabled("auth", "disabled by configuration")
+	} else {
+		keys, err = auth.LoadKeyStore(cfg.Auth.KeysFile)
+		if err != nil {
+			return fmt.Errorf("failed to load API keys: %w", err)
+		}
+		monitor.OK("auth")
+	}
+
+	// Market data stream shared by every streaming client
+	hub := streaming.NewHub(dataAccount.APIKey, dataAccount.APISecret, cfg.Alpaca.DataFeed)
+	monitor.Probe("marketdata_stream", func() health.Component {
+		switch {
+		case !hub.Enabled():
+			return health.Component{Status: health.StatusDisabled, Detail: "no market data credentials"}
+		case !hub.Connected():
+			return health.Component{Status: health.StatusDegraded, Detail: "not connected"}
+		}
+		return health.Component{Status: health.StatusOK}
+	})
+
+	// Order updates for every account, rebuilt from the journal
+	tracker := trading.NewOrderTracker(brokers)
+	for _, name := range brokers.Names() {
+		orders, err := orderJournal.LatestOrders(name)
+		if err != nil {
+			log.Printf("Warning: failed to restore orders for account %q: %v", name, err)
+			continue
+		}
+		tracker.Restore(name, orders)
+	}
+
+	// The market calendar of the default account's broker, for backtests and
+	// scheduled jobs
+	calendar := func(start, end time.Time) ([]alpaca.CalendarDay, error) {
+		broker, err := brokers.Default()
+		if err != nil {
+			return nil, err
+		}
+		return trading.GetCalendar(broker, &start, &end)
+	}
+
+	// Jobs run at times relative to the market's sessions
+	jobs := scheduler.New(calendar)
+	if err := scheduleJobs(jobs, cfg, brokers, riskEngine); err != nil {
+		return fmt.Errorf("failed to schedule jobs: %w", err)
+	}
+	monitor.Probe("scheduler", func() health.Component {
+		switch {
+		case len(cfg.Scheduler.Jobs) == 0:
+			return health.Component{Status: health.StatusDisabled, Detail: "no jobs configured"}
+		case jobs.Err() != nil:
+			return health.Component{Status: health.StatusDegraded, Detail: jobs.Err().Error()}
+		}
+		return health.Component{Status: health.StatusOK}
+	})
+
+	// The workers outlive the listener, so orders placed by requests still
+	// draining are tracked. The journal stops last to record every update.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	start := func(ctx context.Context, work func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			work(ctx)
+		}()
+	}
+	start(workersCtx, hub.Run)
+	start(workersCtx, tracker.Run)
+	start(workersCtx, func(ctx context.Context) { riskEngine.Run(ctx, brokers) })
+	start(workersCtx, jobs.Run)
+	for _, name := range brokers.Names() {
+		broker, _ := brokers.Get(name)
+		if sim, ok := trading.Simulator(broker); ok {
+			start(workersCtx, sim.Run)
+		}
+	}
+	start(workersCtx, func(ctx context.Context) {
+		monitorAccounts(ctx, brokers, time.Duration(cfg.Server.StartupCheckTimeout), monitor)
+	})
+
+	journalCtx, stopJournal := context.WithCancel(context.Background())
+	defer stopJournal()
+	journalDone := make(chan struct{})
+	go func() {
+		defer close(journalDone)
+		orderJournal.Follow(journalCtx, tracker.Events())
+	}()
+
+	// Backtests replay bars from files or cached market data
+	backtests := backtest.NewRunner(backtest.RunnerOptions{
+		DataDir:       cfg.Backtest.DataDir,
+		CacheDir:      cfg.Backtest.CacheDir,
+		MaxConcurrent: cfg.Backtest.MaxConcurrent,
+		MaxQueued:     cfg.Backtest.MaxQueued,
+		Calendar:      calendar,
+	})
+
+	// Live strategies trade through the wrapped brokers, so their orders
+	// pass the risk checks and are journaled
+	strategies := strategy.NewRunner(brokers, hub, tracker.Events())
+	monitor.Probe("strategies", func() health.Component {
+		if failed := strategies.Failed(); len(failed) > 0 {
+			return health.Component{Status: health.StatusDegraded, Detail: fmt.Sprintf("failed: %v", failed)}
+		}
+		return health.Component{Status: health.StatusOK}
+	})
+
+	router := routes.Handler(ctx, cfg, routes.Services{
+		Brokers:    brokers,
+		Risk:       riskEngine,
+		Journal:    orderJournal,
+		Audit:      auditLog,
+		Keys:       keys,
+		Hub:        hub,
+		Tracker:    tracker,
+		Health:     monitor,
+		Backtests:  backtests,
+		Strategies: strategies,
+		Scheduler:  jobs,
+	})
+
+	server := &http.Server{
+		Addr:              cfg.Server.ListenAddr,
+		Handler:           router,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	log.Printf("Listening on %s (%s)", cfg.Server.ListenAddr, monitor.Report().Status)
+
+	var runErr error
+	select {
+	case err := <-serveErr:
+		runErr = fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+		log.Println("Shutting down, draining in-flight requests")
+	}
+	// A second signal kills the process
+	stop()
+
+	shutdownTimeout := time.Duration(cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: requests still in flight after %s were cut off: %v", shutdownTimeout, err)
+		server.Close()
+	}
+
+	// Strategies stop while the tracker still reports their fills
+	strategies.Close()
+	stopWorkers()
+	backtests.Stop()
+	if !waitFor(shutdownCtx, workers.Wait) {
+		log.Println("Warning: background workers did not stop in time")
+	}
+	stopJournal()
+	<-journalDone
+
+	if runErr == nil {
+		log.Println("Server stopped")
+	}
+	return runErr
+}
+
+// waitFor runs wait, giving up when ctx is done. It reports whether wait
+// returned.
+func waitFor(ctx context.Context, wait func()) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// newRegistry registers every configured account. Accounts using the sim
+// broker are backed by their own SimBroker, so the server can run without
+// network.
+func newRegistry(cfg config.Config) *trading.Registry {
+	registry := trading.NewRegistry()
+
+	for _, account := range cfg.Accounts {
+		info := trading.AccountInfo{Name: account.Name, Paper: account.Paper}
+		if account.Broker == config.BrokerSim {
+			log.Printf("Using simulated broker for account %q", account.Name)
+			registry.Register(info, trading.NewSimBroker(trading.NewStaticPriceFeed(cfg.Sim.Prices), cfg.Sim.StartingCash))
+			continue
+		}
+		registry.Register(info, trading.NewAlpacaBroker(account.APIKey, account.APISecret, cfg.BaseURL(account)))
+	}
+
+	return registry
 }
@@ -0,0 +1,378 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxBytes is the size a file grows to before the log rotates
+	defaultMaxBytes = 10 << 20
+	// defaultLimit caps the entries a page holds when no limit is given
+	defaultLimit = 100
+	// maxLineBytes bounds a single entry when reading the log back
+	maxLineBytes = 1 << 20
+)
+
+// filePattern names the files of the log, numbered in the order written
+const filePattern = "audit-%06d.jsonl"
+
+// Entry is a single audited API call. Each entry carries the hash of the one
+// before it, so editing or removing any entry breaks the chain.
+type Entry struct {
+	Seq       uint64          `json:"seq"`
+	At        time.Time       `json:"at"`
+	Caller    string          `json:"caller"`
+	ClientIP  string          `json:"client_ip"`
+	UserAgent string          `json:"user_agent,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Account   string          `json:"account,omitempty"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Route     string          `json:"route"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Status    int             `json:"status"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	LatencyMs float64         `json:"latency_ms"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+// Filter selects audit entries. Empty fields match everything.
+type Filter struct {
+	Caller  string
+	Account string
+	Method  string
+	// Before pages backwards through the log, matching entries with a lower
+	// sequence number
+	Before uint64
+	Limit  int
+}
+
+func (f Filter) matches(e Entry) bool {
+	switch {
+	case f.Caller != "" && e.Caller != f.Caller:
+		return false
+	case f.Account != "" && e.Account != f.Account:
+		return false
+	case f.Method != "" && e.Method != f.Method:
+		return false
+	case f.Before > 0 && e.Seq >= f.Before:
+		return false
+	}
+	return true
+}
+
+// Verification is the outcome of checking the hash chain
+type Verification struct {
+	Valid   bool   `json:"valid"`
+	Entries uint64 `json:"entries"`
+	// BrokenAt is the sequence number of the first entry that does not fit
+	// the chain
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+	File     string `json:"file,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Log is an append-only, hash-chained audit log written as JSON lines. Files
+// are rotated once they reach a size limit and are never removed.
+type Log struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	file     *os.File
+	index    int
+	size     int64
+	seq      uint64
+	lastHash string
+}
+
+// Open opens or creates the audit log in dir, continuing the chain from the
+// last entry written
+func Open(dir string, maxBytes int64) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create audit directory %s: %w", dir, err)
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+
+	l := &Log{dir: dir, maxBytes: maxBytes}
+
+	files, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return l, l.openFile(1)
+	}
+
+	// Pick the chain up from the newest entry, looking back through earlier
+	// files in case the newest one is still empty
+	for i := len(files) - 1; i >= 0 && l.seq == 0; i-- {
+		err := readFile(files[i], -1, func(e Entry) error {
+			l.seq, l.lastHash = e.Seq, e.Hash
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: audit log %s has an unreadable entry: %v", files[i], err)
+		}
+	}
+
+	return l, l.openFile(fileIndex(files[len(files)-1]))
+}
+
+// Close closes the file being written
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// Append chains an entry onto the log and writes it, returning the entry as
+// written
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	e.At = e.At.UTC()
+	e.Seq = l.seq + 1
+	e.PrevHash = l.lastHash
+
+	hash, err := e.hash()
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	line = append(line, '\n')
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return Entry{}, err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return Entry{}, fmt.Errorf("write audit entry: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return Entry{}, fmt.Errorf("sync audit log: %w", err)
+	}
+
+	l.seq, l.lastHash = e.Seq, e.Hash
+	return e, nil
+}
+
+// Query returns a page of the entries matching filter, newest first
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	files, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for i := len(files) - 1; i >= 0 && len(entries) < limit; i-- {
+		var matched []Entry
+		err := files[i].read(func(e Entry) error {
+			if filter.matches(e) {
+				matched = append(matched, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		slices.Reverse(matched)
+		entries = append(entries, matched[:min(len(matched), limit-len(entries))]...)
+	}
+
+	return entries, nil
+}
+
+// Verify walks the whole log, checking that every entry hashes to what it
+// records and links to the entry before it
+func (l *Log) Verify() (Verification, error) {
+	files, err := l.snapshot()
+	if err != nil {
+		return Verification{}, err
+	}
+
+	var result Verification
+	var prev Entry
+	for _, file := range files {
+		err := file.read(func(e Entry) error {
+			hash, err := e.hash()
+			if err != nil {
+				return err
+			}
+			switch {
+			case e.Seq != prev.Seq+1:
+				return fmt.Errorf("entry %d follows entry %d", e.Seq, prev.Seq)
+			case e.PrevHash != prev.Hash:
+				return fmt.Errorf("entry %d does not link to the hash of entry %d", e.Seq, prev.Seq)
+			case e.Hash != hash:
+				return fmt.Errorf("entry %d does not match its hash", e.Seq)
+			}
+			prev = e
+			result.Entries++
+			return nil
+		})
+		if err != nil {
+			result.BrokenAt = prev.Seq + 1
+			result.File = filepath.Base(file.path)
+			result.Error = err.Error()
+			return result, nil
+		}
+	}
+
+	result.Valid = true
+	return result, nil
+}
+
+// hash is the SHA-256 of the entry with its own hash left out
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// rotate closes the current file and starts the next one. The caller must
+// hold l.mu.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("close audit log: %w", err)
+	}
+	return l.openFile(l.index + 1)
+}
+
+// openFile opens the numbered file for appending. The caller must hold l.mu
+// or be the constructor.
+func (l *Log) openFile(index int) error {
+	path := filepath.Join(l.dir, fmt.Sprintf(filePattern, index))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log %s: %w", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("open audit log %s: %w", path, err)
+	}
+
+	l.file, l.index, l.size = file, index, info.Size()
+	return nil
+}
+
+// segment is a log file as far as it had been written when a read began
+type segment struct {
+	path string
+	// size is how much of the file to read, or -1 for all of it
+	size int64
+}
+
+// snapshot lists the files of the log, oldest first, with the size of the one
+// being written. Reads then go through them without holding l.mu, so they
+// never hold up Append, and entries written meanwhile are left out.
+func (l *Log) snapshot() ([]segment, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	files, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, len(files))
+	for i, path := range files {
+		segments[i] = segment{path: path, size: -1}
+		if fileIndex(path) == l.index {
+			segments[i].size = l.size
+		}
+	}
+	return segments, nil
+}
+
+func (s segment) read(fn func(Entry) error) error {
+	return readFile(s.path, s.size, fn)
+}
+
+// files lists the files of the log, oldest first
+func (l *Log) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(l.dir, "audit-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(files, func(a, b string) int {
+		return fileIndex(a) - fileIndex(b)
+	})
+	return files, nil
+}
+
+// fileIndex is the number in a log file's name
+func fileIndex(path string) int {
+	var index int
+	fmt.Sscanf(filepath.Base(path), filePattern, &index)
+	return index
+}
+
+// readFile calls fn with every entry in the first size bytes of a log file,
+// or the whole file when size is negative, in order
+func readFile(path string, size int64, fn func(Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if size >= 0 {
+		r = io.LimitReader(file, size)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("unreadable entry: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,240 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeTestLog appends n entries, alternating between two callers and
+// accounts, and closes the log
+func writeTestLog(t *testing.T, dir string, maxBytes int64, n int) {
+	t.Helper()
+	l, err := Open(dir, maxBytes)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	for i := range n {
+		e := Entry{Caller: "alice", Account: "paper", Method: "POST", Path: "/orders", Route: "/orders", Status: 200}
+		if i%2 == 1 {
+			e.Caller, e.Account, e.Method = "bob", "live", "DELETE"
+		}
+		if _, err := l.Append(e); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+}
+
+func seqs(entries []Entry) []uint64 {
+	var s []uint64
+	for _, e := range entries {
+		s = append(s, e.Seq)
+	}
+	return s
+}
+
+func TestAppendChainsEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeTestLog(t, dir, 0, 3)
+
+	// Reopening continues the chain from the last entry
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	e, err := l.Append(Entry{Caller: "alice", Method: "POST", Path: "/orders"})
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if e.Seq != 4 {
+		t.Errorf("seq = %d, want 4", e.Seq)
+	}
+
+	entries, err := l.Query(Filter{Limit: 2})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 4 || entries[0].PrevHash != entries[1].Hash {
+		t.Errorf("newest entries = %+v, want entry 4 linked to entry 3", entries)
+	}
+
+	v, err := l.Verify()
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !v.Valid || v.Entries != 4 {
+		t.Errorf("Verify() = %+v, want a valid chain of 4 entries", v)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeTestLog(t, dir, 600, 10)
+
+	files, err := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("log wrote %d files, want it rotated into several", len(files))
+	}
+
+	l, err := Open(dir, 600)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	// Pages run across files
+	entries, err := l.Query(Filter{Before: 8, Limit: 5})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got, want := seqs(entries), []uint64{7, 6, 5, 4, 3}; !slices.Equal(got, want) {
+		t.Errorf("Query() seqs = %v, want %v", got, want)
+	}
+
+	v, err := l.Verify()
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !v.Valid || v.Entries != 10 {
+		t.Errorf("Verify() = %+v, want a valid chain of 10 entries", v)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dir := t.TempDir()
+	writeTestLog(t, dir, 0, 6)
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []uint64
+	}{
+		{name: "everything, newest first", want: []uint64{6, 5, 4, 3, 2, 1}},
+		{name: "by caller", filter: Filter{Caller: "alice"}, want: []uint64{5, 3, 1}},
+		{name: "by account", filter: Filter{Account: "live"}, want: []uint64{6, 4, 2}},
+		{name: "by method", filter: Filter{Method: "DELETE", Limit: 2}, want: []uint64{6, 4}},
+		{name: "before a sequence number", filter: Filter{Before: 3}, want: []uint64{2, 1}},
+		{name: "no match", filter: Filter{Caller: "carol"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := l.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if got := seqs(entries); !slices.Equal(got, tt.want) {
+				t.Errorf("Query() seqs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name         string
+		tamper       func(lines []string) []string
+		wantBrokenAt uint64
+		wantError    string
+	}{
+		{
+			name: "edited entry",
+			tamper: func(lines []string) []string {
+				lines[2] = strings.Replace(lines[2], `"status":200`, `"status":201`, 1)
+				return lines
+			},
+			wantBrokenAt: 3,
+			wantError:    "entry 3 does not match its hash",
+		},
+		{
+			name: "edited entry with its hash recomputed",
+			tamper: func(lines []string) []string {
+				lines[1] = rehash(t, strings.Replace(lines[1], `"caller":"bob"`, `"caller":"eve"`, 1))
+				return lines
+			},
+			wantBrokenAt: 3,
+			wantError:    "entry 3 does not link to the hash of entry 2",
+		},
+		{
+			name:         "removed entry",
+			tamper:       func(lines []string) []string { return slices.Delete(lines, 1, 2) },
+			wantBrokenAt: 2,
+			wantError:    "entry 3 follows entry 1",
+		},
+		{
+			name: "reordered entries",
+			tamper: func(lines []string) []string {
+				lines[3], lines[4] = lines[4], lines[3]
+				return lines
+			},
+			wantBrokenAt: 4,
+			wantError:    "entry 5 follows entry 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestLog(t, dir, 0, 5)
+
+			path := filepath.Join(dir, fmt.Sprintf(filePattern, 1))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := tt.tamper(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := Open(dir, 0)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer l.Close()
+
+			v, err := l.Verify()
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if v.Valid || v.BrokenAt != tt.wantBrokenAt || v.Error != tt.wantError {
+				t.Errorf("Verify() = %+v, want broken at %d with %q", v, tt.wantBrokenAt, tt.wantError)
+			}
+		})
+	}
+}
+
+// rehash recomputes the hash of an entry written as a JSON line
+func rehash(t *testing.T, line string) string {
+	t.Helper()
+	var e Entry
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := e.hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Hash = hash
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Scopes a key can be granted
+const (
+	// ScopeMarketData allows reading market data, assets and market hours
+	ScopeMarketData = "marketdata:read"
+	// ScopePaper allows reading and trading the paper account
+	ScopePaper = "trading:paper"
+	// ScopeLive allows reading and trading the live account
+	ScopeLive = "trading:live"
+	// ScopeAdmin allows everything, including the journal, the audit log and
+	// halting or resuming accounts
+	ScopeAdmin = "admin"
+)
+
+// tradingScopePrefix starts the scope of every trading account
+const tradingScopePrefix = "trading:"
+
+var (
+	// ErrMissingKey is returned for requests that carry no API key
+	ErrMissingKey = errors.New("missing API key")
+	// ErrInvalidKey is returned for API keys that are not configured
+	ErrInvalidKey = errors.New("invalid API key")
+)
+
+// AccountScope is the scope needed to use a trading account
+func AccountScope(account string) string {
+	return tradingScopePrefix + account
+}
+
+// Principal is the caller a request was authenticated as
+type Principal struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Anonymous is the principal of every request when authentication is
+// disabled, which is only allowed on a loopback address. It may do anything.
+var Anonymous = Principal{Name: "anonymous", Scopes: []string{ScopeAdmin}}
+
+// Allows reports whether the principal has scope, which admin always does
+func (p Principal) Allows(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// AllowsAny reports whether the principal has at least one of scopes
+func (p Principal) AllowsAny(scopes ...string) bool {
+	return slices.ContainsFunc(scopes, p.Allows)
+}
+
+// CanTrade reports whether the principal may use at least one trading account
+func (p Principal) CanTrade() bool {
+	return slices.ContainsFunc(p.Scopes, func(s string) bool {
+		return s == ScopeAdmin || strings.HasPrefix(s, tradingScopePrefix)
+	})
+}
+
+// KeyConfig is a single API key in the keys file. The key is given either in
+// plain text or as the hex SHA-256 of the key.
+type KeyConfig struct {
+	Name      string   `json:"name"`
+	Key       string   `json:"key,omitempty"`
+	KeySHA256 string   `json:"key_sha256,omitempty"`
+	Scopes    []string `json:"scopes"`
+}
+
+// keysFile is the layout of the keys file
+type keysFile struct {
+	Keys []KeyConfig `json:"keys"`
+}
+
+// KeyStore authenticates API keys. Keys are held only as hashes.
+type KeyStore struct {
+	principals map[string]Principal
+}
+
+// NewKeyStore creates a key store from key configs, rejecting keys without a
+// name, a key or a known scope
+func NewKeyStore(keys []KeyConfig) (*KeyStore, error) {
+	store := &KeyStore{principals: make(map[string]Principal)}
+	names := make(map[string]bool)
+
+	for i, k := range keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("key %d has no name", i)
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("key %q is configured twice", k.Name)
+		}
+		names[k.Name] = true
+
+		var hash string
+		switch {
+		case k.Key != "" && k.KeySHA256 != "":
+			return nil, fmt.Errorf("key %q must set only one of key or key_sha256", k.Name)
+		case k.Key != "":
+			hash = hashKey(k.Key)
+		case k.KeySHA256 != "":
+			decoded, err := hex.DecodeString(k.KeySHA256)
+			if err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("key %q has an invalid key_sha256", k.Name)
+			}
+			hash = strings.ToLower(k.KeySHA256)
+		default:
+			return nil, fmt.Errorf("key %q must set key or key_sha256", k.Name)
+		}
+		if _, ok := store.principals[hash]; ok {
+			return nil, fmt.Errorf("key %q reuses the key of another entry", k.Name)
+		}
+
+		if len(k.Scopes) == 0 {
+			return nil, fmt.Errorf("key %q has no scopes", k.Name)
+		}
+		for _, scope := range k.Scopes {
+			if scope != ScopeMarketData && scope != ScopeAdmin && !strings.HasPrefix(scope, tradingScopePrefix) {
+				return nil, fmt.Errorf("key %q has unknown scope %q", k.Name, scope)
+			}
+		}
+
+		store.principals[hash] = Principal{Name: k.Name, Scopes: slices.Clone(k.Scopes)}
+	}
+
+	return store, nil
+}
+
+// LoadKeyStore reads the keys file at path
+func LoadKeyStore(path string) (*KeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keys file %s: %w", path, err)
+	}
+
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse keys file %s: %w", path, err)
+	}
+
+	store, err := NewKeyStore(file.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("keys file %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Authenticate returns the principal an API key belongs to
+func (s *KeyStore) Authenticate(key string) (Principal, error) {
+	if key == "" {
+		return Principal{}, ErrMissingKey
+	}
+
+	principal, ok := s.principals[hashKey(key)]
+	if !ok {
+		return Principal{}, ErrInvalidKey
+	}
+	return principal, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []KeyConfig
+		wantErr string
+	}{
+		{
+			name: "plain and hashed keys",
+			keys: []KeyConfig{
+				{Name: "dashboard", Key: "dash-key", Scopes: []string{ScopeMarketData, ScopePaper}},
+				{Name: "ops", KeySHA256: strings.ToUpper(hashKey("ops-key")), Scopes: []string{ScopeAdmin}},
+			},
+		},
+		{
+			name:    "no name",
+			keys:    []KeyConfig{{Key: "k", Scopes: []string{ScopePaper}}},
+			wantErr: "key 0 has no name",
+		},
+		{
+			name: "name used twice",
+			keys: []KeyConfig{
+				{Name: "bot", Key: "a", Scopes: []string{ScopePaper}},
+				{Name: "bot", Key: "b", Scopes: []string{ScopePaper}},
+			},
+			wantErr: `key "bot" is configured twice`,
+		},
+		{
+			name:    "both key and hash",
+			keys:    []KeyConfig{{Name: "bot", Key: "k", KeySHA256: hashKey("k"), Scopes: []string{ScopePaper}}},
+			wantErr: "must set only one of key or key_sha256",
+		},
+		{
+			name:    "neither key nor hash",
+			keys:    []KeyConfig{{Name: "bot", Scopes: []string{ScopePaper}}},
+			wantErr: "must set key or key_sha256",
+		},
+		{
+			name:    "hash of the wrong length",
+			keys:    []KeyConfig{{Name: "bot", KeySHA256: "abcd", Scopes: []string{ScopePaper}}},
+			wantErr: `key "bot" has an invalid key_sha256`,
+		},
+		{
+			name: "same key twice",
+			keys: []KeyConfig{
+				{Name: "bot", Key: "k", Scopes: []string{ScopePaper}},
+				{Name: "other", KeySHA256: hashKey("k"), Scopes: []string{ScopePaper}},
+			},
+			wantErr: `key "other" reuses the key of another entry`,
+		},
+		{
+			name:    "no scopes",
+			keys:    []KeyConfig{{Name: "bot", Key: "k"}},
+			wantErr: `key "bot" has no scopes`,
+		},
+		{
+			name:    "unknown scope",
+			keys:    []KeyConfig{{Name: "bot", Key: "k", Scopes: []string{"orders:write"}}},
+			wantErr: `key "bot" has unknown scope "orders:write"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyStore(tt.keys)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("NewKeyStore() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("NewKeyStore() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	store, err := NewKeyStore([]KeyConfig{
+		{Name: "dashboard", Key: "dash-key", Scopes: []string{ScopeMarketData}},
+		{Name: "ops", KeySHA256: hashKey("ops-key"), Scopes: []string{ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyStore() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		wantName string
+		wantErr  error
+	}{
+		{name: "plain key", key: "dash-key", wantName: "dashboard"},
+		{name: "hashed key", key: "ops-key", wantName: "ops"},
+		{name: "missing key", wantErr: ErrMissingKey},
+		{name: "unknown key", key: "guess", wantErr: ErrInvalidKey},
+		{name: "hash given as the key", key: hashKey("ops-key"), wantErr: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := store.Authenticate(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if principal.Name != tt.wantName {
+				t.Errorf("Authenticate() = %q, want %q", principal.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestPrincipalScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		scopes    []string
+		scope     string
+		wantAllow bool
+		wantTrade bool
+	}{
+		{name: "market data only", scopes: []string{ScopeMarketData}, scope: ScopePaper},
+		{name: "paper trading", scopes: []string{ScopePaper}, scope: ScopePaper, wantAllow: true, wantTrade: true},
+		{name: "paper scope on the live account", scopes: []string{ScopePaper}, scope: ScopeLive, wantTrade: true},
+		{name: "named account", scopes: []string{AccountScope("ira")}, scope: AccountScope("ira"), wantAllow: true, wantTrade: true},
+		{name: "admin", scopes: []string{ScopeAdmin}, scope: ScopeLive, wantAllow: true, wantTrade: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Principal{Name: "key", Scopes: tt.scopes}
+			if got := p.Allows(tt.scope); got != tt.wantAllow {
+				t.Errorf("Allows(%q) = %t, want %t", tt.scope, got, tt.wantAllow)
+			}
+			if got := p.CanTrade(); got != tt.wantTrade {
+				t.Errorf("CanTrade() = %t, want %t", got, tt.wantTrade)
+			}
+		})
+	}
+}
+
+func TestPrincipalAllowsAny(t *testing.T) {
+	p := Principal{Name: "dashboard", Scopes: []string{ScopeMarketData, ScopePaper}}
+	if !p.AllowsAny(ScopeLive, ScopePaper) {
+		t.Error("AllowsAny() = false with one of the scopes, want true")
+	}
+	if p.AllowsAny(ScopeLive, ScopeAdmin) {
+		t.Error("AllowsAny() = true with none of the scopes, want false")
+	}
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	store, err := LoadKeyStore(write("keys.json", `{"keys": [{"name": "bot", "key": "bot-key", "scopes": ["trading:paper"]}]}`))
+	if err != nil {
+		t.Fatalf("LoadKeyStore() error = %v", err)
+	}
+	if p, err := store.Authenticate("bot-key"); err != nil || !p.Allows(ScopePaper) {
+		t.Errorf("Authenticate() = %+v, %v, want bot with %s", p, err, ScopePaper)
+	}
+
+	if _, err := LoadKeyStore(write("bad.json", `{"keys": [`)); err == nil || !strings.Contains(err.Error(), "parse keys file") {
+		t.Errorf("LoadKeyStore() of bad JSON error = %v, want a parse error", err)
+	}
+	if _, err := LoadKeyStore(write("invalid.json", `{"keys": [{"name": "bot", "key": "k"}]}`)); err == nil || !strings.Contains(err.Error(), "has no scopes") {
+		t.Errorf("LoadKeyStore() of an invalid key error = %v, want the key's problem", err)
+	}
+	if _, err := LoadKeyStore(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadKeyStore() of a missing file succeeded, want an error")
+	}
+}
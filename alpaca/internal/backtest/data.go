@@ -0,0 +1,304 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	internalmd "github.com/nathgoh/investment-trader/alpaca/internal/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+// csvColumns maps the accepted header names of each bar field
+var csvColumns = map[string][]string{
+	"timestamp":   {"timestamp", "time", "date", "datetime", "t"},
+	"open":        {"open", "o"},
+	"high":        {"high", "h"},
+	"low":         {"low", "l"},
+	"close":       {"close", "c"},
+	"volume":      {"volume", "v"},
+	"trade_count": {"trade_count", "n"},
+	"vwap":        {"vwap", "vw"},
+}
+
+// Source supplies the bars of a symbol between start and end
+type Source interface {
+	Bars(symbol string, start, end time.Time) ([]marketdata.Bar, error)
+}
+
+// Load reads the bars of every symbol from source and merges them in time
+// order, keeping symbols in the given order within each timestamp
+func Load(source Source, symbols []string, start, end time.Time) ([]strategy.Bar, error) {
+	var bars []strategy.Bar
+	for _, symbol := range symbols {
+		symbolBars, err := source.Bars(symbol, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("load %s bars: %w", symbol, err)
+		}
+		if len(symbolBars) == 0 {
+			return nil, fmt.Errorf("no %s bars between %s and %s", symbol, start.Format(time.RFC3339), end.Format(time.RFC3339))
+		}
+		for _, bar := range symbolBars {
+			bars = append(bars, strategy.Bar{Symbol: symbol, Bar: bar})
+		}
+	}
+
+	sort.SliceStable(bars, func(i, j int) bool { return bars[i].Timestamp.Before(bars[j].Timestamp) })
+	return bars, nil
+}
+
+// LoadCSV reads bars from CSV with a header row. Columns are matched by name:
+// timestamp (or time, date, t), open, high, low, close, volume and the
+// optional trade_count and vwap. Timestamps are RFC3339 or YYYY-MM-DD, with
+// bare dates taken as midnight in New York like Alpaca's daily bars.
+func LoadCSV(r io.Reader) ([]marketdata.Bar, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for field, names := range csvColumns {
+			for _, n := range names {
+				if n == name {
+					columns[field] = i
+				}
+			}
+		}
+	}
+	for _, field := range []string{"timestamp", "open", "high", "low", "close"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("missing %s column", field)
+		}
+	}
+
+	var bars []marketdata.Bar
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bar, err := parseCSVBar(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		bars = append(bars, bar)
+	}
+
+	sort.SliceStable(bars, func(i, j int) bool { return bars[i].Timestamp.Before(bars[j].Timestamp) })
+	return bars, nil
+}
+
+func parseCSVBar(record []string, columns map[string]int) (marketdata.Bar, error) {
+	value := func(field string) (string, bool) {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return "", false
+		}
+		s := strings.TrimSpace(record[i])
+		return s, s != ""
+	}
+	number := func(field string, dst *float64) error {
+		s, ok := value(field)
+		if !ok {
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%s %q is not a number", field, s)
+		}
+		*dst = f
+		return nil
+	}
+
+	var bar marketdata.Bar
+	s, _ := value("timestamp")
+	timestamp, err := parseBarTime(s)
+	if err != nil {
+		return bar, err
+	}
+	bar.Timestamp = timestamp
+
+	var volume, tradeCount float64
+	for field, dst := range map[string]*float64{
+		"open":        &bar.Open,
+		"high":        &bar.High,
+		"low":         &bar.Low,
+		"close":       &bar.Close,
+		"vwap":        &bar.VWAP,
+		"volume":      &volume,
+		"trade_count": &tradeCount,
+	} {
+		if err := number(field, dst); err != nil {
+			return bar, err
+		}
+	}
+	bar.Volume = uint64(volume)
+	bar.TradeCount = uint64(tradeCount)
+
+	if bar.Open <= 0 || bar.High <= 0 || bar.Low <= 0 || bar.Close <= 0 {
+		return bar, errors.New("prices must be greater than zero")
+	}
+	if bar.Low > bar.High {
+		return bar, errors.New("low is above high")
+	}
+	return bar, nil
+}
+
+// parseBarTime parses an RFC3339 timestamp or a YYYY-MM-DD date
+func parseBarTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, utils.NewYork); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q must be RFC3339 or YYYY-MM-DD", s)
+}
+
+// LoadFile reads a CSV bar file
+func LoadFile(path string) ([]marketdata.Bar, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return nil, fmt.Errorf("bar file %s must be .csv", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bars, err := LoadCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bars, nil
+}
+
+// FileSource reads bars from CSV files named after the symbol in Dir, such as
+// AAPL_1Day.csv or AAPL.csv
+type FileSource struct {
+	Dir string
+	// Timeframe picks SYMBOL_<Timeframe> files over plain SYMBOL files
+	Timeframe string
+}
+
+// Bars returns the bars of the symbol's file between start and end
+func (s FileSource) Bars(symbol string, start, end time.Time) ([]marketdata.Bar, error) {
+	var names []string
+	if s.Timeframe != "" {
+		names = append(names, symbol+"_"+s.Timeframe)
+	}
+	names = append(names, symbol)
+
+	for _, name := range names {
+		path := filepath.Join(s.Dir, name+".csv")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		bars, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return between(bars, start, end), nil
+	}
+	return nil, fmt.Errorf("no bar file for %s in %s", symbol, s.Dir)
+}
+
+// CacheSource fetches bars through internal/marketdata and keeps each
+// response in Dir, so later runs over the same range need no network. Only
+// ranges ending before today in New York are kept, since bars of a session
+// still trading would otherwise be served incomplete forever.
+type CacheSource struct {
+	Dir        string
+	Timeframe  string
+	Adjustment marketdata.Adjustment
+	Feed       marketdata.Feed
+}
+
+// Bars returns the cached bars for the range, fetching them on a miss
+func (s CacheSource) Bars(symbol string, start, end time.Time) ([]marketdata.Bar, error) {
+	path := filepath.Join(s.Dir, fmt.Sprintf("%s_%s_%s_%s_%s_%s.json",
+		symbol, s.Timeframe, s.Adjustment, s.Feed, start.UTC().Format("20060102T150405Z"), end.UTC().Format("20060102T150405Z")))
+
+	if data, err := os.ReadFile(path); err == nil {
+		var bars []marketdata.Bar
+		if err := json.Unmarshal(data, &bars); err != nil {
+			return nil, fmt.Errorf("read cached bars %s: %w", path, err)
+		}
+		return bars, nil
+	}
+
+	timeframe, err := internalmd.ParseTimeFrame(s.Timeframe)
+	if err != nil {
+		return nil, err
+	}
+	bars, err := internalmd.GetStockBars(symbol, timeframe, start, end, s.Adjustment, s.Feed, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bars) > 0 && complete(end, time.Now()) {
+		if err := writeCache(path, bars); err != nil {
+			return nil, err
+		}
+	}
+	return bars, nil
+}
+
+// complete reports whether every session of a range ending at end was over
+// by now, which is the case once end is no later than midnight in New York
+func complete(end, now time.Time) bool {
+	now = now.In(utils.NewYork)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return !end.After(today)
+}
+
+// writeCache writes bars to path through a temporary file, so an interrupted
+// write never leaves a truncated cache entry
+func writeCache(path string, bars []marketdata.Bar) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create bar cache: %w", err)
+	}
+	data, err := json.Marshal(bars)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write bar cache: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// between returns the bars from start up to but not including end. A zero
+// time leaves that side open.
+func between(bars []marketdata.Bar, start, end time.Time) []marketdata.Bar {
+	var in []marketdata.Bar
+	for _, bar := range bars {
+		if (!start.IsZero() && bar.Timestamp.Before(start)) || (!end.IsZero() && !bar.Timestamp.Before(end)) {
+			continue
+		}
+		in = append(in, bar)
+	}
+	return in
+}
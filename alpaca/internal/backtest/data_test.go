@@ -0,0 +1,62 @@
+package backtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"AAPL_1Day.csv": "date,open,high,low,close\n2024-01-02,100,101,99,100\n2024-01-03,101,102,100,101\n",
+		"AAPL.csv":      "date,open,high,low,close\n2024-01-02,1,1,1,1\n",
+		"MSFT.csv":      "date,open,high,low,close\n2024-01-02,400,401,399,400\n",
+		"SPY.parquet":   "PAR1",
+		"BAD.csv":       "date,open,high,low,close\n2024-01-02,100,99,101,100\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := FileSource{Dir: dir, Timeframe: "1Day"}
+	start, end := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		symbol    string
+		wantBars  int
+		wantClose float64
+		wantErr   string
+	}{
+		{name: "timeframe file preferred", symbol: "AAPL", wantBars: 2, wantClose: 100},
+		{name: "plain file", symbol: "MSFT", wantBars: 1, wantClose: 400},
+		{name: "parquet files are not read", symbol: "SPY", wantErr: "no bar file for SPY"},
+		{name: "invalid bar", symbol: "BAD", wantErr: "low is above high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bars, err := source.Bars(tt.symbol, start, end)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Bars() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bars() error = %v", err)
+			}
+			if len(bars) != tt.wantBars || bars[0].Close != tt.wantClose {
+				t.Errorf("Bars() = %+v, want %d bars opening with a close of %v", bars, tt.wantBars, tt.wantClose)
+			}
+		})
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "SPY.parquet")); err == nil || !strings.Contains(err.Error(), "must be .csv") {
+		t.Errorf("LoadFile() of a parquet file error = %v, want %q", err, "must be .csv")
+	}
+}
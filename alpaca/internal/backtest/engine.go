@@ -0,0 +1,663 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+// orderStatusRejected marks orders that could not be filled
+const orderStatusRejected = "rejected"
+
+// basisPoints is the number of basis points in a whole
+var basisPoints = decimal.NewFromInt(10000)
+
+// Commission is charged on every fill
+type Commission struct {
+	PerShare decimal.Decimal `json:"per_share"`
+	PerOrder decimal.Decimal `json:"per_order"`
+	// Percent of the fill's notional value
+	Percent decimal.Decimal `json:"percent"`
+}
+
+func (c Commission) on(qty, price decimal.Decimal) decimal.Decimal {
+	percent := qty.Mul(price).Mul(c.Percent).Div(decimal.NewFromInt(100))
+	return c.PerOrder.Add(c.PerShare.Mul(qty)).Add(percent)
+}
+
+// Config configures a backtest
+type Config struct {
+	StartingCash decimal.Decimal `json:"starting_cash"`
+	// SlippageBps moves the price of market and stop fills against the order
+	// by this many basis points. Limit fills get their limit price or better.
+	SlippageBps decimal.Decimal `json:"slippage_bps"`
+	Commission  Commission      `json:"commission"`
+	// Calendar holds the trading sessions. When set, bars outside them are
+	// skipped: intraday bars must start between a session's open and close,
+	// which honours early closes, and daily bars must fall on a trading day.
+	// Without it every bar is replayed.
+	Calendar []alpaca.CalendarDay `json:"-"`
+}
+
+// EquityPoint is the value of the account after the bars at Time
+type EquityPoint struct {
+	Time        time.Time       `json:"time"`
+	Equity      decimal.Decimal `json:"equity"`
+	Cash        decimal.Decimal `json:"cash"`
+	MarketValue decimal.Decimal `json:"market_value"`
+}
+
+// Fill is an execution of an order
+type Fill struct {
+	Time       time.Time       `json:"time"`
+	OrderID    string          `json:"order_id"`
+	Symbol     string          `json:"symbol"`
+	Side       alpaca.Side     `json:"side"`
+	Qty        decimal.Decimal `json:"qty"`
+	Price      decimal.Decimal `json:"price"`
+	Commission decimal.Decimal `json:"commission"`
+	// Slippage is what the fill cost over the price before slippage
+	Slippage decimal.Decimal `json:"slippage"`
+}
+
+// Trade is a round trip: shares bought and later sold, matched first in
+// first out. Commissions of both fills are included in the P&L.
+type Trade struct {
+	Symbol     string          `json:"symbol"`
+	Qty        decimal.Decimal `json:"qty"`
+	EntryTime  time.Time       `json:"entry_time"`
+	EntryPrice decimal.Decimal `json:"entry_price"`
+	ExitTime   time.Time       `json:"exit_time"`
+	ExitPrice  decimal.Decimal `json:"exit_price"`
+	PnL        decimal.Decimal `json:"pnl"`
+	// ReturnPercent is the P&L as a percentage of the entry cost
+	ReturnPercent float64 `json:"return_percent"`
+}
+
+// Rejection is an order the simulated broker refused when it came to fill it
+type Rejection struct {
+	Time    time.Time `json:"time"`
+	OrderID string    `json:"order_id"`
+	Symbol  string    `json:"symbol"`
+	Reason  string    `json:"reason"`
+}
+
+// Result is the outcome of a backtest
+type Result struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Bars counts the bars replayed and SkippedBars those outside the
+	// market's sessions
+	Bars        int                        `json:"bars"`
+	SkippedBars int                        `json:"skipped_bars"`
+	Summary     Summary                    `json:"summary"`
+	Equity      []EquityPoint              `json:"equity"`
+	Fills       []Fill                     `json:"fills"`
+	Trades      []Trade                    `json:"trades"`
+	Rejections  []Rejection                `json:"rejections"`
+	Orders      []alpaca.Order             `json:"orders"`
+	Positions   map[string]decimal.Decimal `json:"positions"`
+}
+
+// lot is shares bought by one fill that are still held
+type lot struct {
+	time  time.Time
+	qty   decimal.Decimal
+	price decimal.Decimal
+	// cost is the commission per share paid to buy the lot
+	cost decimal.Decimal
+}
+
+// simOrder is an order working in the backtest
+type simOrder struct {
+	order  alpaca.Order
+	placed time.Time
+	// session is the trading day a day order is valid for. Orders placed on
+	// a daily bar, after its session, are valid for the next session seen.
+	session string
+}
+
+// engine replays bars through a strategy and is the strategy's Context
+type engine struct {
+	strat    strategy.Strategy
+	cfg      Config
+	sessions sessions
+	now      time.Time
+	day      string
+	nextID   int
+
+	cash      decimal.Decimal
+	positions map[string]decimal.Decimal
+	lots      map[string][]lot
+	prices    map[string]decimal.Decimal
+	orders    []*simOrder
+
+	result *Result
+}
+
+// Replay runs bars, which must be in time order, through strat. The strategy
+// sees each bar once all orders working from earlier bars have had the chance
+// to fill against it, so it never trades on a price it has not seen.
+// Market orders fill at the next bar's open.
+func Replay(ctx context.Context, strat strategy.Strategy, bars []strategy.Bar, cfg Config) (*Result, error) {
+	if !cfg.StartingCash.IsPositive() {
+		return nil, errors.New("starting cash must be greater than zero")
+	}
+	if cfg.SlippageBps.IsNegative() {
+		return nil, errors.New("slippage must not be negative")
+	}
+	if cfg.Commission.PerShare.IsNegative() || cfg.Commission.PerOrder.IsNegative() || cfg.Commission.Percent.IsNegative() {
+		return nil, errors.New("commission must not be negative")
+	}
+	sessions, err := newSessions(cfg.Calendar)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &engine{
+		strat:     strat,
+		cfg:       cfg,
+		sessions:  sessions,
+		cash:      cfg.StartingCash,
+		positions: make(map[string]decimal.Decimal),
+		lots:      make(map[string][]lot),
+		prices:    make(map[string]decimal.Decimal),
+		result: &Result{
+			Equity:     []EquityPoint{},
+			Fills:      []Fill{},
+			Trades:     []Trade{},
+			Rejections: []Rejection{},
+			Positions:  make(map[string]decimal.Decimal),
+		},
+	}
+
+	if len(bars) > 0 {
+		e.now = bars[0].Timestamp
+	}
+	if err := strat.OnStart(e); err != nil {
+		return nil, fmt.Errorf("strategy failed to start: %w", err)
+	}
+
+	for i := 0; i < len(bars); {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Every bar with the same timestamp is handled as one event
+		j := i + 1
+		for j < len(bars) && bars[j].Timestamp.Equal(bars[i].Timestamp) {
+			j++
+		}
+		group := bars[i:j]
+		i = j
+
+		if sessions != nil && !sessions.contains(group[0].Timestamp) {
+			e.result.SkippedBars += len(group)
+			continue
+		}
+		if err := e.step(group); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := strat.OnStop(e); err != nil {
+		return nil, fmt.Errorf("strategy failed to stop: %w", err)
+	}
+
+	e.finish()
+	return e.result, nil
+}
+
+// step handles the bars of one timestamp
+func (e *engine) step(group []strategy.Bar) error {
+	e.now = group[0].Timestamp
+	if day := tradingDay(e.now); day != e.day {
+		e.day = day
+		e.expireDayOrders()
+	}
+	if e.result.Bars == 0 {
+		e.result.Start = e.now
+	}
+	e.result.End = e.now
+	e.result.Bars += len(group)
+
+	for _, bar := range group {
+		if err := e.fillOrders(bar); err != nil {
+			return err
+		}
+	}
+	for _, bar := range group {
+		e.prices[bar.Symbol] = decimal.NewFromFloat(bar.Close)
+	}
+	for _, bar := range group {
+		if err := e.strat.OnBar(e, bar); err != nil {
+			return fmt.Errorf("strategy failed on %s bar at %s: %w", bar.Symbol, bar.Timestamp.Format(time.RFC3339), err)
+		}
+	}
+
+	marketValue := e.marketValue()
+	e.result.Equity = append(e.result.Equity, EquityPoint{
+		Time:        e.now,
+		Equity:      e.cash.Add(marketValue),
+		Cash:        e.cash,
+		MarketValue: marketValue,
+	})
+	return nil
+}
+
+// finish collects the orders and open positions and summarizes the run
+func (e *engine) finish() {
+	e.result.Orders = make([]alpaca.Order, 0, len(e.orders))
+	for _, o := range e.orders {
+		e.result.Orders = append(e.result.Orders, o.order)
+	}
+	for symbol, qty := range e.positions {
+		if !qty.IsZero() {
+			e.result.Positions[symbol] = qty
+		}
+	}
+	e.result.Summary = summarize(e.cfg.StartingCash, e.result)
+}
+
+// Now is the time of the bars being handled
+func (e *engine) Now() time.Time {
+	return e.now
+}
+
+// Cash is the simulated account's cash
+func (e *engine) Cash() decimal.Decimal {
+	return e.cash
+}
+
+// Equity is cash plus positions valued at their last close
+func (e *engine) Equity() decimal.Decimal {
+	return e.cash.Add(e.marketValue())
+}
+
+// Position is the quantity held of a symbol
+func (e *engine) Position(symbol string) decimal.Decimal {
+	return e.positions[strings.ToUpper(symbol)]
+}
+
+// PlaceOrder accepts a market, limit, stop or stop limit order for a symbol
+// with bars, valid for the day or until cancelled. Sells may not exceed the
+// shares held less those already being sold, as short selling is not
+// simulated.
+func (e *engine) PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error) {
+	if err := trading.ValidateOrder(req); err != nil {
+		return nil, err
+	}
+	symbol := strings.ToUpper(req.Symbol)
+	if _, ok := e.prices[symbol]; !ok {
+		return nil, fmt.Errorf("no %s bars have been replayed yet", symbol)
+	}
+	if req.OrderClass != "" && req.OrderClass != alpaca.Simple {
+		return nil, fmt.Errorf("%s orders are not supported in backtests", req.OrderClass)
+	}
+	if req.TimeInForce != alpaca.Day && req.TimeInForce != alpaca.GTC {
+		return nil, fmt.Errorf("time in force %q is not supported in backtests, use day or gtc", req.TimeInForce)
+	}
+	if req.Side != alpaca.Buy && req.Side != alpaca.Sell {
+		return nil, fmt.Errorf("invalid side %q", req.Side)
+	}
+	switch req.Type {
+	case alpaca.Market:
+	case alpaca.Limit:
+		if req.LimitPrice == nil {
+			return nil, errors.New("limit orders require a limit price")
+		}
+	case alpaca.Stop:
+		if req.StopPrice == nil {
+			return nil, errors.New("stop orders require a stop price")
+		}
+	case alpaca.StopLimit:
+		if req.LimitPrice == nil || req.StopPrice == nil {
+			return nil, errors.New("stop limit orders require a stop price and a limit price")
+		}
+	default:
+		return nil, fmt.Errorf("%s orders are not supported in backtests", req.Type)
+	}
+	if req.Side == alpaca.Sell && req.Qty != nil && req.Qty.GreaterThan(e.available(symbol)) {
+		return nil, fmt.Errorf("insufficient qty available for %s sell order", symbol)
+	}
+
+	e.nextID++
+	o := &simOrder{
+		placed: e.now,
+		order: alpaca.Order{
+			ID:            fmt.Sprintf("bt-%d", e.nextID),
+			ClientOrderID: req.ClientOrderID,
+			CreatedAt:     e.now,
+			UpdatedAt:     e.now,
+			SubmittedAt:   e.now,
+			Symbol:        symbol,
+			AssetClass:    alpaca.USEquity,
+			OrderClass:    alpaca.Simple,
+			Type:          req.Type,
+			Side:          req.Side,
+			TimeInForce:   req.TimeInForce,
+			Status:        trading.OrderStatusNew,
+			Qty:           req.Qty,
+			Notional:      req.Notional,
+			FilledQty:     decimal.Zero,
+			LimitPrice:    req.LimitPrice,
+			StopPrice:     req.StopPrice,
+		},
+	}
+	if o.order.ClientOrderID == "" {
+		o.order.ClientOrderID = o.order.ID
+	}
+	if !isDaily(e.now) {
+		o.session = e.day
+	}
+	e.orders = append(e.orders, o)
+
+	order := o.order
+	return &order, nil
+}
+
+// CancelOrder cancels a working order
+func (e *engine) CancelOrder(orderID string) error {
+	for _, o := range e.orders {
+		if o.order.ID != orderID {
+			continue
+		}
+		if o.order.Status != trading.OrderStatusNew {
+			return fmt.Errorf("order %s is %s", orderID, o.order.Status)
+		}
+		o.order.Status = trading.OrderStatusCanceled
+		o.order.CanceledAt = timePtr(e.now)
+		o.order.UpdatedAt = e.now
+		return nil
+	}
+	return fmt.Errorf("order %s not found", orderID)
+}
+
+// available is the quantity held of a symbol less what working sells hold
+func (e *engine) available(symbol string) decimal.Decimal {
+	qty := e.positions[symbol]
+	for _, o := range e.orders {
+		if o.order.Symbol == symbol && o.order.Side == alpaca.Sell && o.order.Status == trading.OrderStatusNew && o.order.Qty != nil {
+			qty = qty.Sub(*o.order.Qty)
+		}
+	}
+	return qty
+}
+
+func (e *engine) marketValue() decimal.Decimal {
+	value := decimal.Zero
+	for symbol, qty := range e.positions {
+		value = value.Add(qty.Mul(e.prices[symbol]))
+	}
+	return value
+}
+
+// expireDayOrders expires the day orders of sessions before the current one
+func (e *engine) expireDayOrders() {
+	for _, o := range e.orders {
+		if o.order.Status == trading.OrderStatusNew && o.order.TimeInForce == alpaca.Day && o.session != "" && o.session < e.day {
+			o.order.Status = trading.OrderStatusExpired
+			o.order.ExpiredAt = timePtr(e.now)
+			o.order.UpdatedAt = e.now
+		}
+	}
+}
+
+// fillOrders fills the working orders of the bar's symbol placed before it
+// that the bar's prices reach
+func (e *engine) fillOrders(bar strategy.Bar) error {
+	for _, o := range e.orders {
+		if o.order.Symbol != bar.Symbol || o.order.Status != trading.OrderStatusNew || !o.placed.Before(bar.Timestamp) {
+			continue
+		}
+		if o.session == "" {
+			o.session = e.day
+		}
+
+		price, slipped, ok := executionPrice(o.order, bar)
+		if !ok {
+			continue
+		}
+		if slipped {
+			slip := price.Mul(e.cfg.SlippageBps).Div(basisPoints)
+			if o.order.Side == alpaca.Sell {
+				slip = slip.Neg()
+			}
+			if err := e.fill(o, price.Add(slip), slip.Abs()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := e.fill(o, price, decimal.Zero); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executionPrice is the price an order fills at against a bar before
+// slippage, and whether slippage applies to it
+func executionPrice(o alpaca.Order, bar strategy.Bar) (decimal.Decimal, bool, bool) {
+	open := decimal.NewFromFloat(bar.Open)
+	high := decimal.NewFromFloat(bar.High)
+	low := decimal.NewFromFloat(bar.Low)
+	buy := o.Side == alpaca.Buy
+
+	// limit fills at the limit or better once the bar trades through it
+	limit := func(from decimal.Decimal) (decimal.Decimal, bool) {
+		l := *o.LimitPrice
+		if buy && low.LessThanOrEqual(l) {
+			return decimal.Min(from, l), true
+		}
+		if !buy && high.GreaterThanOrEqual(l) {
+			return decimal.Max(from, l), true
+		}
+		return decimal.Zero, false
+	}
+	// stop triggers once the bar trades through the stop, at the stop or
+	// the open if it gapped past it
+	stop := func() (decimal.Decimal, bool) {
+		s := *o.StopPrice
+		if buy && high.GreaterThanOrEqual(s) {
+			return decimal.Max(open, s), true
+		}
+		if !buy && low.LessThanOrEqual(s) {
+			return decimal.Min(open, s), true
+		}
+		return decimal.Zero, false
+	}
+
+	switch o.Type {
+	case alpaca.Market:
+		return open, true, true
+	case alpaca.Limit:
+		price, ok := limit(open)
+		return price, false, ok
+	case alpaca.Stop:
+		price, ok := stop()
+		return price, true, ok
+	case alpaca.StopLimit:
+		triggered, ok := stop()
+		if !ok {
+			return decimal.Zero, false, false
+		}
+		price, ok := limit(triggered)
+		return price, false, ok
+	}
+	return decimal.Zero, false, false
+}
+
+// fill executes an order in full at price and tells the strategy, or rejects
+// the order when the account cannot pay for it or no longer holds the shares
+func (e *engine) fill(o *simOrder, price, slippage decimal.Decimal) error {
+	symbol := o.order.Symbol
+	qty := decimal.Zero
+	if o.order.Qty != nil {
+		qty = *o.order.Qty
+	} else {
+		qty = o.order.Notional.Div(price).Truncate(9)
+	}
+	commission := e.cfg.Commission.on(qty, price)
+
+	switch {
+	case !qty.IsPositive():
+		e.reject(o, "qty rounds to zero")
+		return nil
+	case o.order.Side == alpaca.Buy && qty.Mul(price).Add(commission).GreaterThan(e.cash):
+		e.reject(o, "insufficient cash")
+		return nil
+	case o.order.Side == alpaca.Sell && qty.GreaterThan(e.positions[symbol]):
+		e.reject(o, "insufficient qty")
+		return nil
+	}
+
+	if o.order.Side == alpaca.Buy {
+		e.cash = e.cash.Sub(qty.Mul(price)).Sub(commission)
+		e.positions[symbol] = e.positions[symbol].Add(qty)
+		e.lots[symbol] = append(e.lots[symbol], lot{time: e.now, qty: qty, price: price, cost: commission.Div(qty)})
+	} else {
+		e.cash = e.cash.Add(qty.Mul(price)).Sub(commission)
+		e.positions[symbol] = e.positions[symbol].Sub(qty)
+		e.closeLots(symbol, qty, price, commission.Div(qty))
+	}
+	slippage = slippage.Mul(qty)
+
+	o.order.Status = trading.OrderStatusFilled
+	o.order.FilledQty = qty
+	o.order.FilledAvgPrice = &price
+	o.order.FilledAt = timePtr(e.now)
+	o.order.UpdatedAt = e.now
+
+	e.result.Fills = append(e.result.Fills, Fill{
+		Time:       e.now,
+		OrderID:    o.order.ID,
+		Symbol:     symbol,
+		Side:       o.order.Side,
+		Qty:        qty,
+		Price:      price,
+		Commission: commission,
+		Slippage:   slippage,
+	})
+
+	err := e.strat.OnFill(e, strategy.Fill{Order: o.order, Price: price, Qty: qty, Time: e.now})
+	if err != nil {
+		return fmt.Errorf("strategy failed on fill of order %s: %w", o.order.ID, err)
+	}
+	return nil
+}
+
+// closeLots sells qty of a symbol's lots first in first out, recording a
+// trade for each lot sold from
+func (e *engine) closeLots(symbol string, qty, price, cost decimal.Decimal) {
+	lots := e.lots[symbol]
+	for qty.IsPositive() && len(lots) > 0 {
+		l := &lots[0]
+		sold := decimal.Min(qty, l.qty)
+
+		entry := sold.Mul(l.price.Add(l.cost))
+		pnl := sold.Mul(price.Sub(cost)).Sub(entry)
+		trade := Trade{
+			Symbol:     symbol,
+			Qty:        sold,
+			EntryTime:  l.time,
+			EntryPrice: l.price,
+			ExitTime:   e.now,
+			ExitPrice:  price,
+			PnL:        pnl.Round(2),
+		}
+		if entry.IsPositive() {
+			trade.ReturnPercent = pnl.Div(entry).Mul(decimal.NewFromInt(100)).InexactFloat64()
+		}
+		e.result.Trades = append(e.result.Trades, trade)
+
+		l.qty = l.qty.Sub(sold)
+		qty = qty.Sub(sold)
+		if l.qty.IsZero() {
+			lots = lots[1:]
+		}
+	}
+	e.lots[symbol] = lots
+}
+
+func (e *engine) reject(o *simOrder, reason string) {
+	o.order.Status = orderStatusRejected
+	o.order.FailedAt = timePtr(e.now)
+	o.order.UpdatedAt = e.now
+	e.result.Rejections = append(e.result.Rejections, Rejection{
+		Time:    e.now,
+		OrderID: o.order.ID,
+		Symbol:  o.order.Symbol,
+		Reason:  reason,
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// sessions are the trading sessions of a calendar by New York date
+type sessions map[string]session
+
+type session struct {
+	open, close time.Time
+}
+
+// newSessions indexes a calendar, returning nil for an empty one
+func newSessions(calendar []alpaca.CalendarDay) (sessions, error) {
+	if len(calendar) == 0 {
+		return nil, nil
+	}
+
+	parse := func(date, clock string) (time.Time, error) {
+		for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05"} {
+			if t, err := time.ParseInLocation(layout, date+" "+clock, utils.NewYork); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid calendar time %q on %s", clock, date)
+	}
+
+	s := make(sessions, len(calendar))
+	for _, day := range calendar {
+		open, err := parse(day.Date, day.Open)
+		if err != nil {
+			return nil, err
+		}
+		close, err := parse(day.Date, day.Close)
+		if err != nil {
+			return nil, err
+		}
+		s[day.Date] = session{open: open, close: close}
+	}
+	return s, nil
+}
+
+// contains reports whether a bar at t falls in a session. Daily bars only
+// need to fall on a trading day.
+func (s sessions) contains(t time.Time) bool {
+	session, ok := s[tradingDay(t)]
+	if !ok {
+		return false
+	}
+	return isDaily(t) || (!t.Before(session.open) && t.Before(session.close))
+}
+
+// tradingDay is the New York date of t
+func tradingDay(t time.Time) string {
+	return t.In(utils.NewYork).Format("2006-01-02")
+}
+
+// isDaily reports whether t stamps a daily bar, which Alpaca stamps at
+// midnight New York time
+func isDaily(t time.Time) bool {
+	ny := t.In(utils.NewYork)
+	return ny.Hour() == 0 && ny.Minute() == 0 && ny.Second() == 0
+}
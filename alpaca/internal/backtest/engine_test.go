@@ -0,0 +1,295 @@
+package backtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func decPtr(s string) *decimal.Decimal {
+	d := dec(s)
+	return &d
+}
+
+// dailyBar is an AAPL bar stamped at midnight New York time like Alpaca's
+// daily bars, on the given day of January 2024
+func dailyBar(day int, open, high, low, close float64) strategy.Bar {
+	return strategy.Bar{Symbol: "AAPL", Bar: marketdata.Bar{
+		Timestamp: time.Date(2024, 1, day, 0, 0, 0, 0, utils.NewYork),
+		Open:      open, High: high, Low: low, Close: close,
+	}}
+}
+
+// scripted places the orders listed for each bar, by the bar's index
+type scripted struct {
+	strategy.Base
+	orders map[int][]alpaca.PlaceOrderRequest
+	bar    int
+	errs   []error
+	fills  int
+}
+
+func (s *scripted) OnBar(ctx strategy.Context, bar strategy.Bar) error {
+	for _, req := range s.orders[s.bar] {
+		if _, err := ctx.PlaceOrder(req); err != nil {
+			s.errs = append(s.errs, err)
+		}
+	}
+	s.bar++
+	return nil
+}
+
+func (s *scripted) OnFill(ctx strategy.Context, fill strategy.Fill) error {
+	s.fills++
+	return nil
+}
+
+func order(side alpaca.Side, typ alpaca.OrderType, qty string, edit func(*alpaca.PlaceOrderRequest)) alpaca.PlaceOrderRequest {
+	req := alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr(qty), Side: side, Type: typ, TimeInForce: alpaca.GTC}
+	if edit != nil {
+		edit(&req)
+	}
+	return req
+}
+
+func TestExecutionPrice(t *testing.T) {
+	bar := dailyBar(2, 100, 105, 95, 102)
+	limit := func(price string) func(*alpaca.Order) { return func(o *alpaca.Order) { o.LimitPrice = decPtr(price) } }
+	stop := func(price string) func(*alpaca.Order) { return func(o *alpaca.Order) { o.StopPrice = decPtr(price) } }
+
+	tests := []struct {
+		name        string
+		side        alpaca.Side
+		typ         alpaca.OrderType
+		prices      []func(*alpaca.Order)
+		wantPrice   string
+		wantSlipped bool
+		wantOK      bool
+	}{
+		{name: "market buy fills at the open", side: alpaca.Buy, typ: alpaca.Market, wantPrice: "100", wantSlipped: true, wantOK: true},
+		{name: "buy limit below the open fills at the limit", side: alpaca.Buy, typ: alpaca.Limit, prices: []func(*alpaca.Order){limit("97")}, wantPrice: "97", wantOK: true},
+		{name: "buy limit above the open fills at the open", side: alpaca.Buy, typ: alpaca.Limit, prices: []func(*alpaca.Order){limit("101")}, wantPrice: "100", wantOK: true},
+		{name: "buy limit below the low does not fill", side: alpaca.Buy, typ: alpaca.Limit, prices: []func(*alpaca.Order){limit("94")}},
+		{name: "sell limit above the open fills at the limit", side: alpaca.Sell, typ: alpaca.Limit, prices: []func(*alpaca.Order){limit("104")}, wantPrice: "104", wantOK: true},
+		{name: "buy stop triggers at the stop", side: alpaca.Buy, typ: alpaca.Stop, prices: []func(*alpaca.Order){stop("103")}, wantPrice: "103", wantSlipped: true, wantOK: true},
+		{name: "buy stop gapped through fills at the open", side: alpaca.Buy, typ: alpaca.Stop, prices: []func(*alpaca.Order){stop("98")}, wantPrice: "100", wantSlipped: true, wantOK: true},
+		{name: "sell stop above the low triggers at the stop", side: alpaca.Sell, typ: alpaca.Stop, prices: []func(*alpaca.Order){stop("96")}, wantPrice: "96", wantSlipped: true, wantOK: true},
+		{name: "sell stop below the low does not trigger", side: alpaca.Sell, typ: alpaca.Stop, prices: []func(*alpaca.Order){stop("90")}},
+		{name: "buy stop limit fills at the limit once triggered", side: alpaca.Buy, typ: alpaca.StopLimit, prices: []func(*alpaca.Order){stop("103"), limit("102")}, wantPrice: "102", wantOK: true},
+		{name: "buy stop limit not triggered", side: alpaca.Buy, typ: alpaca.StopLimit, prices: []func(*alpaca.Order){stop("106"), limit("107")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := alpaca.Order{Side: tt.side, Type: tt.typ}
+			for _, set := range tt.prices {
+				set(&o)
+			}
+
+			price, slipped, ok := executionPrice(o, bar)
+			if ok != tt.wantOK {
+				t.Fatalf("filled = %t, want %t", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !price.Equal(dec(tt.wantPrice)) || slipped != tt.wantSlipped {
+				t.Errorf("executionPrice() = %s, slipped %t, want %s, slipped %t", price, slipped, tt.wantPrice, tt.wantSlipped)
+			}
+		})
+	}
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	bars := []strategy.Bar{
+		dailyBar(2, 100, 101, 99, 100),
+		dailyBar(3, 102, 103, 101, 102),
+		dailyBar(4, 104, 105, 103, 104),
+		dailyBar(5, 106, 107, 105, 106),
+	}
+	strat := &scripted{orders: map[int][]alpaca.PlaceOrderRequest{
+		0: {order(alpaca.Buy, alpaca.Market, "10", nil)},
+		2: {order(alpaca.Sell, alpaca.Market, "10", nil)},
+	}}
+	cfg := Config{StartingCash: dec("10000"), SlippageBps: dec("10"), Commission: Commission{PerOrder: dec("1")}}
+
+	result, err := Replay(context.Background(), strat, bars, cfg)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(strat.errs) > 0 || strat.fills != 2 {
+		t.Fatalf("strategy saw errors %v and %d fills, want none and 2", strat.errs, strat.fills)
+	}
+
+	// Market orders fill at the next open moved 10bps against them
+	if len(result.Fills) != 2 || !result.Fills[0].Price.Equal(dec("102.102")) || !result.Fills[1].Price.Equal(dec("105.894")) {
+		t.Fatalf("fills = %+v, want a buy at 102.102 and a sell at 105.894", result.Fills)
+	}
+	if len(result.Trades) != 1 || !result.Trades[0].PnL.Equal(dec("35.92")) {
+		t.Errorf("trades = %+v, want one round trip making 35.92 after commission", result.Trades)
+	}
+
+	summary := result.Summary
+	if !summary.EndingEquity.Equal(dec("10035.92")) {
+		t.Errorf("ending equity = %s, want 10035.92", summary.EndingEquity)
+	}
+	if !summary.TotalCommission.Equal(dec("2")) || !summary.TotalSlippage.Equal(dec("2.08")) {
+		t.Errorf("commission = %s, slippage = %s, want 2 and 2.08", summary.TotalCommission, summary.TotalSlippage)
+	}
+	if summary.Trades != 1 || summary.WinRate != 1 {
+		t.Errorf("trades = %d, win rate = %v, want 1 winning trade", summary.Trades, summary.WinRate)
+	}
+	if len(result.Equity) != 4 || len(result.Positions) != 0 {
+		t.Errorf("%d equity points and positions %v, want 4 points and no positions", len(result.Equity), result.Positions)
+	}
+}
+
+func TestReplayOrders(t *testing.T) {
+	bars := []strategy.Bar{
+		dailyBar(2, 100, 101, 99, 100),
+		dailyBar(3, 100, 101, 99, 100),
+		dailyBar(4, 100, 101, 99, 100),
+	}
+	day := func(r *alpaca.PlaceOrderRequest) { r.TimeInForce = alpaca.Day; r.LimitPrice = decPtr("90") }
+	gtc := func(r *alpaca.PlaceOrderRequest) { r.LimitPrice = decPtr("90") }
+
+	tests := []struct {
+		name       string
+		orders     map[int][]alpaca.PlaceOrderRequest
+		wantStatus string
+		wantErr    string
+		wantReason string
+	}{
+		{
+			name:       "gtc limit that never fills stays working",
+			orders:     map[int][]alpaca.PlaceOrderRequest{0: {order(alpaca.Buy, alpaca.Limit, "1", gtc)}},
+			wantStatus: "new",
+		},
+		{
+			name:       "day limit expires after its session",
+			orders:     map[int][]alpaca.PlaceOrderRequest{0: {order(alpaca.Buy, alpaca.Limit, "1", day)}},
+			wantStatus: "expired",
+		},
+		{
+			name:       "buy beyond the cash is rejected at the fill",
+			orders:     map[int][]alpaca.PlaceOrderRequest{0: {order(alpaca.Buy, alpaca.Market, "1000", nil)}},
+			wantStatus: orderStatusRejected,
+			wantReason: "insufficient cash",
+		},
+		{
+			name:    "sell without a position",
+			orders:  map[int][]alpaca.PlaceOrderRequest{0: {order(alpaca.Sell, alpaca.Market, "1", nil)}},
+			wantErr: "insufficient qty available",
+		},
+		{
+			name:    "ioc",
+			orders:  map[int][]alpaca.PlaceOrderRequest{0: {order(alpaca.Buy, alpaca.Market, "1", func(r *alpaca.PlaceOrderRequest) { r.TimeInForce = alpaca.IOC })}},
+			wantErr: "not supported in backtests",
+		},
+		{
+			name:    "trailing stop",
+			orders:  map[int][]alpaca.PlaceOrderRequest{0: {order(alpaca.Sell, alpaca.TrailingStop, "1", func(r *alpaca.PlaceOrderRequest) { r.TrailPercent = decPtr("5") })}},
+			wantErr: "trailing_stop orders are not supported in backtests",
+		},
+		{
+			name:    "symbol without bars",
+			orders:  map[int][]alpaca.PlaceOrderRequest{0: {order(alpaca.Buy, alpaca.Market, "1", func(r *alpaca.PlaceOrderRequest) { r.Symbol = "MSFT" })}},
+			wantErr: "no MSFT bars have been replayed yet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strat := &scripted{orders: tt.orders}
+			result, err := Replay(context.Background(), strat, bars, Config{StartingCash: dec("10000")})
+			if err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+
+			if tt.wantErr != "" {
+				if len(strat.errs) != 1 || !strings.Contains(strat.errs[0].Error(), tt.wantErr) {
+					t.Fatalf("PlaceOrder() errors = %v, want %q", strat.errs, tt.wantErr)
+				}
+				return
+			}
+			if len(result.Orders) != 1 || result.Orders[0].Status != tt.wantStatus {
+				t.Fatalf("orders = %+v, want one %s order", result.Orders, tt.wantStatus)
+			}
+			if tt.wantReason != "" && (len(result.Rejections) != 1 || result.Rejections[0].Reason != tt.wantReason) {
+				t.Errorf("rejections = %+v, want %q", result.Rejections, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReplayCalendar(t *testing.T) {
+	at := func(day, hour, minute int) strategy.Bar {
+		return strategy.Bar{Symbol: "AAPL", Bar: marketdata.Bar{
+			Timestamp: time.Date(2024, 11, day, hour, minute, 0, 0, utils.NewYork),
+			Open:      100, High: 100, Low: 100, Close: 100,
+		}}
+	}
+	// Thanksgiving on the 28th is a holiday and the 29th closes early
+	calendar := []alpaca.CalendarDay{
+		{Date: "2024-11-27", Open: "09:30", Close: "16:00"},
+		{Date: "2024-11-29", Open: "09:30", Close: "13:00"},
+	}
+
+	tests := []struct {
+		name        string
+		bars        []strategy.Bar
+		wantBars    int
+		wantSkipped int
+	}{
+		{name: "regular session", bars: []strategy.Bar{at(27, 9, 30), at(27, 15, 59)}, wantBars: 2},
+		{name: "before the open and at the close", bars: []strategy.Bar{at(27, 9, 29), at(27, 16, 0)}, wantSkipped: 2},
+		{name: "holiday", bars: []strategy.Bar{at(28, 10, 0), at(28, 0, 0)}, wantSkipped: 2},
+		{name: "after an early close", bars: []strategy.Bar{at(29, 12, 59), at(29, 13, 0), at(29, 15, 0)}, wantBars: 1, wantSkipped: 2},
+		{name: "daily bars on trading days", bars: []strategy.Bar{at(27, 0, 0), at(28, 0, 0), at(29, 0, 0)}, wantBars: 2, wantSkipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Replay(context.Background(), &scripted{}, tt.bars, Config{StartingCash: dec("1000"), Calendar: calendar})
+			if err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+			if result.Bars != tt.wantBars || result.SkippedBars != tt.wantSkipped {
+				t.Errorf("replayed %d and skipped %d bars, want %d and %d", result.Bars, result.SkippedBars, tt.wantBars, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestReplayConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "no cash", cfg: Config{}, wantErr: "starting cash must be greater than zero"},
+		{name: "negative slippage", cfg: Config{StartingCash: dec("1"), SlippageBps: dec("-1")}, wantErr: "slippage must not be negative"},
+		{name: "negative commission", cfg: Config{StartingCash: dec("1"), Commission: Commission{PerShare: dec("-0.01")}}, wantErr: "commission must not be negative"},
+		{name: "bad calendar", cfg: Config{StartingCash: dec("1"), Calendar: []alpaca.CalendarDay{{Date: "2024-01-02", Open: "9am", Close: "16:00"}}}, wantErr: `invalid calendar time "9am"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Replay(context.Background(), &scripted{}, nil, tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Replay() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
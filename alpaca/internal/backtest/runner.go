@@ -0,0 +1,392 @@
+package backtest
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	internalmd "github.com/nathgoh/investment-trader/alpaca/internal/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/strategy"
+	"github.com/shopspring/decimal"
+)
+
+// Bar sources a request can replay
+const (
+	// SourceMarketData fetches bars through internal/marketdata, caching them
+	SourceMarketData = "marketdata"
+	// SourceFile reads bars from CSV files in the data directory
+	SourceFile = "file"
+)
+
+// Run states
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// maxRuns is how many runs are kept; the oldest finished ones are dropped
+const maxRuns = 100
+
+// ErrQueueFull is returned by Submit when MaxQueued runs are already waiting
+var ErrQueueFull = errors.New("too many backtests are waiting to run, try again later")
+
+// symbolPattern is what a symbol must look like. Symbols name bar files, so
+// anything that could leave the data or cache directory is refused.
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9.]*$`)
+
+// Request describes a backtest to run
+type Request struct {
+	Strategy string          `json:"strategy"`
+	Params   strategy.Params `json:"params,omitempty"`
+	Symbols  []string        `json:"symbols"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	// Timeframe is the bar size: 1Min, 5Min, 15Min, 1Hour or 1Day
+	Timeframe  string `json:"timeframe"`
+	Adjustment string `json:"adjustment,omitempty"`
+	Feed       string `json:"feed,omitempty"`
+	// Source is SourceMarketData or SourceFile
+	Source       string          `json:"source"`
+	StartingCash decimal.Decimal `json:"starting_cash"`
+	SlippageBps  decimal.Decimal `json:"slippage_bps"`
+	Commission   Commission      `json:"commission"`
+	// MarketHours skips bars outside the market calendar's sessions
+	// (default true)
+	MarketHours *bool `json:"market_hours"`
+}
+
+// Run is a backtest submitted to a Runner
+type Run struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Request     Request    `json:"request"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	// Summary is set once the run completes. Result, with the equity curve
+	// and trades, is only included when a single run is fetched.
+	Summary *Summary `json:"summary,omitempty"`
+	Result  *Result  `json:"result,omitempty"`
+}
+
+// RunnerOptions configure where a Runner finds bars and the calendar
+type RunnerOptions struct {
+	// DataDir holds the CSV files of SourceFile
+	DataDir string
+	// CacheDir keeps the bars fetched for SourceMarketData
+	CacheDir string
+	// Calendar returns the market sessions between two dates
+	Calendar func(start, end time.Time) ([]alpaca.CalendarDay, error)
+	// MaxConcurrent limits the runs replayed at once (default 2)
+	MaxConcurrent int
+	// MaxQueued limits the runs waiting for a slot (default 20)
+	MaxQueued int
+}
+
+// Runner runs backtests in the background and keeps the most recent ones
+type Runner struct {
+	opts  RunnerOptions
+	slots chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.RWMutex
+	runs  map[string]*Run
+	order []string
+}
+
+// NewRunner creates a runner with no runs
+func NewRunner(opts RunnerOptions) *Runner {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 2
+	}
+	if opts.MaxQueued <= 0 {
+		opts.MaxQueued = 20
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		opts:   opts,
+		slots:  make(chan struct{}, opts.MaxConcurrent),
+		ctx:    ctx,
+		cancel: cancel,
+		runs:   make(map[string]*Run),
+	}
+}
+
+// Submit validates a request and queues it, returning the queued run. It
+// returns ErrQueueFull when the queue is full.
+func (r *Runner) Submit(req Request) (Run, error) {
+	req, err := r.normalize(req)
+	if err != nil {
+		return Run{}, err
+	}
+	strat, err := strategy.New(req.Strategy, req.Params)
+	if err != nil {
+		return Run{}, err
+	}
+	if r.ctx.Err() != nil {
+		return Run{}, errors.New("backtest runner is stopped")
+	}
+
+	run := &Run{
+		ID:          newRunID(),
+		Status:      StatusQueued,
+		Request:     req,
+		SubmittedAt: time.Now(),
+	}
+	r.mu.Lock()
+	queued := 0
+	for _, existing := range r.runs {
+		if existing.Status == StatusQueued {
+			queued++
+		}
+	}
+	if queued >= r.opts.MaxQueued {
+		r.mu.Unlock()
+		return Run{}, ErrQueueFull
+	}
+	r.runs[run.ID] = run
+	r.order = append(r.order, run.ID)
+	r.prune()
+	// Copy the run before it starts, as it is then only read under r.mu
+	view := r.view(run, false)
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.execute(run, strat)
+	}()
+
+	return view, nil
+}
+
+// Get returns a run with its full result
+func (r *Runner) Get(id string) (Run, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	run, ok := r.runs[id]
+	if !ok {
+		return Run{}, fmt.Errorf("backtest %s not found", id)
+	}
+	return r.view(run, true), nil
+}
+
+// List returns every kept run, newest first, without results
+func (r *Runner) List() []Run {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	runs := make([]Run, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		runs = append(runs, r.view(r.runs[r.order[i]], false))
+	}
+	return runs
+}
+
+// Stop cancels the runs in progress and waits for them to finish
+func (r *Runner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Execute runs a request synchronously, for callers of the Go API
+func (r *Runner) Execute(ctx context.Context, req Request) (*Result, error) {
+	req, err := r.normalize(req)
+	if err != nil {
+		return nil, err
+	}
+	strat, err := strategy.New(req.Strategy, req.Params)
+	if err != nil {
+		return nil, err
+	}
+	return r.run(ctx, req, strat)
+}
+
+// normalize fills in defaults and checks a request
+func (r *Runner) normalize(req Request) (Request, error) {
+	if req.Strategy == "" {
+		return req, errors.New("strategy is required")
+	}
+	symbols := make([]string, 0, len(req.Symbols))
+	seen := make(map[string]bool)
+	for _, s := range req.Symbols {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		if !symbolPattern.MatchString(s) {
+			return req, fmt.Errorf("invalid symbol %q, must be letters, digits and dots", s)
+		}
+		seen[s] = true
+		symbols = append(symbols, s)
+	}
+	if len(symbols) == 0 {
+		return req, errors.New("at least one symbol is required")
+	}
+	req.Symbols = symbols
+
+	if req.Start.IsZero() || req.End.IsZero() {
+		return req, errors.New("start and end are required")
+	}
+	if !req.End.After(req.Start) {
+		return req, errors.New("end must be after start")
+	}
+
+	if req.Timeframe == "" {
+		req.Timeframe = "1Day"
+	}
+	if _, err := internalmd.ParseTimeFrame(req.Timeframe); err != nil {
+		return req, err
+	}
+	if req.Adjustment == "" {
+		req.Adjustment = string(marketdata.All)
+	}
+	if _, err := internalmd.ParseAdjustment(req.Adjustment); err != nil {
+		return req, err
+	}
+	if req.Feed != "" {
+		if _, err := internalmd.ParseFeed(req.Feed); err != nil {
+			return req, err
+		}
+	}
+
+	switch req.Source {
+	case "":
+		req.Source = SourceMarketData
+	case SourceMarketData, SourceFile:
+	default:
+		return req, fmt.Errorf("invalid source %q, must be %q or %q", req.Source, SourceMarketData, SourceFile)
+	}
+	if req.Source == SourceFile && r.opts.DataDir == "" {
+		return req, errors.New("no backtest data directory is configured")
+	}
+
+	if req.MarketHours == nil {
+		marketHours := true
+		req.MarketHours = &marketHours
+	}
+	if req.StartingCash.IsZero() {
+		req.StartingCash = decimal.NewFromInt(100000)
+	}
+	return req, nil
+}
+
+// execute replays a queued run once a slot is free
+func (r *Runner) execute(run *Run, strat strategy.Strategy) {
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-r.ctx.Done():
+		r.finish(run, nil, r.ctx.Err())
+		return
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	run.Status = StatusRunning
+	run.StartedAt = &now
+	r.mu.Unlock()
+
+	result, err := r.run(r.ctx, run.Request, strat)
+	r.finish(run, result, err)
+}
+
+// run loads a request's bars and calendar and replays them
+func (r *Runner) run(ctx context.Context, req Request, strat strategy.Strategy) (*Result, error) {
+	var source Source = FileSource{Dir: r.opts.DataDir, Timeframe: req.Timeframe}
+	if req.Source == SourceMarketData {
+		source = CacheSource{
+			Dir:        r.opts.CacheDir,
+			Timeframe:  req.Timeframe,
+			Adjustment: marketdata.Adjustment(req.Adjustment),
+			Feed:       req.Feed,
+		}
+	}
+	bars, err := Load(source, req.Symbols, req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Config{
+		StartingCash: req.StartingCash,
+		SlippageBps:  req.SlippageBps,
+		Commission:   req.Commission,
+	}
+	if *req.MarketHours {
+		if r.opts.Calendar == nil {
+			return nil, errors.New("no market calendar is available")
+		}
+		cfg.Calendar, err = r.opts.Calendar(req.Start, req.End)
+		if err != nil {
+			return nil, fmt.Errorf("load market calendar: %w", err)
+		}
+	}
+
+	return Replay(ctx, strat, bars, cfg)
+}
+
+func (r *Runner) finish(run *Run, result *Result, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	run.FinishedAt = &now
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Status = StatusCanceled
+		run.Error = "the server stopped before the backtest finished"
+	case err != nil:
+		run.Status = StatusFailed
+		run.Error = err.Error()
+	default:
+		run.Status = StatusCompleted
+		run.Result = result
+	}
+}
+
+// view copies a run for callers, with or without its result
+func (r *Runner) view(run *Run, withResult bool) Run {
+	v := *run
+	if run.Result != nil {
+		summary := run.Result.Summary
+		v.Summary = &summary
+	}
+	if !withResult {
+		v.Result = nil
+	}
+	return v
+}
+
+// prune drops the oldest finished runs beyond maxRuns
+func (r *Runner) prune() {
+	for i := 0; len(r.order) > maxRuns && i < len(r.order); {
+		run := r.runs[r.order[i]]
+		if run.Status == StatusQueued || run.Status == StatusRunning {
+			i++
+			continue
+		}
+		delete(r.runs, run.ID)
+		r.order = append(r.order[:i], r.order[i+1:]...)
+	}
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("bt_%x", b)
+}
@@ -0,0 +1,209 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+func TestNormalize(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	valid := func(edit func(*Request)) Request {
+		req := Request{Strategy: "buy_and_hold", Symbols: []string{"AAPL"}, Start: start, End: end}
+		edit(&req)
+		return req
+	}
+
+	tests := []struct {
+		name        string
+		req         Request
+		wantSymbols []string
+		wantErr     string
+	}{
+		{name: "defaults", req: valid(func(*Request) {}), wantSymbols: []string{"AAPL"}},
+		{
+			name:        "symbols are upper cased and deduplicated",
+			req:         valid(func(r *Request) { r.Symbols = []string{" aapl", "BRK.B", "AAPL", ""} }),
+			wantSymbols: []string{"AAPL", "BRK.B"},
+		},
+		{name: "path in a symbol", req: valid(func(r *Request) { r.Symbols = []string{"../../etc/passwd"} }), wantErr: `invalid symbol "../../ETC/PASSWD"`},
+		{name: "separator in a symbol", req: valid(func(r *Request) { r.Symbols = []string{"AAPL/X"} }), wantErr: "invalid symbol"},
+		{name: "symbol starting with a dot", req: valid(func(r *Request) { r.Symbols = []string{".AAPL"} }), wantErr: "invalid symbol"},
+		{name: "no symbols", req: valid(func(r *Request) { r.Symbols = []string{" "} }), wantErr: "at least one symbol is required"},
+		{name: "no strategy", req: valid(func(r *Request) { r.Strategy = "" }), wantErr: "strategy is required"},
+		{name: "end before start", req: valid(func(r *Request) { r.End = start }), wantErr: "end must be after start"},
+		{name: "unknown source", req: valid(func(r *Request) { r.Source = "s3" }), wantErr: `invalid source "s3"`},
+		{name: "file source without a data directory", req: valid(func(r *Request) { r.Source = SourceFile }), wantErr: "no backtest data directory is configured"},
+	}
+
+	runner := NewRunner(RunnerOptions{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := runner.normalize(tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("normalize() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalize() error = %v", err)
+			}
+			if !slices.Equal(req.Symbols, tt.wantSymbols) {
+				t.Errorf("symbols = %v, want %v", req.Symbols, tt.wantSymbols)
+			}
+			if req.Timeframe != "1Day" || req.Source != SourceMarketData || !*req.MarketHours || !req.StartingCash.Equal(dec("100000")) {
+				t.Errorf("normalize() = %+v, want the defaults filled in", req)
+			}
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	// 02:00 UTC on the 3rd is still the 2nd in New York
+	now := time.Date(2024, 1, 3, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		end  time.Time
+		want bool
+	}{
+		{name: "yesterday", end: time.Date(2024, 1, 1, 16, 0, 0, 0, utils.NewYork), want: true},
+		{name: "midnight starting today", end: time.Date(2024, 1, 2, 0, 0, 0, 0, utils.NewYork), want: true},
+		{name: "during today", end: time.Date(2024, 1, 2, 10, 0, 0, 0, utils.NewYork)},
+		{name: "today in UTC but tomorrow in New York", end: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := complete(tt.end, now); got != tt.want {
+				t.Errorf("complete(%s) = %t, want %t", tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeBars writes a daily AAPL CSV file to dir
+func writeBars(t *testing.T, dir string) {
+	t.Helper()
+	csv := "date,open,high,low,close,volume\n" +
+		"2024-01-02,100,101,99,100,1000\n" +
+		"2024-01-03,102,103,101,102,1000\n" +
+		"2024-01-04,104,105,103,104,1000\n"
+	if err := os.WriteFile(filepath.Join(dir, "AAPL_1Day.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunnerExecute(t *testing.T) {
+	dir := t.TempDir()
+	writeBars(t, dir)
+	runner := NewRunner(RunnerOptions{DataDir: dir})
+	defer runner.Stop()
+
+	marketHours := false
+	result, err := runner.Execute(context.Background(), Request{
+		Strategy:     "buy_and_hold",
+		Params:       map[string]float64{"qty": 10},
+		Symbols:      []string{"aapl"},
+		Start:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:          time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		Source:       SourceFile,
+		StartingCash: dec("10000"),
+		MarketHours:  &marketHours,
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// Bought at the second bar's open and valued at the last close
+	if result.Bars != 3 || !result.Positions["AAPL"].Equal(dec("10")) {
+		t.Fatalf("result = %d bars, positions %v, want 3 bars and 10 AAPL", result.Bars, result.Positions)
+	}
+	if !result.Summary.EndingEquity.Equal(dec("10020")) {
+		t.Errorf("ending equity = %s, want 10020", result.Summary.EndingEquity)
+	}
+}
+
+func TestRunnerQueue(t *testing.T) {
+	dir := t.TempDir()
+	writeBars(t, dir)
+
+	started, release := make(chan struct{}, 4), make(chan struct{})
+	runner := NewRunner(RunnerOptions{
+		DataDir:       dir,
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		Calendar: func(start, end time.Time) ([]alpaca.CalendarDay, error) {
+			started <- struct{}{}
+			<-release
+			return []alpaca.CalendarDay{{Date: "2024-01-02", Open: "09:30", Close: "16:00"}}, nil
+		},
+	})
+	defer runner.Stop()
+
+	req := Request{
+		Strategy: "buy_and_hold",
+		Symbols:  []string{"AAPL"},
+		Start:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		Source:   SourceFile,
+	}
+
+	first, err := runner.Submit(req)
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-started
+
+	// The first run holds the only slot, so one more may wait and no more
+	second, err := runner.Submit(req)
+	if err != nil {
+		t.Fatalf("Submit() of the queued run error = %v", err)
+	}
+	if second.Status != StatusQueued {
+		t.Errorf("second run status = %s, want %s", second.Status, StatusQueued)
+	}
+	if _, err := runner.Submit(req); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Submit() beyond the queue error = %v, want %v", err, ErrQueueFull)
+	}
+
+	close(release)
+	for _, id := range []string{first.ID, second.ID} {
+		run := waitForRun(t, runner, id)
+		if run.Status != StatusCompleted || run.Result == nil || run.Result.Bars != 1 || run.Result.SkippedBars != 2 {
+			t.Errorf("run %s = %+v, want completed over the one trading day in the calendar", id, run)
+		}
+	}
+	if runs := runner.List(); len(runs) != 2 || runs[0].ID != second.ID || runs[0].Result != nil {
+		t.Errorf("List() = %+v, want both runs newest first without results", runs)
+	}
+}
+
+// waitForRun polls a run until it finishes
+func waitForRun(t *testing.T, runner *Runner, id string) Run {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		run, err := runner.Get(id)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if run.Status != StatusQueued && run.Status != StatusRunning {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s is still %s", id, run.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
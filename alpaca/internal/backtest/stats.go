@@ -0,0 +1,117 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/nathgoh/investment-trader/alpaca/internal/performance"
+	"github.com/shopspring/decimal"
+)
+
+// Summary holds the statistics of a backtest. Ratios are fractions, so a
+// total return of 0.12 is 12%. Statistics that cannot be computed, such as a
+// Sharpe ratio from fewer than two days, are zero.
+type Summary struct {
+	StartingCash decimal.Decimal `json:"starting_cash"`
+	EndingEquity decimal.Decimal `json:"ending_equity"`
+	TotalReturn  float64         `json:"total_return"`
+	// AnnualizedReturn compounds the total return over the calendar time
+	// between the first and last bar
+	AnnualizedReturn float64 `json:"annualized_return"`
+	// Volatility is the annualized standard deviation of daily returns
+	Volatility  float64 `json:"volatility"`
+	Sharpe      float64 `json:"sharpe"`
+	Sortino     float64 `json:"sortino"`
+	MaxDrawdown float64 `json:"max_drawdown"`
+	Trades      int     `json:"trades"`
+	WinRate     float64 `json:"win_rate"`
+	// ProfitFactor is gross profit over gross loss
+	ProfitFactor    float64         `json:"profit_factor"`
+	AverageTradePnL decimal.Decimal `json:"average_trade_pnl"`
+	// Exposure is the fraction of replayed timestamps a position was held
+	Exposure        float64         `json:"exposure"`
+	TotalCommission decimal.Decimal `json:"total_commission"`
+	TotalSlippage   decimal.Decimal `json:"total_slippage"`
+}
+
+func summarize(startingCash decimal.Decimal, r *Result) Summary {
+	s := Summary{
+		StartingCash:    startingCash,
+		EndingEquity:    startingCash,
+		AverageTradePnL: decimal.Zero,
+		TotalCommission: decimal.Zero,
+		TotalSlippage:   decimal.Zero,
+	}
+	if len(r.Equity) == 0 {
+		return s
+	}
+
+	s.EndingEquity = r.Equity[len(r.Equity)-1].Equity
+	s.TotalReturn = s.EndingEquity.Div(startingCash).InexactFloat64() - 1
+	s.AnnualizedReturn = performance.Annualize(s.TotalReturn, r.Start, r.End)
+
+	returns := dailyReturns(startingCash, r.Equity)
+	s.Volatility = performance.Volatility(returns)
+	s.Sharpe = performance.Sharpe(returns)
+	s.Sortino = performance.Sortino(returns)
+	values := []float64{startingCash.InexactFloat64()}
+	for _, point := range r.Equity {
+		values = append(values, point.Equity.InexactFloat64())
+	}
+	s.MaxDrawdown = performance.MaxDrawdown(values)
+
+	held := 0
+	for _, point := range r.Equity {
+		if !point.MarketValue.IsZero() {
+			held++
+		}
+	}
+	s.Exposure = float64(held) / float64(len(r.Equity))
+
+	s.Trades = len(r.Trades)
+	grossProfit, grossLoss, total := decimal.Zero, decimal.Zero, decimal.Zero
+	wins := 0
+	for _, t := range r.Trades {
+		total = total.Add(t.PnL)
+		if t.PnL.IsPositive() {
+			wins++
+			grossProfit = grossProfit.Add(t.PnL)
+		} else {
+			grossLoss = grossLoss.Sub(t.PnL)
+		}
+	}
+	if s.Trades > 0 {
+		s.WinRate = float64(wins) / float64(s.Trades)
+		s.AverageTradePnL = total.Div(decimal.NewFromInt(int64(s.Trades))).Round(2)
+	}
+	if grossLoss.IsPositive() {
+		s.ProfitFactor = grossProfit.Div(grossLoss).InexactFloat64()
+	}
+
+	for _, f := range r.Fills {
+		s.TotalCommission = s.TotalCommission.Add(f.Commission)
+		s.TotalSlippage = s.TotalSlippage.Add(f.Slippage)
+	}
+	return s
+}
+
+// dailyReturns are the returns between the last equity of each New York
+// trading day, the first measured from the starting cash
+func dailyReturns(startingCash decimal.Decimal, equity []EquityPoint) []float64 {
+	var returns []float64
+	prev := startingCash.InexactFloat64()
+	for i, point := range equity {
+		if i+1 < len(equity) && sameDay(point.Time, equity[i+1].Time) {
+			continue
+		}
+		value := point.Equity.InexactFloat64()
+		if prev > 0 {
+			returns = append(returns, value/prev-1)
+		}
+		prev = value
+	}
+	return returns
+}
+
+func sameDay(a, b time.Time) bool {
+	return tradingDay(a) == tradingDay(b)
+}
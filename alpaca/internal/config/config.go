@@ -0,0 +1,695 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/joho/godotenv"
+	"github.com/nathgoh/investment-trader/alpaca/internal/risk"
+	"github.com/nathgoh/investment-trader/alpaca/internal/scheduler"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+)
+
+// Brokers the accounts can be backed by
+const (
+	BrokerAlpaca = "alpaca"
+	BrokerSim    = "sim"
+)
+
+// Actions a scheduled job can take
+const (
+	JobFlatten      = "flatten"
+	JobCancelOrders = "cancel_orders"
+	JobRebalance    = "rebalance"
+	JobReport       = "report"
+)
+
+var jobActions = []string{JobFlatten, JobCancelOrders, JobRebalance, JobReport}
+
+// redacted replaces secrets in the view of the config served by the API
+const redacted = "[redacted]"
+
+// accountName is the form account names take, since they appear in URLs and
+// API key scopes
+var accountName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// dataFeeds are the market data feeds a stock subscription can use
+var dataFeeds = []marketdata.Feed{marketdata.IEX, marketdata.SIP, marketdata.DelayedSIP, marketdata.OTC}
+
+// Config is the configuration of the whole server
+type Config struct {
+	Server    ServerConfig    `yaml:"server" json:"server"`
+	Alpaca    AlpacaConfig    `yaml:"alpaca" json:"alpaca"`
+	Accounts  []AccountConfig `yaml:"accounts" json:"accounts"`
+	Sim       SimConfig       `yaml:"sim" json:"sim"`
+	Live      LiveConfig      `yaml:"live" json:"live"`
+	Risk      risk.Limits     `yaml:"risk" json:"risk"`
+	Journal   JournalConfig   `yaml:"journal" json:"journal"`
+	Audit     AuditConfig     `yaml:"audit" json:"audit"`
+	Auth      AuthConfig      `yaml:"auth" json:"auth"`
+	Backtest  BacktestConfig  `yaml:"backtest" json:"backtest"`
+	Scheduler SchedulerConfig `yaml:"scheduler" json:"scheduler"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	ListenAddr  string   `yaml:"listen_addr" json:"listen_addr"`
+	CORSOrigins []string `yaml:"cors_origins" json:"cors_origins"`
+	// ReadTimeout bounds reading a whole request, headers and body
+	ReadTimeout Duration `yaml:"read_timeout" json:"read_timeout"`
+	// WriteTimeout bounds writing a response. Streams are exempt.
+	WriteTimeout Duration `yaml:"write_timeout" json:"write_timeout"`
+	IdleTimeout  Duration `yaml:"idle_timeout" json:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests may take to finish
+	// once the server is asked to stop
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+	// StartupCheckTimeout bounds the connectivity check of each account
+	StartupCheckTimeout Duration `yaml:"startup_check_timeout" json:"startup_check_timeout"`
+}
+
+// Duration is a time.Duration written as a string such as "15s", both in the
+// config file and in the config served by the API
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %q is not a valid duration", node.Line, node.Value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// AlpacaConfig configures the Alpaca endpoints and the market data feed
+type AlpacaConfig struct {
+	PaperBaseURL string          `yaml:"paper_base_url" json:"paper_base_url"`
+	LiveBaseURL  string          `yaml:"live_base_url" json:"live_base_url"`
+	DataBaseURL  string          `yaml:"data_base_url" json:"data_base_url"`
+	DataFeed     marketdata.Feed `yaml:"data_feed" json:"data_feed"`
+}
+
+// AccountConfig configures a named brokerage account
+type AccountConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Paper marks accounts that trade no real money. Changes to every other
+	// account pass the live gate.
+	Paper bool `yaml:"paper" json:"paper"`
+	// Broker is "alpaca" (the default), or "sim" to back a paper account
+	// with the in-memory simulated broker
+	Broker    string `yaml:"broker" json:"broker"`
+	APIKey    string `yaml:"api_key" json:"api_key"`
+	APISecret string `yaml:"api_secret" json:"api_secret"`
+	// BaseURL overrides the paper or live trading endpoint for the account
+	BaseURL string `yaml:"base_url" json:"base_url"`
+}
+
+// Configured reports whether both the key and the secret are set
+func (a AccountConfig) Configured() bool {
+	return a.APIKey != "" && a.APISecret != ""
+}
+
+// SimConfig configures the simulated broker
+type SimConfig struct {
+	StartingCash decimal.Decimal            `yaml:"starting_cash" json:"starting_cash"`
+	Prices       map[string]decimal.Decimal `yaml:"prices" json:"prices"`
+}
+
+// LiveConfig configures the gate in front of live account changes
+type LiveConfig struct {
+	TradingEnabled bool   `yaml:"trading_enabled" json:"trading_enabled"`
+	Token          string `yaml:"token" json:"token"`
+}
+
+// JournalConfig configures the order journal
+type JournalConfig struct {
+	Path string `yaml:"path" json:"path"`
+}
+
+// AuditConfig configures the audit log
+type AuditConfig struct {
+	Dir      string `yaml:"dir" json:"dir"`
+	MaxBytes int64  `yaml:"max_bytes" json:"max_bytes"`
+}
+
+// AuthConfig configures API authentication
+type AuthConfig struct {
+	// KeysFile holds the API keys. It is required unless Disabled is set.
+	KeysFile string `yaml:"keys_file" json:"keys_file"`
+	// Disabled serves the API without authentication, which is only allowed
+	// on a loopback address
+	Disabled bool `yaml:"disabled" json:"disabled"`
+}
+
+// BacktestConfig configures where backtests find their bars
+type BacktestConfig struct {
+	// DataDir holds CSV bar files named after their symbol
+	DataDir string `yaml:"data_dir" json:"data_dir"`
+	// CacheDir keeps the bars fetched from Alpaca for backtests
+	CacheDir string `yaml:"cache_dir" json:"cache_dir"`
+	// MaxConcurrent limits the backtests replayed at once
+	MaxConcurrent int `yaml:"max_concurrent" json:"max_concurrent"`
+	// MaxQueued limits the backtests waiting to be replayed
+	MaxQueued int `yaml:"max_queued" json:"max_queued"`
+}
+
+// SchedulerConfig configures the jobs run at times relative to the market's
+// sessions
+type SchedulerConfig struct {
+	// ReportDir is where report jobs write their reports
+	ReportDir string      `yaml:"report_dir" json:"report_dir"`
+	Jobs      []JobConfig `yaml:"jobs" json:"jobs"`
+}
+
+// JobConfig configures a scheduled job
+type JobConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Schedule is when the job runs, such as "15m before close"
+	Schedule string `yaml:"schedule" json:"schedule"`
+	// Action is flatten, cancel_orders, rebalance or report
+	Action  string `yaml:"action" json:"action"`
+	Account string `yaml:"account" json:"account"`
+	// Targets are the weights of equity a rebalance trades each symbol to
+	Targets map[string]decimal.Decimal `yaml:"targets" json:"targets,omitempty"`
+}
+
+// Default returns the configuration used for anything not set elsewhere
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddr:          ":8080",
+			CORSOrigins:         []string{"http://localhost:8501"},
+			ReadTimeout:         Duration(15 * time.Second),
+			WriteTimeout:        Duration(30 * time.Second),
+			IdleTimeout:         Duration(2 * time.Minute),
+			ShutdownTimeout:     Duration(30 * time.Second),
+			StartupCheckTimeout: Duration(10 * time.Second),
+		},
+		Alpaca: AlpacaConfig{
+			PaperBaseURL: utils.PAPER_BASE_URL,
+			LiveBaseURL:  utils.LIVE_BASE_URL,
+			DataBaseURL:  utils.MARKETDATA_BASE_URL,
+			DataFeed:     marketdata.IEX,
+		},
+		Sim: SimConfig{
+			StartingCash: decimal.NewFromInt(100000),
+			Prices:       map[string]decimal.Decimal{},
+		},
+		Journal: JournalConfig{Path: "journal.db"},
+		Audit:   AuditConfig{Dir: "audit", MaxBytes: 10 << 20},
+		Backtest: BacktestConfig{
+			DataDir:       "data",
+			CacheDir:      "cache/bars",
+			MaxConcurrent: 2,
+			MaxQueued:     20,
+		},
+		Scheduler: SchedulerConfig{ReportDir: "reports"},
+	}
+}
+
+// Load builds the configuration from the defaults, then the YAML file at path
+// (or TRADER_CONFIG), then the environment, with envFile loaded into the
+// environment first. Either path may be empty. Values that cannot be parsed
+// are reported together.
+func Load(envFile, path string) (Config, error) {
+	if envFile != "" {
+		if err := godotenv.Load(envFile); err != nil {
+			log.Println("Warning: Error loading .env file")
+		}
+	}
+
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv("TRADER_CONFIG")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	env := &envReader{}
+	env.string("LISTEN_ADDR", &cfg.Server.ListenAddr)
+	env.list("CORS_ORIGINS", &cfg.Server.CORSOrigins)
+	env.duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	env.duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	env.duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	env.duration("SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	env.duration("STARTUP_CHECK_TIMEOUT", &cfg.Server.StartupCheckTimeout)
+
+	env.string("ALPACA_PAPER_BASE_URL", &cfg.Alpaca.PaperBaseURL)
+	env.string("ALPACA_LIVE_BASE_URL", &cfg.Alpaca.LiveBaseURL)
+	env.string("ALPACA_DATA_BASE_URL", &cfg.Alpaca.DataBaseURL)
+	env.string("ALPACA_DATA_FEED", &cfg.Alpaca.DataFeed)
+
+	// The legacy paper and live keys define the accounts of those names
+	paper := AccountConfig{Name: trading.PaperAccount, Paper: true}
+	env.string("ALPACA_PAPER_API_KEY", &paper.APIKey)
+	env.string("ALPACA_PAPER_SECRET_KEY", &paper.APISecret)
+	cfg.mergeAccount(paper)
+	live := AccountConfig{Name: trading.LiveAccount}
+	env.string("ALPACA_LIVE_API_KEY", &live.APIKey)
+	env.string("ALPACA_LIVE_API_SECRET_KEY", &live.APISecret)
+	cfg.mergeAccount(live)
+
+	var broker string
+	env.string("TRADER_BROKER", &broker)
+	if broker != "" {
+		cfg.UseBroker(broker)
+	}
+
+	env.decimal("SIM_STARTING_CASH", &cfg.Sim.StartingCash)
+	env.prices("SIM_PRICES", &cfg.Sim.Prices)
+
+	env.bool("LIVE_TRADING_ENABLED", &cfg.Live.TradingEnabled)
+	env.string("LIVE_TRADING_TOKEN", &cfg.Live.Token)
+
+	env.decimal("RISK_MAX_ORDER_NOTIONAL", &cfg.Risk.MaxOrderNotional)
+	env.decimal("RISK_MAX_POSITION_NOTIONAL", &cfg.Risk.MaxPositionNotional)
+	env.decimal("RISK_MAX_GROSS_EXPOSURE", &cfg.Risk.MaxGrossExposure)
+	env.list("RISK_ALLOWED_SYMBOLS", &cfg.Risk.AllowedSymbols)
+	env.list("RISK_DENIED_SYMBOLS", &cfg.Risk.DeniedSymbols)
+	env.decimal("RISK_PRICE_BAND_PERCENT", &cfg.Risk.PriceBandPercent)
+	env.int("RISK_MAX_ORDERS_PER_MINUTE", &cfg.Risk.MaxOrdersPerMinute)
+	env.decimal("RISK_DAILY_LOSS_LIMIT", &cfg.Risk.DailyLossLimit)
+	env.decimal("RISK_DAILY_LOSS_PERCENT", &cfg.Risk.DailyLossPercent)
+	env.bool("RISK_HALT_CANCEL_ORDERS", &cfg.Risk.HaltCancelOrders)
+	env.bool("RISK_HALT_CLOSE_POSITIONS", &cfg.Risk.HaltClosePositions)
+
+	env.string("JOURNAL_PATH", &cfg.Journal.Path)
+	env.string("AUDIT_DIR", &cfg.Audit.Dir)
+	env.int64("AUDIT_MAX_BYTES", &cfg.Audit.MaxBytes)
+	env.string("AUTH_KEYS_FILE", &cfg.Auth.KeysFile)
+	env.bool("AUTH_DISABLED", &cfg.Auth.Disabled)
+	env.string("BACKTEST_DATA_DIR", &cfg.Backtest.DataDir)
+	env.string("BACKTEST_CACHE_DIR", &cfg.Backtest.CacheDir)
+	env.int("BACKTEST_MAX_CONCURRENT", &cfg.Backtest.MaxConcurrent)
+	env.int("BACKTEST_MAX_QUEUED", &cfg.Backtest.MaxQueued)
+	env.string("SCHEDULER_REPORT_DIR", &cfg.Scheduler.ReportDir)
+
+	if err := errors.Join(env.errs...); err != nil {
+		return Config{}, err
+	}
+
+	cfg.normalize()
+	return cfg, nil
+}
+
+// loadFile reads the YAML file at path over cfg. Unknown keys are rejected so
+// a misspelt setting does not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// mergeAccount applies the credentials of an account set in the environment,
+// adding the account when the config file does not define it
+func (c *Config) mergeAccount(account AccountConfig) {
+	if account.APIKey == "" && account.APISecret == "" {
+		return
+	}
+
+	for i := range c.Accounts {
+		if c.Accounts[i].Name == account.Name {
+			if account.APIKey != "" {
+				c.Accounts[i].APIKey = account.APIKey
+			}
+			if account.APISecret != "" {
+				c.Accounts[i].APISecret = account.APISecret
+			}
+			return
+		}
+	}
+	c.Accounts = append(c.Accounts, account)
+}
+
+// UseBroker backs every paper account with broker. Switching to the sim
+// broker without any paper account adds one called paper, so the server can
+// run without credentials.
+func (c *Config) UseBroker(broker string) {
+	broker = strings.ToLower(broker)
+
+	found := false
+	for i := range c.Accounts {
+		if c.Accounts[i].Paper {
+			c.Accounts[i].Broker = broker
+			found = true
+		}
+	}
+	if !found && broker == BrokerSim {
+		c.Accounts = append(c.Accounts, AccountConfig{Name: trading.PaperAccount, Paper: true, Broker: BrokerSim})
+	}
+}
+
+// BaseURL is the trading endpoint of an account: its own, or the paper or
+// live endpoint
+func (c Config) BaseURL(account AccountConfig) string {
+	switch {
+	case account.BaseURL != "":
+		return account.BaseURL
+	case account.Paper:
+		return c.Alpaca.PaperBaseURL
+	default:
+		return c.Alpaca.LiveBaseURL
+	}
+}
+
+// MarketDataAccount is the account whose keys market data is fetched with:
+// the first Alpaca paper account with keys, or failing that any Alpaca
+// account with keys
+func (c Config) MarketDataAccount() (AccountConfig, bool) {
+	var fallback *AccountConfig
+	for i, account := range c.Accounts {
+		if account.Broker != BrokerAlpaca || !account.Configured() {
+			continue
+		}
+		if account.Paper {
+			return account, true
+		}
+		if fallback == nil {
+			fallback = &c.Accounts[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return AccountConfig{}, false
+}
+
+// normalize tidies values that may be written in more than one way
+func (c *Config) normalize() {
+	for i := range c.Accounts {
+		c.Accounts[i].Broker = strings.ToLower(c.Accounts[i].Broker)
+		if c.Accounts[i].Broker == "" {
+			c.Accounts[i].Broker = BrokerAlpaca
+		}
+	}
+	c.Alpaca.DataFeed = strings.ToLower(c.Alpaca.DataFeed)
+	c.Risk.AllowedSymbols = upperSymbols(c.Risk.AllowedSymbols)
+	c.Risk.DeniedSymbols = upperSymbols(c.Risk.DeniedSymbols)
+
+	prices := make(map[string]decimal.Decimal, len(c.Sim.Prices))
+	for symbol, price := range c.Sim.Prices {
+		prices[strings.ToUpper(strings.TrimSpace(symbol))] = price
+	}
+	c.Sim.Prices = prices
+
+	for i, job := range c.Scheduler.Jobs {
+		c.Scheduler.Jobs[i].Action = strings.ToLower(job.Action)
+		targets := make(map[string]decimal.Decimal, len(job.Targets))
+		for symbol, weight := range job.Targets {
+			targets[strings.ToUpper(strings.TrimSpace(symbol))] = weight
+		}
+		c.Scheduler.Jobs[i].Targets = targets
+	}
+}
+
+// Validate checks the configuration is complete and consistent, reporting
+// every problem found
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	host, _, err := net.SplitHostPort(c.Server.ListenAddr)
+	if err != nil {
+		fail("server.listen_addr %q must be host:port", c.Server.ListenAddr)
+	}
+
+	// An API without keys must not be reachable from other machines
+	switch {
+	case c.Auth.Disabled && c.Auth.KeysFile != "":
+		fail("auth.keys_file cannot be set when auth.disabled is")
+	case c.Auth.Disabled && err == nil && !isLoopback(host):
+		fail("server.listen_addr %q must be a loopback address such as 127.0.0.1:8080 when auth.disabled is set", c.Server.ListenAddr)
+	case !c.Auth.Disabled && c.Auth.KeysFile == "":
+		fail("auth.keys_file is required; set auth.disabled to serve without authentication on a loopback address")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if err := checkURL(origin); err != nil {
+			fail("server.cors_origins: %v", err)
+		}
+	}
+
+	for name, d := range map[string]Duration{
+		"server.read_timeout":          c.Server.ReadTimeout,
+		"server.write_timeout":         c.Server.WriteTimeout,
+		"server.idle_timeout":          c.Server.IdleTimeout,
+		"server.shutdown_timeout":      c.Server.ShutdownTimeout,
+		"server.startup_check_timeout": c.Server.StartupCheckTimeout,
+	} {
+		if d <= 0 {
+			fail("%s must be greater than zero", name)
+		}
+	}
+
+	for name, u := range map[string]string{
+		"alpaca.paper_base_url": c.Alpaca.PaperBaseURL,
+		"alpaca.live_base_url":  c.Alpaca.LiveBaseURL,
+		"alpaca.data_base_url":  c.Alpaca.DataBaseURL,
+	} {
+		if err := checkURL(u); err != nil {
+			fail("%s: %v", name, err)
+		}
+	}
+	if !slices.Contains(dataFeeds, c.Alpaca.DataFeed) {
+		fail("alpaca.data_feed %q must be one of %v", c.Alpaca.DataFeed, dataFeeds)
+	}
+
+	names := make(map[string]bool)
+	paper := make(map[string]bool)
+	live := false
+	for i, account := range c.Accounts {
+		field := fmt.Sprintf("accounts[%d]", i)
+		if account.Name != "" {
+			field = fmt.Sprintf("accounts.%s", account.Name)
+		}
+
+		switch {
+		case !accountName.MatchString(account.Name):
+			fail("%s: name %q must be lower case letters, digits, - or _", field, account.Name)
+		case names[account.Name]:
+			fail("%s: name is used by more than one account", field)
+		}
+		names[account.Name] = true
+		paper[account.Name] = account.Paper
+
+		switch account.Broker {
+		case BrokerAlpaca:
+			if !account.Configured() {
+				fail("%s: api_key and api_secret are required", field)
+			}
+		case BrokerSim:
+			if !account.Paper {
+				fail("%s: only paper accounts can use the sim broker", field)
+			}
+		default:
+			fail("%s: broker %q must be %q or %q", field, account.Broker, BrokerAlpaca, BrokerSim)
+		}
+		if account.BaseURL != "" {
+			if err := checkURL(account.BaseURL); err != nil {
+				fail("%s: base_url: %v", field, err)
+			}
+		}
+		live = live || !account.Paper
+	}
+
+	if !c.Sim.StartingCash.IsPositive() {
+		fail("sim.starting_cash must be greater than zero")
+	}
+	for symbol, price := range c.Sim.Prices {
+		if symbol == "" || !price.IsPositive() {
+			fail("sim.prices: %q must have a price greater than zero", symbol)
+		}
+	}
+
+	if c.Live.TradingEnabled {
+		if c.Live.Token == "" {
+			fail("live.token is required when live trading is enabled")
+		}
+		if !live {
+			fail("live trading is enabled but every account is a paper account")
+		}
+	}
+
+	limits := map[string]decimal.Decimal{
+		"risk.max_order_notional":    c.Risk.MaxOrderNotional,
+		"risk.max_position_notional": c.Risk.MaxPositionNotional,
+		"risk.max_gross_exposure":    c.Risk.MaxGrossExposure,
+		"risk.price_band_percent":    c.Risk.PriceBandPercent,
+		"risk.daily_loss_limit":      c.Risk.DailyLossLimit,
+		"risk.daily_loss_percent":    c.Risk.DailyLossPercent,
+	}
+	for name, limit := range limits {
+		if limit.IsNegative() {
+			fail("%s must not be negative", name)
+		}
+	}
+	if c.Risk.DailyLossPercent.GreaterThanOrEqual(decimal.NewFromInt(100)) {
+		fail("risk.daily_loss_percent must be less than 100")
+	}
+	if c.Risk.MaxOrdersPerMinute < 0 {
+		fail("risk.max_orders_per_minute must not be negative")
+	}
+	for _, symbol := range c.Risk.AllowedSymbols {
+		if slices.Contains(c.Risk.DeniedSymbols, symbol) {
+			fail("risk: %s is on both the allowed and denied symbol lists", symbol)
+		}
+	}
+
+	if c.Journal.Path == "" {
+		fail("journal.path is required")
+	}
+	if c.Audit.Dir == "" {
+		fail("audit.dir is required")
+	}
+	if c.Audit.MaxBytes <= 0 {
+		fail("audit.max_bytes must be greater than zero")
+	}
+	if c.Backtest.CacheDir == "" {
+		fail("backtest.cache_dir is required")
+	}
+	if c.Backtest.MaxConcurrent <= 0 {
+		fail("backtest.max_concurrent must be greater than zero")
+	}
+	if c.Backtest.MaxQueued <= 0 {
+		fail("backtest.max_queued must be greater than zero")
+	}
+
+	jobs := make(map[string]bool)
+	for i, job := range c.Scheduler.Jobs {
+		field := fmt.Sprintf("scheduler.jobs[%d]", i)
+		if job.Name != "" {
+			field = fmt.Sprintf("scheduler.jobs.%s", job.Name)
+		}
+
+		switch {
+		case !accountName.MatchString(job.Name):
+			fail("%s: name %q must be lower case letters, digits, - or _", field, job.Name)
+		case jobs[job.Name]:
+			fail("%s: name is used by more than one job", field)
+		}
+		jobs[job.Name] = true
+
+		if _, err := scheduler.Parse(job.Schedule); err != nil {
+			fail("%s: %v", field, err)
+		}
+		if !slices.Contains(jobActions, job.Action) {
+			fail("%s: action %q must be one of %v", field, job.Action, jobActions)
+		}
+		switch {
+		case !names[job.Account]:
+			fail("%s: account %q is not configured", field, job.Account)
+		case !paper[job.Account] && job.Action != JobReport && !c.Live.TradingEnabled:
+			fail("%s: %s jobs on live account %q need live trading enabled", field, job.Action, job.Account)
+		}
+
+		if job.Action != JobRebalance {
+			if len(job.Targets) > 0 {
+				fail("%s: targets only apply to rebalance jobs", field)
+			}
+			continue
+		}
+		total := decimal.Zero
+		for symbol, weight := range job.Targets {
+			if symbol == "" || !weight.IsPositive() {
+				fail("%s: targets: %q must have a weight greater than zero", field, symbol)
+			}
+			total = total.Add(weight)
+		}
+		switch {
+		case len(job.Targets) == 0:
+			fail("%s: rebalance jobs need targets", field)
+		case total.GreaterThan(decimal.NewFromInt(1)):
+			fail("%s: targets add up to %s, more than 1", field, total)
+		}
+	}
+	for _, job := range c.Scheduler.Jobs {
+		if job.Action == JobReport && c.Scheduler.ReportDir == "" {
+			fail("scheduler.report_dir is required for report jobs")
+			break
+		}
+	}
+
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration safe to show, with every
+// credential and token replaced
+func (c Config) Redacted() Config {
+	redact := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+
+	c.Accounts = slices.Clone(c.Accounts)
+	for i := range c.Accounts {
+		c.Accounts[i].APIKey = redact(c.Accounts[i].APIKey)
+		c.Accounts[i].APISecret = redact(c.Accounts[i].APISecret)
+	}
+	c.Live.Token = redact(c.Live.Token)
+	return c
+}
+
+// checkURL checks s is an absolute http or https URL
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an http or https URL", s)
+	}
+	return nil
+}
+
+func upperSymbols(symbols []string) []string {
+	var upper []string
+	for _, s := range symbols {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" {
+			upper = append(upper, s)
+		}
+	}
+	return upper
+}
+
+// isLoopback reports whether a listen host only accepts local connections. An
+// empty host listens on every interface.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
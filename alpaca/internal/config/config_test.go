@@ -0,0 +1,277 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+// validConfig is the default configuration with the settings it needs to
+// pass validation
+func validConfig() Config {
+	cfg := Default()
+	cfg.Auth.KeysFile = "keys.json"
+	cfg.Accounts = []AccountConfig{{Name: "paper", Paper: true, Broker: BrokerSim}}
+	return cfg
+}
+
+// checkValidate checks Validate fails with wantErr, or passes when it is empty
+func checkValidate(t *testing.T, cfg Config, wantErr string) {
+	t.Helper()
+	err := cfg.Validate()
+	switch {
+	case wantErr == "" && err != nil:
+		t.Fatalf("Validate() error = %v", err)
+	case wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)):
+		t.Fatalf("Validate() error = %v, want %q", err, wantErr)
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		listenAddr string
+		keysFile   string
+		disabled   bool
+		wantErr    string
+	}{
+		{name: "keys file", listenAddr: ":8080", keysFile: "keys.json"},
+		{name: "no keys file", listenAddr: ":8080", wantErr: "auth.keys_file is required"},
+		{name: "disabled on 127.0.0.1", listenAddr: "127.0.0.1:8080", disabled: true},
+		{name: "disabled on localhost", listenAddr: "localhost:8080", disabled: true},
+		{name: "disabled on ::1", listenAddr: "[::1]:8080", disabled: true},
+		{name: "disabled on every interface", listenAddr: ":8080", disabled: true, wantErr: "must be a loopback address"},
+		{name: "disabled on a public address", listenAddr: "0.0.0.0:8080", disabled: true, wantErr: "must be a loopback address"},
+		{name: "disabled with a keys file", listenAddr: "127.0.0.1:8080", keysFile: "keys.json", disabled: true, wantErr: "auth.keys_file cannot be set when auth.disabled is"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Server.ListenAddr = tt.listenAddr
+			cfg.Auth = AuthConfig{KeysFile: tt.keysFile, Disabled: tt.disabled}
+			checkValidate(t, cfg, tt.wantErr)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(*Config)
+		wantErr string
+	}{
+		{name: "valid", edit: func(*Config) {}},
+		{
+			name:    "listen address without a port",
+			edit:    func(c *Config) { c.Server.ListenAddr = "8080" },
+			wantErr: `server.listen_addr "8080" must be host:port`,
+		},
+		{
+			name:    "zero timeout",
+			edit:    func(c *Config) { c.Server.WriteTimeout = 0 },
+			wantErr: "server.write_timeout must be greater than zero",
+		},
+		{
+			name:    "relative base URL",
+			edit:    func(c *Config) { c.Alpaca.PaperBaseURL = "paper-api.alpaca.markets" },
+			wantErr: "alpaca.paper_base_url",
+		},
+		{
+			name:    "unknown data feed",
+			edit:    func(c *Config) { c.Alpaca.DataFeed = "nasdaq" },
+			wantErr: `alpaca.data_feed "nasdaq" must be one of`,
+		},
+		{
+			name:    "alpaca account without keys",
+			edit:    func(c *Config) { c.Accounts[0].Broker = BrokerAlpaca },
+			wantErr: "accounts.paper: api_key and api_secret are required",
+		},
+		{
+			name:    "live sim account",
+			edit:    func(c *Config) { c.Accounts[0].Paper = false },
+			wantErr: "accounts.paper: only paper accounts can use the sim broker",
+		},
+		{
+			name:    "account name with upper case",
+			edit:    func(c *Config) { c.Accounts[0].Name = "Paper" },
+			wantErr: `name "Paper" must be lower case letters`,
+		},
+		{
+			name:    "account name used twice",
+			edit:    func(c *Config) { c.Accounts = append(c.Accounts, c.Accounts[0]) },
+			wantErr: "accounts.paper: name is used by more than one account",
+		},
+		{
+			name:    "live trading without a token",
+			edit:    func(c *Config) { c.Live.TradingEnabled = true },
+			wantErr: "live.token is required when live trading is enabled",
+		},
+		{
+			name: "live trading with only paper accounts",
+			edit: func(c *Config) {
+				c.Live = LiveConfig{TradingEnabled: true, Token: "s3cret"}
+			},
+			wantErr: "live trading is enabled but every account is a paper account",
+		},
+		{
+			name:    "negative risk limit",
+			edit:    func(c *Config) { c.Risk.MaxOrderNotional = dec("-1") },
+			wantErr: "risk.max_order_notional must not be negative",
+		},
+		{
+			name: "symbol both allowed and denied",
+			edit: func(c *Config) {
+				c.Risk.AllowedSymbols, c.Risk.DeniedSymbols = []string{"AAPL"}, []string{"AAPL"}
+			},
+			wantErr: "risk: AAPL is on both the allowed and denied symbol lists",
+		},
+		{
+			name:    "no journal path",
+			edit:    func(c *Config) { c.Journal.Path = "" },
+			wantErr: "journal.path is required",
+		},
+		{
+			name: "job on an unknown account",
+			edit: func(c *Config) {
+				c.Scheduler.Jobs = []JobConfig{{Name: "eod", Schedule: "15m before close", Action: JobFlatten, Account: "ira"}}
+			},
+			wantErr: `scheduler.jobs.eod: account "ira" is not configured`,
+		},
+		{
+			name: "rebalance targets over 1",
+			edit: func(c *Config) {
+				c.Scheduler.Jobs = []JobConfig{{Name: "rebalance", Schedule: "at open", Action: JobRebalance, Account: "paper", Targets: map[string]decimal.Decimal{"AAPL": dec("0.6"), "MSFT": dec("0.5")}}}
+			},
+			wantErr: "targets add up to 1.1, more than 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.edit(&cfg)
+			checkValidate(t, cfg, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Journal.Path = ""
+	cfg.Audit.Dir = ""
+	cfg.Backtest.MaxQueued = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() succeeded, want errors")
+	}
+	want := "audit.dir is required\nbacktest.max_queued must be greater than zero\njournal.path is required"
+	if err.Error() != want {
+		t.Errorf("Validate() error = %q, want %q", err, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+server:
+  listen_addr: "127.0.0.1:9090"
+  read_timeout: 5s
+accounts:
+  - name: paper
+    paper: true
+    api_key: file-key
+    api_secret: file-secret
+risk:
+  denied_symbols: [gme]
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The environment wins over the file
+	t.Setenv("ALPACA_PAPER_API_KEY", "env-key")
+	t.Setenv("RISK_MAX_ORDER_NOTIONAL", "5000")
+
+	cfg, err := Load("", path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.ListenAddr != "127.0.0.1:9090" || time.Duration(cfg.Server.ReadTimeout) != 5*time.Second {
+		t.Errorf("server = %+v, want the file's listen address and read timeout", cfg.Server)
+	}
+	if time.Duration(cfg.Server.WriteTimeout) != 30*time.Second {
+		t.Errorf("write timeout = %v, want the 30s default", time.Duration(cfg.Server.WriteTimeout))
+	}
+	if len(cfg.Accounts) != 1 || cfg.Accounts[0].APIKey != "env-key" || cfg.Accounts[0].APISecret != "file-secret" || cfg.Accounts[0].Broker != BrokerAlpaca {
+		t.Errorf("accounts = %+v, want paper with the env key, the file secret and the alpaca broker", cfg.Accounts)
+	}
+	if !cfg.Risk.MaxOrderNotional.Equal(dec("5000")) || len(cfg.Risk.DeniedSymbols) != 1 || cfg.Risk.DeniedSymbols[0] != "GME" {
+		t.Errorf("risk = %+v, want a 5000 order limit and GME denied", cfg.Risk)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			yaml:    "server:\n  listen_adr: \":8080\"\n",
+			wantErr: "field listen_adr not found",
+		},
+		{
+			name:    "invalid duration",
+			yaml:    "server:\n  read_timeout: soon\n",
+			wantErr: `"soon" is not a valid duration`,
+		},
+		{
+			name:    "invalid environment values",
+			env:     map[string]string{"LIVE_TRADING_ENABLED": "maybe", "BACKTEST_MAX_QUEUED": "lots"},
+			wantErr: `LIVE_TRADING_ENABLED "maybe" is not a valid boolean`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load("", path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := validConfig()
+	cfg.Accounts[0].APIKey, cfg.Accounts[0].APISecret = "key", "secret"
+	cfg.Live.Token = "s3cret"
+
+	redactedCfg := cfg.Redacted()
+	if a := redactedCfg.Accounts[0]; a.APIKey != redacted || a.APISecret != redacted || redactedCfg.Live.Token != redacted {
+		t.Errorf("Redacted() = %+v, %+v, want every credential redacted", a, redactedCfg.Live)
+	}
+	if cfg.Accounts[0].APIKey != "key" {
+		t.Error("Redacted() changed the original config")
+	}
+}
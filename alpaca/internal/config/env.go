@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// envReader overrides config values with the environment variables that are
+// set, collecting the ones that cannot be parsed
+type envReader struct {
+	errs []error
+}
+
+// lookup returns the value of a variable that is set and not empty
+func (e *envReader) lookup(key string) (string, bool) {
+	s, ok := os.LookupEnv(key)
+	return strings.TrimSpace(s), ok && strings.TrimSpace(s) != ""
+}
+
+func (e *envReader) fail(key, s, kind string) {
+	e.errs = append(e.errs, fmt.Errorf("%s %q is not a valid %s", key, s, kind))
+}
+
+func (e *envReader) string(key string, dst *string) {
+	if s, ok := e.lookup(key); ok {
+		*dst = s
+	}
+}
+
+func (e *envReader) list(key string, dst *[]string) {
+	s, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
+
+func (e *envReader) bool(key string, dst *bool) {
+	s, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		e.fail(key, s, "boolean")
+		return
+	}
+	*dst = b
+}
+
+func (e *envReader) int(key string, dst *int) {
+	s, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		e.fail(key, s, "integer")
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) int64(key string, dst *int64) {
+	s, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		e.fail(key, s, "integer")
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) decimal(key string, dst *decimal.Decimal) {
+	s, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		e.fail(key, s, "number")
+		return
+	}
+	*dst = d
+}
+
+func (e *envReader) duration(key string, dst *Duration) {
+	s, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		e.fail(key, s, "duration")
+		return
+	}
+	*dst = Duration(d)
+}
+
+// prices reads SYMBOL=PRICE pairs such as "AAPL=190.50,MSFT=410"
+func (e *envReader) prices(key string, dst *map[string]decimal.Decimal) {
+	s, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	prices := make(map[string]decimal.Decimal)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		symbol, priceStr, ok := strings.Cut(pair, "=")
+		price, err := decimal.NewFromString(strings.TrimSpace(priceStr))
+		if !ok || err != nil {
+			e.fail(key, pair, "SYMBOL=PRICE entry")
+			continue
+		}
+		prices[symbol] = price
+	}
+	*dst = prices
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// Component states
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	// StatusDisabled marks components turned off by configuration. They do
+	// not make the server degraded.
+	StatusDisabled = "disabled"
+)
+
+// Component is the state of one part of the server
+type Component struct {
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the state of the server and each of its components
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Monitor collects the state of the server's components. A component is
+// either set when it is checked or probed each time a report is made.
+type Monitor struct {
+	mu         sync.RWMutex
+	components map[string]Component
+	probes     map[string]func() Component
+}
+
+// NewMonitor creates a monitor with no components
+func NewMonitor() *Monitor {
+	return &Monitor{
+		components: make(map[string]Component),
+		probes:     make(map[string]func() Component),
+	}
+}
+
+// Set records the state of a component
+func (m *Monitor) Set(name, status, detail string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components[name] = Component{Status: status, Detail: detail, CheckedAt: time.Now()}
+}
+
+// OK marks a component healthy
+func (m *Monitor) OK(name string) {
+	m.Set(name, StatusOK, "")
+}
+
+// Degraded marks a component as not working, with the error that shows it
+func (m *Monitor) Degraded(name string, err error) {
+	m.Set(name, StatusDegraded, err.Error())
+}
+
+// Disabled marks a component turned off, with the reason
+func (m *Monitor) Disabled(name, reason string) {
+	m.Set(name, StatusDisabled, reason)
+}
+
+// Probe registers a function reporting the current state of a component
+func (m *Monitor) Probe(name string, probe func() Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probes[name] = probe
+}
+
+// Report returns the state of every component. The server is degraded when
+// any component is.
+func (m *Monitor) Report() Report {
+	m.mu.RLock()
+	components := maps.Clone(m.components)
+	probes := maps.Clone(m.probes)
+	m.mu.RUnlock()
+
+	for name, probe := range probes {
+		component := probe()
+		if component.CheckedAt.IsZero() {
+			component.CheckedAt = time.Now()
+		}
+		components[name] = component
+	}
+
+	report := Report{Status: StatusOK, Components: components}
+	for _, component := range components {
+		if component.Status == StatusDegraded {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// Redacted returns the report without component details, which can name
+// accounts and strategies and carry errors from the brokers
+func (r Report) Redacted() Report {
+	components := make(map[string]Component, len(r.Components))
+	for name, component := range r.Components {
+		component.Detail = ""
+		components[name] = component
+	}
+	return Report{Status: r.Status, Components: components}
+}
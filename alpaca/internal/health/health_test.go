@@ -0,0 +1,144 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(m *Monitor)
+		wantStatus string
+		want       map[string]Component
+	}{
+		{
+			name:       "no components",
+			setup:      func(m *Monitor) {},
+			wantStatus: StatusOK,
+			want:       map[string]Component{},
+		},
+		{
+			name: "healthy and disabled",
+			setup: func(m *Monitor) {
+				m.OK("journal")
+				m.Disabled("auth", "disabled by configuration")
+			},
+			wantStatus: StatusOK,
+			want: map[string]Component{
+				"journal": {Status: StatusOK},
+				"auth":    {Status: StatusDisabled, Detail: "disabled by configuration"},
+			},
+		},
+		{
+			name: "degraded component",
+			setup: func(m *Monitor) {
+				m.OK("journal")
+				m.Degraded("account:live", errors.New("forbidden"))
+			},
+			wantStatus: StatusDegraded,
+			want: map[string]Component{
+				"journal":      {Status: StatusOK},
+				"account:live": {Status: StatusDegraded, Detail: "forbidden"},
+			},
+		},
+		{
+			name: "recovered component",
+			setup: func(m *Monitor) {
+				m.Degraded("account:live", errors.New("forbidden"))
+				m.OK("account:live")
+			},
+			wantStatus: StatusOK,
+			want:       map[string]Component{"account:live": {Status: StatusOK}},
+		},
+		{
+			name: "degraded probe",
+			setup: func(m *Monitor) {
+				m.OK("audit")
+				m.Probe("scheduler", func() Component {
+					return Component{Status: StatusDegraded, Detail: "no calendar"}
+				})
+			},
+			wantStatus: StatusDegraded,
+			want: map[string]Component{
+				"audit":     {Status: StatusOK},
+				"scheduler": {Status: StatusDegraded, Detail: "no calendar"},
+			},
+		},
+		{
+			name: "probe replaces a set component",
+			setup: func(m *Monitor) {
+				m.Degraded("marketdata_stream", errors.New("not connected"))
+				m.Probe("marketdata_stream", func() Component {
+					return Component{Status: StatusOK}
+				})
+			},
+			wantStatus: StatusOK,
+			want:       map[string]Component{"marketdata_stream": {Status: StatusOK}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMonitor()
+			tt.setup(m)
+
+			before := time.Now()
+			report := m.Report()
+			if report.Status != tt.wantStatus {
+				t.Errorf("Report().Status = %q, want %q", report.Status, tt.wantStatus)
+			}
+			if len(report.Components) != len(tt.want) {
+				t.Errorf("Report().Components = %v, want %v", report.Components, tt.want)
+			}
+			for name, want := range tt.want {
+				got, ok := report.Components[name]
+				if !ok {
+					t.Errorf("Report() is missing component %q", name)
+					continue
+				}
+				if got.Status != want.Status || got.Detail != want.Detail {
+					t.Errorf("Report() component %q = %+v, want %+v", name, got, want)
+				}
+				if got.CheckedAt.IsZero() || got.CheckedAt.After(before.Add(time.Second)) {
+					t.Errorf("Report() component %q checked at %v, want a time of check", name, got.CheckedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorReportIsACopy(t *testing.T) {
+	m := NewMonitor()
+	m.OK("journal")
+
+	report := m.Report()
+	report.Components["journal"] = Component{Status: StatusDegraded}
+
+	if got := m.Report().Components["journal"].Status; got != StatusOK {
+		t.Errorf("Report() after changing an earlier report = %q, want %q", got, StatusOK)
+	}
+}
+
+func TestReportRedacted(t *testing.T) {
+	m := NewMonitor()
+	m.OK("journal")
+	m.Degraded("account:live", errors.New("forbidden"))
+	m.Disabled("auth", "disabled by configuration")
+
+	report := m.Report()
+	redacted := report.Redacted()
+	if redacted.Status != StatusDegraded {
+		t.Errorf("Redacted() status = %q, want %q", redacted.Status, StatusDegraded)
+	}
+	for name, component := range report.Components {
+		got, ok := redacted.Components[name]
+		if !ok || got.Status != component.Status || got.Detail != "" {
+			t.Errorf("Redacted() component %q = %+v, want status %q without detail", name, got, component.Status)
+		}
+	}
+	if got := report.Components["account:live"].Detail; got != "forbidden" {
+		t.Errorf("Redacted() changed the report's detail to %q", got)
+	}
+}
@@ -0,0 +1,124 @@
+package indicators
+
+import "fmt"
+
+// SMA is the simple moving average of the last period values
+type SMA struct {
+	period int
+	window []float64
+	next   int
+	sum    float64
+	value  float64
+	ready  bool
+}
+
+// NewSMA creates a simple moving average over period values, which must be
+// at least 1
+func NewSMA(period int) (*SMA, error) {
+	if err := checkPeriod("period", period, 1); err != nil {
+		return nil, err
+	}
+	return newSMA(period), nil
+}
+
+func newSMA(period int) *SMA {
+	return &SMA{period: period, window: make([]float64, 0, period)}
+}
+
+// Add adds a value and returns the average once period values have been added
+func (s *SMA) Add(v float64) (float64, bool) {
+	if len(s.window) < s.period {
+		s.window = append(s.window, v)
+		s.sum += v
+	} else {
+		s.sum += v - s.window[s.next]
+		s.window[s.next] = v
+		s.next = (s.next + 1) % s.period
+		// Sum the window afresh once per lap so rounding errors do not pile up
+		if s.next == 0 {
+			s.sum = 0
+			for _, w := range s.window {
+				s.sum += w
+			}
+		}
+	}
+
+	if len(s.window) == s.period {
+		s.value, s.ready = s.sum/float64(s.period), true
+	}
+	return s.value, s.ready
+}
+
+// Value returns the latest average, and false until there is one
+func (s *SMA) Value() (float64, bool) {
+	return s.value, s.ready
+}
+
+// EMA is the exponential moving average of values, weighting the latest by
+// 2/(period+1). It starts from the simple average of the first period values.
+type EMA struct {
+	period int
+	alpha  float64
+	seed   *SMA
+	value  float64
+	ready  bool
+}
+
+// NewEMA creates an exponential moving average over period values, which
+// must be at least 1
+func NewEMA(period int) (*EMA, error) {
+	if err := checkPeriod("period", period, 1); err != nil {
+		return nil, err
+	}
+	return newEMA(period), nil
+}
+
+func newEMA(period int) *EMA {
+	return &EMA{period: period, alpha: 2 / float64(period+1), seed: newSMA(period)}
+}
+
+// Add adds a value and returns the average once period values have been added
+func (e *EMA) Add(v float64) (float64, bool) {
+	if e.ready {
+		e.value += e.alpha * (v - e.value)
+	} else {
+		e.value, e.ready = e.seed.Add(v)
+	}
+	return e.value, e.ready
+}
+
+// Value returns the latest average, and false until there is one
+func (e *EMA) Value() (float64, bool) {
+	return e.value, e.ready
+}
+
+// wilder is Wilder's moving average, which weights the latest value by
+// 1/period and starts from the simple average of the first period values
+type wilder struct {
+	period float64
+	seed   *SMA
+	value  float64
+	ready  bool
+}
+
+func newWilder(period int) *wilder {
+	return &wilder{period: float64(period), seed: newSMA(period)}
+}
+
+func (w *wilder) add(v float64) (float64, bool) {
+	if w.ready {
+		w.value += (v - w.value) / w.period
+	} else {
+		w.value, w.ready = w.seed.Add(v)
+	}
+	return w.value, w.ready
+}
+
+// checkPeriod rejects a period of less than least, which an indicator cannot
+// be computed over
+func checkPeriod(name string, period, least int) error {
+	if period < least {
+		return fmt.Errorf("%s must be at least %d, not %d", name, least, period)
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+// Package indicators computes technical indicators over bars. Each indicator
+// has a streaming form, updated one value or bar at a time, and a batch form
+// over a whole series that runs the streaming one, so both give the same
+// numbers.
+package indicators
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+// maxPeriod is the longest period an indicator is computed over by name
+const maxPeriod = 1000
+
+// settleFactor is how many periods of extra bars a recursive average is given
+// before the first value asked for. Its values depend on every earlier value,
+// and after this many periods the start of the bars barely matters.
+const settleFactor = 4
+
+// Params are the numeric parameters of an indicator computed by name
+type Params map[string]float64
+
+// Float returns a parameter, or def when it is not set
+func (p Params) Float(name string, def float64) float64 {
+	if v, ok := p[name]; ok {
+		return v
+	}
+	return def
+}
+
+// Int returns a parameter as a whole number, or def when it is not set
+func (p Params) Int(name string, def int) (int, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	if v != float64(int(v)) {
+		return 0, fmt.Errorf("parameter %s must be a whole number", name)
+	}
+	return int(v), nil
+}
+
+// Point is the value of an indicator at the close of a bar. Indicators with
+// one output name it after the indicator, such as "rsi".
+type Point struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Values    map[string]float64 `json:"values"`
+}
+
+// update adds a bar to a streaming indicator and returns its outputs once it
+// has a value
+type update func(bar marketdata.Bar) (map[string]float64, bool)
+
+// definition is an indicator that can be computed by name
+type definition struct {
+	// defaults are the parameters the indicator takes
+	defaults Params
+	// warmup is how many bars before the first value asked for are needed
+	warmup func(p Params) int
+	create func(p Params) (update, error)
+}
+
+var definitions = map[string]definition{
+	"sma": {
+		defaults: Params{"period": 20},
+		warmup:   func(p Params) int { return int(p["period"]) - 1 },
+		create: closes(func(p Params) (func(float64) (map[string]float64, bool), error) {
+			if err := periods(p, 1, "period"); err != nil {
+				return nil, err
+			}
+			sma, err := NewSMA(int(p["period"]))
+			if err != nil {
+				return nil, err
+			}
+			return scalar("sma", sma.Add), nil
+		}),
+	},
+	"ema": {
+		defaults: Params{"period": 20},
+		warmup:   func(p Params) int { return int(p["period"])*(1+settleFactor) - 1 },
+		create: closes(func(p Params) (func(float64) (map[string]float64, bool), error) {
+			if err := periods(p, 1, "period"); err != nil {
+				return nil, err
+			}
+			ema, err := NewEMA(int(p["period"]))
+			if err != nil {
+				return nil, err
+			}
+			return scalar("ema", ema.Add), nil
+		}),
+	},
+	"rsi": {
+		defaults: Params{"period": 14},
+		// Wilder's average settles half as fast as an EMA of the same period
+		warmup: func(p Params) int { return int(p["period"]) * (1 + 2*settleFactor) },
+		create: closes(func(p Params) (func(float64) (map[string]float64, bool), error) {
+			if err := periods(p, 1, "period"); err != nil {
+				return nil, err
+			}
+			rsi, err := NewRSI(int(p["period"]))
+			if err != nil {
+				return nil, err
+			}
+			return scalar("rsi", rsi.Add), nil
+		}),
+	},
+	"macd": {
+		defaults: Params{"fast": 12, "slow": 26, "signal": 9},
+		warmup: func(p Params) int {
+			return int(p["slow"])*(1+settleFactor) + int(p["signal"]) - 2
+		},
+		create: closes(func(p Params) (func(float64) (map[string]float64, bool), error) {
+			if err := periods(p, 1, "fast", "slow", "signal"); err != nil {
+				return nil, err
+			}
+			if p["fast"] >= p["slow"] {
+				return nil, fmt.Errorf("fast must be less than slow")
+			}
+			macd, err := NewMACD(int(p["fast"]), int(p["slow"]), int(p["signal"]))
+			if err != nil {
+				return nil, err
+			}
+			return func(v float64) (map[string]float64, bool) {
+				m, ok := macd.Add(v)
+				return map[string]float64{"macd": m.MACD, "signal": m.Signal, "histogram": m.Histogram}, ok
+			}, nil
+		}),
+	},
+	"bollinger": {
+		defaults: Params{"period": 20, "stddev": 2},
+		warmup:   func(p Params) int { return int(p["period"]) - 1 },
+		create: closes(func(p Params) (func(float64) (map[string]float64, bool), error) {
+			if err := periods(p, 1, "period"); err != nil {
+				return nil, err
+			}
+			if p["stddev"] <= 0 {
+				return nil, fmt.Errorf("stddev must be greater than 0")
+			}
+			bands, err := NewBollinger(int(p["period"]), p["stddev"])
+			if err != nil {
+				return nil, err
+			}
+			return func(v float64) (map[string]float64, bool) {
+				b, ok := bands.Add(v)
+				return map[string]float64{"middle": b.Middle, "upper": b.Upper, "lower": b.Lower}, ok
+			}, nil
+		}),
+	},
+	"atr": {
+		defaults: Params{"period": 14},
+		warmup:   func(p Params) int { return int(p["period"])*(1+2*settleFactor) - 1 },
+		create: func(p Params) (update, error) {
+			if err := periods(p, 1, "period"); err != nil {
+				return nil, err
+			}
+			atr, err := NewATR(int(p["period"]))
+			if err != nil {
+				return nil, err
+			}
+			return func(bar marketdata.Bar) (map[string]float64, bool) {
+				v, ok := atr.Update(bar)
+				return map[string]float64{"atr": v}, ok
+			}, nil
+		},
+	},
+	"vwap": {
+		// A period of zero averages each day's bars since the first one
+		defaults: Params{"period": 0},
+		warmup:   func(p Params) int { return max(int(p["period"])-1, 0) },
+		create: func(p Params) (update, error) {
+			if err := periods(p, 0, "period"); err != nil {
+				return nil, err
+			}
+			vwap, err := NewVWAP(int(p["period"]), utils.NewYork)
+			if err != nil {
+				return nil, err
+			}
+			return func(bar marketdata.Bar) (map[string]float64, bool) {
+				v, ok := vwap.Update(bar)
+				return map[string]float64{"vwap": v}, ok
+			}, nil
+		},
+	},
+	"stochastic": {
+		defaults: Params{"period": 14, "smooth": 3},
+		warmup:   func(p Params) int { return int(p["period"]) + int(p["smooth"]) - 2 },
+		create: func(p Params) (update, error) {
+			if err := periods(p, 1, "period", "smooth"); err != nil {
+				return nil, err
+			}
+			stochastic, err := NewStochastic(int(p["period"]), int(p["smooth"]))
+			if err != nil {
+				return nil, err
+			}
+			return func(bar marketdata.Bar) (map[string]float64, bool) {
+				s, ok := stochastic.Update(bar)
+				return map[string]float64{"k": s.K, "d": s.D}, ok
+			}, nil
+		},
+	},
+	"obv": {
+		defaults: Params{},
+		warmup:   func(Params) int { return 0 },
+		create: func(Params) (update, error) {
+			obv := NewOBV()
+			return func(bar marketdata.Bar) (map[string]float64, bool) {
+				v, ok := obv.Update(bar)
+				return map[string]float64{"obv": v}, ok
+			}, nil
+		},
+	},
+}
+
+// periods checks parameters are whole numbers from least to maxPeriod
+func periods(p Params, least int, names ...string) error {
+	for _, name := range names {
+		v, err := p.Int(name, 0)
+		if err != nil {
+			return err
+		}
+		if v < least || v > maxPeriod {
+			return fmt.Errorf("parameter %s must be from %d to %d", name, least, maxPeriod)
+		}
+	}
+	return nil
+}
+
+// closes adapts an indicator of values to one of bars' closes
+func closes(create func(p Params) (func(float64) (map[string]float64, bool), error)) func(p Params) (update, error) {
+	return func(p Params) (update, error) {
+		add, err := create(p)
+		if err != nil {
+			return nil, err
+		}
+		return func(bar marketdata.Bar) (map[string]float64, bool) {
+			return add(bar.Close)
+		}, nil
+	}
+}
+
+// scalar names the output of an indicator with one value
+func scalar(name string, add func(float64) (float64, bool)) func(float64) (map[string]float64, bool) {
+	return func(v float64) (map[string]float64, bool) {
+		value, ok := add(v)
+		return map[string]float64{name: value}, ok
+	}
+}
+
+// Names returns the names of the indicators that can be computed by name in
+// sorted order
+func Names() []string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Spec is an indicator chosen by name with its parameters
+type Spec struct {
+	Name string `json:"name"`
+	// Params include the defaults of those not given
+	Params Params `json:"params"`
+	def    definition
+}
+
+// NewSpec looks up an indicator by name and checks its parameters. Periods
+// are whole numbers from 1 to 1000; the vwap period may also be 0.
+func NewSpec(name string, params Params) (Spec, error) {
+	def, ok := definitions[name]
+	if !ok {
+		return Spec{}, fmt.Errorf("unknown indicator %q, must be one of %v", name, Names())
+	}
+
+	resolved := make(Params, len(def.defaults))
+	for param, value := range def.defaults {
+		resolved[param] = value
+	}
+	for param, value := range params {
+		if _, ok := def.defaults[param]; !ok {
+			return Spec{}, fmt.Errorf("indicator %s does not take parameter %s, it takes %v", name, param, paramNames(def.defaults))
+		}
+		resolved[param] = value
+	}
+
+	if _, err := def.create(resolved); err != nil {
+		return Spec{}, fmt.Errorf("indicator %s: %w", name, err)
+	}
+	return Spec{Name: name, Params: resolved, def: def}, nil
+}
+
+// Warmup is how many bars before the first value asked for the indicator
+// needs. Recursive averages are given extra bars to settle. The on-balance
+// volume is a running total, so it always depends on its first bar.
+func (s Spec) Warmup() int {
+	return s.def.warmup(s.Params)
+}
+
+// Compute runs the indicator over bars in time order and returns its values,
+// leaving out the bars it has no value for yet
+func (s Spec) Compute(bars []marketdata.Bar) []Point {
+	add, _ := s.def.create(s.Params)
+
+	points := make([]Point, 0, len(bars))
+	for _, bar := range bars {
+		if values, ok := add(bar); ok {
+			points = append(points, Point{Timestamp: bar.Timestamp, Values: values})
+		}
+	}
+	return points
+}
+
+func paramNames(params Params) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Closes returns the closing prices of bars
+func Closes(bars []marketdata.Bar) []float64 {
+	closes := make([]float64, len(bars))
+	for i, bar := range bars {
+		closes[i] = bar.Close
+	}
+	return closes
+}
+
+// series runs a streaming indicator over n inputs. Positions without a value
+// yet hold blank.
+func series[T any](n int, blank T, next func(i int) (T, bool)) []T {
+	out := make([]T, n)
+	for i := range out {
+		v, ok := next(i)
+		if !ok {
+			v = blank
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// SMASeries returns the simple moving average at each value, NaN until there
+// is one
+func SMASeries(values []float64, period int) ([]float64, error) {
+	sma, err := NewSMA(period)
+	if err != nil {
+		return nil, err
+	}
+	return series(len(values), math.NaN(), func(i int) (float64, bool) { return sma.Add(values[i]) }), nil
+}
+
+// EMASeries returns the exponential moving average at each value, NaN until
+// there is one
+func EMASeries(values []float64, period int) ([]float64, error) {
+	ema, err := NewEMA(period)
+	if err != nil {
+		return nil, err
+	}
+	return series(len(values), math.NaN(), func(i int) (float64, bool) { return ema.Add(values[i]) }), nil
+}
+
+// RSISeries returns the relative strength index at each value, NaN until
+// there is one
+func RSISeries(values []float64, period int) ([]float64, error) {
+	rsi, err := NewRSI(period)
+	if err != nil {
+		return nil, err
+	}
+	return series(len(values), math.NaN(), func(i int) (float64, bool) { return rsi.Add(values[i]) }), nil
+}
+
+// MACDSeries returns the MACD at each value, with NaN fields until there is
+// one
+func MACDSeries(values []float64, fast, slow, signal int) ([]MACDValue, error) {
+	macd, err := NewMACD(fast, slow, signal)
+	if err != nil {
+		return nil, err
+	}
+	nan := math.NaN()
+	return series(len(values), MACDValue{nan, nan, nan}, func(i int) (MACDValue, bool) { return macd.Add(values[i]) }), nil
+}
+
+// BollingerSeries returns the Bollinger Bands at each value, with NaN fields
+// until there are any
+func BollingerSeries(values []float64, period int, width float64) ([]BandsValue, error) {
+	bands, err := NewBollinger(period, width)
+	if err != nil {
+		return nil, err
+	}
+	nan := math.NaN()
+	return series(len(values), BandsValue{nan, nan, nan}, func(i int) (BandsValue, bool) { return bands.Add(values[i]) }), nil
+}
+
+// ATRSeries returns the average true range at each bar, NaN until there is
+// one
+func ATRSeries(bars []marketdata.Bar, period int) ([]float64, error) {
+	atr, err := NewATR(period)
+	if err != nil {
+		return nil, err
+	}
+	return series(len(bars), math.NaN(), func(i int) (float64, bool) { return atr.Update(bars[i]) }), nil
+}
+
+// VWAPSeries returns the VWAP at each bar, NaN when there is none. A period
+// of zero averages each New York day's bars.
+func VWAPSeries(bars []marketdata.Bar, period int) ([]float64, error) {
+	vwap, err := NewVWAP(period, utils.NewYork)
+	if err != nil {
+		return nil, err
+	}
+	return series(len(bars), math.NaN(), func(i int) (float64, bool) { return vwap.Update(bars[i]) }), nil
+}
+
+// StochasticSeries returns the stochastic oscillator at each bar, with NaN
+// fields until there is one
+func StochasticSeries(bars []marketdata.Bar, period, smooth int) ([]StochasticValue, error) {
+	stochastic, err := NewStochastic(period, smooth)
+	if err != nil {
+		return nil, err
+	}
+	nan := math.NaN()
+	return series(len(bars), StochasticValue{nan, nan}, func(i int) (StochasticValue, bool) { return stochastic.Update(bars[i]) }), nil
+}
+
+// OBVSeries returns the on-balance volume at each bar
+func OBVSeries(bars []marketdata.Bar) []float64 {
+	obv := NewOBV()
+	return series(len(bars), 0, func(i int) (float64, bool) { return obv.Update(bars[i]) })
+}
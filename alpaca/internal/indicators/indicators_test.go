@@ -0,0 +1,337 @@
+package indicators
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+// rsiCloses are the closes of the 14 period RSI worked example published by
+// StockCharts. Its spreadsheet rounds the average gain and loss to two places,
+// giving 70.53 for the first value; rsiWant are the unrounded values.
+var (
+	rsiCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+	}
+	rsiWant = []float64{70.46, 66.25, 66.48, 69.35, 66.29, 57.92}
+)
+
+// emaCloses and emaWant are the 10 period EMA worked example published by
+// StockCharts, rounded to two places
+var (
+	emaCloses = []float64{
+		22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+		22.15, 22.39, 22.38, 22.61, 23.36,
+	}
+	emaWant = []float64{22.22, 22.21, 22.24, 22.27, 22.33, 22.52}
+)
+
+// testBars are bars with a gap up on the fourth and flat closes at the end
+var testBars = []marketdata.Bar{
+	{High: 10, Low: 8, Close: 9, Volume: 100},
+	{High: 11, Low: 9, Close: 10.5, Volume: 200},
+	{High: 12, Low: 10.5, Close: 11, Volume: 300},
+	{High: 13, Low: 12.5, Close: 12.8, Volume: 400},
+	{High: 12.5, Low: 11.5, Close: 12, Volume: 500},
+	{High: 12.5, Low: 11.5, Close: 12, Volume: 600},
+}
+
+// checkSeries compares a series with want to within tol, where NaN marks the
+// positions without a value
+func checkSeries(t *testing.T, got, want []float64, tol float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d values, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.IsNaN(want[i]) {
+			if !math.IsNaN(got[i]) {
+				t.Errorf("value %d = %v, want none", i, got[i])
+			}
+			continue
+		}
+		if math.Abs(got[i]-want[i]) > tol {
+			t.Errorf("value %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+// blanks prepends n NaNs to want
+func blanks(n int, want ...float64) []float64 {
+	out := make([]float64, n, n+len(want))
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return append(out, want...)
+}
+
+func TestSMA(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	got, err := SMASeries(values, 3)
+	if err != nil {
+		t.Fatalf("SMASeries() error = %v", err)
+	}
+	checkSeries(t, got, blanks(2, 2, 3, 4, 5, 6, 7, 8, 9), 1e-12)
+
+	// Many laps of the window leave no rounding error behind
+	sma, _ := NewSMA(4)
+	for i := 0; i < 10000; i++ {
+		sma.Add(0.1 * float64(i%7))
+	}
+	for _, v := range []float64{1, 1, 1, 1} {
+		sma.Add(v)
+	}
+	if v, _ := sma.Value(); v != 1 {
+		t.Errorf("Value() = %v, want exactly 1", v)
+	}
+}
+
+func TestEMA(t *testing.T) {
+	got, err := EMASeries(emaCloses, 10)
+	if err != nil {
+		t.Fatalf("EMASeries() error = %v", err)
+	}
+	checkSeries(t, got, blanks(9, emaWant...), 0.005)
+}
+
+func TestRSI(t *testing.T) {
+	got, err := RSISeries(rsiCloses, 14)
+	if err != nil {
+		t.Fatalf("RSISeries() error = %v", err)
+	}
+	checkSeries(t, got, blanks(14, rsiWant...), 0.01)
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "flat", values: []float64{5, 5, 5}, want: 50},
+		{name: "only gains", values: []float64{1, 2, 3}, want: 100},
+		{name: "only losses", values: []float64{3, 2, 1}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsi, _ := NewRSI(2)
+			for _, v := range tt.values {
+				rsi.Add(v)
+			}
+			if v, ok := rsi.Value(); !ok || v != tt.want {
+				t.Errorf("Value() = %v, %t, want %v", v, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMACD(t *testing.T) {
+	got, err := MACDSeries(emaCloses, 3, 5, 2)
+	if err != nil {
+		t.Fatalf("MACDSeries() error = %v", err)
+	}
+	fast, _ := EMASeries(emaCloses, 3)
+	slow, _ := EMASeries(emaCloses, 5)
+
+	// The signal line forms after slow+signal-1 values
+	for i, m := range got[:5] {
+		if !math.IsNaN(m.MACD) {
+			t.Errorf("value %d = %+v, want none", i, m)
+		}
+	}
+	var lines []float64
+	for i := 4; i < len(emaCloses); i++ {
+		lines = append(lines, fast[i]-slow[i])
+	}
+	signal, _ := EMASeries(lines, 2)
+	for i := 5; i < len(got); i++ {
+		m, line, sig := got[i], lines[i-4], signal[i-4]
+		if math.Abs(m.MACD-line) > 1e-12 || math.Abs(m.Signal-sig) > 1e-12 || math.Abs(m.Histogram-(line-sig)) > 1e-12 {
+			t.Errorf("value %d = %+v, want MACD %v and signal %v", i, m, line, sig)
+		}
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	got, err := BollingerSeries([]float64{2, 4, 4, 4, 5, 5, 7, 9}, 8, 2)
+	if err != nil {
+		t.Fatalf("BollingerSeries() error = %v", err)
+	}
+	// The mean is 5 and the population standard deviation 2
+	if b := got[7]; b != (BandsValue{Middle: 5, Upper: 9, Lower: 1}) {
+		t.Errorf("bands = %+v, want 5 with bands at 1 and 9", b)
+	}
+	if !math.IsNaN(got[6].Middle) {
+		t.Errorf("bands before the period = %+v, want none", got[6])
+	}
+}
+
+func TestATR(t *testing.T) {
+	got, err := ATRSeries(testBars, 2)
+	if err != nil {
+		t.Fatalf("ATRSeries() error = %v", err)
+	}
+	// True ranges 2, 2, 1.5, 2 across the gap up from the previous close,
+	// 1.3 down to the low from it, then 1
+	checkSeries(t, got, blanks(1, 2, 1.75, 1.875, 1.5875, 1.29375), 1e-12)
+}
+
+func TestStochastic(t *testing.T) {
+	got, err := StochasticSeries(testBars, 3, 2)
+	if err != nil {
+		t.Fatalf("StochasticSeries() error = %v", err)
+	}
+	want := []StochasticValue{
+		{K: 95, D: 85},
+		{K: 100 * (12 - 10.5) / (13 - 10.5), D: (95 + 60) / 2.0},
+		{K: 100 * (12 - 11.5) / (13 - 11.5), D: (60 + 100.0/3) / 2},
+	}
+	for i, w := range want {
+		g := got[i+3]
+		if math.Abs(g.K-w.K) > 1e-9 || math.Abs(g.D-w.D) > 1e-9 {
+			t.Errorf("value %d = %+v, want %+v", i+3, g, w)
+		}
+	}
+	if !math.IsNaN(got[2].K) {
+		t.Errorf("value before D forms = %+v, want none", got[2])
+	}
+
+	flat, _ := NewStochastic(2, 1)
+	flat.Update(marketdata.Bar{High: 5, Low: 5, Close: 5})
+	if v, _ := flat.Update(marketdata.Bar{High: 5, Low: 5, Close: 5}); v.K != 50 {
+		t.Errorf("K over a flat range = %v, want 50", v.K)
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.November, day, hour, minute, 0, 0, utils.NewYork)
+	}
+	bars := []marketdata.Bar{
+		{Timestamp: at(26, 10, 0), VWAP: 10, Volume: 100},
+		// Priced at its typical price and after midnight in UTC, but still
+		// the same day in New York
+		{Timestamp: at(26, 19, 30), High: 12, Low: 10, Close: 11, Volume: 300},
+		{Timestamp: at(27, 10, 0), VWAP: 20, Volume: 50},
+		{Timestamp: at(28, 10, 0), VWAP: 21, Volume: 0},
+	}
+
+	daily, err := VWAPSeries(bars, 0)
+	if err != nil {
+		t.Fatalf("VWAPSeries() error = %v", err)
+	}
+	checkSeries(t, daily, []float64{10, 10.75, 20, math.NaN()}, 1e-12)
+
+	rolling, err := VWAPSeries(bars, 2)
+	if err != nil {
+		t.Fatalf("VWAPSeries() error = %v", err)
+	}
+	checkSeries(t, rolling, blanks(1, 10.75, 4300.0/350, 20), 1e-12)
+}
+
+func TestOBV(t *testing.T) {
+	checkSeries(t, OBVSeries(testBars), []float64{0, 200, 500, 900, 400, 400}, 0)
+}
+
+func TestPeriodErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		create  func() error
+		wantErr string
+	}{
+		{name: "sma", create: func() error { _, err := NewSMA(0); return err }, wantErr: "period must be at least 1, not 0"},
+		{name: "ema", create: func() error { _, err := NewEMA(-1); return err }, wantErr: "period must be at least 1, not -1"},
+		{name: "rsi", create: func() error { _, err := NewRSI(0); return err }, wantErr: "period must be at least 1, not 0"},
+		{name: "macd signal", create: func() error { _, err := NewMACD(12, 26, 0); return err }, wantErr: "signal must be at least 1, not 0"},
+		{name: "stochastic smooth", create: func() error { _, err := NewStochastic(14, 0); return err }, wantErr: "smooth must be at least 1, not 0"},
+		{name: "vwap", create: func() error { _, err := NewVWAP(-1, utils.NewYork); return err }, wantErr: "period must be at least 0, not -1"},
+		{name: "daily vwap without location", create: func() error { _, err := NewVWAP(0, nil); return err }, wantErr: "a daily VWAP needs a location"},
+		{name: "series", create: func() error { _, err := ATRSeries(testBars, 0); return err }, wantErr: "period must be at least 1, not 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.create(); err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     Params
+		wantParams Params
+		wantWarmup int
+		wantErr    string
+	}{
+		{name: "sma", wantParams: Params{"period": 20}, wantWarmup: 19},
+		{name: "ema", params: Params{"period": 10}, wantParams: Params{"period": 10}, wantWarmup: 49},
+		{name: "rsi", wantParams: Params{"period": 14}, wantWarmup: 126},
+		{name: "macd", params: Params{"signal": 5}, wantParams: Params{"fast": 12, "slow": 26, "signal": 5}, wantWarmup: 133},
+		{name: "vwap", wantParams: Params{"period": 0}, wantWarmup: 0},
+		{name: "obv", wantParams: Params{}, wantWarmup: 0},
+		{name: "kama", wantErr: `unknown indicator "kama"`},
+		{name: "sma", params: Params{"length": 5}, wantErr: "indicator sma does not take parameter length, it takes [period]"},
+		{name: "sma", params: Params{"period": 2.5}, wantErr: "indicator sma: parameter period must be a whole number"},
+		{name: "ema", params: Params{"period": 1001}, wantErr: "indicator ema: parameter period must be from 1 to 1000"},
+		{name: "vwap", params: Params{"period": -1}, wantErr: "indicator vwap: parameter period must be from 0 to 1000"},
+		{name: "macd", params: Params{"fast": 26}, wantErr: "indicator macd: fast must be less than slow"},
+		{name: "bollinger", params: Params{"stddev": 0}, wantErr: "indicator bollinger: stddev must be greater than 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := NewSpec(tt.name, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewSpec() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSpec() error = %v", err)
+			}
+			if len(spec.Params) != len(tt.wantParams) {
+				t.Errorf("Params = %v, want %v", spec.Params, tt.wantParams)
+			}
+			for name, want := range tt.wantParams {
+				if spec.Params[name] != want {
+					t.Errorf("Params = %v, want %v", spec.Params, tt.wantParams)
+				}
+			}
+			if got := spec.Warmup(); got != tt.wantWarmup {
+				t.Errorf("Warmup() = %d, want %d", got, tt.wantWarmup)
+			}
+		})
+	}
+}
+
+func TestSpecCompute(t *testing.T) {
+	bars := make([]marketdata.Bar, len(rsiCloses))
+	start := time.Date(2024, time.November, 1, 16, 0, 0, 0, utils.NewYork)
+	for i, c := range rsiCloses {
+		bars[i] = marketdata.Bar{Timestamp: start.AddDate(0, 0, i), Close: c}
+	}
+
+	spec, err := NewSpec("rsi", nil)
+	if err != nil {
+		t.Fatalf("NewSpec() error = %v", err)
+	}
+	points := spec.Compute(bars)
+	want, _ := RSISeries(Closes(bars), 14)
+
+	// Bars without a value yet are left out
+	if len(points) != len(want)-14 {
+		t.Fatalf("Compute() returned %d points, want %d", len(points), len(want)-14)
+	}
+	for i, p := range points {
+		if !p.Timestamp.Equal(bars[i+14].Timestamp) || p.Values["rsi"] != want[i+14] {
+			t.Errorf("point %d = %+v, want rsi %v at %s", i, p, want[i+14], bars[i+14].Timestamp)
+		}
+	}
+}
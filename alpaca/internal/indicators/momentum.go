@@ -0,0 +1,176 @@
+package indicators
+
+import "github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+
+// RSI is Wilder's relative strength index of values, from 0 to 100
+type RSI struct {
+	gains, losses *wilder
+	prev          float64
+	started       bool
+	value         float64
+	ready         bool
+}
+
+// NewRSI creates a relative strength index over period changes, which must
+// be at least 1
+func NewRSI(period int) (*RSI, error) {
+	if err := checkPeriod("period", period, 1); err != nil {
+		return nil, err
+	}
+	return &RSI{gains: newWilder(period), losses: newWilder(period)}, nil
+}
+
+// Add adds a value and returns the index once period changes, so period+1
+// values, have been added
+func (r *RSI) Add(v float64) (float64, bool) {
+	if !r.started {
+		r.prev, r.started = v, true
+		return 0, false
+	}
+	change := v - r.prev
+	r.prev = v
+
+	gain, _ := r.gains.add(max(change, 0))
+	loss, ok := r.losses.add(max(-change, 0))
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case loss == 0 && gain == 0:
+		r.value = 50
+	case loss == 0:
+		r.value = 100
+	default:
+		r.value = 100 - 100/(1+gain/loss)
+	}
+	r.ready = true
+	return r.value, true
+}
+
+// Value returns the latest index, and false until there is one
+func (r *RSI) Value() (float64, bool) {
+	return r.value, r.ready
+}
+
+// MACDValue is a value of the MACD indicator
+type MACDValue struct {
+	// MACD is the fast average less the slow one
+	MACD float64 `json:"macd"`
+	// Signal is the exponential moving average of MACD
+	Signal float64 `json:"signal"`
+	// Histogram is MACD less Signal
+	Histogram float64 `json:"histogram"`
+}
+
+// MACD is the moving average convergence divergence of values
+type MACD struct {
+	fast, slow, signal *EMA
+	value              MACDValue
+	ready              bool
+}
+
+// NewMACD creates a MACD indicator from fast and slow exponential moving
+// averages, with a signal line averaging the difference over signal values.
+// Each period must be at least 1.
+func NewMACD(fast, slow, signal int) (*MACD, error) {
+	if err := checkPeriod("fast", fast, 1); err != nil {
+		return nil, err
+	}
+	if err := checkPeriod("slow", slow, 1); err != nil {
+		return nil, err
+	}
+	if err := checkPeriod("signal", signal, 1); err != nil {
+		return nil, err
+	}
+	return &MACD{fast: newEMA(fast), slow: newEMA(slow), signal: newEMA(signal)}, nil
+}
+
+// Add adds a value and returns the indicator once the signal line has formed,
+// after slow+signal-1 values
+func (m *MACD) Add(v float64) (MACDValue, bool) {
+	fast, _ := m.fast.Add(v)
+	slow, ok := m.slow.Add(v)
+	if !ok {
+		return MACDValue{}, false
+	}
+	macd := fast - slow
+	signal, ok := m.signal.Add(macd)
+	if !ok {
+		return MACDValue{}, false
+	}
+
+	m.value = MACDValue{MACD: macd, Signal: signal, Histogram: macd - signal}
+	m.ready = true
+	return m.value, true
+}
+
+// Value returns the latest value, and false until there is one
+func (m *MACD) Value() (MACDValue, bool) {
+	return m.value, m.ready
+}
+
+// StochasticValue is a value of the stochastic oscillator, from 0 to 100
+type StochasticValue struct {
+	// K is where the close sits in the high-low range of the period
+	K float64 `json:"k"`
+	// D is the simple moving average of K
+	D float64 `json:"d"`
+}
+
+// Stochastic is the stochastic oscillator of bars
+type Stochastic struct {
+	period int
+	highs  []float64
+	lows   []float64
+	smooth *SMA
+	value  StochasticValue
+	ready  bool
+}
+
+// NewStochastic creates a stochastic oscillator over the range of period bars,
+// with D averaging K over smooth bars. Both must be at least 1.
+func NewStochastic(period, smooth int) (*Stochastic, error) {
+	if err := checkPeriod("period", period, 1); err != nil {
+		return nil, err
+	}
+	if err := checkPeriod("smooth", smooth, 1); err != nil {
+		return nil, err
+	}
+	return &Stochastic{period: period, smooth: newSMA(smooth)}, nil
+}
+
+// Update adds a bar and returns the oscillator once D has formed, after
+// period+smooth-1 bars. K is 50 while the range is flat.
+func (s *Stochastic) Update(bar marketdata.Bar) (StochasticValue, bool) {
+	s.highs = append(s.highs, bar.High)
+	s.lows = append(s.lows, bar.Low)
+	if len(s.highs) > s.period {
+		s.highs, s.lows = s.highs[1:], s.lows[1:]
+	}
+	if len(s.highs) < s.period {
+		return StochasticValue{}, false
+	}
+
+	high, low := s.highs[0], s.lows[0]
+	for i := range s.highs {
+		high, low = max(high, s.highs[i]), min(low, s.lows[i])
+	}
+	k := 50.0
+	if high > low {
+		k = 100 * (bar.Close - low) / (high - low)
+	}
+	d, ok := s.smooth.Add(k)
+	if !ok {
+		return StochasticValue{}, false
+	}
+
+	s.value = StochasticValue{K: k, D: d}
+	s.ready = true
+	return s.value, true
+}
+
+// Value returns the latest value, and false until there is one
+func (s *Stochastic) Value() (StochasticValue, bool) {
+	return s.value, s.ready
+}
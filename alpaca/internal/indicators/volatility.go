@@ -0,0 +1,97 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// BandsValue is a value of Bollinger Bands
+type BandsValue struct {
+	Middle float64 `json:"middle"`
+	Upper  float64 `json:"upper"`
+	Lower  float64 `json:"lower"`
+}
+
+// Bollinger is Bollinger Bands: the simple moving average of values with bands
+// a number of standard deviations above and below it
+type Bollinger struct {
+	period int
+	width  float64
+	window []float64
+	value  BandsValue
+	ready  bool
+}
+
+// NewBollinger creates Bollinger Bands over period values, width population
+// standard deviations either side of the average. The period must be at
+// least 1.
+func NewBollinger(period int, width float64) (*Bollinger, error) {
+	if err := checkPeriod("period", period, 1); err != nil {
+		return nil, err
+	}
+	return &Bollinger{period: period, width: width}, nil
+}
+
+// Add adds a value and returns the bands once period values have been added
+func (b *Bollinger) Add(v float64) (BandsValue, bool) {
+	b.window = append(b.window, v)
+	if len(b.window) > b.period {
+		b.window = b.window[1:]
+	}
+	if len(b.window) < b.period {
+		return BandsValue{}, false
+	}
+
+	mean := 0.0
+	for _, w := range b.window {
+		mean += w
+	}
+	mean /= float64(b.period)
+	variance := 0.0
+	for _, w := range b.window {
+		variance += (w - mean) * (w - mean)
+	}
+	spread := b.width * math.Sqrt(variance/float64(b.period))
+
+	b.value = BandsValue{Middle: mean, Upper: mean + spread, Lower: mean - spread}
+	b.ready = true
+	return b.value, true
+}
+
+// Value returns the latest bands, and false until there are any
+func (b *Bollinger) Value() (BandsValue, bool) {
+	return b.value, b.ready
+}
+
+// ATR is Wilder's average true range of bars
+type ATR struct {
+	average   *wilder
+	prevClose float64
+	started   bool
+}
+
+// NewATR creates an average true range over period bars, which must be at
+// least 1
+func NewATR(period int) (*ATR, error) {
+	if err := checkPeriod("period", period, 1); err != nil {
+		return nil, err
+	}
+	return &ATR{average: newWilder(period)}, nil
+}
+
+// Update adds a bar and returns the average once period bars have been added.
+// The true range of the first bar is its high less its low.
+func (a *ATR) Update(bar marketdata.Bar) (float64, bool) {
+	trueRange := bar.High - bar.Low
+	if a.started {
+		trueRange = max(trueRange, math.Abs(bar.High-a.prevClose), math.Abs(bar.Low-a.prevClose))
+	}
+	a.prevClose, a.started = bar.Close, true
+	return a.average.add(trueRange)
+}
+
+// Value returns the latest average, and false until there is one
+func (a *ATR) Value() (float64, bool) {
+	return a.average.value, a.average.ready
+}
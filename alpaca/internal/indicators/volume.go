@@ -0,0 +1,105 @@
+package indicators
+
+import (
+	"errors"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// VWAP is the volume weighted average price of bars. Each bar is priced at
+// its own VWAP, or its typical price (high+low+close)/3 when it has none.
+type VWAP struct {
+	period  int
+	loc     *time.Location
+	prices  []float64
+	volumes []float64
+	day     string
+	value   float64
+	ready   bool
+}
+
+// NewVWAP creates a VWAP over the last period bars or, when period is zero,
+// over the bars of each day in loc since the first bar of the day
+func NewVWAP(period int, loc *time.Location) (*VWAP, error) {
+	if err := checkPeriod("period", period, 0); err != nil {
+		return nil, err
+	}
+	if period == 0 && loc == nil {
+		return nil, errors.New("a daily VWAP needs a location")
+	}
+	return &VWAP{period: period, loc: loc}, nil
+}
+
+// Update adds a bar and returns the average. There is none while the bars
+// being averaged have no volume, or until period bars have been added.
+func (v *VWAP) Update(bar marketdata.Bar) (float64, bool) {
+	if v.period == 0 {
+		if day := bar.Timestamp.In(v.loc).Format("2006-01-02"); day != v.day {
+			v.day, v.prices, v.volumes = day, v.prices[:0], v.volumes[:0]
+		}
+	}
+
+	price := bar.VWAP
+	if price == 0 {
+		price = (bar.High + bar.Low + bar.Close) / 3
+	}
+	v.prices = append(v.prices, price)
+	v.volumes = append(v.volumes, float64(bar.Volume))
+	if v.period > 0 && len(v.prices) > v.period {
+		v.prices, v.volumes = v.prices[1:], v.volumes[1:]
+	}
+
+	v.ready = false
+	if v.period > 0 && len(v.prices) < v.period {
+		return 0, false
+	}
+	notional, volume := 0.0, 0.0
+	for i := range v.prices {
+		notional += v.prices[i] * v.volumes[i]
+		volume += v.volumes[i]
+	}
+	if volume == 0 {
+		return 0, false
+	}
+	v.value, v.ready = notional/volume, true
+	return v.value, true
+}
+
+// Value returns the latest average, and false when there is none
+func (v *VWAP) Value() (float64, bool) {
+	return v.value, v.ready
+}
+
+// OBV is the on-balance volume of bars: a running total that adds a bar's
+// volume when it closes higher than the previous bar and subtracts it when it
+// closes lower. It starts at zero on the first bar.
+type OBV struct {
+	prevClose float64
+	value     float64
+	ready     bool
+}
+
+// NewOBV creates an on-balance volume indicator
+func NewOBV() *OBV {
+	return &OBV{}
+}
+
+// Update adds a bar and returns the running total
+func (o *OBV) Update(bar marketdata.Bar) (float64, bool) {
+	if o.ready {
+		switch {
+		case bar.Close > o.prevClose:
+			o.value += float64(bar.Volume)
+		case bar.Close < o.prevClose:
+			o.value -= float64(bar.Volume)
+		}
+	}
+	o.prevClose, o.ready = bar.Close, true
+	return o.value, true
+}
+
+// Value returns the running total, and false until a bar has been added
+func (o *OBV) Value() (float64, bool) {
+	return o.value, o.ready
+}
@@ -0,0 +1,181 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// Wrap records every order call made on an account's broker, with the
+// broker's response
+func (j *Journal) Wrap(account string, broker trading.Broker) trading.Broker {
+	return &journaledBroker{Broker: broker, account: account, journal: j}
+}
+
+// Follow records every order event published on bus until ctx is cancelled.
+// Publishers wait for the journal rather than have a fill go unrecorded.
+func (j *Journal) Follow(ctx context.Context, bus *trading.EventBus) {
+	events, unsubscribe := bus.SubscribeBlocking(1024)
+	defer unsubscribe()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			j.recordEvent(event)
+		case <-ctx.Done():
+			// Write the updates already received before returning, so none
+			// are lost when the server shuts down
+			for {
+				select {
+				case event, ok := <-events:
+					if !ok {
+						return
+					}
+					j.recordEvent(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// recordEvent writes an order update from the trade updates stream
+func (j *Journal) recordEvent(event trading.OrderEvent) {
+	order := event.Order
+	j.record(Record{
+		At:            event.At,
+		Account:       event.Account,
+		Kind:          KindUpdate,
+		Action:        ActionTradeUpdate,
+		Event:         event.Event,
+		OrderID:       order.ID,
+		ClientOrderID: order.ClientOrderID,
+		Symbol:        order.Symbol,
+		Side:          order.Side,
+		Status:        order.Status,
+		Price:         event.Price,
+		Qty:           event.Qty,
+		Order:         &order,
+	})
+}
+
+// journaledBroker writes a request record before each order call and a
+// response or error record after it
+type journaledBroker struct {
+	trading.Broker
+	account string
+	journal *Journal
+	meta    trading.OrderMeta
+}
+
+func (b *journaledBroker) Unwrap() trading.Broker {
+	return b.Broker
+}
+
+func (b *journaledBroker) WithMeta(meta trading.OrderMeta) trading.Broker {
+	return &journaledBroker{Broker: trading.WithMeta(b.Broker, meta), account: b.account, journal: b.journal, meta: meta}
+}
+
+func (b *journaledBroker) PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error) {
+	b.request(ActionPlaceOrder, Record{ClientOrderID: req.ClientOrderID, Symbol: req.Symbol, Side: req.Side, Qty: req.Qty}, req)
+
+	order, err := b.Broker.PlaceOrder(req)
+	b.response(ActionPlaceOrder, Record{ClientOrderID: req.ClientOrderID, Symbol: req.Symbol, Side: req.Side}, order, err)
+	return order, err
+}
+
+// ObserveDuplicate records a retried placement and the order it was answered
+// with, both marked as duplicates so the retry is not taken for a new order
+func (b *journaledBroker) ObserveDuplicate(req alpaca.PlaceOrderRequest, existing *alpaca.Order) {
+	b.request(ActionPlaceOrder, Record{ClientOrderID: req.ClientOrderID, Symbol: req.Symbol, Side: req.Side, Qty: req.Qty, Duplicate: true}, req)
+	b.response(ActionPlaceOrder, Record{ClientOrderID: req.ClientOrderID, Symbol: req.Symbol, Side: req.Side, Duplicate: true}, existing, nil)
+}
+
+func (b *journaledBroker) ReplaceOrder(orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error) {
+	b.request(ActionReplaceOrder, Record{OrderID: orderID, Qty: req.Qty}, req)
+
+	order, err := b.Broker.ReplaceOrder(orderID, req)
+	b.response(ActionReplaceOrder, Record{OrderID: orderID}, order, err)
+	return order, err
+}
+
+func (b *journaledBroker) CancelOrder(orderID string) error {
+	b.request(ActionCancelOrder, Record{OrderID: orderID}, nil)
+
+	err := b.Broker.CancelOrder(orderID)
+	b.response(ActionCancelOrder, Record{OrderID: orderID}, nil, err)
+	return err
+}
+
+func (b *journaledBroker) CancelAllOrders() error {
+	b.request(ActionCancelAllOrders, Record{}, nil)
+
+	err := b.Broker.CancelAllOrders()
+	b.response(ActionCancelAllOrders, Record{}, nil, err)
+	return err
+}
+
+func (b *journaledBroker) ClosePosition(symbol string, req alpaca.ClosePositionRequest) (*alpaca.Order, error) {
+	b.request(ActionClosePosition, Record{Symbol: symbol}, req)
+
+	order, err := b.Broker.ClosePosition(symbol, req)
+	b.response(ActionClosePosition, Record{Symbol: symbol}, order, err)
+	return order, err
+}
+
+func (b *journaledBroker) CloseAllPositions(req alpaca.CloseAllPositionsRequest) ([]alpaca.Order, error) {
+	b.request(ActionCloseAllPositions, Record{}, req)
+
+	orders, err := b.Broker.CloseAllPositions(req)
+	if err != nil || len(orders) == 0 {
+		b.response(ActionCloseAllPositions, Record{}, nil, err)
+	}
+	for i := range orders {
+		b.response(ActionCloseAllPositions, Record{}, &orders[i], nil)
+	}
+	return orders, err
+}
+
+// request records an order call about to be made
+func (b *journaledBroker) request(action string, r Record, req any) {
+	if req != nil {
+		if data, err := json.Marshal(req); err == nil {
+			r.Request = data
+		}
+	}
+	r.Account = b.account
+	r.Kind = KindRequest
+	r.Action = action
+	r.Meta = b.meta
+	b.journal.record(r)
+}
+
+// response records the outcome of an order call, filling in the order
+// details from the broker's response when there is one
+func (b *journaledBroker) response(action string, r Record, order *alpaca.Order, err error) {
+	r.Account = b.account
+	r.Kind = KindResponse
+	r.Action = action
+	r.Meta = b.meta
+	if err != nil {
+		r.Kind = KindError
+		r.Error = err.Error()
+	}
+	if order != nil {
+		r.Order = order
+		r.OrderID = order.ID
+		r.ClientOrderID = order.ClientOrderID
+		r.Symbol = order.Symbol
+		r.Side = order.Side
+		r.Status = order.Status
+		r.Qty = order.Qty
+		r.Price = order.FilledAvgPrice
+	}
+	b.journal.record(r)
+}
@@ -0,0 +1,347 @@
+package journal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultLimit caps the records a query returns when no limit is given
+const defaultLimit = 500
+
+var (
+	recordsBucket = []byte("records")
+	metaBucket    = []byte("order_meta")
+	// accountsBucket holds a bucket per account listing the sequence numbers
+	// of its records, and fillsBucket one listing those of its fills, so
+	// account queries do not scan every record
+	accountsBucket = []byte("accounts")
+	fillsBucket    = []byte("fills")
+)
+
+// Kinds of journal record
+const (
+	KindRequest  = "request"  // an order call as sent to the broker
+	KindResponse = "response" // the broker's answer to an order call
+	KindError    = "error"    // an order call the broker or a check refused
+	KindUpdate   = "update"   // a status change or fill from the trade updates stream
+)
+
+// Actions a record can describe
+const (
+	ActionPlaceOrder        = "place_order"
+	ActionReplaceOrder      = "replace_order"
+	ActionCancelOrder       = "cancel_order"
+	ActionCancelAllOrders   = "cancel_all_orders"
+	ActionClosePosition     = "close_position"
+	ActionCloseAllPositions = "close_all_positions"
+	ActionTradeUpdate       = "trade_update"
+)
+
+// Record is a single journal entry
+type Record struct {
+	Seq           uint64            `json:"seq"`
+	At            time.Time         `json:"at"`
+	Account       string            `json:"account"`
+	Kind          string            `json:"kind"`
+	Action        string            `json:"action"`
+	Event         string            `json:"event,omitempty"`
+	OrderID       string            `json:"order_id,omitempty"`
+	ClientOrderID string            `json:"client_order_id,omitempty"`
+	Symbol        string            `json:"symbol,omitempty"`
+	Side          alpaca.Side       `json:"side,omitempty"`
+	Status        string            `json:"status,omitempty"`
+	Price         *decimal.Decimal  `json:"price,omitempty"`
+	Qty           *decimal.Decimal  `json:"qty,omitempty"`
+	Request       json.RawMessage   `json:"request,omitempty"`
+	Order         *alpaca.Order     `json:"order,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Duplicate     bool              `json:"duplicate,omitempty"` // a retried placement answered with an earlier order
+	Meta          trading.OrderMeta `json:"meta"`
+}
+
+// Filter selects journal records. Empty fields match everything.
+type Filter struct {
+	Account  string
+	Symbol   string
+	Strategy string
+	Status   string
+	Kind     string
+	OrderID  string
+	Start    time.Time
+	End      time.Time
+	Limit    int
+}
+
+func (f Filter) matches(r Record) bool {
+	switch {
+	case f.Account != "" && r.Account != f.Account:
+		return false
+	case f.Symbol != "" && !strings.EqualFold(r.Symbol, f.Symbol):
+		return false
+	case f.Strategy != "" && r.Meta.Strategy != f.Strategy:
+		return false
+	case f.Status != "" && r.Status != f.Status:
+		return false
+	case f.Kind != "" && r.Kind != f.Kind:
+		return false
+	case f.OrderID != "" && r.OrderID != f.OrderID:
+		return false
+	case !f.Start.IsZero() && r.At.Before(f.Start):
+		return false
+	case !f.End.IsZero() && r.At.After(f.End):
+		return false
+	}
+	return true
+}
+
+// Journal is an append-only record of every order call, broker response and
+// trade update, kept in an embedded BoltDB file
+type Journal struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the journal at path
+func Open(path string) (*Journal, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open journal %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{recordsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return buildIndexes(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initialize journal %s: %w", path, err)
+	}
+
+	return &Journal{db: db}, nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.db.Close()
+}
+
+// Append writes a record, assigning its sequence number. Records of orders
+// placed with metadata remember it so later updates of the order are tagged
+// with the same strategy.
+func (j *Journal) Append(r Record) error {
+	if r.At.IsZero() {
+		r.At = time.Now()
+	}
+
+	return j.db.Update(func(tx *bolt.Tx) error {
+		records, meta := tx.Bucket(recordsBucket), tx.Bucket(metaBucket)
+
+		if r.OrderID != "" {
+			if r.Meta == (trading.OrderMeta{}) {
+				if data := meta.Get([]byte(r.OrderID)); data != nil {
+					if err := json.Unmarshal(data, &r.Meta); err != nil {
+						return err
+					}
+				}
+			} else {
+				data, err := json.Marshal(r.Meta)
+				if err != nil {
+					return err
+				}
+				if err := meta.Put([]byte(r.OrderID), data); err != nil {
+					return err
+				}
+			}
+		}
+
+		seq, err := records.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.Seq = seq
+
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err := records.Put(seqKey(seq), data); err != nil {
+			return err
+		}
+		return index(tx, r)
+	})
+}
+
+// index lists a record under its account, and under the account's fills when
+// it is one
+func index(tx *bolt.Tx, r Record) error {
+	if r.Account == "" {
+		return nil
+	}
+	indexes := [][]byte{accountsBucket}
+	if r.isFill() {
+		indexes = append(indexes, fillsBucket)
+	}
+
+	for _, name := range indexes {
+		bucket, err := tx.Bucket(name).CreateBucketIfNotExists([]byte(r.Account))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(seqKey(r.Seq), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildIndexes creates the account indexes, listing every existing record in
+// them when a journal written before they existed is opened
+func buildIndexes(tx *bolt.Tx) error {
+	if tx.Bucket(accountsBucket) != nil && tx.Bucket(fillsBucket) != nil {
+		return nil
+	}
+	for _, name := range [][]byte{accountsBucket, fillsBucket} {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket(recordsBucket).ForEach(func(_, v []byte) error {
+		var r Record
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		return index(tx, r)
+	})
+}
+
+// isFill reports whether a record is the execution of a fill or partial fill
+func (r Record) isFill() bool {
+	return r.Kind == KindUpdate && r.Price != nil && r.Qty != nil &&
+		(r.Event == trading.EventFill || r.Event == trading.EventPartialFill)
+}
+
+// scan calls fn with records, newest or oldest first, until it returns
+// false. With an index only the records it lists for account are visited.
+func scan(tx *bolt.Tx, index []byte, account string, newestFirst bool, fn func(Record) bool) error {
+	records := tx.Bucket(recordsBucket)
+	c := records.Cursor()
+	if index != nil {
+		bucket := tx.Bucket(index).Bucket([]byte(account))
+		if bucket == nil {
+			return nil
+		}
+		c = bucket.Cursor()
+	}
+
+	first, next := c.First, c.Next
+	if newestFirst {
+		first, next = c.Last, c.Prev
+	}
+	for k, v := first(); k != nil; k, v = next() {
+		if index != nil {
+			v = records.Get(k)
+		}
+		var r Record
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		if !fn(r) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Query returns the records matching filter, newest first
+func (j *Journal) Query(filter Filter) ([]Record, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	var index []byte
+	if filter.Account != "" {
+		index = accountsBucket
+	}
+
+	records := []Record{}
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return scan(tx, index, filter.Account, true, func(r Record) bool {
+			if filter.matches(r) {
+				records = append(records, r)
+			}
+			return len(records) < limit
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// LatestOrders returns the last recorded state of every order on an account,
+// used to rebuild in-memory state after a restart
+func (j *Journal) LatestOrders(account string) ([]alpaca.Order, error) {
+	seen := make(map[string]bool)
+	orders := []alpaca.Order{}
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return scan(tx, accountsBucket, account, true, func(r Record) bool {
+			if r.Order != nil && !seen[r.Order.ID] {
+				seen[r.Order.ID] = true
+				orders = append(orders, *r.Order)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// Fills returns every fill and partial fill recorded on an account, oldest
+// first. Their Price and Qty are those of the execution.
+func (j *Journal) Fills(account string) ([]Record, error) {
+	fills := []Record{}
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return scan(tx, fillsBucket, account, false, func(r Record) bool {
+			fills = append(fills, r)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fills, nil
+}
+
+// record appends r, logging rather than failing since the journal must never
+// stand in the way of trading
+func (j *Journal) record(r Record) {
+	if err := j.Append(r); err != nil {
+		log.Printf("Warning: failed to write journal record: %v", err)
+	}
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
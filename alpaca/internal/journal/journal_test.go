@@ -0,0 +1,232 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
+)
+
+func decPtr(s string) *decimal.Decimal {
+	d := decimal.RequireFromString(s)
+	return &d
+}
+
+func openTestJournal(t *testing.T) (*Journal, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.db")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j, path
+}
+
+func newTestSim() *trading.SimBroker {
+	feed := trading.NewStaticPriceFeed(map[string]decimal.Decimal{"AAPL": decimal.NewFromInt(100), "MSFT": decimal.NewFromInt(200)})
+	return trading.NewSimBroker(feed, decimal.NewFromInt(100000))
+}
+
+func buy(symbol, qty string) alpaca.PlaceOrderRequest {
+	return alpaca.PlaceOrderRequest{Symbol: symbol, Qty: decPtr(qty), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day}
+}
+
+func TestJournaledBroker(t *testing.T) {
+	j, _ := openTestJournal(t)
+	broker := j.Wrap("paper", newTestSim())
+
+	order, err := trading.WithMeta(broker, trading.OrderMeta{Strategy: "sma_cross"}).PlaceOrder(buy("AAPL", "10"))
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	if _, err := broker.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "MSFT", Qty: decPtr("1"), Side: alpaca.Sell, Type: alpaca.Market, TimeInForce: alpaca.Day}); err == nil {
+		t.Fatal("PlaceOrder() selling without a position succeeded, want an error")
+	}
+
+	// Updates of an order placed by a strategy are tagged with it
+	if err := j.Append(Record{Account: "paper", Kind: KindUpdate, Action: ActionTradeUpdate, Event: trading.EventFill, OrderID: order.ID, Symbol: "AAPL"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		wantKinds []string
+	}{
+		{name: "every record, newest first", filter: Filter{Account: "paper"}, wantKinds: []string{KindUpdate, KindError, KindRequest, KindResponse, KindRequest}},
+		{name: "by symbol", filter: Filter{Symbol: "msft"}, wantKinds: []string{KindError, KindRequest}},
+		{name: "by kind", filter: Filter{Kind: KindResponse}, wantKinds: []string{KindResponse}},
+		{name: "by strategy", filter: Filter{Strategy: "sma_cross"}, wantKinds: []string{KindUpdate, KindResponse, KindRequest}},
+		{name: "by order", filter: Filter{OrderID: order.ID}, wantKinds: []string{KindUpdate, KindResponse}},
+		{name: "other account", filter: Filter{Account: "live"}},
+		{name: "limited", filter: Filter{Account: "paper", Limit: 2}, wantKinds: []string{KindUpdate, KindError}},
+		{name: "after the end", filter: Filter{Start: time.Now().Add(time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := j.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(records) != len(tt.wantKinds) {
+				t.Fatalf("Query() returned %d records, want %d", len(records), len(tt.wantKinds))
+			}
+			for i, r := range records {
+				if r.Kind != tt.wantKinds[i] {
+					t.Errorf("record %d kind = %s, want %s", i, r.Kind, tt.wantKinds[i])
+				}
+				if i > 0 && r.Seq >= records[i-1].Seq {
+					t.Errorf("record %d seq = %d, not older than %d", i, r.Seq, records[i-1].Seq)
+				}
+			}
+		})
+	}
+}
+
+func TestLatestOrdersAndFills(t *testing.T) {
+	j, path := openTestJournal(t)
+
+	order := alpaca.Order{ID: "order-1", Symbol: "AAPL", Status: "new"}
+	partial, filled := order, order
+	partial.Status, filled.Status = "partially_filled", "filled"
+	records := []Record{
+		{Account: "paper", Kind: KindResponse, Action: ActionPlaceOrder, OrderID: order.ID, Order: &order},
+		{Account: "paper", Kind: KindUpdate, Action: ActionTradeUpdate, Event: trading.EventPartialFill, OrderID: order.ID, Order: &partial, Price: decPtr("100"), Qty: decPtr("4")},
+		{Account: "live", Kind: KindUpdate, Action: ActionTradeUpdate, Event: trading.EventFill, OrderID: "order-2", Order: &alpaca.Order{ID: "order-2"}, Price: decPtr("50"), Qty: decPtr("1")},
+		{Account: "paper", Kind: KindUpdate, Action: ActionTradeUpdate, Event: trading.EventFill, OrderID: order.ID, Order: &filled, Price: decPtr("101"), Qty: decPtr("6")},
+		{Account: "paper", Kind: KindUpdate, Action: ActionTradeUpdate, Event: trading.EventCanceled, OrderID: "order-3", Order: &alpaca.Order{ID: "order-3", Status: "canceled"}},
+	}
+	for _, r := range records {
+		if err := j.Append(r); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	// Everything survives reopening the file
+	j.Close()
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer j.Close()
+
+	orders, err := j.LatestOrders("paper")
+	if err != nil {
+		t.Fatalf("LatestOrders() error = %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != "order-3" || orders[1].ID != "order-1" || orders[1].Status != "filled" {
+		t.Errorf("LatestOrders() = %+v, want order-3 and order-1 as filled", orders)
+	}
+
+	fills, err := j.Fills("paper")
+	if err != nil {
+		t.Fatalf("Fills() error = %v", err)
+	}
+	if len(fills) != 2 {
+		t.Fatalf("Fills() returned %d records, want 2", len(fills))
+	}
+	if !fills[0].Qty.Equal(decimal.NewFromInt(4)) || !fills[1].Price.Equal(decimal.NewFromInt(101)) {
+		t.Errorf("Fills() = %+v, want the partial fill then the fill, oldest first", fills)
+	}
+
+	if fills, err := j.Fills("unknown"); err != nil || len(fills) != 0 {
+		t.Errorf("Fills() of an unknown account = %v, %v, want none", fills, err)
+	}
+}
+
+func TestFollowRecordsEveryFill(t *testing.T) {
+	j, _ := openTestJournal(t)
+	bus := trading.NewEventBus()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.Follow(ctx, bus)
+	}()
+
+	// Wait for the journal to subscribe
+	probe := trading.OrderEvent{Account: "probe", Event: trading.EventNew, Order: alpaca.Order{ID: "probe"}}
+	for {
+		bus.Publish(probe)
+		if records, err := j.Query(Filter{Account: "probe", Limit: 1}); err == nil && len(records) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Far more fills than the subscription buffers are published at once
+	const fills = 2000
+	for i := range fills {
+		bus.Publish(trading.OrderEvent{
+			Account: "paper",
+			Event:   trading.EventFill,
+			At:      time.Now(),
+			Order:   alpaca.Order{ID: fmt.Sprintf("order-%d", i), Symbol: "AAPL", Status: "filled"},
+			Price:   decPtr("100"),
+			Qty:     decPtr("1"),
+		})
+	}
+	cancel()
+	<-done
+
+	records, err := j.Fills("paper")
+	if err != nil {
+		t.Fatalf("Fills() error = %v", err)
+	}
+	if len(records) != fills {
+		t.Errorf("Fills() returned %d records, want %d", len(records), fills)
+	}
+}
+
+func TestJournaledDuplicate(t *testing.T) {
+	j, _ := openTestJournal(t)
+	broker := j.Wrap("paper", newTestSim())
+
+	req := buy("AAPL", "10")
+	req.ClientOrderID = "retry-1"
+	first, err := trading.PlaceOrder(broker, req)
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	retry, err := trading.PlaceOrder(broker, req)
+	if err != nil {
+		t.Fatalf("PlaceOrder() retry error = %v", err)
+	}
+	if retry.ID != first.ID {
+		t.Fatalf("PlaceOrder() retry placed order %s, want %s", retry.ID, first.ID)
+	}
+
+	records, err := j.Query(Filter{Account: "paper"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	want := []struct {
+		kind      string
+		duplicate bool
+	}{
+		{KindResponse, true},
+		{KindRequest, true},
+		{KindResponse, false},
+		{KindRequest, false},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Query() returned %d records, want %d", len(records), len(want))
+	}
+	for i, r := range records {
+		if r.Kind != want[i].kind || r.Duplicate != want[i].duplicate || r.ClientOrderID != "retry-1" {
+			t.Errorf("record %d = %s duplicate=%t client order ID %q, want %s duplicate=%t retry-1",
+				i, r.Kind, r.Duplicate, r.ClientOrderID, want[i].kind, want[i].duplicate)
+		}
+	}
+	if records[0].OrderID != first.ID {
+		t.Errorf("duplicate response order ID = %q, want %q", records[0].OrderID, first.ID)
+	}
+}
@@ -1,38 +1,27 @@
 package marketdata
 
 import (
-	"log"
-	"os"
+	"errors"
+	"fmt"
+	"net/http"
 	"time"
 
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
 	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
-	"github.com/joho/godotenv"
 )
 
 var (
 	client *marketdata.Client
 )
 
-// Initialize the market data client
-func init() {
-	// Load .env file
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Println("Warning: Error loading .env file")
-	}
-
-	// Get API keys from environment variables (use paper keys for market data)
-	apiKey := os.Getenv("ALPACA_PAPER_API_KEY")
-	apiSecret := os.Getenv("ALPACA_PAPER_SECRET_KEY")
-
-	if apiKey == "" || apiSecret == "" {
-		log.Println("Warning: API key or secret not found in .env file")
-		return
-	}
-
+// Configure sets up the market data client with the given credentials,
+// endpoint and default feed
+func Configure(apiKey, apiSecret, baseURL string, feed marketdata.Feed) {
 	client = marketdata.NewClient(marketdata.ClientOpts{
 		APIKey:    apiKey,
 		APISecret: apiSecret,
+		BaseURL:   baseURL,
+		Feed:      feed,
 	})
 }
 
@@ -52,3 +41,188 @@ func GetStockQuote(symbols string, quoteLimit int, quoteStartDate string) ([]mar
 
 	return quotes, nil
 }
+
+// GetLatestQuote retrieves the most recent quote for a symbol
+func GetLatestQuote(symbol string) (*marketdata.Quote, error) {
+	if client == nil {
+		return nil, fmt.Errorf("market data client is not configured")
+	}
+
+	quote, err := client.GetLatestQuote(symbol, marketdata.GetLatestQuoteRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+// ParseTimeFrame converts a bar timeframe such as 1Min, 5Min, 15Min, 1Hour or 1Day
+func ParseTimeFrame(timeframe string) (marketdata.TimeFrame, error) {
+	switch timeframe {
+	case "1Min":
+		return marketdata.OneMin, nil
+	case "5Min":
+		return marketdata.NewTimeFrame(5, marketdata.Min), nil
+	case "15Min":
+		return marketdata.NewTimeFrame(15, marketdata.Min), nil
+	case "1Hour":
+		return marketdata.OneHour, nil
+	case "1Day":
+		return marketdata.OneDay, nil
+	default:
+		return marketdata.TimeFrame{}, fmt.Errorf("invalid timeframe %q, must be one of 1Min, 5Min, 15Min, 1Hour, 1Day", timeframe)
+	}
+}
+
+// ParseAdjustment validates a corporate action adjustment mode
+func ParseAdjustment(adjustment string) (marketdata.Adjustment, error) {
+	switch a := marketdata.Adjustment(adjustment); a {
+	case marketdata.Raw, marketdata.Split, marketdata.Dividend, marketdata.All:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid adjustment %q, must be one of raw, split, dividend, all", adjustment)
+	}
+}
+
+// ParseFeed validates a market data feed selection
+func ParseFeed(feed string) (marketdata.Feed, error) {
+	switch feed {
+	case marketdata.SIP, marketdata.IEX, marketdata.OTC, marketdata.DelayedSIP:
+		return feed, nil
+	default:
+		return "", fmt.Errorf("invalid feed %q, must be one of sip, iex, otc, delayed_sip", feed)
+	}
+}
+
+// GetStockBars retrieves historical OHLCV bars for a symbol. An empty feed
+// uses the client's default feed and a zero limit returns every bar in range.
+func GetStockBars(symbol string, timeframe marketdata.TimeFrame, start, end time.Time, adjustment marketdata.Adjustment, feed marketdata.Feed, limit int) ([]marketdata.Bar, error) {
+	if client == nil {
+		return nil, fmt.Errorf("market data client is not configured")
+	}
+
+	bars, err := client.GetBars(symbol, marketdata.GetBarsRequest{
+		TimeFrame:  timeframe,
+		Adjustment: adjustment,
+		Start:      start,
+		End:        end,
+		TotalLimit: limit,
+		Feed:       feed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bars, nil
+}
+
+// GetStockBarsBefore retrieves up to n bars that end before a time, oldest
+// first. It looks back far enough to find n bars across weekends and
+// holidays, and returns fewer when the symbol has fewer.
+func GetStockBarsBefore(symbol string, timeframe marketdata.TimeFrame, before time.Time, n int, adjustment marketdata.Adjustment, feed marketdata.Feed) ([]marketdata.Bar, error) {
+	if client == nil {
+		return nil, fmt.Errorf("market data client is not configured")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	// The market trades on five days in seven, for about a quarter of the
+	// hours of each; a week more covers holidays and thinly traded symbols
+	var lookback time.Duration
+	switch timeframe.Unit {
+	case marketdata.Min:
+		lookback = time.Duration(n*timeframe.N) * time.Minute * 6
+	case marketdata.Hour:
+		lookback = time.Duration(n*timeframe.N) * time.Hour * 6
+	default:
+		lookback = time.Duration(n*timeframe.N) * 24 * time.Hour * 2
+	}
+	lookback += 7 * 24 * time.Hour
+
+	bars, err := client.GetBars(symbol, marketdata.GetBarsRequest{
+		TimeFrame:  timeframe,
+		Adjustment: adjustment,
+		Start:      before.Add(-lookback),
+		End:        before.Add(-time.Nanosecond),
+		TotalLimit: n,
+		Feed:       feed,
+		Sort:       marketdata.SortDesc,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(bars)-1; i < j; i, j = i+1, j-1 {
+		bars[i], bars[j] = bars[j], bars[i]
+	}
+	return bars, nil
+}
+
+// SnapshotsResult holds the snapshots found for a batch of symbols along with
+// the symbols that could not be resolved
+type SnapshotsResult struct {
+	Snapshots map[string]*marketdata.Snapshot `json:"snapshots"`
+	Invalid   []string                        `json:"invalid"`
+}
+
+// GetStockSnapshots retrieves the latest trade, latest quote, minute bar, daily
+// bar and previous daily bar for each symbol. Symbols without data are listed
+// as invalid instead of failing the whole request.
+func GetStockSnapshots(symbols []string, feed marketdata.Feed) (*SnapshotsResult, error) {
+	if client == nil {
+		return nil, fmt.Errorf("market data client is not configured")
+	}
+
+	req := marketdata.GetSnapshotRequest{Feed: feed}
+	result := &SnapshotsResult{
+		Snapshots: make(map[string]*marketdata.Snapshot),
+		Invalid:   []string{},
+	}
+
+	snapshots, err := client.GetSnapshots(symbols, req)
+	if err != nil {
+		// A malformed symbol rejects the whole batch, so fall back to
+		// requesting each symbol on its own to salvage the valid ones
+		if !isInvalidSymbol(err) {
+			return nil, err
+		}
+
+		snapshots = make(map[string]*marketdata.Snapshot)
+		for _, symbol := range symbols {
+			snapshot, err := client.GetSnapshot(symbol, req)
+			if isInvalidSymbol(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("get snapshot of %s: %w", symbol, err)
+			}
+			snapshots[symbol] = snapshot
+		}
+	}
+
+	for _, symbol := range symbols {
+		if snapshot := snapshots[symbol]; snapshot != nil {
+			result.Snapshots[symbol] = snapshot
+		} else {
+			result.Invalid = append(result.Invalid, symbol)
+		}
+	}
+
+	return result, nil
+}
+
+// isInvalidSymbol reports whether err is the API rejecting a symbol rather
+// than a failure such as rate limiting that says nothing about the symbol
+func isInvalidSymbol(err error) bool {
+	var apiErr *alpaca.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,266 @@
+package marketdata
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// newTestClient points the client at a fake market data API served by
+// handler for the rest of the test
+func newTestClient(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	previous := client
+	t.Cleanup(func() {
+		server.Close()
+		client = previous
+	})
+	Configure("key", "secret", server.URL, marketdata.IEX)
+}
+
+// writeJSON writes v as the response of the fake API
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestParseTimeFrame(t *testing.T) {
+	tests := []struct {
+		timeframe string
+		want      marketdata.TimeFrame
+		wantErr   string
+	}{
+		{timeframe: "1Min", want: marketdata.OneMin},
+		{timeframe: "5Min", want: marketdata.NewTimeFrame(5, marketdata.Min)},
+		{timeframe: "15Min", want: marketdata.NewTimeFrame(15, marketdata.Min)},
+		{timeframe: "1Hour", want: marketdata.OneHour},
+		{timeframe: "1Day", want: marketdata.OneDay},
+		{timeframe: "1day", wantErr: `invalid timeframe "1day"`},
+		{timeframe: "2Hour", wantErr: `invalid timeframe "2Hour"`},
+		{timeframe: "", wantErr: `invalid timeframe ""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.timeframe, func(t *testing.T) {
+			got, err := ParseTimeFrame(tt.timeframe)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseTimeFrame() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimeFrame() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTimeFrame() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAdjustment(t *testing.T) {
+	tests := []struct {
+		adjustment string
+		want       marketdata.Adjustment
+		wantErr    string
+	}{
+		{adjustment: "raw", want: marketdata.Raw},
+		{adjustment: "split", want: marketdata.Split},
+		{adjustment: "dividend", want: marketdata.Dividend},
+		{adjustment: "all", want: marketdata.All},
+		{adjustment: "RAW", wantErr: `invalid adjustment "RAW"`},
+		{adjustment: "", wantErr: `invalid adjustment ""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.adjustment, func(t *testing.T) {
+			got, err := ParseAdjustment(tt.adjustment)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseAdjustment() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAdjustment() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAdjustment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		feed    string
+		want    marketdata.Feed
+		wantErr string
+	}{
+		{feed: "sip", want: marketdata.SIP},
+		{feed: "iex", want: marketdata.IEX},
+		{feed: "otc", want: marketdata.OTC},
+		{feed: "delayed_sip", want: marketdata.DelayedSIP},
+		{feed: "nasdaq", wantErr: `invalid feed "nasdaq"`},
+		{feed: "", wantErr: `invalid feed ""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.feed, func(t *testing.T) {
+			got, err := ParseFeed(tt.feed)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFeed() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFeed() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFeed() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetStockBars(t *testing.T) {
+	start := time.Date(2024, 11, 25, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+
+	var query map[string]string
+	newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/stocks/bars" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "not found"})
+			return
+		}
+		query = map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"bars": map[string]any{
+				"AAPL": []map[string]any{
+					{"t": "2024-11-25T05:00:00Z", "o": 231.5, "h": 233.2, "l": 229.7, "c": 232.9, "v": 90152832},
+					{"t": "2024-11-26T05:00:00Z", "o": 233.3, "h": 235.6, "l": 233.0, "c": 235.1, "v": 45986189},
+				},
+			},
+		})
+	})
+
+	bars, err := GetStockBars("AAPL", marketdata.OneDay, start, end, marketdata.Split, marketdata.SIP, 2)
+	if err != nil {
+		t.Fatalf("GetStockBars() error = %v", err)
+	}
+	if len(bars) != 2 || bars[1].Close != 235.1 {
+		t.Errorf("GetStockBars() = %+v, want the two bars served", bars)
+	}
+
+	want := map[string]string{
+		"symbols":    "AAPL",
+		"timeframe":  "1Day",
+		"adjustment": "split",
+		"feed":       "sip",
+		"limit":      "2",
+		"start":      start.Format(time.RFC3339),
+		"end":        end.Format(time.RFC3339),
+	}
+	for key, value := range want {
+		if query[key] != value {
+			t.Errorf("GetStockBars() sent %s=%q, want %q", key, query[key], value)
+		}
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	previous := client
+	client = nil
+	t.Cleanup(func() { client = previous })
+
+	if _, err := GetStockBars("AAPL", marketdata.OneDay, time.Now(), time.Now(), marketdata.Raw, "", 0); err == nil {
+		t.Error("GetStockBars() without a client succeeded, want an error")
+	}
+}
+
+func TestGetStockSnapshots(t *testing.T) {
+	snapshot := map[string]any{"latestTrade": map[string]any{"t": "2024-11-25T20:59:59Z", "p": 232.87, "s": 100}}
+
+	tests := []struct {
+		name        string
+		symbols     []string
+		handler     http.HandlerFunc
+		want        []string
+		wantInvalid []string
+		wantErr     string
+	}{
+		{
+			name:    "batch",
+			symbols: []string{"AAPL", "MSFT", "ZZZZ"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, map[string]any{"AAPL": snapshot, "MSFT": snapshot, "ZZZZ": nil})
+			},
+			want:        []string{"AAPL", "MSFT"},
+			wantInvalid: []string{"ZZZZ"},
+		},
+		{
+			name:    "malformed symbol rejects the batch",
+			symbols: []string{"AAPL", "BRK B", "MSFT"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				symbols := r.URL.Query().Get("symbols")
+				if strings.Contains(symbols, "BRK B") {
+					writeJSON(w, http.StatusBadRequest, map[string]any{"message": "invalid symbol: BRK B"})
+					return
+				}
+				writeJSON(w, http.StatusOK, map[string]any{symbols: snapshot})
+			},
+			want:        []string{"AAPL", "MSFT"},
+			wantInvalid: []string{"BRK B"},
+		},
+		{
+			name:    "other errors fail the request",
+			symbols: []string{"AAPL", "MSFT"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusForbidden, map[string]any{"message": "subscription does not permit querying recent SIP data"})
+			},
+			wantErr: "subscription does not permit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestClient(t, tt.handler)
+
+			got, err := GetStockSnapshots(tt.symbols, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetStockSnapshots() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetStockSnapshots() error = %v", err)
+			}
+			for _, symbol := range tt.want {
+				if got.Snapshots[symbol] == nil || got.Snapshots[symbol].LatestTrade.Price != 232.87 {
+					t.Errorf("GetStockSnapshots() snapshot of %s = %+v, want the served snapshot", symbol, got.Snapshots[symbol])
+				}
+			}
+			if len(got.Snapshots) != len(tt.want) {
+				t.Errorf("GetStockSnapshots() returned %d snapshots, want %d", len(got.Snapshots), len(tt.want))
+			}
+			if !slices.Equal(got.Invalid, tt.wantInvalid) {
+				t.Errorf("GetStockSnapshots() invalid = %v, want %v", got.Invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
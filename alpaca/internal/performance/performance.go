@@ -0,0 +1,379 @@
+// Package performance measures how accounts have done from their broker's
+// portfolio history and the fills recorded in the order journal
+package performance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/journal"
+	internalmd "github.com/nathgoh/investment-trader/alpaca/internal/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+// Periods are the spans a report can cover, each ending today. YTD covers
+// the calendar year so far and the others a number of weeks, months or
+// years.
+var Periods = []string{"1W", "1M", "3M", "6M", "1A", "YTD"}
+
+// Report is the performance of an account over a period. Returns are
+// fractions, so 0.12 is 12%.
+type Report struct {
+	Account string `json:"account"`
+	Period  string `json:"period"`
+	// Start is the close the first return is measured from and End the last
+	// close
+	Start          string          `json:"start"`
+	End            string          `json:"end"`
+	StartingEquity decimal.Decimal `json:"starting_equity"`
+	EndingEquity   decimal.Decimal `json:"ending_equity"`
+	ProfitLoss     decimal.Decimal `json:"profit_loss"`
+	// NetDeposits is the change in equity that is not profit or loss
+	NetDeposits decimal.Decimal `json:"net_deposits"`
+	// TimeWeightedReturn chains the daily returns, so deposits and
+	// withdrawals do not count as gains or losses
+	TimeWeightedReturn float64 `json:"time_weighted_return"`
+	AnnualizedReturn   float64 `json:"annualized_return"`
+	Volatility         float64 `json:"volatility"`
+	Sharpe             float64 `json:"sharpe"`
+	Sortino            float64 `json:"sortino"`
+	MaxDrawdown        float64 `json:"max_drawdown"`
+	// Trades counts the round trips closed during the period, matched first
+	// in first out from the journal's fills, and WinRate the fraction that
+	// made money
+	Trades  int     `json:"trades"`
+	WinRate float64 `json:"win_rate"`
+	// Exposure is the fraction of days a position was held at some point
+	Exposure  float64    `json:"exposure"`
+	Benchmark *Benchmark `json:"benchmark,omitempty"`
+	Days      []Day      `json:"days"`
+}
+
+// Day is an account's result for one trading day
+type Day struct {
+	Date   string          `json:"date"`
+	Equity decimal.Decimal `json:"equity"`
+	// ProfitLoss is the day's profit or loss, excluding deposits and
+	// withdrawals, and Return that as a fraction of the previous day's equity
+	ProfitLoss      decimal.Decimal `json:"profit_loss"`
+	Return          float64         `json:"return"`
+	BenchmarkReturn *float64        `json:"benchmark_return,omitempty"`
+	Exposed         bool            `json:"exposed"`
+}
+
+// Benchmark compares an account with a symbol over the same days
+type Benchmark struct {
+	Symbol      string  `json:"symbol"`
+	TotalReturn float64 `json:"total_return"`
+	Volatility  float64 `json:"volatility"`
+	Sharpe      float64 `json:"sharpe"`
+	MaxDrawdown float64 `json:"max_drawdown"`
+	// ExcessReturn is the account's time-weighted return less the
+	// benchmark's
+	ExcessReturn float64 `json:"excess_return"`
+	Beta         float64 `json:"beta"`
+	Correlation  float64 `json:"correlation"`
+	// Error is why the benchmark's bars could not be fetched, in which case
+	// the other fields are zero
+	Error string `json:"error,omitempty"`
+}
+
+// Analyzer builds performance reports
+type Analyzer struct {
+	journal *journal.Journal
+	loc     *time.Location
+}
+
+// NewAnalyzer creates an analyzer reading fills from j
+func NewAnalyzer(j *journal.Journal) *Analyzer {
+	return &Analyzer{journal: j, loc: utils.NewYork}
+}
+
+// ParsePeriod checks a period is one of Periods, ignoring case
+func ParsePeriod(period string) (string, error) {
+	for _, p := range Periods {
+		if strings.EqualFold(period, p) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("invalid period %q, must be one of %v", period, Periods)
+}
+
+// Report measures an account's performance over a period from its broker's
+// daily portfolio history. The benchmark is skipped when its symbol is empty.
+func (a *Analyzer) Report(account string, broker trading.Broker, period, benchmark string) (*Report, error) {
+	period, err := ParsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	req := alpaca.GetPortfolioHistoryRequest{Period: period, TimeFrame: alpaca.Day1}
+	if period == "YTD" {
+		req.Period = "1A"
+	}
+	history, err := trading.GetPortfolioHistory(broker, req)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := trading.GetPositions(broker)
+	if err != nil {
+		return nil, err
+	}
+	fills, err := a.journal.Fills(account)
+	if err != nil {
+		return nil, err
+	}
+
+	var since time.Time
+	if period == "YTD" {
+		since = time.Date(time.Now().In(a.loc).Year(), 1, 1, 0, 0, 0, 0, a.loc)
+	}
+	report := a.analyze(history, since, positions, fills)
+	report.Account, report.Period = account, period
+
+	if benchmark != "" && len(report.Days) > 0 {
+		report.Benchmark = a.benchmark(report, strings.ToUpper(benchmark))
+	}
+	return report, nil
+}
+
+// analyze computes a report from a daily portfolio history. Days before
+// since are left out, except the last one, which the first return is
+// measured from.
+func (a *Analyzer) analyze(history *alpaca.PortfolioHistory, since time.Time, positions []alpaca.Position, fills []journal.Record) *Report {
+	report := &Report{Days: []Day{}}
+
+	type point struct {
+		date   time.Time
+		equity decimal.Decimal
+		pnl    decimal.Decimal
+	}
+	var closes []point
+	for i, ts := range history.Timestamp {
+		if i >= len(history.Equity) {
+			break
+		}
+		c := point{date: time.Unix(ts, 0).In(a.loc), equity: history.Equity[i]}
+		if i < len(history.ProfitLoss) {
+			c.pnl = history.ProfitLoss[i]
+		}
+		// Leading days before the account was funded have no equity
+		if len(closes) == 0 && !c.equity.IsPositive() {
+			continue
+		}
+		if !since.IsZero() && c.date.Before(since) {
+			closes = closes[:0]
+		}
+		closes = append(closes, c)
+	}
+	if len(closes) == 0 {
+		return report
+	}
+
+	base, last := closes[0], closes[len(closes)-1]
+	report.Start = base.date.Format("2006-01-02")
+	report.End = last.date.Format("2006-01-02")
+	report.StartingEquity, report.EndingEquity = base.equity, last.equity
+	report.ProfitLoss = decimal.Zero
+
+	// The drawdown is measured on the returns rather than the equity, so
+	// withdrawals are not mistaken for losses
+	returns := make([]float64, 0, len(closes)-1)
+	growth := []float64{1}
+	for i := 1; i < len(closes); i++ {
+		day := Day{Date: closes[i].date.Format("2006-01-02"), Equity: closes[i].equity, ProfitLoss: closes[i].pnl}
+		if prev := closes[i-1].equity; prev.IsPositive() {
+			day.Return = closes[i].pnl.Div(prev).InexactFloat64()
+		}
+		report.ProfitLoss = report.ProfitLoss.Add(closes[i].pnl)
+		report.Days = append(report.Days, day)
+		returns = append(returns, day.Return)
+		growth = append(growth, growth[len(growth)-1]*(1+day.Return))
+	}
+	report.NetDeposits = last.equity.Sub(base.equity).Sub(report.ProfitLoss)
+
+	report.TimeWeightedReturn = Compound(returns)
+	report.AnnualizedReturn = Annualize(report.TimeWeightedReturn, base.date, last.date)
+	report.Volatility = Volatility(returns)
+	report.Sharpe = Sharpe(returns)
+	report.Sortino = Sortino(returns)
+	report.MaxDrawdown = MaxDrawdown(growth)
+
+	if len(report.Days) == 0 {
+		return report
+	}
+	start := a.dayStart(report.Days[0].Date)
+
+	trades := roundTrips(fills)
+	wins := 0
+	for _, t := range trades {
+		if t.exit.Before(start) {
+			continue
+		}
+		report.Trades++
+		if t.pnl.IsPositive() {
+			wins++
+		}
+	}
+	if report.Trades > 0 {
+		report.WinRate = float64(wins) / float64(report.Trades)
+	}
+
+	exposed := a.exposure(report.Days, positions, fills)
+	report.Exposure = float64(exposed) / float64(len(report.Days))
+	return report
+}
+
+// exposure marks the days a position was held at some point, counting back
+// from the current positions through the fills, and returns how many there
+// were. A day is exposed when a position was open at its start or something
+// was filled during it.
+func (a *Analyzer) exposure(days []Day, positions []alpaca.Position, fills []journal.Record) int {
+	held := make(map[string]decimal.Decimal, len(positions))
+	for _, p := range positions {
+		held[p.Symbol] = p.Qty
+	}
+
+	exposed := 0
+	j := len(fills) - 1
+	for i := len(days) - 1; i >= 0; i-- {
+		start := a.dayStart(days[i].Date)
+		end := start.AddDate(0, 0, 1)
+		for ; j >= 0 && !fills[j].At.Before(start); j-- {
+			if fills[j].At.Before(end) {
+				days[i].Exposed = true
+			}
+			held[fills[j].Symbol] = held[fills[j].Symbol].Sub(signedQty(fills[j]))
+		}
+		for _, qty := range held {
+			if !qty.IsZero() {
+				days[i].Exposed = true
+			}
+		}
+		if days[i].Exposed {
+			exposed++
+		}
+	}
+	return exposed
+}
+
+// benchmark compares the report's days with the daily closes of symbol
+func (a *Analyzer) benchmark(report *Report, symbol string) *Benchmark {
+	b := &Benchmark{Symbol: symbol}
+
+	// A week before the first close covers a holiday on that day
+	start := a.dayStart(report.Start).AddDate(0, 0, -7)
+	end := a.dayStart(report.End).AddDate(0, 0, 1)
+	bars, err := internalmd.GetStockBars(symbol, marketdata.OneDay, start, end, marketdata.All, "", 0)
+	if err != nil {
+		b.Error = err.Error()
+		return b
+	}
+	closes := make(map[string]float64, len(bars))
+	for _, bar := range bars {
+		closes[bar.Timestamp.In(a.loc).Format("2006-01-02")] = bar.Close
+	}
+
+	var returns, paired, values []float64
+	prevDate := report.Start
+	if c, ok := closes[prevDate]; ok {
+		values = append(values, c)
+	}
+	for i := range report.Days {
+		day := &report.Days[i]
+		curr, ok := closes[day.Date]
+		prev, prevOK := closes[prevDate]
+		prevDate = day.Date
+		if !ok {
+			continue
+		}
+		values = append(values, curr)
+		if !prevOK || prev == 0 {
+			continue
+		}
+		r := curr/prev - 1
+		day.BenchmarkReturn = &r
+		returns = append(returns, r)
+		paired = append(paired, day.Return)
+	}
+
+	b.TotalReturn = Compound(returns)
+	b.Volatility = Volatility(returns)
+	b.Sharpe = Sharpe(returns)
+	b.MaxDrawdown = MaxDrawdown(values)
+	b.ExcessReturn = report.TimeWeightedReturn - b.TotalReturn
+	b.Beta = Beta(paired, returns)
+	b.Correlation = Correlation(paired, returns)
+	return b
+}
+
+// dayStart is midnight in New York at the start of a date
+func (a *Analyzer) dayStart(date string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02", date, a.loc)
+	return t
+}
+
+// trade is a round trip matched from fills
+type trade struct {
+	exit time.Time
+	pnl  decimal.Decimal
+}
+
+// lot is an open part of a position, long when qty is positive
+type lot struct {
+	qty   decimal.Decimal
+	price decimal.Decimal
+}
+
+// roundTrips matches fills first in first out into round trips, long or
+// short. A fill that closes more than is open opens a position the other way.
+func roundTrips(fills []journal.Record) []trade {
+	ordered := make([]journal.Record, len(fills))
+	copy(ordered, fills)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].At.Before(ordered[j].At) })
+
+	lots := make(map[string][]lot)
+	var trades []trade
+	for _, f := range ordered {
+		qty := signedQty(f)
+		open := lots[f.Symbol]
+		for len(open) > 0 && !qty.IsZero() && open[0].qty.Sign() != qty.Sign() {
+			l := &open[0]
+			closed := decimal.Min(qty.Abs(), l.qty.Abs())
+			pnl := f.Price.Sub(l.price).Mul(closed)
+			if l.qty.IsNegative() {
+				pnl = pnl.Neg()
+			}
+			trades = append(trades, trade{exit: f.At, pnl: pnl})
+
+			if l.qty.IsPositive() {
+				l.qty, qty = l.qty.Sub(closed), qty.Add(closed)
+			} else {
+				l.qty, qty = l.qty.Add(closed), qty.Sub(closed)
+			}
+			if l.qty.IsZero() {
+				open = open[1:]
+			}
+		}
+		if !qty.IsZero() && (len(open) == 0 || open[0].qty.Sign() == qty.Sign()) {
+			open = append(open, lot{qty: qty, price: *f.Price})
+		}
+		lots[f.Symbol] = open
+	}
+	return trades
+}
+
+// signedQty is the quantity a fill added to the position: positive for buys
+// and negative for sells
+func signedQty(f journal.Record) decimal.Decimal {
+	if f.Side == alpaca.Sell {
+		return f.Qty.Neg()
+	}
+	return *f.Qty
+}
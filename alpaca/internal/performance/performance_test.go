@@ -0,0 +1,261 @@
+package performance
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/journal"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func decPtr(s string) *decimal.Decimal {
+	d := dec(s)
+	return &d
+}
+
+func newYorkTime(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, utils.NewYork)
+}
+
+func fill(at time.Time, symbol string, side alpaca.Side, qty, price string) journal.Record {
+	return journal.Record{At: at, Kind: "fill", Symbol: symbol, Side: side, Qty: decPtr(qty), Price: decPtr(price)}
+}
+
+// testHistory is an account funded on December 30th, given a deposit of 5000
+// on January 2nd and then returning -2% and 5%
+func testHistory() *alpaca.PortfolioHistory {
+	closes := []time.Time{
+		newYorkTime(2024, time.December, 27, 16),
+		newYorkTime(2024, time.December, 30, 16),
+		newYorkTime(2024, time.December, 31, 16),
+		newYorkTime(2025, time.January, 2, 16),
+		newYorkTime(2025, time.January, 3, 16),
+		newYorkTime(2025, time.January, 6, 16),
+	}
+	history := &alpaca.PortfolioHistory{}
+	for _, c := range closes {
+		history.Timestamp = append(history.Timestamp, c.Unix())
+	}
+	for _, e := range []string{"0", "10000", "10100", "15100", "14798", "15537.9"} {
+		history.Equity = append(history.Equity, dec(e))
+	}
+	for _, p := range []string{"0", "0", "100", "0", "-302", "739.9"} {
+		history.ProfitLoss = append(history.ProfitLoss, dec(p))
+	}
+	return history
+}
+
+// testFills are a round trip before the report starts, a long position closed
+// in two parts and a short still open
+var testFills = []journal.Record{
+	fill(newYorkTime(2024, time.December, 27, 10), "MSFT", alpaca.Buy, "1", "400"),
+	fill(newYorkTime(2024, time.December, 30, 10), "MSFT", alpaca.Sell, "1", "410"),
+	fill(newYorkTime(2024, time.December, 30, 11), "AAPL", alpaca.Buy, "10", "100"),
+	fill(newYorkTime(2024, time.December, 31, 10), "AAPL", alpaca.Sell, "4", "110"),
+	fill(newYorkTime(2025, time.January, 2, 10), "AAPL", alpaca.Sell, "6", "95"),
+	fill(newYorkTime(2025, time.January, 6, 10), "TSLA", alpaca.Sell, "2", "50"),
+}
+
+func TestAnalyze(t *testing.T) {
+	positions := []alpaca.Position{{Symbol: "TSLA", Qty: dec("-2")}}
+
+	tests := []struct {
+		name            string
+		since           time.Time
+		wantStart       string
+		wantStarting    string
+		wantProfitLoss  string
+		wantReturns     []float64
+		wantTWR         float64
+		wantMaxDrawdown float64
+		wantTrades      int
+		wantWinRate     float64
+		wantExposed     []bool
+	}{
+		{
+			name:            "whole history",
+			wantStart:       "2024-12-30",
+			wantStarting:    "10000",
+			wantProfitLoss:  "537.9",
+			wantReturns:     []float64{0.01, 0, -0.02, 0.05},
+			wantTWR:         1.01*0.98*1.05 - 1,
+			wantMaxDrawdown: 1 - 0.98,
+			wantTrades:      2,
+			wantWinRate:     0.5,
+			wantExposed:     []bool{true, true, false, true},
+		},
+		{
+			name:            "year to date",
+			since:           newYorkTime(2025, time.January, 1, 0),
+			wantStart:       "2024-12-31",
+			wantStarting:    "10100",
+			wantProfitLoss:  "437.9",
+			wantReturns:     []float64{0, -0.02, 0.05},
+			wantTWR:         0.98*1.05 - 1,
+			wantMaxDrawdown: 0.02,
+			wantTrades:      1,
+			wantWinRate:     0,
+			wantExposed:     []bool{true, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewAnalyzer(nil).analyze(testHistory(), tt.since, positions, testFills)
+
+			if report.Start != tt.wantStart || report.End != "2025-01-06" {
+				t.Errorf("span = %s to %s, want %s to 2025-01-06", report.Start, report.End, tt.wantStart)
+			}
+			if !report.StartingEquity.Equal(dec(tt.wantStarting)) || !report.EndingEquity.Equal(dec("15537.9")) {
+				t.Errorf("equity = %s to %s, want %s to 15537.9", report.StartingEquity, report.EndingEquity, tt.wantStarting)
+			}
+			// The deposit is neither profit nor return
+			if !report.ProfitLoss.Equal(dec(tt.wantProfitLoss)) || !report.NetDeposits.Equal(dec("5000")) {
+				t.Errorf("ProfitLoss = %s and NetDeposits = %s, want %s and 5000", report.ProfitLoss, report.NetDeposits, tt.wantProfitLoss)
+			}
+			if len(report.Days) != len(tt.wantReturns) {
+				t.Fatalf("got %d days, want %d", len(report.Days), len(tt.wantReturns))
+			}
+			for i, day := range report.Days {
+				if math.Abs(day.Return-tt.wantReturns[i]) > 1e-12 || day.Exposed != tt.wantExposed[i] {
+					t.Errorf("day %s = return %v exposed %t, want %v and %t", day.Date, day.Return, day.Exposed, tt.wantReturns[i], tt.wantExposed[i])
+				}
+			}
+			if math.Abs(report.TimeWeightedReturn-tt.wantTWR) > 1e-12 {
+				t.Errorf("TimeWeightedReturn = %v, want %v", report.TimeWeightedReturn, tt.wantTWR)
+			}
+			if math.Abs(report.MaxDrawdown-tt.wantMaxDrawdown) > 1e-12 {
+				t.Errorf("MaxDrawdown = %v, want %v", report.MaxDrawdown, tt.wantMaxDrawdown)
+			}
+			if math.Abs(report.Sharpe-Sharpe(tt.wantReturns)) > 1e-9 || math.Abs(report.Sortino-Sortino(tt.wantReturns)) > 1e-9 {
+				t.Errorf("Sharpe = %v and Sortino = %v, want %v and %v", report.Sharpe, report.Sortino, Sharpe(tt.wantReturns), Sortino(tt.wantReturns))
+			}
+			if report.Trades != tt.wantTrades || report.WinRate != tt.wantWinRate {
+				t.Errorf("Trades = %d at WinRate %v, want %d at %v", report.Trades, report.WinRate, tt.wantTrades, tt.wantWinRate)
+			}
+			exposed := 0
+			for _, e := range tt.wantExposed {
+				if e {
+					exposed++
+				}
+			}
+			if want := float64(exposed) / float64(len(tt.wantExposed)); report.Exposure != want {
+				t.Errorf("Exposure = %v, want %v", report.Exposure, want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeEmptyHistory(t *testing.T) {
+	history := &alpaca.PortfolioHistory{
+		Timestamp: []int64{newYorkTime(2025, time.January, 2, 16).Unix()},
+		Equity:    []decimal.Decimal{decimal.Zero},
+	}
+	report := NewAnalyzer(nil).analyze(history, time.Time{}, nil, nil)
+	if report.Start != "" || len(report.Days) != 0 || report.TimeWeightedReturn != 0 {
+		t.Errorf("report = %+v, want an empty one for an unfunded account", report)
+	}
+}
+
+func TestRoundTrips(t *testing.T) {
+	at := func(hour int) time.Time { return newYorkTime(2025, time.January, 2, hour) }
+
+	tests := []struct {
+		name  string
+		fills []journal.Record
+		want  []string
+	}{
+		{
+			name: "first in first out",
+			fills: []journal.Record{
+				fill(at(10), "AAPL", alpaca.Buy, "5", "100"),
+				fill(at(11), "AAPL", alpaca.Buy, "5", "120"),
+				fill(at(12), "AAPL", alpaca.Sell, "7", "110"),
+			},
+			want: []string{"50", "-20"},
+		},
+		{
+			name: "short",
+			fills: []journal.Record{
+				fill(at(10), "TSLA", alpaca.Sell, "2", "50"),
+				fill(at(11), "TSLA", alpaca.Buy, "2", "45"),
+			},
+			want: []string{"10"},
+		},
+		{
+			name: "closing more than is open reverses",
+			fills: []journal.Record{
+				fill(at(10), "AAPL", alpaca.Buy, "2", "100"),
+				fill(at(11), "AAPL", alpaca.Sell, "5", "105"),
+				fill(at(12), "AAPL", alpaca.Buy, "3", "104"),
+			},
+			want: []string{"10", "3"},
+		},
+		{
+			name: "out of order",
+			fills: []journal.Record{
+				fill(at(11), "AAPL", alpaca.Sell, "1", "90"),
+				fill(at(10), "AAPL", alpaca.Buy, "1", "100"),
+			},
+			want: []string{"-10"},
+		},
+		{
+			name: "symbols apart",
+			fills: []journal.Record{
+				fill(at(10), "AAPL", alpaca.Buy, "1", "100"),
+				fill(at(11), "MSFT", alpaca.Sell, "1", "400"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trades := roundTrips(tt.fills)
+			if len(trades) != len(tt.want) {
+				t.Fatalf("got %d trades, want %d", len(trades), len(tt.want))
+			}
+			for i, trade := range trades {
+				if !trade.pnl.Equal(dec(tt.want[i])) {
+					t.Errorf("trade %d made %s, want %s", i, trade.pnl, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		period  string
+		want    string
+		wantErr string
+	}{
+		{period: "1M", want: "1M"},
+		{period: "ytd", want: "YTD"},
+		{period: "1a", want: "1A"},
+		{period: "2A", wantErr: `invalid period "2A", must be one of [1W 1M 3M 6M 1A YTD]`},
+		{period: "", wantErr: "invalid period"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			got, err := ParsePeriod(tt.period)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePeriod() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParsePeriod() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
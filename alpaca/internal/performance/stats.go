@@ -0,0 +1,134 @@
+package performance
+
+import (
+	"math"
+	"time"
+)
+
+// TradingDaysPerYear annualizes daily statistics
+const TradingDaysPerYear = 252
+
+// Mean is the average of values, zero when there are none
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// StdDev is the sample standard deviation of values
+func StdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := Mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// Volatility is the annualized standard deviation of daily returns
+func Volatility(returns []float64) float64 {
+	return StdDev(returns) * math.Sqrt(TradingDaysPerYear)
+}
+
+// Sharpe is the annualized Sharpe ratio of daily returns with no risk-free
+// rate
+func Sharpe(returns []float64) float64 {
+	sd := StdDev(returns)
+	if sd == 0 {
+		return 0
+	}
+	return Mean(returns) / sd * math.Sqrt(TradingDaysPerYear)
+}
+
+// Sortino is the annualized Sortino ratio of daily returns, penalizing only
+// the deviation of losing days
+func Sortino(returns []float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	sum := 0.0
+	for _, r := range returns {
+		if r < 0 {
+			sum += r * r
+		}
+	}
+	downside := math.Sqrt(sum / float64(len(returns)))
+	if downside == 0 {
+		return 0
+	}
+	return Mean(returns) / downside * math.Sqrt(TradingDaysPerYear)
+}
+
+// MaxDrawdown is the largest fall from a peak of values, as a fraction of the
+// peak
+func MaxDrawdown(values []float64) float64 {
+	peak, worst := 0.0, 0.0
+	for _, value := range values {
+		peak = math.Max(peak, value)
+		if peak > 0 {
+			worst = math.Max(worst, 1-value/peak)
+		}
+	}
+	return worst
+}
+
+// Compound is the total return of a series of returns
+func Compound(returns []float64) float64 {
+	total := 1.0
+	for _, r := range returns {
+		total *= 1 + r
+	}
+	return total - 1
+}
+
+// Annualize compounds a total return earned between start and end over a
+// year of calendar time. It is zero when the span is empty or everything was
+// lost.
+func Annualize(total float64, start, end time.Time) float64 {
+	years := end.Sub(start).Hours() / 24 / 365.25
+	if years <= 0 || total <= -1 {
+		return 0
+	}
+	return math.Pow(1+total, 1/years) - 1
+}
+
+// Beta is the sensitivity of returns to the benchmark returns of the same
+// days
+func Beta(returns, benchmark []float64) float64 {
+	variance := covariance(benchmark, benchmark)
+	if variance == 0 {
+		return 0
+	}
+	return covariance(returns, benchmark) / variance
+}
+
+// Correlation is the correlation of returns with the benchmark returns of the
+// same days
+func Correlation(returns, benchmark []float64) float64 {
+	sd := StdDev(returns) * StdDev(benchmark)
+	if sd == 0 {
+		return 0
+	}
+	return covariance(returns, benchmark) / sd
+}
+
+// covariance is the sample covariance of two series of the same length
+func covariance(a, b []float64) float64 {
+	if len(a) < 2 || len(a) != len(b) {
+		return 0
+	}
+	ma, mb := Mean(a), Mean(b)
+	sum := 0.0
+	for i := range a {
+		sum += (a[i] - ma) * (b[i] - mb)
+	}
+	return sum / float64(len(a)-1)
+}
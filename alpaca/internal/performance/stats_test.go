@@ -0,0 +1,74 @@
+package performance
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	returns := []float64{0.01, 0.02, -0.01, 0.03, -0.02}
+	// The mean is 0.006, the sample variance 0.00043 and the downside
+	// deviation sqrt((0.01² + 0.02²) / 5) = 0.01
+	annual := math.Sqrt(252)
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "mean", got: Mean(returns), want: 0.006},
+		{name: "mean of none", got: Mean(nil), want: 0},
+		{name: "standard deviation", got: StdDev(returns), want: math.Sqrt(0.00043)},
+		{name: "standard deviation of one", got: StdDev([]float64{0.05}), want: 0},
+		{name: "volatility", got: Volatility(returns), want: math.Sqrt(0.00043) * annual},
+		{name: "sharpe", got: Sharpe(returns), want: 0.006 / math.Sqrt(0.00043) * annual},
+		{name: "sharpe without deviation", got: Sharpe([]float64{0.01, 0.01}), want: 0},
+		{name: "sortino", got: Sortino(returns), want: 0.6 * annual},
+		{name: "sortino without losses", got: Sortino([]float64{0.01, 0.02}), want: 0},
+		{name: "sortino of one", got: Sortino([]float64{-0.01}), want: 0},
+		{name: "max drawdown", got: MaxDrawdown([]float64{100, 120, 90, 130, 104}), want: 0.25},
+		{name: "max drawdown rising", got: MaxDrawdown([]float64{1, 2, 3}), want: 0},
+		{name: "compound", got: Compound([]float64{0.1, -0.1}), want: -0.01},
+		{name: "compound of none", got: Compound(nil), want: 0},
+		{name: "beta", got: Beta([]float64{0.02, -0.02, 0.04, 0}, []float64{0.01, -0.01, 0.02, 0}), want: 2},
+		{name: "beta of a flat benchmark", got: Beta([]float64{0.01, 0.02}, []float64{0, 0}), want: 0},
+		{name: "beta of uneven series", got: Beta([]float64{0.01, 0.02}, []float64{0.01, 0.02, 0.03}), want: 0},
+		{name: "correlation", got: Correlation([]float64{0.02, -0.02, 0.04, 0}, []float64{0.01, -0.01, 0.02, 0}), want: 1},
+		{name: "inverse correlation", got: Correlation([]float64{-0.01, 0.01, -0.02, 0}, []float64{0.01, -0.01, 0.02, 0}), want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 1e-12 {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnualize(t *testing.T) {
+	start := time.Date(2022, time.January, 3, 16, 0, 0, 0, time.UTC)
+	twoYears := start.Add(2 * 365.25 * 24 * time.Hour)
+
+	tests := []struct {
+		name  string
+		total float64
+		end   time.Time
+		want  float64
+	}{
+		{name: "two years", total: 0.21, end: twoYears, want: 0.1},
+		{name: "half a year", total: 0.1, end: start.Add(365.25 * 12 * time.Hour), want: 0.21},
+		{name: "loss", total: -0.19, end: twoYears, want: -0.1},
+		{name: "everything lost", total: -1, end: twoYears, want: 0},
+		{name: "empty span", total: 0.05, end: start, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Annualize(tt.total, start, tt.end); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Annualize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
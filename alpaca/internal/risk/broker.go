@@ -0,0 +1,84 @@
+package risk
+
+import (
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+)
+
+// checkedBroker runs the engine's checks before orders reach the wrapped
+// broker. An account's orders are checked and placed one at a time. Closing
+// positions is not checked since it only ever reduces risk.
+type checkedBroker struct {
+	trading.Broker
+	account string
+	engine  *Engine
+}
+
+func (b *checkedBroker) Unwrap() trading.Broker {
+	return b.Broker
+}
+
+func (b *checkedBroker) WithMeta(meta trading.OrderMeta) trading.Broker {
+	return &checkedBroker{Broker: trading.WithMeta(b.Broker, meta), account: b.account, engine: b.engine}
+}
+
+func (b *checkedBroker) PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error) {
+	lock := b.engine.placement(b.account)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := b.engine.Check(b.account, b.Broker, req); err != nil {
+		return nil, err
+	}
+	order, err := b.Broker.PlaceOrder(req)
+	if err != nil {
+		return nil, err
+	}
+	b.engine.accept(b.account)
+	return order, nil
+}
+
+// ReplaceOrder checks the order as it will be once replaced
+func (b *checkedBroker) ReplaceOrder(orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error) {
+	lock := b.engine.placement(b.account)
+	lock.Lock()
+	defer lock.Unlock()
+
+	original, err := b.Broker.GetOrder(orderID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := alpaca.PlaceOrderRequest{
+		Symbol:      original.Symbol,
+		Qty:         original.Qty,
+		Side:        original.Side,
+		Type:        original.Type,
+		TimeInForce: original.TimeInForce,
+		LimitPrice:  original.LimitPrice,
+		StopPrice:   original.StopPrice,
+	}
+	if req.Qty != nil {
+		replaced.Qty = req.Qty
+	}
+	if req.LimitPrice != nil {
+		replaced.LimitPrice = req.LimitPrice
+	}
+	if req.StopPrice != nil {
+		replaced.StopPrice = req.StopPrice
+	}
+	if qty := replaced.Qty; qty != nil {
+		remaining := qty.Sub(original.FilledQty)
+		replaced.Qty = &remaining
+	}
+
+	if err := b.engine.Check(b.account, b.Broker, replaced); err != nil {
+		return nil, err
+	}
+	order, err := b.Broker.ReplaceOrder(orderID, req)
+	if err != nil {
+		return nil, err
+	}
+	b.engine.accept(b.account)
+	return order, nil
+}
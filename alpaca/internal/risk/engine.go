@@ -0,0 +1,445 @@
+package risk
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
+)
+
+// maxRejections is how many rejections are kept for inspection
+const maxRejections = 500
+
+// Rules an order can be rejected under
+const (
+	RuleHalted              = "halted"
+	RuleSymbolList          = "symbol_list"
+	RuleReferencePrice      = "reference_price"
+	RulePriceBand           = "price_band"
+	RuleMaxOrderNotional    = "max_order_notional"
+	RuleMaxPositionNotional = "max_position_notional"
+	RuleMaxGrossExposure    = "max_gross_exposure"
+	RuleOrderRate           = "order_rate"
+)
+
+// Violation is a single reason an order was rejected
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// RejectionError is returned for orders that fail one or more checks
+type RejectionError struct {
+	Violations []Violation
+}
+
+func (e *RejectionError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "order rejected by risk checks: " + strings.Join(messages, "; ")
+}
+
+// Rejection records an order the engine turned away
+type Rejection struct {
+	At         time.Time        `json:"at"`
+	Account    string           `json:"account"`
+	Symbol     string           `json:"symbol"`
+	Side       alpaca.Side      `json:"side"`
+	Type       alpaca.OrderType `json:"type"`
+	Qty        *decimal.Decimal `json:"qty,omitempty"`
+	Notional   *decimal.Decimal `json:"notional,omitempty"`
+	Violations []Violation      `json:"violations"`
+}
+
+// PriceSource supplies the reference prices orders are checked against
+type PriceSource interface {
+	LastPrice(symbol string) (decimal.Decimal, error)
+}
+
+// QuotePrices prices symbols at the midpoint of their latest quote
+type QuotePrices struct{}
+
+func (QuotePrices) LastPrice(symbol string) (decimal.Decimal, error) {
+	quote, err := marketdata.GetLatestQuote(symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	bid, ask := decimal.NewFromFloat(quote.BidPrice), decimal.NewFromFloat(quote.AskPrice)
+	switch {
+	case bid.IsPositive() && ask.IsPositive():
+		return bid.Add(ask).Div(decimal.NewFromInt(2)), nil
+	case ask.IsPositive():
+		return ask, nil
+	case bid.IsPositive():
+		return bid, nil
+	default:
+		return decimal.Zero, fmt.Errorf("no quote for %s", symbol)
+	}
+}
+
+// brokerPrices is implemented by brokers that know their own prices, such as
+// the simulated broker, which are used instead of market data quotes
+type brokerPrices interface {
+	LastPrice(symbol string) (decimal.Decimal, bool)
+}
+
+// Engine runs the pre-trade checks every order passes before it is sent to
+// the broker and keeps a record of the orders it rejects
+type Engine struct {
+	prices PriceSource
+	// brokers is the registry the engine was installed in, whose outermost
+	// brokers clean up halted accounts
+	brokers *trading.Registry
+
+	mu         sync.Mutex
+	placing    map[string]*sync.Mutex
+	limits     Limits
+	accepted   map[string][]time.Time
+	rejections []Rejection
+	statuses   map[string]*AccountStatus
+}
+
+// NewEngine creates an engine enforcing limits with reference prices from
+// prices
+func NewEngine(limits Limits, prices PriceSource) *Engine {
+	return &Engine{
+		prices:   prices,
+		limits:   limits,
+		placing:  make(map[string]*sync.Mutex),
+		accepted: make(map[string][]time.Time),
+		statuses: make(map[string]*AccountStatus),
+	}
+}
+
+// Limits returns the limits being enforced
+func (e *Engine) Limits() Limits {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.limits
+}
+
+// Rejections returns the recorded rejections, most recent first
+func (e *Engine) Rejections() []Rejection {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rejections := slices.Clone(e.rejections)
+	slices.Reverse(rejections)
+	return rejections
+}
+
+// Wrap puts the engine in front of an account's broker
+func (e *Engine) Wrap(account string, broker trading.Broker) trading.Broker {
+	return &checkedBroker{Broker: broker, account: account, engine: e}
+}
+
+// Install puts the engine in front of every broker in brokers. Halted
+// accounts are then cleaned up through the registry's outermost brokers, so
+// the orders are journaled like any other.
+func (e *Engine) Install(brokers *trading.Registry) {
+	e.brokers = brokers
+	brokers.Wrap(e.Wrap)
+}
+
+// placement returns the lock held while an account's order is checked and
+// placed, so concurrent orders cannot each pass the position and exposure
+// limits that together they break
+func (e *Engine) placement(account string) *sync.Mutex {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	lock, ok := e.placing[account]
+	if !ok {
+		lock = &sync.Mutex{}
+		e.placing[account] = lock
+	}
+	return lock
+}
+
+// Check runs every check against an order for an account. Orders that fail
+// are recorded and reported with a *RejectionError; errors from the broker
+// while gathering account state are returned as they are. Orders that pass
+// only count towards the order rate once the broker accepts them.
+func (e *Engine) Check(account string, broker trading.Broker, req alpaca.PlaceOrderRequest) error {
+	limits := e.Limits()
+	symbol := strings.ToUpper(req.Symbol)
+
+	var violations []Violation
+	reject := func(rule, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Keep the P&L current so a breach halts the account before this order
+	if limits.lossLimited() {
+		if _, err := e.Refresh(account, broker); err != nil {
+			return err
+		}
+	}
+	if reason, halted := e.halted(account); halted {
+		reject(RuleHalted, "trading on account %s is halted: %s", account, reason)
+	}
+
+	// Orders that shrink a position may trade a symbol kept off the lists, so
+	// a holding can still be sold once its symbol is denied
+	unlisted := len(limits.AllowedSymbols) > 0 && !slices.Contains(limits.AllowedSymbols, symbol)
+	denied := slices.Contains(limits.DeniedSymbols, symbol)
+	if unlisted || denied {
+		reducing, err := e.reduces(broker, req, symbol)
+		if err != nil {
+			return err
+		}
+		if unlisted && !reducing {
+			reject(RuleSymbolList, "%s is not on the allowed symbol list", symbol)
+		}
+		if denied && !reducing {
+			reject(RuleSymbolList, "%s is on the denied symbol list", symbol)
+		}
+	}
+
+	needsPrice := limits.PriceBandPercent.IsPositive() || limits.MaxOrderNotional.IsPositive() ||
+		limits.MaxPositionNotional.IsPositive() || limits.MaxGrossExposure.IsPositive()
+	if needsPrice {
+		ref, err := e.LastPrice(broker, symbol)
+		if err != nil {
+			reject(RuleReferencePrice, "no reference price for %s: %v", symbol, err)
+		} else {
+			more, err := e.checkPrices(limits, broker, req, symbol, ref)
+			if err != nil {
+				return err
+			}
+			violations = append(violations, more...)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if limits.MaxOrdersPerMinute > 0 {
+		recent := e.accepted[account][:0]
+		for _, at := range e.accepted[account] {
+			if now.Sub(at) < time.Minute {
+				recent = append(recent, at)
+			}
+		}
+		e.accepted[account] = recent
+
+		if len(recent) >= limits.MaxOrdersPerMinute {
+			reject(RuleOrderRate, "account %s has reached %d orders per minute", account, limits.MaxOrdersPerMinute)
+		}
+	}
+
+	if len(violations) > 0 {
+		e.record(Rejection{
+			At:         now,
+			Account:    account,
+			Symbol:     symbol,
+			Side:       req.Side,
+			Type:       req.Type,
+			Qty:        req.Qty,
+			Notional:   req.Notional,
+			Violations: violations,
+		})
+		return &RejectionError{Violations: violations}
+	}
+
+	return nil
+}
+
+// accept counts an order the broker has taken towards the account's order
+// rate. Orders the broker refuses do not count.
+func (e *Engine) accept(account string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.limits.MaxOrdersPerMinute > 0 {
+		e.accepted[account] = append(e.accepted[account], time.Now())
+	}
+}
+
+// reduces reports whether an order only shrinks the account's position in
+// symbol, without turning it into a position on the other side
+func (e *Engine) reduces(broker trading.Broker, req alpaca.PlaceOrderRequest, symbol string) (bool, error) {
+	positions, err := broker.GetPositions()
+	if err != nil {
+		return false, err
+	}
+
+	current := decimal.Zero
+	for _, p := range positions {
+		if p.Symbol == symbol {
+			current = p.Qty
+		}
+	}
+
+	var qty decimal.Decimal
+	switch {
+	case req.Qty != nil:
+		qty = *req.Qty
+	case req.Notional != nil:
+		// A notional order is only known to reduce once it can be priced
+		ref, err := e.LastPrice(broker, symbol)
+		if err != nil {
+			return false, nil
+		}
+		qty = req.Notional.Div(ref)
+	}
+	if req.Side == alpaca.Sell {
+		qty = qty.Neg()
+	}
+
+	opposite := qty.Sign() != 0 && qty.Sign() == -current.Sign()
+	return opposite && !qty.Abs().GreaterThan(current.Abs()), nil
+}
+
+// checkPrices runs the checks that depend on the reference price: the price
+// band, the order value and the position and exposure the order leads to
+func (e *Engine) checkPrices(limits Limits, broker trading.Broker, req alpaca.PlaceOrderRequest, symbol string, ref decimal.Decimal) ([]Violation, error) {
+	var violations []Violation
+	reject := func(rule, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if limits.PriceBandPercent.IsPositive() {
+		prices := []struct {
+			name  string
+			price *decimal.Decimal
+		}{{"limit_price", req.LimitPrice}, {"stop_price", req.StopPrice}}
+		for _, p := range prices {
+			name, price := p.name, p.price
+			if price == nil {
+				continue
+			}
+			deviation := price.Sub(ref).Abs().Div(ref).Mul(decimal.NewFromInt(100))
+			if deviation.GreaterThan(limits.PriceBandPercent) {
+				reject(RulePriceBand, "%s %s is %s%% from the last price %s, more than the %s%% band",
+					name, price, deviation.Round(2), ref.Round(2), limits.PriceBandPercent)
+			}
+		}
+	}
+
+	// Value the order at its own limit or stop price where it has one
+	price := ref
+	switch {
+	case req.LimitPrice != nil && (req.Type == alpaca.Limit || req.Type == alpaca.StopLimit):
+		price = *req.LimitPrice
+	case req.StopPrice != nil && req.Type == alpaca.Stop:
+		price = *req.StopPrice
+	}
+
+	var qty, notional decimal.Decimal
+	if req.Notional != nil {
+		notional = *req.Notional
+		qty = notional.Div(price)
+	} else if req.Qty != nil {
+		qty = *req.Qty
+		notional = qty.Mul(price)
+	}
+
+	if limits.MaxOrderNotional.IsPositive() && notional.GreaterThan(limits.MaxOrderNotional) {
+		reject(RuleMaxOrderNotional, "order value %s exceeds the %s limit", notional.Round(2), limits.MaxOrderNotional)
+	}
+
+	if !limits.MaxPositionNotional.IsPositive() && !limits.MaxGrossExposure.IsPositive() {
+		return violations, nil
+	}
+
+	positions, err := broker.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	current, gross := decimal.Zero, decimal.Zero
+	for _, p := range positions {
+		if p.Symbol == symbol {
+			current = p.Qty
+			continue
+		}
+		if p.MarketValue != nil {
+			gross = gross.Add(p.MarketValue.Abs())
+		}
+	}
+
+	after := current.Add(qty)
+	if req.Side == alpaca.Sell {
+		after = current.Sub(qty)
+	}
+
+	// Orders that shrink a position are always allowed through, so limits
+	// never stand in the way of reducing risk
+	if !after.Abs().GreaterThan(current.Abs()) {
+		return violations, nil
+	}
+
+	positionValue := after.Abs().Mul(ref)
+	if limits.MaxPositionNotional.IsPositive() && positionValue.GreaterThan(limits.MaxPositionNotional) {
+		reject(RuleMaxPositionNotional, "%s position value would reach %s, above the %s limit",
+			symbol, positionValue.Round(2), limits.MaxPositionNotional)
+	}
+
+	if limits.MaxGrossExposure.IsPositive() {
+		account, err := broker.GetAccount()
+		if err != nil {
+			return nil, err
+		}
+
+		exposure := gross.Add(positionValue)
+		allowed := account.Equity.Mul(limits.MaxGrossExposure)
+		if exposure.GreaterThan(allowed) {
+			reject(RuleMaxGrossExposure, "gross exposure would reach %s, above %sx equity of %s",
+				exposure.Round(2), limits.MaxGrossExposure, account.Equity.Round(2))
+		}
+	}
+
+	return violations, nil
+}
+
+// LastPrice looks up the reference price of a symbol, preferring the
+// broker's own price when it has one
+func (e *Engine) LastPrice(broker trading.Broker, symbol string) (decimal.Decimal, error) {
+	for {
+		if prices, ok := broker.(brokerPrices); ok {
+			if price, ok := prices.LastPrice(symbol); ok {
+				return price, nil
+			}
+			break
+		}
+		wrapper, ok := broker.(trading.Wrapper)
+		if !ok {
+			break
+		}
+		broker = wrapper.Unwrap()
+	}
+
+	price, err := e.prices.LastPrice(symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !price.IsPositive() {
+		return decimal.Zero, fmt.Errorf("invalid price %s", price)
+	}
+	return price, nil
+}
+
+// record keeps a rejection, dropping the oldest once the record is full. The
+// caller must hold e.mu.
+func (e *Engine) record(r Rejection) {
+	err := &RejectionError{Violations: r.Violations}
+	log.Printf("Warning: %s %s order on account %q: %v", r.Side, r.Symbol, r.Account, err)
+
+	e.rejections = append(e.rejections, r)
+	if len(e.rejections) > maxRejections {
+		e.rejections = e.rejections[len(e.rejections)-maxRejections:]
+	}
+}
@@ -0,0 +1,278 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
+)
+
+// noPrices is a price source without any quotes, so only the simulated
+// broker's own prices are available
+type noPrices struct{}
+
+func (noPrices) LastPrice(symbol string) (decimal.Decimal, error) {
+	return decimal.Zero, fmt.Errorf("no quote for %s", symbol)
+}
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func decPtr(s string) *decimal.Decimal {
+	d := dec(s)
+	return &d
+}
+
+// newTestSim creates a simulated broker with AAPL at 100 and MSFT at 200
+// holding the given positions
+func newTestSim(t *testing.T, cash string, positions map[string]string) *trading.SimBroker {
+	t.Helper()
+	feed := trading.NewStaticPriceFeed(map[string]decimal.Decimal{"AAPL": dec("100"), "MSFT": dec("200")})
+	sim := trading.NewSimBroker(feed, dec(cash))
+	for symbol, qty := range positions {
+		if _, err := sim.PlaceOrder(marketOrder(symbol, alpaca.Buy, qty)); err != nil {
+			t.Fatalf("buy %s %s: %v", qty, symbol, err)
+		}
+	}
+	return sim
+}
+
+func marketOrder(symbol string, side alpaca.Side, qty string) alpaca.PlaceOrderRequest {
+	return alpaca.PlaceOrderRequest{Symbol: symbol, Qty: decPtr(qty), Side: side, Type: alpaca.Market, TimeInForce: alpaca.Day}
+}
+
+func limitOrder(symbol string, side alpaca.Side, qty, price string) alpaca.PlaceOrderRequest {
+	return alpaca.PlaceOrderRequest{Symbol: symbol, Qty: decPtr(qty), Side: side, Type: alpaca.Limit, LimitPrice: decPtr(price), TimeInForce: alpaca.Day}
+}
+
+// rules returns the rules err was rejected under
+func rules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var rejection *RejectionError
+	if !errors.As(err, &rejection) {
+		t.Fatalf("error = %v, want a *RejectionError", err)
+	}
+	var names []string
+	for _, v := range rejection.Violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestEngineCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    Limits
+		positions map[string]string
+		req       alpaca.PlaceOrderRequest
+		wantRules []string
+	}{
+		{
+			name: "no limits",
+			req:  marketOrder("AAPL", alpaca.Buy, "1000"),
+		},
+		{
+			name:      "denied symbol",
+			limits:    Limits{DeniedSymbols: []string{"AAPL"}},
+			req:       marketOrder("aapl", alpaca.Buy, "1"),
+			wantRules: []string{RuleSymbolList},
+		},
+		{
+			name:      "denied symbol sold down",
+			limits:    Limits{DeniedSymbols: []string{"AAPL"}},
+			positions: map[string]string{"AAPL": "10"},
+			req:       marketOrder("AAPL", alpaca.Sell, "10"),
+		},
+		{
+			name:      "denied symbol sold down by notional",
+			limits:    Limits{DeniedSymbols: []string{"AAPL"}},
+			positions: map[string]string{"AAPL": "10"},
+			req:       alpaca.PlaceOrderRequest{Symbol: "AAPL", Notional: decPtr("500"), Side: alpaca.Sell, Type: alpaca.Market, TimeInForce: alpaca.Day},
+		},
+		{
+			name:      "denied symbol sold past the position",
+			limits:    Limits{DeniedSymbols: []string{"AAPL"}},
+			positions: map[string]string{"AAPL": "10"},
+			req:       marketOrder("AAPL", alpaca.Sell, "11"),
+			wantRules: []string{RuleSymbolList},
+		},
+		{
+			name:      "denied symbol added to",
+			limits:    Limits{DeniedSymbols: []string{"AAPL"}},
+			positions: map[string]string{"AAPL": "10"},
+			req:       marketOrder("AAPL", alpaca.Buy, "1"),
+			wantRules: []string{RuleSymbolList},
+		},
+		{
+			name:      "denied symbol sold without a position",
+			limits:    Limits{DeniedSymbols: []string{"AAPL"}},
+			req:       marketOrder("AAPL", alpaca.Sell, "1"),
+			wantRules: []string{RuleSymbolList},
+		},
+		{
+			name:      "symbol off the allowed list sold down",
+			limits:    Limits{AllowedSymbols: []string{"MSFT"}},
+			positions: map[string]string{"AAPL": "10"},
+			req:       marketOrder("AAPL", alpaca.Sell, "5"),
+		},
+		{
+			name:      "symbol off the allowed list",
+			limits:    Limits{AllowedSymbols: []string{"MSFT"}},
+			req:       marketOrder("AAPL", alpaca.Buy, "1"),
+			wantRules: []string{RuleSymbolList},
+		},
+		{
+			name:   "limit price inside the band",
+			limits: Limits{PriceBandPercent: dec("5")},
+			req:    limitOrder("AAPL", alpaca.Buy, "1", "96"),
+		},
+		{
+			name:      "limit price outside the band",
+			limits:    Limits{PriceBandPercent: dec("5")},
+			req:       limitOrder("AAPL", alpaca.Buy, "1", "90"),
+			wantRules: []string{RulePriceBand},
+		},
+		{
+			name:      "order value over the limit",
+			limits:    Limits{MaxOrderNotional: dec("500")},
+			req:       marketOrder("AAPL", alpaca.Buy, "10"),
+			wantRules: []string{RuleMaxOrderNotional},
+		},
+		{
+			name:   "limit order valued at its limit price",
+			limits: Limits{MaxOrderNotional: dec("500")},
+			req:    limitOrder("AAPL", alpaca.Buy, "10", "40"),
+		},
+		{
+			name:      "notional order over the limit",
+			limits:    Limits{MaxOrderNotional: dec("500")},
+			req:       alpaca.PlaceOrderRequest{Symbol: "AAPL", Notional: decPtr("600"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day},
+			wantRules: []string{RuleMaxOrderNotional},
+		},
+		{
+			name:      "position grown over the limit",
+			limits:    Limits{MaxPositionNotional: dec("1500")},
+			positions: map[string]string{"AAPL": "10"},
+			req:       marketOrder("AAPL", alpaca.Buy, "10"),
+			wantRules: []string{RuleMaxPositionNotional},
+		},
+		{
+			name:      "position reduced while over the limit",
+			limits:    Limits{MaxPositionNotional: dec("500")},
+			positions: map[string]string{"AAPL": "10"},
+			req:       marketOrder("AAPL", alpaca.Sell, "5"),
+		},
+		{
+			name:      "gross exposure over a multiple of equity",
+			limits:    Limits{MaxGrossExposure: dec("0.01")},
+			positions: map[string]string{"MSFT": "5"},
+			req:       marketOrder("AAPL", alpaca.Buy, "1"),
+			wantRules: []string{RuleMaxGrossExposure},
+		},
+		{
+			name:      "gross exposure within a multiple of equity",
+			limits:    Limits{MaxGrossExposure: dec("1")},
+			positions: map[string]string{"MSFT": "5"},
+			req:       marketOrder("AAPL", alpaca.Buy, "100"),
+		},
+		{
+			name:      "symbol without a reference price",
+			limits:    Limits{MaxOrderNotional: dec("500")},
+			req:       marketOrder("TSLA", alpaca.Buy, "1"),
+			wantRules: []string{RuleReferencePrice},
+		},
+		{
+			name:      "every violation is reported",
+			limits:    Limits{DeniedSymbols: []string{"AAPL"}, MaxOrderNotional: dec("500"), PriceBandPercent: dec("5")},
+			req:       limitOrder("AAPL", alpaca.Buy, "10", "120"),
+			wantRules: []string{RuleSymbolList, RulePriceBand, RuleMaxOrderNotional},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(tt.limits, noPrices{})
+			sim := newTestSim(t, "100000", tt.positions)
+
+			got := rules(t, engine.Check("paper", sim, tt.req))
+			if !slices.Equal(got, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", got, tt.wantRules)
+			}
+			if rejected := len(engine.Rejections()) > 0; rejected != (len(tt.wantRules) > 0) {
+				t.Errorf("rejection recorded = %t, want %t", rejected, len(tt.wantRules) > 0)
+			}
+		})
+	}
+}
+
+func TestEngineOrderRate(t *testing.T) {
+	engine := NewEngine(Limits{MaxOrdersPerMinute: 2}, noPrices{})
+	sim := newTestSim(t, "100000", nil)
+	broker := engine.Wrap("paper", sim)
+	req := marketOrder("AAPL", alpaca.Buy, "1")
+
+	// Orders the broker refuses do not count towards the rate
+	if _, err := broker.PlaceOrder(marketOrder("TSLA", alpaca.Buy, "1")); err == nil {
+		t.Fatal("PlaceOrder() of an unknown symbol succeeded, want the broker to refuse it")
+	}
+	for i := range 2 {
+		if _, err := broker.PlaceOrder(req); err != nil {
+			t.Fatalf("order %d: PlaceOrder() error = %v", i+1, err)
+		}
+	}
+	_, err := broker.PlaceOrder(req)
+	if got := rules(t, err); !slices.Equal(got, []string{RuleOrderRate}) {
+		t.Errorf("third order rules = %v, want [%s]", got, RuleOrderRate)
+	}
+
+	// Checking an order alone does not count it, rejected orders do not
+	// count, and accounts are limited separately
+	if err := engine.Check("live", sim, req); err != nil {
+		t.Errorf("other account: Check() error = %v", err)
+	}
+	if _, err := engine.Wrap("live", sim).PlaceOrder(req); err != nil {
+		t.Errorf("other account: PlaceOrder() error = %v", err)
+	}
+}
+
+func TestEngineWrap(t *testing.T) {
+	engine := NewEngine(Limits{MaxOrderNotional: dec("500")}, noPrices{})
+	sim := newTestSim(t, "100000", nil)
+	broker := engine.Wrap("paper", sim)
+
+	if _, err := broker.PlaceOrder(marketOrder("AAPL", alpaca.Buy, "10")); len(rules(t, err)) == 0 {
+		t.Fatal("PlaceOrder() over the order limit succeeded, want a rejection")
+	}
+	orders, err := sim.GetOrders(alpaca.GetOrdersRequest{Status: "all"})
+	if err != nil {
+		t.Fatalf("GetOrders() error = %v", err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("rejected order reached the broker: %d orders placed", len(orders))
+	}
+
+	order, err := broker.PlaceOrder(limitOrder("AAPL", alpaca.Buy, "4", "90"))
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+
+	// The replacement is checked as the order it becomes
+	if _, err := broker.ReplaceOrder(order.ID, alpaca.ReplaceOrderRequest{Qty: decPtr("10")}); len(rules(t, err)) == 0 {
+		t.Error("ReplaceOrder() over the order limit succeeded, want a rejection")
+	}
+	if _, err := broker.ReplaceOrder(order.ID, alpaca.ReplaceOrderRequest{Qty: decPtr("5")}); err != nil {
+		t.Errorf("ReplaceOrder() error = %v", err)
+	}
+
+	if got := len(engine.Rejections()); got != 2 {
+		t.Errorf("recorded %d rejections, want 2", got)
+	}
+}
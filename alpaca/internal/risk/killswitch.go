@@ -0,0 +1,265 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+// monitorInterval is how often Run refreshes the P&L of every account
+const monitorInterval = 15 * time.Second
+
+// AccountStatus is the session P&L and halt state of an account
+type AccountStatus struct {
+	Account string `json:"account"`
+	// Session is the trading day the P&L is measured over, in New York time
+	Session      string          `json:"session"`
+	StartEquity  decimal.Decimal `json:"start_equity"`
+	Equity       decimal.Decimal `json:"equity"`
+	DailyPL      decimal.Decimal `json:"daily_pl"`
+	RealizedPL   decimal.Decimal `json:"realized_pl"`
+	UnrealizedPL decimal.Decimal `json:"unrealized_pl"`
+	// Drawdown is the session loss as a percentage of the starting equity
+	Drawdown  decimal.Decimal `json:"drawdown_percent"`
+	UpdatedAt time.Time       `json:"updated_at"`
+
+	Halted   bool       `json:"halted"`
+	Manual   bool       `json:"manual"`
+	Reason   string     `json:"reason,omitempty"`
+	HaltedAt *time.Time `json:"halted_at,omitempty"`
+	// Override is set when trading was resumed by hand, which keeps the loss
+	// limit from halting the account again for the rest of the session
+	Override bool `json:"override"`
+}
+
+// HaltRequest describes a manual halt and the clean-up to run with it
+type HaltRequest struct {
+	Reason         string `json:"reason"`
+	CancelOrders   bool   `json:"cancel_orders"`
+	ClosePositions bool   `json:"close_positions"`
+}
+
+// Run refreshes the P&L of every account in brokers until ctx is cancelled,
+// halting those that breach the daily loss limit. It returns straight away
+// when no loss limit is configured.
+func (e *Engine) Run(ctx context.Context, brokers *trading.Registry) {
+	if !e.Limits().lossLimited() {
+		return
+	}
+
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, name := range brokers.Names() {
+			broker, err := brokers.Get(name)
+			if err != nil {
+				continue
+			}
+			if _, err := e.Refresh(name, broker); err != nil {
+				log.Printf("Warning: failed to refresh P&L for account %q: %v", name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh recalculates an account's session P&L from its equity and
+// positions, halting it when the daily loss limit is breached
+func (e *Engine) Refresh(account string, broker trading.Broker) (AccountStatus, error) {
+	acct, err := broker.GetAccount()
+	if err != nil {
+		return AccountStatus{}, err
+	}
+	positions, err := broker.GetPositions()
+	if err != nil {
+		return AccountStatus{}, err
+	}
+
+	unrealized := decimal.Zero
+	for _, p := range positions {
+		switch {
+		case p.UnrealizedIntradayPL != nil:
+			unrealized = unrealized.Add(*p.UnrealizedIntradayPL)
+		case p.UnrealizedPL != nil:
+			unrealized = unrealized.Add(*p.UnrealizedPL)
+		}
+	}
+
+	limits := e.Limits()
+	now := time.Now()
+
+	e.mu.Lock()
+	status := e.status(account, now)
+
+	// The previous close is the baseline; without one the first equity seen
+	// in the session is used
+	if status.StartEquity.IsZero() {
+		status.StartEquity = acct.LastEquity
+		if !status.StartEquity.IsPositive() {
+			status.StartEquity = acct.Equity
+		}
+	}
+	status.Equity = acct.Equity
+	status.DailyPL = acct.Equity.Sub(status.StartEquity)
+	status.UnrealizedPL = unrealized
+	status.RealizedPL = status.DailyPL.Sub(unrealized)
+	status.Drawdown = decimal.Zero
+	if status.StartEquity.IsPositive() && status.DailyPL.IsNegative() {
+		status.Drawdown = status.DailyPL.Neg().Div(status.StartEquity).Mul(decimal.NewFromInt(100)).Round(4)
+	}
+	status.UpdatedAt = now
+
+	var reason string
+	if !status.Halted && !status.Override {
+		reason = limits.lossBreach(status)
+		if reason != "" {
+			halt(status, reason, false, now)
+		}
+	}
+	snapshot := *status
+	e.mu.Unlock()
+
+	if reason != "" {
+		log.Printf("Warning: trading halted on account %q: %s", account, reason)
+		e.cleanUp(account, broker, limits.HaltCancelOrders, limits.HaltClosePositions)
+	}
+
+	return snapshot, nil
+}
+
+// Halt stops new orders on an account until it is resumed
+func (e *Engine) Halt(account string, broker trading.Broker, req HaltRequest) AccountStatus {
+	reason := req.Reason
+	if reason == "" {
+		reason = "halted manually"
+	}
+
+	e.mu.Lock()
+	status := e.status(account, time.Now())
+	halt(status, reason, true, time.Now())
+	status.Override = false
+	snapshot := *status
+	e.mu.Unlock()
+
+	log.Printf("Warning: trading halted on account %q: %s", account, reason)
+	e.cleanUp(account, broker, req.CancelOrders, req.ClosePositions)
+
+	return snapshot
+}
+
+// Resume lifts a halt. The daily loss limit stays overridden for the rest of
+// the session so the account is not halted again straight away.
+func (e *Engine) Resume(account string) AccountStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := e.status(account, time.Now())
+	status.Halted = false
+	status.Manual = false
+	status.Reason = ""
+	status.HaltedAt = nil
+	status.Override = true
+
+	log.Printf("Trading resumed on account %q", account)
+	return *status
+}
+
+// Status returns the session P&L and halt state of an account
+func (e *Engine) Status(account string) AccountStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return *e.status(account, time.Now())
+}
+
+// status returns the state of an account for the current session, starting
+// a new session when the trading day has changed. Halts from the loss limit
+// end with the session while manual halts carry over. The caller must hold
+// e.mu.
+func (e *Engine) status(account string, now time.Time) *AccountStatus {
+	session := now.In(utils.NewYork).Format(time.DateOnly)
+
+	status, ok := e.statuses[account]
+	if !ok {
+		status = &AccountStatus{Account: account, Session: session}
+		e.statuses[account] = status
+	}
+	if status.Session != session {
+		next := &AccountStatus{Account: account, Session: session}
+		if status.Halted && status.Manual {
+			halt(next, status.Reason, true, *status.HaltedAt)
+		}
+		*status = *next
+	}
+
+	return status
+}
+
+// halted reports why trading is halted on an account, if it is
+func (e *Engine) halted(account string) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := e.status(account, time.Now())
+	return status.Reason, status.Halted
+}
+
+// cleanUp cancels orders and closes positions on a halted account as asked,
+// through the account's outermost broker when the engine is installed in a
+// registry. Failures are logged rather than returned since the halt itself
+// stands.
+func (e *Engine) cleanUp(account string, broker trading.Broker, cancelOrders, closePositions bool) {
+	if e.brokers != nil {
+		if outer, err := e.brokers.Get(account); err == nil {
+			broker = outer
+		}
+	}
+	if closePositions {
+		if _, err := broker.CloseAllPositions(alpaca.CloseAllPositionsRequest{CancelOrders: true}); err != nil {
+			log.Printf("Warning: failed to close positions on halted account %q: %v", account, err)
+		}
+		return
+	}
+	if cancelOrders {
+		if err := broker.CancelAllOrders(); err != nil {
+			log.Printf("Warning: failed to cancel orders on halted account %q: %v", account, err)
+		}
+	}
+}
+
+func halt(status *AccountStatus, reason string, manual bool, at time.Time) {
+	status.Halted = true
+	status.Manual = manual
+	status.Reason = reason
+	status.HaltedAt = &at
+}
+
+// lossLimited reports whether a daily loss limit is configured
+func (l Limits) lossLimited() bool {
+	return l.DailyLossLimit.IsPositive() || l.DailyLossPercent.IsPositive()
+}
+
+// lossBreach describes how an account's session loss breaches the daily loss
+// limit, or returns "" when it does not
+func (l Limits) lossBreach(status *AccountStatus) string {
+	loss := status.DailyPL.Neg()
+	if l.DailyLossLimit.IsPositive() && loss.GreaterThanOrEqual(l.DailyLossLimit) {
+		return fmt.Sprintf("daily loss of %s reached the %s limit", loss.Round(2), l.DailyLossLimit)
+	}
+	if l.DailyLossPercent.IsPositive() && status.Drawdown.GreaterThanOrEqual(l.DailyLossPercent) {
+		return fmt.Sprintf("daily drawdown of %s%% reached the %s%% limit", status.Drawdown.Round(2), l.DailyLossPercent)
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package risk
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+func TestLossBreach(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     Limits
+		dailyPL    string
+		drawdown   string
+		wantReason string
+	}{
+		{name: "no limits", dailyPL: "-5000", drawdown: "5"},
+		{name: "gain", limits: Limits{DailyLossLimit: dec("500")}, dailyPL: "800", drawdown: "0"},
+		{name: "loss under the dollar limit", limits: Limits{DailyLossLimit: dec("500")}, dailyPL: "-499.99", drawdown: "0.5"},
+		{name: "loss at the dollar limit", limits: Limits{DailyLossLimit: dec("500")}, dailyPL: "-500", drawdown: "0.5", wantReason: "daily loss of 500 reached the 500 limit"},
+		{name: "drawdown under the percent limit", limits: Limits{DailyLossPercent: dec("2")}, dailyPL: "-1000", drawdown: "1"},
+		{name: "drawdown over the percent limit", limits: Limits{DailyLossPercent: dec("2")}, dailyPL: "-2500", drawdown: "2.5", wantReason: "daily drawdown of 2.5% reached the 2% limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &AccountStatus{DailyPL: dec(tt.dailyPL), Drawdown: dec(tt.drawdown)}
+			if got := tt.limits.lossBreach(status); got != tt.wantReason {
+				t.Errorf("lossBreach() = %q, want %q", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRefreshHaltsOnLossLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		limits        Limits
+		wantOpen      int
+		wantPositions int
+	}{
+		{name: "halt only", limits: Limits{DailyLossLimit: dec("500")}, wantOpen: 1, wantPositions: 1},
+		{name: "halt and cancel orders", limits: Limits{DailyLossLimit: dec("500"), HaltCancelOrders: true}, wantPositions: 1},
+		{name: "halt and close positions", limits: Limits{DailyLossPercent: dec("0.5"), HaltClosePositions: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(tt.limits, noPrices{})
+			sim := newTestSim(t, "100000", map[string]string{"AAPL": "100"})
+			if _, err := sim.PlaceOrder(limitOrder("MSFT", alpaca.Buy, "1", "150")); err != nil {
+				t.Fatalf("PlaceOrder() error = %v", err)
+			}
+
+			status, err := engine.Refresh("paper", sim)
+			if err != nil {
+				t.Fatalf("Refresh() error = %v", err)
+			}
+			if status.Halted {
+				t.Fatalf("account halted before any loss: %s", status.Reason)
+			}
+
+			// A 10% drop on 10,000 of AAPL loses 1,000, or 1% of equity
+			if err := sim.SetPrice("AAPL", dec("90")); err != nil {
+				t.Fatalf("SetPrice() error = %v", err)
+			}
+			status, err = engine.Refresh("paper", sim)
+			if err != nil {
+				t.Fatalf("Refresh() error = %v", err)
+			}
+			if !status.Halted || status.Manual {
+				t.Fatalf("status = %+v, want halted by the loss limit", status)
+			}
+			if !status.DailyPL.Equal(dec("-1000")) || !status.Drawdown.Equal(dec("1")) {
+				t.Errorf("daily P&L = %s, drawdown = %s%%, want -1000 and 1%%", status.DailyPL, status.Drawdown)
+			}
+
+			orders, err := sim.GetOrders(alpaca.GetOrdersRequest{Status: "open"})
+			if err != nil {
+				t.Fatalf("GetOrders() error = %v", err)
+			}
+			if len(orders) != tt.wantOpen {
+				t.Errorf("%d open orders after the halt, want %d", len(orders), tt.wantOpen)
+			}
+			positions, err := sim.GetPositions()
+			if err != nil {
+				t.Fatalf("GetPositions() error = %v", err)
+			}
+			if len(positions) != tt.wantPositions {
+				t.Errorf("%d positions after the halt, want %d", len(positions), tt.wantPositions)
+			}
+
+			err = engine.Check("paper", sim, marketOrder("AAPL", alpaca.Sell, "1"))
+			if got := rules(t, err); !slices.Contains(got, RuleHalted) {
+				t.Errorf("rules after the halt = %v, want %s", got, RuleHalted)
+			}
+		})
+	}
+}
+
+func TestHaltAndResume(t *testing.T) {
+	engine := NewEngine(Limits{DailyLossLimit: dec("500")}, noPrices{})
+	sim := newTestSim(t, "100000", map[string]string{"AAPL": "100"})
+
+	status := engine.Halt("paper", sim, HaltRequest{})
+	if !status.Halted || !status.Manual || status.Reason != "halted manually" {
+		t.Fatalf("status = %+v, want a manual halt", status)
+	}
+	if err := engine.Check("paper", sim, marketOrder("AAPL", alpaca.Buy, "1")); !strings.Contains(err.Error(), "halted manually") {
+		t.Errorf("Check() error = %v, want the halt reason", err)
+	}
+	if engine.Status("live").Halted {
+		t.Error("halting one account halted another")
+	}
+
+	status = engine.Resume("paper")
+	if status.Halted || !status.Override {
+		t.Fatalf("status = %+v, want resumed with the loss limit overridden", status)
+	}
+
+	// The override keeps a breach from halting the account again this session
+	if err := sim.SetPrice("AAPL", dec("90")); err != nil {
+		t.Fatalf("SetPrice() error = %v", err)
+	}
+	if err := engine.Check("paper", sim, marketOrder("AAPL", alpaca.Buy, "1")); err != nil {
+		t.Errorf("Check() after resuming error = %v", err)
+	}
+	if engine.Status("paper").Halted {
+		t.Error("account halted again after being resumed")
+	}
+}
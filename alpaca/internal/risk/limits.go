@@ -0,0 +1,38 @@
+package risk
+
+import "github.com/shopspring/decimal"
+
+// Limits configures the pre-trade checks. A zero or empty limit disables its
+// check.
+type Limits struct {
+	// MaxOrderNotional is the largest value of a single order in dollars
+	MaxOrderNotional decimal.Decimal `yaml:"max_order_notional" json:"max_order_notional"`
+	// MaxPositionNotional is the largest value a position in one symbol may
+	// reach in dollars once the order fills
+	MaxPositionNotional decimal.Decimal `yaml:"max_position_notional" json:"max_position_notional"`
+	// MaxGrossExposure is the largest total value of all positions, long and
+	// short, as a multiple of account equity
+	MaxGrossExposure decimal.Decimal `yaml:"max_gross_exposure" json:"max_gross_exposure"`
+	// AllowedSymbols, when set, are the only symbols that may be traded
+	AllowedSymbols []string `yaml:"allowed_symbols" json:"allowed_symbols"`
+	// DeniedSymbols may never be traded
+	DeniedSymbols []string `yaml:"denied_symbols" json:"denied_symbols"`
+	// PriceBandPercent is how far a limit or stop price may sit from the
+	// last quote, in percent
+	PriceBandPercent decimal.Decimal `yaml:"price_band_percent" json:"price_band_percent"`
+	// MaxOrdersPerMinute caps the orders accepted per account per minute
+	MaxOrdersPerMinute int `yaml:"max_orders_per_minute" json:"max_orders_per_minute"`
+
+	// DailyLossLimit halts an account once its loss since the previous
+	// close reaches this many dollars
+	DailyLossLimit decimal.Decimal `yaml:"daily_loss_limit" json:"daily_loss_limit"`
+	// DailyLossPercent halts an account once its loss since the previous
+	// close reaches this percentage of equity
+	DailyLossPercent decimal.Decimal `yaml:"daily_loss_percent" json:"daily_loss_percent"`
+	// HaltCancelOrders cancels every open order when the loss limit halts
+	// an account
+	HaltCancelOrders bool `yaml:"halt_cancel_orders" json:"halt_cancel_orders"`
+	// HaltClosePositions closes every position, cancelling open orders too,
+	// when the loss limit halts an account
+	HaltClosePositions bool `yaml:"halt_close_positions" json:"halt_close_positions"`
+}
@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// What a schedule's time of day is relative to
+const (
+	anchorOpen  = "open"
+	anchorClose = "close"
+	anchorClock = "clock"
+	anchorEvery = "every"
+)
+
+// Which trading days a schedule runs on
+const (
+	daysEvery      = "every trading day"
+	daysFirstMonth = "first trading day of the month"
+	daysLastMonth  = "last trading day of the month"
+	daysFirstWeek  = "first trading day of the week"
+	daysLastWeek   = "last trading day of the week"
+)
+
+var dayFilters = []string{daysEvery, daysFirstMonth, daysLastMonth, daysFirstWeek, daysLastWeek}
+
+var (
+	relativePattern = regexp.MustCompile(`^(.+) (before|after) (open|close)$`)
+	everyPattern    = regexp.MustCompile(`^every (.+) while open$`)
+	clockPattern    = regexp.MustCompile(`^at (\d{1,2}):(\d{2})$`)
+	durationPattern = regexp.MustCompile(`^(\d+)\s*([a-z]+)$`)
+)
+
+// durationUnits are the unit words accepted besides Go duration strings
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+}
+
+// Schedule is when a job runs, relative to the sessions of the market
+// calendar in New York time
+type Schedule struct {
+	spec   string
+	anchor string
+	// offset is added to the open or close, or is the interval of an every
+	// schedule, or the time after midnight of a clock schedule
+	offset time.Duration
+	days   string
+}
+
+// Parse reads a schedule written as a time, optionally followed by "on" and
+// the days it runs on. Times are "open", "close", "<duration> after open",
+// "<duration> before close" (or before open and after close), "every
+// <duration> while open" or "at HH:MM". Days are "every trading day" (the
+// default) or the first or last trading day of the month or week, as in
+// "5m after open on the first trading day of the month". Durations are Go
+// durations such as "90s" or a number and unit such as "5 minutes".
+func Parse(spec string) (Schedule, error) {
+	s := Schedule{spec: spec, days: daysEvery}
+	text := strings.Join(strings.Fields(strings.ToLower(spec)), " ")
+
+	when, days, hasDays := strings.Cut(text, " on ")
+	if hasDays {
+		days = strings.TrimPrefix(days, "the ")
+		if !isDayFilter(days) {
+			return s, fmt.Errorf("schedule %q: days must be one of %v", spec, dayFilters)
+		}
+		s.days = days
+	} else if d := strings.TrimPrefix(when, "the "); isDayFilter(d) {
+		// A day alone runs at the open
+		when, s.days = anchorOpen, d
+	}
+
+	switch {
+	case when == "open" || when == "at open":
+		s.anchor = anchorOpen
+	case when == "close" || when == "at close":
+		s.anchor = anchorClose
+	case relativePattern.MatchString(when):
+		m := relativePattern.FindStringSubmatch(when)
+		d, err := parseDuration(m[1])
+		if err != nil {
+			return s, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		if m[2] == "before" {
+			d = -d
+		}
+		s.anchor, s.offset = m[3], d
+	case everyPattern.MatchString(when):
+		d, err := parseDuration(everyPattern.FindStringSubmatch(when)[1])
+		if err != nil {
+			return s, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		if d < time.Second {
+			return s, fmt.Errorf("schedule %q: the interval must be at least a second", spec)
+		}
+		s.anchor, s.offset = anchorEvery, d
+	case clockPattern.MatchString(when):
+		m := clockPattern.FindStringSubmatch(when)
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour > 23 || minute > 59 {
+			return s, fmt.Errorf("schedule %q: %s is not a time of day", spec, strings.TrimPrefix(when, "at "))
+		}
+		s.anchor, s.offset = anchorClock, time.Duration(hour)*time.Hour+time.Duration(minute)*time.Minute
+	default:
+		return s, fmt.Errorf(`schedule %q: must be "open", "close", "<duration> after open", "<duration> before close", "every <duration> while open" or "at HH:MM"`, spec)
+	}
+	return s, nil
+}
+
+// String returns the schedule as it was written
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first run of the schedule after the given time within
+// the sessions of the calendar, and false when there is none. Runs relative
+// to the open or close that would fall outside the session, such as "4h
+// after open" on an early close day, are skipped; "before open" and "after
+// close" runs are outside it by design.
+func (s Schedule) Next(after time.Time, calendar Calendar) (time.Time, bool) {
+	for i, day := range calendar {
+		if day.Close.Add(24*time.Hour).Before(after) || !s.runsOn(calendar, i) {
+			continue
+		}
+		for _, t := range s.times(day) {
+			if t.After(after) {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// times lists the runs of the schedule on a trading day in order
+func (s Schedule) times(day Session) []time.Time {
+	switch s.anchor {
+	case anchorOpen, anchorClose:
+		t := day.Open.Add(s.offset)
+		if s.anchor == anchorClose {
+			t = day.Close.Add(s.offset)
+		}
+		if (s.anchor == anchorOpen && s.offset >= 0 && !t.Before(day.Close)) ||
+			(s.anchor == anchorClose && s.offset <= 0 && !t.After(day.Open)) {
+			return nil
+		}
+		return []time.Time{t}
+	case anchorEvery:
+		var times []time.Time
+		for t := day.Open; t.Before(day.Close); t = t.Add(s.offset) {
+			times = append(times, t)
+		}
+		return times
+	case anchorClock:
+		return []time.Time{day.Date.Add(s.offset)}
+	}
+	return nil
+}
+
+// runsOn reports whether the schedule runs on the i-th day of the calendar.
+// The first and last days of a month or week are only known when the
+// calendar reaches past them.
+func (s Schedule) runsOn(calendar Calendar, i int) bool {
+	day := calendar[i].Date
+	sameMonth := func(j int) bool {
+		return calendar[j].Date.Year() == day.Year() && calendar[j].Date.Month() == day.Month()
+	}
+	sameWeek := func(j int) bool {
+		y1, w1 := calendar[j].Date.ISOWeek()
+		y2, w2 := day.ISOWeek()
+		return y1 == y2 && w1 == w2
+	}
+
+	switch s.days {
+	case daysFirstMonth:
+		return i > 0 && !sameMonth(i-1)
+	case daysLastMonth:
+		return i+1 < len(calendar) && !sameMonth(i+1)
+	case daysFirstWeek:
+		return i > 0 && !sameWeek(i-1)
+	case daysLastWeek:
+		return i+1 < len(calendar) && !sameWeek(i+1)
+	}
+	return true
+}
+
+// Session is a trading day of the market calendar in New York time
+type Session struct {
+	// Date is midnight at the start of the day
+	Date  time.Time
+	Open  time.Time
+	Close time.Time
+}
+
+// Calendar is the trading days of the market in date order
+type Calendar []Session
+
+// NewCalendar converts Alpaca calendar days to sessions in loc
+func NewCalendar(days []alpaca.CalendarDay, loc *time.Location) (Calendar, error) {
+	calendar := make(Calendar, 0, len(days))
+	for _, day := range days {
+		date, err := time.ParseInLocation("2006-01-02", day.Date, loc)
+		if err != nil {
+			return nil, fmt.Errorf("calendar date %q: %w", day.Date, err)
+		}
+		open, err := clockTime(date, day.Open, loc)
+		if err != nil {
+			return nil, err
+		}
+		closeAt, err := clockTime(date, day.Close, loc)
+		if err != nil {
+			return nil, err
+		}
+		calendar = append(calendar, Session{Date: date, Open: open, Close: closeAt})
+	}
+	return calendar, nil
+}
+
+// clockTime is the time of day s, such as "09:30", on date
+func clockTime(date time.Time, s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("calendar time %q on %s must be HH:MM", s, date.Format("2006-01-02"))
+}
+
+// parseDuration reads a Go duration or a number and unit, such as "5 min"
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(strings.ReplaceAll(s, " ", "")); err == nil && d > 0 {
+		return d, nil
+	}
+	if m := durationPattern.FindStringSubmatch(s); m != nil {
+		if unit, ok := durationUnits[m[2]]; ok {
+			n, _ := strconv.Atoi(m[1])
+			if n > 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%q is not a positive duration", s)
+}
+
+func isDayFilter(s string) bool {
+	for _, f := range dayFilters {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
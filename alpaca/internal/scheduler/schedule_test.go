@@ -0,0 +1,223 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+// testDays are trading days around Thanksgiving 2024: the market is closed
+// on Thursday the 28th and closes at 13:00 on Friday the 29th
+var testDays = []alpaca.CalendarDay{
+	{Date: "2024-10-31", Open: "09:30", Close: "16:00"},
+	{Date: "2024-11-01", Open: "09:30", Close: "16:00"},
+	{Date: "2024-11-25", Open: "09:30", Close: "16:00"},
+	{Date: "2024-11-26", Open: "09:30", Close: "16:00"},
+	{Date: "2024-11-27", Open: "09:30", Close: "16:00"},
+	{Date: "2024-11-29", Open: "09:30", Close: "13:00"},
+	{Date: "2024-12-02", Open: "09:30", Close: "16:00"},
+	{Date: "2024-12-03", Open: "09:30", Close: "16:00"},
+}
+
+func newYorkTime(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2024, month, day, hour, minute, 0, 0, utils.NewYork)
+}
+
+func testCalendar(t *testing.T) Calendar {
+	t.Helper()
+	calendar, err := NewCalendar(testDays, utils.NewYork)
+	if err != nil {
+		t.Fatalf("NewCalendar() error = %v", err)
+	}
+	return calendar
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantAnchor string
+		wantOffset time.Duration
+		wantDays   string
+		wantErr    string
+	}{
+		{spec: "open", wantAnchor: anchorOpen, wantDays: daysEvery},
+		{spec: "At Close", wantAnchor: anchorClose, wantDays: daysEvery},
+		{spec: "15m before close", wantAnchor: anchorClose, wantOffset: -15 * time.Minute, wantDays: daysEvery},
+		{spec: "5 minutes after open", wantAnchor: anchorOpen, wantOffset: 5 * time.Minute, wantDays: daysEvery},
+		{spec: "1h30m before open", wantAnchor: anchorOpen, wantOffset: -90 * time.Minute, wantDays: daysEvery},
+		{spec: "every 30 min while open", wantAnchor: anchorEvery, wantOffset: 30 * time.Minute, wantDays: daysEvery},
+		{spec: "at 8:05", wantAnchor: anchorClock, wantOffset: 8*time.Hour + 5*time.Minute, wantDays: daysEvery},
+		{spec: "close on the last trading day of the month", wantAnchor: anchorClose, wantDays: daysLastMonth},
+		{spec: "first trading day of the week", wantAnchor: anchorOpen, wantDays: daysFirstWeek},
+		{spec: "noon", wantErr: "must be"},
+		{spec: "0m after open", wantErr: `"0m" is not a positive duration`},
+		{spec: "5 fortnights after open", wantErr: "is not a positive duration"},
+		{spec: "every 500ms while open", wantErr: "the interval must be at least a second"},
+		{spec: "at 24:00", wantErr: "24:00 is not a time of day"},
+		{spec: "open on mondays", wantErr: "days must be one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if s.anchor != tt.wantAnchor || s.offset != tt.wantOffset || s.days != tt.wantDays {
+				t.Errorf("Parse() = %s %v on %q, want %s %v on %q", s.anchor, s.offset, s.days, tt.wantAnchor, tt.wantOffset, tt.wantDays)
+			}
+			if s.String() != tt.spec {
+				t.Errorf("String() = %q, want %q", s.String(), tt.spec)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	calendar := testCalendar(t)
+
+	tests := []struct {
+		name     string
+		spec     string
+		after    time.Time
+		want     time.Time
+		wantNone bool
+	}{
+		{
+			name:  "before close skips the holiday and follows the early close",
+			spec:  "15m before close",
+			after: newYorkTime(time.November, 27, 16, 0),
+			want:  newYorkTime(time.November, 29, 12, 45),
+		},
+		{
+			name:  "after open past an early close is skipped",
+			spec:  "4h after open",
+			after: newYorkTime(time.November, 27, 14, 0),
+			want:  newYorkTime(time.December, 2, 13, 30),
+		},
+		{
+			name:  "after close runs outside the session",
+			spec:  "30m after close",
+			after: newYorkTime(time.November, 29, 13, 0),
+			want:  newYorkTime(time.November, 29, 13, 30),
+		},
+		{
+			name:  "before open on the next trading day",
+			spec:  "1h before open",
+			after: newYorkTime(time.November, 27, 9, 0),
+			want:  newYorkTime(time.November, 29, 8, 30),
+		},
+		{
+			name:  "clock time skips the holiday",
+			spec:  "at 08:00",
+			after: newYorkTime(time.November, 27, 9, 0),
+			want:  newYorkTime(time.November, 29, 8, 0),
+		},
+		{
+			name:  "every interval within the session",
+			spec:  "every 2h while open",
+			after: newYorkTime(time.November, 29, 10, 0),
+			want:  newYorkTime(time.November, 29, 11, 30),
+		},
+		{
+			name:  "every interval stops at an early close",
+			spec:  "every 2h while open",
+			after: newYorkTime(time.November, 29, 11, 30),
+			want:  newYorkTime(time.December, 2, 9, 30),
+		},
+		{
+			name:  "last trading day of the month closes early",
+			spec:  "close on the last trading day of the month",
+			after: newYorkTime(time.November, 1, 16, 0),
+			want:  newYorkTime(time.November, 29, 13, 0),
+		},
+		{
+			name:  "first trading day of the month",
+			spec:  "first trading day of the month",
+			after: newYorkTime(time.October, 31, 12, 0),
+			want:  newYorkTime(time.November, 1, 9, 30),
+		},
+		{
+			name:  "last trading day of a week with a holiday",
+			spec:  "5m before close on the last trading day of the week",
+			after: newYorkTime(time.November, 25, 9, 0),
+			want:  newYorkTime(time.November, 29, 12, 55),
+		},
+		{
+			name:  "first trading day of the week",
+			spec:  "first trading day of the week",
+			after: newYorkTime(time.November, 26, 0, 0),
+			want:  newYorkTime(time.December, 2, 9, 30),
+		},
+		{
+			name:     "past the end of the calendar",
+			spec:     "open",
+			after:    newYorkTime(time.December, 3, 10, 0),
+			wantNone: true,
+		},
+		{
+			name:     "last trading day not yet known",
+			spec:     "close on the last trading day of the month",
+			after:    newYorkTime(time.December, 1, 0, 0),
+			wantNone: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, ok := s.Next(tt.after, calendar)
+			if tt.wantNone {
+				if ok {
+					t.Errorf("Next() = %s, want no run", got)
+				}
+				return
+			}
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("Next() = %s, %t, want %s", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCalendar(t *testing.T) {
+	calendar := testCalendar(t)
+	early := calendar[5]
+	if !early.Open.Equal(newYorkTime(time.November, 29, 9, 30)) || !early.Close.Equal(newYorkTime(time.November, 29, 13, 0)) {
+		t.Errorf("session = %+v, want 09:30 to 13:00 on November 29", early)
+	}
+
+	tests := []struct {
+		name    string
+		day     alpaca.CalendarDay
+		wantErr string
+	}{
+		{name: "bad date", day: alpaca.CalendarDay{Date: "11/29/2024", Open: "09:30", Close: "13:00"}, wantErr: `calendar date "11/29/2024"`},
+		{name: "bad open", day: alpaca.CalendarDay{Date: "2024-11-29", Open: "9:30am", Close: "13:00"}, wantErr: `calendar time "9:30am" on 2024-11-29 must be HH:MM`},
+		{name: "seconds", day: alpaca.CalendarDay{Date: "2024-11-29", Open: "09:30:00", Close: "13:00:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCalendar([]alpaca.CalendarDay{tt.day}, utils.NewYork)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("NewCalendar() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("NewCalendar() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+// calendarRetry is how long the scheduler waits to load the calendar again
+// after failing, and the longest it sleeps between checks
+const calendarRetry = time.Minute
+
+// calendarAhead is how far past today the calendar is loaded, enough to
+// find the last trading day of next month
+const calendarAhead = 70 * 24 * time.Hour
+
+// CalendarFunc returns the market's trading days between two dates
+type CalendarFunc func(start, end time.Time) ([]alpaca.CalendarDay, error)
+
+// Job is a scheduled job as reported by the scheduler
+type Job struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Running  bool   `json:"running"`
+	Runs     int    `json:"runs"`
+	// Skipped counts the runs missed because the previous run was still
+	// going
+	Skipped int `json:"skipped"`
+	// LastRun is when the last run started and LastDuration how long it took
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	// NextRun is empty until the calendar is loaded, or when the schedule
+	// has no run within it
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+type job struct {
+	info     Job
+	schedule Schedule
+	run      func(ctx context.Context) error
+	next     time.Time
+}
+
+// Scheduler runs jobs at times relative to the market's sessions. Runs are
+// not caught up: a run missed while the server was down or the previous run
+// was still going is skipped.
+type Scheduler struct {
+	calendar CalendarFunc
+	loc      *time.Location
+	wake     chan struct{}
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	jobs     []*job
+	days     Calendar
+	loadedOn string
+	loadedAt time.Time
+	err      error
+}
+
+// New creates a scheduler with no jobs that reads the trading days from
+// calendar
+func New(calendar CalendarFunc) *Scheduler {
+	return &Scheduler{
+		calendar: calendar,
+		loc:      utils.NewYork,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Add schedules a job. The job's context is cancelled when the scheduler
+// stops.
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.info.Name == name {
+			return fmt.Errorf("job %q is already scheduled", name)
+		}
+	}
+	s.jobs = append(s.jobs, &job{
+		info:     Job{Name: name, Schedule: schedule.String()},
+		schedule: schedule,
+		run:      run,
+	})
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Jobs reports every job in the order they were added
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.info)
+	}
+	return jobs
+}
+
+// Err is why the calendar could not be loaded, nil once it has been
+func (s *Scheduler) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Run starts jobs as they come due until ctx is cancelled, then waits for
+// the running ones to return
+func (s *Scheduler) Run(ctx context.Context) {
+	defer s.wg.Wait()
+
+	for {
+		now := time.Now().In(s.loc)
+		s.refresh(now)
+		wait := s.dispatch(ctx, now)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// refresh loads the calendar once a day, or again after a failed load
+func (s *Scheduler) refresh(now time.Time) {
+	today := now.Format("2006-01-02")
+	s.mu.Lock()
+	stale := s.loadedOn != today && (s.err == nil || now.Sub(s.loadedAt) >= calendarRetry)
+	s.mu.Unlock()
+	if !stale {
+		return
+	}
+
+	// From a week before the start of the month, so the first trading day
+	// of the month and week are known
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, s.loc).AddDate(0, 0, -7)
+	end := now.Add(calendarAhead)
+	days, err := s.calendar(start, end)
+	var calendar Calendar
+	if err == nil {
+		calendar, err = NewCalendar(days, s.loc)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadedAt = now
+	if err != nil {
+		if s.err == nil {
+			log.Printf("Warning: failed to load the market calendar, scheduled jobs are paused: %v", err)
+		}
+		s.err = fmt.Errorf("load market calendar: %w", err)
+		return
+	}
+	if s.err != nil {
+		log.Println("Market calendar loaded, scheduled jobs resumed")
+	}
+	s.err = nil
+	s.days = calendar
+	s.loadedOn = today
+	// Runs already due are left for dispatch to start
+	for _, j := range s.jobs {
+		if j.next.IsZero() || j.next.After(now) {
+			s.plan(j, now)
+		}
+	}
+}
+
+// dispatch starts the jobs that are due and plans their next runs. It
+// returns how long to sleep until the next job is due.
+func (s *Scheduler) dispatch(ctx context.Context, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := calendarRetry
+	for _, j := range s.jobs {
+		// Jobs added since the calendar was loaded have no run planned
+		if j.next.IsZero() && s.days != nil {
+			s.plan(j, now)
+		}
+		if j.next.IsZero() {
+			continue
+		}
+		if !j.next.After(now) {
+			if j.info.Running {
+				j.info.Skipped++
+				log.Printf("Warning: job %q is still running, skipping its run at %s", j.info.Name, j.next.Format(time.RFC3339))
+			} else {
+				s.start(ctx, j, now)
+			}
+			s.plan(j, now)
+			if j.next.IsZero() {
+				continue
+			}
+		}
+		wait = min(wait, j.next.Sub(now))
+	}
+	return wait
+}
+
+// plan sets a job's next run after now
+func (s *Scheduler) plan(j *job, now time.Time) {
+	next, ok := j.schedule.Next(now, s.days)
+	if !ok {
+		j.next, j.info.NextRun = time.Time{}, nil
+		return
+	}
+	j.next = next
+	j.info.NextRun = &next
+}
+
+// start runs a job in the background, recording how it went
+func (s *Scheduler) start(ctx context.Context, j *job, now time.Time) {
+	j.info.Running = true
+	j.info.LastRun = &now
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		started := time.Now()
+		err := call(ctx, j.run)
+		elapsed := time.Since(started).Round(time.Millisecond)
+		if err != nil {
+			log.Printf("Warning: job %q failed after %s: %v", j.info.Name, elapsed, err)
+		} else {
+			log.Printf("Job %q finished in %s", j.info.Name, elapsed)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		j.info.Running = false
+		j.info.Runs++
+		j.info.LastDuration = elapsed.String()
+		j.info.LastError = ""
+		if err != nil {
+			j.info.LastError = err.Error()
+		}
+	}()
+}
+
+// call runs a job, turning a panic into an error
+func call(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return run(ctx)
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+func testCalendarFunc(start, end time.Time) ([]alpaca.CalendarDay, error) {
+	return testDays, nil
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	s := New(testCalendarFunc)
+	noop := func(ctx context.Context) error { return nil }
+
+	if err := s.Add("rebalance", "close on the last trading day of the month", noop); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := s.Add("rebalance", "open", noop); err == nil || !strings.Contains(err.Error(), `job "rebalance" is already scheduled`) {
+		t.Errorf("Add() error = %v, want a duplicate job error", err)
+	}
+	if err := s.Add("report", "noon", noop); err == nil {
+		t.Error("Add() error = nil, want a schedule error")
+	}
+
+	jobs := s.Jobs()
+	if len(jobs) != 1 || jobs[0].Schedule != "close on the last trading day of the month" || jobs[0].NextRun != nil {
+		t.Errorf("Jobs() = %+v, want the one unplanned rebalance job", jobs)
+	}
+}
+
+func TestSchedulerCalendarFailure(t *testing.T) {
+	fail := true
+	s := New(func(start, end time.Time) ([]alpaca.CalendarDay, error) {
+		if fail {
+			return nil, errors.New("calendar unavailable")
+		}
+		return testDays, nil
+	})
+	if err := s.Add("report", "close", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	now := newYorkTime(time.November, 27, 10, 0)
+	s.refresh(now)
+	if err := s.Err(); err == nil || !strings.Contains(err.Error(), "load market calendar: calendar unavailable") {
+		t.Fatalf("Err() = %v, want the calendar error", err)
+	}
+	if wait := s.dispatch(context.Background(), now); wait != calendarRetry {
+		t.Errorf("dispatch() = %s, want %s", wait, calendarRetry)
+	}
+	if next := s.Jobs()[0].NextRun; next != nil {
+		t.Errorf("NextRun = %s, want none without a calendar", next)
+	}
+
+	// The load is retried only once calendarRetry has passed
+	fail = false
+	s.refresh(now.Add(calendarRetry / 2))
+	if s.Err() == nil {
+		t.Fatal("Err() = nil before the retry is due")
+	}
+	s.refresh(now.Add(calendarRetry))
+	if err := s.Err(); err != nil {
+		t.Fatalf("Err() = %v after the calendar loaded", err)
+	}
+	want := newYorkTime(time.November, 27, 16, 0)
+	if next := s.Jobs()[0].NextRun; next == nil || !next.Equal(want) {
+		t.Errorf("NextRun = %v, want %s", next, want)
+	}
+}
+
+func TestSchedulerDispatch(t *testing.T) {
+	s := New(testCalendarFunc)
+	release := make(chan struct{})
+	if err := s.Add("report", "15m before close", func(ctx context.Context) error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := s.Add("broken", "at 08:00", func(ctx context.Context) error {
+		panic("boom")
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	ctx := context.Background()
+	s.refresh(newYorkTime(time.November, 27, 10, 0))
+
+	// The report comes due and keeps running past its next run on the
+	// early close after the holiday, which is skipped
+	due := newYorkTime(time.November, 27, 15, 45)
+	if wait := s.dispatch(ctx, due.Add(-time.Minute)); wait != time.Minute {
+		t.Errorf("dispatch() = %s, want 1m until the report is due", wait)
+	}
+	s.dispatch(ctx, due)
+	s.dispatch(ctx, newYorkTime(time.November, 29, 12, 45))
+	close(release)
+	s.wg.Wait()
+
+	jobs := s.Jobs()
+	report, broken := jobs[0], jobs[1]
+	if report.Running || report.Runs != 1 || report.Skipped != 1 || report.LastError != "" {
+		t.Errorf("report = %+v, want 1 run and 1 skipped", report)
+	}
+	if report.LastRun == nil || !report.LastRun.Equal(due) {
+		t.Errorf("report LastRun = %v, want %s", report.LastRun, due)
+	}
+	want := newYorkTime(time.December, 2, 15, 45)
+	if report.NextRun == nil || !report.NextRun.Equal(want) {
+		t.Errorf("report NextRun = %v, want %s", report.NextRun, want)
+	}
+	if broken.Runs != 1 || broken.LastError != "panic: boom" {
+		t.Errorf("broken = %+v, want 1 run failed with the panic", broken)
+	}
+}
@@ -0,0 +1,169 @@
+package strategy
+
+import (
+	"errors"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/indicators"
+	"github.com/shopspring/decimal"
+)
+
+func init() {
+	Register("buy_and_hold", NewBuyAndHold)
+	Register("sma_crossover", NewSMACrossover)
+}
+
+// BuyAndHold buys each symbol on its first bar and holds it
+type BuyAndHold struct {
+	Base
+	qty        decimal.Decimal
+	allocation float64
+	bought     map[string]bool
+}
+
+// NewBuyAndHold creates a buy and hold strategy. Params: qty, the shares to
+// buy of each symbol, or allocation, the fraction of equity to spend on each
+// symbol (default 1).
+func NewBuyAndHold(params Params) (Strategy, error) {
+	s := &BuyAndHold{
+		qty:        decimal.NewFromFloat(params.Float("qty", 0)),
+		allocation: params.Float("allocation", 1),
+		bought:     make(map[string]bool),
+	}
+	if s.qty.IsNegative() {
+		return nil, errors.New("qty must not be negative")
+	}
+	if s.allocation <= 0 || s.allocation > 1 {
+		return nil, errors.New("allocation must be greater than 0 and at most 1")
+	}
+	return s, nil
+}
+
+// OnBar buys a symbol the first time one of its bars arrives
+func (s *BuyAndHold) OnBar(ctx Context, bar Bar) error {
+	if s.bought[bar.Symbol] {
+		return nil
+	}
+	s.bought[bar.Symbol] = true
+
+	qty := s.qty
+	if qty.IsZero() {
+		qty = affordableQty(ctx, s.allocation, bar.Close)
+	}
+	if !qty.IsPositive() {
+		return nil
+	}
+
+	_, err := ctx.PlaceOrder(marketOrder(bar.Symbol, alpaca.Buy, qty))
+	return err
+}
+
+// SMACrossover holds a symbol while its fast simple moving average of closes
+// is above its slow one
+type SMACrossover struct {
+	Base
+	fast, slow int
+	allocation float64
+	averages   map[string]*crossover
+}
+
+// crossover is the moving averages of a symbol and whether the fast one was
+// above the slow one at the previous bar
+type crossover struct {
+	fast, slow   *indicators.SMA
+	above, known bool
+}
+
+// NewSMACrossover creates a moving average crossover strategy. Params: fast
+// (default 10) and slow (default 30) periods, and allocation, the fraction of
+// equity to buy each symbol with (default 1).
+func NewSMACrossover(params Params) (Strategy, error) {
+	fast, err := params.Int("fast", 10)
+	if err != nil {
+		return nil, err
+	}
+	slow, err := params.Int("slow", 30)
+	if err != nil {
+		return nil, err
+	}
+	if fast < 1 || slow <= fast {
+		return nil, errors.New("fast must be at least 1 and less than slow")
+	}
+
+	s := &SMACrossover{
+		fast:       fast,
+		slow:       slow,
+		allocation: params.Float("allocation", 1),
+		averages:   make(map[string]*crossover),
+	}
+	if s.allocation <= 0 || s.allocation > 1 {
+		return nil, errors.New("allocation must be greater than 0 and at most 1")
+	}
+	return s, nil
+}
+
+// OnBar buys when the fast average crosses above the slow one and sells the
+// whole position when it crosses back below
+func (s *SMACrossover) OnBar(ctx Context, bar Bar) error {
+	x, ok := s.averages[bar.Symbol]
+	if !ok {
+		fast, err := indicators.NewSMA(s.fast)
+		if err != nil {
+			return err
+		}
+		slow, err := indicators.NewSMA(s.slow)
+		if err != nil {
+			return err
+		}
+		x = &crossover{fast: fast, slow: slow}
+		s.averages[bar.Symbol] = x
+	}
+	fast, _ := x.fast.Add(bar.Close)
+	slow, ok := x.slow.Add(bar.Close)
+	if !ok {
+		return nil
+	}
+	wasAbove, known := x.above, x.known
+	isAbove := fast > slow
+	x.above, x.known = isAbove, true
+	if !known {
+		return nil
+	}
+
+	position := ctx.Position(bar.Symbol)
+	switch {
+	case isAbove && !wasAbove && position.IsZero():
+		qty := affordableQty(ctx, s.allocation, bar.Close)
+		if !qty.IsPositive() {
+			return nil
+		}
+		_, err := ctx.PlaceOrder(marketOrder(bar.Symbol, alpaca.Buy, qty))
+		return err
+	case !isAbove && wasAbove && position.IsPositive():
+		_, err := ctx.PlaceOrder(marketOrder(bar.Symbol, alpaca.Sell, position))
+		return err
+	}
+	return nil
+}
+
+// SMAState is the moving averages of a symbol. They are zero until Ready,
+// once slow closes have arrived.
+type SMAState struct {
+	Ready bool    `json:"ready"`
+	Fast  float64 `json:"fast"`
+	Slow  float64 `json:"slow"`
+}
+
+// State reports the latest moving averages of each symbol
+func (s *SMACrossover) State() any {
+	state := make(map[string]SMAState, len(s.averages))
+	for symbol, x := range s.averages {
+		var st SMAState
+		if slow, ok := x.slow.Value(); ok {
+			st.Ready, st.Slow = true, slow
+			st.Fast, _ = x.fast.Value()
+		}
+		state[symbol] = st
+	}
+	return state
+}
@@ -0,0 +1,658 @@
+package strategy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/nathgoh/investment-trader/alpaca/internal/streaming"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
+)
+
+// Instance states
+const (
+	StatusRunning = "running"
+	StatusPaused  = "paused"
+	StatusStopped = "stopped"
+	StatusFailed  = "failed"
+)
+
+// maxInstances is how many instances are kept; the oldest stopped ones are
+// dropped
+const maxInstances = 100
+
+// eventBuffer is how many order events are held on the event bus for an
+// instance before publishing waits for them to be queued
+const eventBuffer = 256
+
+var instanceNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// StartRequest describes a strategy instance to start
+type StartRequest struct {
+	// Name identifies the instance and tags its orders in the journal. One
+	// is generated from the strategy when empty.
+	Name     string   `json:"name"`
+	Strategy string   `json:"strategy"`
+	Account  string   `json:"account"`
+	Symbols  []string `json:"symbols"`
+	Params   Params   `json:"params,omitempty"`
+	// Quotes streams quotes to OnQuote as well as bars to OnBar
+	Quotes bool `json:"quotes"`
+}
+
+// Stats count what an instance has handled and done
+type Stats struct {
+	Bars   int `json:"bars"`
+	Quotes int `json:"quotes"`
+	Orders int `json:"orders"`
+	Fills  int `json:"fills"`
+	Errors int `json:"errors"`
+}
+
+// Instance is a strategy started by a Runner
+type Instance struct {
+	Name      string       `json:"name"`
+	Status    string       `json:"status"`
+	Request   StartRequest `json:"request"`
+	StartedAt time.Time    `json:"started_at"`
+	StoppedAt *time.Time   `json:"stopped_at,omitempty"`
+	Stats     Stats        `json:"stats"`
+	// LastEventAt is when the instance last handled a bar, quote or fill
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// State is what the strategy last reported, when it is an Inspector
+	State json.RawMessage `json:"state,omitempty"`
+}
+
+// Runner runs strategy instances against live accounts. Each instance gets
+// the streamed bars, and optionally quotes, of its symbols and the fills of
+// its own orders. Orders go through the account's broker, so they pass the
+// risk checks and are journaled under the instance name.
+type Runner struct {
+	brokers *trading.Registry
+	hub     *streaming.Hub
+	events  *trading.EventBus
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.RWMutex
+	instances map[string]*instance
+	order     []string
+}
+
+// NewRunner creates a runner trading through brokers, fed by hub and told of
+// fills by events
+func NewRunner(brokers *trading.Registry, hub *streaming.Hub, events *trading.EventBus) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		brokers:   brokers,
+		hub:       hub,
+		events:    events,
+		ctx:       ctx,
+		cancel:    cancel,
+		instances: make(map[string]*instance),
+	}
+}
+
+// Start creates a strategy instance, calls its OnStart hook and starts
+// feeding it events. An instance whose OnStart fails is kept as failed.
+func (r *Runner) Start(req StartRequest) (Instance, error) {
+	req, err := r.normalize(req)
+	if err != nil {
+		return Instance{}, err
+	}
+	strat, err := New(req.Strategy, req.Params)
+	if err != nil {
+		return Instance{}, err
+	}
+	broker, err := r.brokers.Get(req.Account)
+	if err != nil {
+		return Instance{}, err
+	}
+	if !r.hub.Enabled() {
+		return Instance{}, errors.New("market data streaming is disabled, strategies would receive no bars")
+	}
+	if r.ctx.Err() != nil {
+		return Instance{}, errors.New("strategy runner is stopped")
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	inst := &instance{
+		strat:  strat,
+		broker: trading.WithMeta(broker, trading.OrderMeta{Strategy: req.Name, Source: "strategy"}),
+		cancel: cancel,
+		done:   make(chan struct{}),
+		orders: make(map[string]bool),
+		info: Instance{
+			Name:      req.Name,
+			Status:    StatusRunning,
+			Request:   req,
+			StartedAt: time.Now(),
+		},
+	}
+
+	r.mu.Lock()
+	if existing, ok := r.instances[req.Name]; ok {
+		if existing.active() {
+			r.mu.Unlock()
+			cancel()
+			return Instance{}, fmt.Errorf("strategy instance %q is already running", req.Name)
+		}
+		r.remove(req.Name)
+	}
+	r.instances[req.Name] = inst
+	r.order = append(r.order, req.Name)
+	r.prune()
+	r.mu.Unlock()
+
+	// Subscribe before starting, so fills of orders placed by OnStart and
+	// bars arriving meanwhile are not missed
+	busEvents, unsubscribe := r.events.SubscribeBlocking(eventBuffer)
+	events := queueEvents(busEvents, req.Account)
+	sub := r.hub.NewSubscriber("strategy:" + req.Name)
+	subs := streaming.Subscriptions{Bars: req.Symbols}
+	if req.Quotes {
+		subs.Quotes = req.Symbols
+	}
+	// A subscriber just created cannot have been removed
+	_ = r.hub.Subscribe(sub, subs)
+
+	if err := inst.call("OnStart", time.Now(), inst.strat.OnStart); err != nil {
+		r.hub.Remove(sub)
+		unsubscribe()
+		cancel()
+		inst.finish(StatusFailed)
+		close(inst.done)
+		return Instance{}, fmt.Errorf("strategy %s failed to start: %w", req.Name, err)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer unsubscribe()
+		defer r.hub.Remove(sub)
+		inst.run(ctx, sub.Messages(), events)
+	}()
+
+	log.Printf("Started strategy %q (%s) on account %q for %v", req.Name, req.Strategy, req.Account, req.Symbols)
+	return inst.view(), nil
+}
+
+// Get returns an instance by name
+func (r *Runner) Get(name string) (Instance, error) {
+	inst, err := r.instance(name)
+	if err != nil {
+		return Instance{}, err
+	}
+	return inst.view(), nil
+}
+
+// List returns every kept instance, newest first
+func (r *Runner) List() []Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	instances := make([]Instance, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		instances = append(instances, r.instances[r.order[i]].view())
+	}
+	return instances
+}
+
+// Pause stops an instance receiving bars and quotes. Fills of its orders are
+// still delivered.
+func (r *Runner) Pause(name string) (Instance, error) {
+	return r.transition(name, StatusRunning, StatusPaused)
+}
+
+// Resume delivers bars and quotes to a paused instance again. Those that
+// arrived while it was paused are not replayed.
+func (r *Runner) Resume(name string) (Instance, error) {
+	return r.transition(name, StatusPaused, StatusRunning)
+}
+
+// Stop stops an instance, waiting for its OnStop hook to return. Its open
+// orders are left working.
+func (r *Runner) Stop(name string) (Instance, error) {
+	inst, err := r.instance(name)
+	if err != nil {
+		return Instance{}, err
+	}
+	if !inst.active() {
+		return Instance{}, fmt.Errorf("strategy instance %q is not running", name)
+	}
+
+	inst.cancel()
+	<-inst.done
+	log.Printf("Stopped strategy %q", name)
+	return inst.view(), nil
+}
+
+// Close stops every instance and waits for them to finish
+func (r *Runner) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Failed lists the instances that stopped because a hook failed
+func (r *Runner) Failed() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var failed []string
+	for _, name := range r.order {
+		if r.instances[name].view().Status == StatusFailed {
+			failed = append(failed, name)
+		}
+	}
+	return failed
+}
+
+func (r *Runner) instance(name string) (*instance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inst, ok := r.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("strategy instance %q not found", name)
+	}
+	return inst, nil
+}
+
+func (r *Runner) transition(name, from, to string) (Instance, error) {
+	inst, err := r.instance(name)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.info.Status != from {
+		return Instance{}, fmt.Errorf("strategy instance %q is %s, not %s", name, inst.info.Status, from)
+	}
+	inst.info.Status = to
+	return inst.info, nil
+}
+
+// normalize fills in defaults and checks a request
+func (r *Runner) normalize(req StartRequest) (StartRequest, error) {
+	if req.Strategy == "" {
+		return req, errors.New("strategy is required")
+	}
+	if req.Account == "" {
+		return req, errors.New("account is required")
+	}
+	if req.Name == "" {
+		b := make([]byte, 3)
+		rand.Read(b)
+		req.Name = fmt.Sprintf("%s-%x", strings.ReplaceAll(req.Strategy, "_", "-"), b)
+	}
+	if !instanceNamePattern.MatchString(req.Name) {
+		return req, fmt.Errorf("instance name %q must use only a-z, 0-9, - and _", req.Name)
+	}
+
+	symbols := make([]string, 0, len(req.Symbols))
+	seen := make(map[string]bool)
+	for _, s := range req.Symbols {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" && !seen[s] {
+			seen[s] = true
+			symbols = append(symbols, s)
+		}
+	}
+	if len(symbols) == 0 {
+		return req, errors.New("at least one symbol is required")
+	}
+	req.Symbols = symbols
+	return req, nil
+}
+
+// remove drops an instance from the runner
+func (r *Runner) remove(name string) {
+	delete(r.instances, name)
+	for i, n := range r.order {
+		if n == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// prune drops the oldest stopped instances beyond maxInstances
+func (r *Runner) prune() {
+	for i := 0; len(r.order) > maxInstances && i < len(r.order); {
+		name := r.order[i]
+		if r.instances[name].active() {
+			i++
+			continue
+		}
+		r.remove(name)
+	}
+}
+
+// instance is the runner's handle on a started strategy
+type instance struct {
+	strat  Strategy
+	broker trading.Broker
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// orders are the IDs of the instance's orders that may still fill. Only
+	// the instance's goroutine uses it.
+	orders map[string]bool
+
+	mu   sync.Mutex
+	info Instance
+}
+
+// hookPanic is the error of a hook that panicked, which fails the instance
+type hookPanic struct {
+	value any
+}
+
+func (p hookPanic) Error() string {
+	return fmt.Sprintf("panic: %v", p.value)
+}
+
+// queueEvents passes on the events of an account from a blocking bus
+// subscription, queueing them for as long as the instance is busy so none
+// are dropped. Publishing never waits on a strategy's hooks, which may
+// themselves place orders that publish events. The returned channel is
+// closed once in is.
+func queueEvents(in <-chan trading.OrderEvent, account string) <-chan trading.OrderEvent {
+	out := make(chan trading.OrderEvent)
+	go func() {
+		defer close(out)
+
+		var queue []trading.OrderEvent
+		for {
+			var send chan<- trading.OrderEvent
+			var next trading.OrderEvent
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+
+			select {
+			case event, ok := <-in:
+				if !ok {
+					return
+				}
+				if event.Account == account {
+					queue = append(queue, event)
+				}
+			case send <- next:
+				queue = queue[1:]
+			}
+		}
+	}()
+	return out
+}
+
+// run feeds the instance events until ctx is done or a hook panics
+func (i *instance) run(ctx context.Context, messages <-chan streaming.Message, events <-chan trading.OrderEvent) {
+	defer close(i.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			i.call("OnStop", time.Now(), i.strat.OnStop)
+			i.finish(StatusStopped)
+			return
+
+		case msg := <-messages:
+			if i.paused() {
+				continue
+			}
+			if err := i.handleMessage(msg); errors.As(err, new(hookPanic)) {
+				i.finish(StatusFailed)
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if err := i.handleEvent(event); errors.As(err, new(hookPanic)) {
+				i.finish(StatusFailed)
+				return
+			}
+		}
+	}
+}
+
+// handleMessage passes a streamed bar or quote to the strategy
+func (i *instance) handleMessage(msg streaming.Message) error {
+	switch data := msg.Data.(type) {
+	case streaming.Bar:
+		bar := Bar{Symbol: msg.Symbol, Bar: marketdata.Bar{
+			Timestamp:  data.Timestamp,
+			Open:       data.Open,
+			High:       data.High,
+			Low:        data.Low,
+			Close:      data.Close,
+			Volume:     data.Volume,
+			TradeCount: data.TradeCount,
+			VWAP:       data.VWAP,
+		}}
+		i.update(func(info *Instance) { info.Stats.Bars++ })
+		return i.call("OnBar", data.Timestamp, func(ctx Context) error { return i.strat.OnBar(ctx, bar) })
+
+	case streaming.Quote:
+		quote := Quote{Symbol: msg.Symbol, Quote: marketdata.Quote{
+			Timestamp:   data.Timestamp,
+			BidPrice:    data.BidPrice,
+			BidSize:     data.BidSize,
+			BidExchange: data.BidExchange,
+			AskPrice:    data.AskPrice,
+			AskSize:     data.AskSize,
+			AskExchange: data.AskExchange,
+			Conditions:  data.Conditions,
+			Tape:        data.Tape,
+		}}
+		i.update(func(info *Instance) { info.Stats.Quotes++ })
+		return i.call("OnQuote", data.Timestamp, func(ctx Context) error { return i.strat.OnQuote(ctx, quote) })
+	}
+	return nil
+}
+
+// handleEvent passes the fills of the instance's own orders to the strategy
+func (i *instance) handleEvent(event trading.OrderEvent) error {
+	if event.Account != i.info.Request.Account || !i.orders[event.Order.ID] {
+		return nil
+	}
+
+	switch event.Event {
+	case trading.EventFill, trading.EventCanceled, trading.EventExpired, trading.EventRejected, trading.EventReplaced:
+		delete(i.orders, event.Order.ID)
+	}
+	if event.Event != trading.EventFill && event.Event != trading.EventPartialFill {
+		return nil
+	}
+
+	fill := Fill{Order: event.Order, Time: event.At}
+	if event.Price != nil {
+		fill.Price = *event.Price
+	}
+	if event.Qty != nil {
+		fill.Qty = *event.Qty
+	}
+	i.update(func(info *Instance) { info.Stats.Fills++ })
+	return i.call("OnFill", event.At, func(ctx Context) error { return i.strat.OnFill(ctx, fill) })
+}
+
+// call runs a hook, recording its error and the strategy's state. A panic
+// is returned as a hookPanic.
+func (i *instance) call(hook string, now time.Time, fn func(ctx Context) error) (err error) {
+	ctx := &liveContext{inst: i, now: now}
+	defer func() {
+		if v := recover(); v != nil {
+			err = hookPanic{value: v}
+		}
+		if err == nil {
+			err = ctx.err
+		}
+
+		var state json.RawMessage
+		if inspector, ok := i.strat.(Inspector); ok {
+			state, _ = json.Marshal(inspector.State())
+		}
+
+		at := time.Now()
+		i.update(func(info *Instance) {
+			if hook != "OnStart" && hook != "OnStop" {
+				info.LastEventAt = &at
+			}
+			if state != nil {
+				info.State = state
+			}
+			if err != nil {
+				info.Stats.Errors++
+				info.LastError = fmt.Sprintf("%s: %v", hook, err)
+			}
+		})
+		if err != nil {
+			log.Printf("Warning: strategy %q %s failed: %v", i.info.Request.Name, hook, err)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// track records an order placed by the instance, and its legs, so their
+// fills reach the strategy
+func (i *instance) track(order *alpaca.Order) {
+	i.orders[order.ID] = true
+	for _, leg := range order.Legs {
+		i.orders[leg.ID] = true
+	}
+	i.update(func(info *Instance) { info.Stats.Orders++ })
+}
+
+func (i *instance) finish(status string) {
+	now := time.Now()
+	i.update(func(info *Instance) {
+		info.Status = status
+		info.StoppedAt = &now
+	})
+}
+
+func (i *instance) update(fn func(info *Instance)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	fn(&i.info)
+}
+
+func (i *instance) view() Instance {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.info
+}
+
+func (i *instance) active() bool {
+	status := i.view().Status
+	return status == StatusRunning || status == StatusPaused
+}
+
+func (i *instance) paused() bool {
+	return i.view().Status == StatusPaused
+}
+
+// liveContext is the Context of one hook call. The account and positions are
+// fetched at most once per call, and again after an order is placed. A
+// failed fetch reads as zero and is reported as the hook's error, and no
+// orders are placed for the rest of the call, since the hook decided on the
+// zeros instead of the account's real state.
+type liveContext struct {
+	inst      *instance
+	now       time.Time
+	account   *alpaca.Account
+	positions map[string]decimal.Decimal
+	err       error
+}
+
+// Now is the time of the event being handled
+func (c *liveContext) Now() time.Time {
+	return c.now
+}
+
+// Cash is the account's cash
+func (c *liveContext) Cash() decimal.Decimal {
+	if account := c.loadAccount(); account != nil {
+		return account.Cash
+	}
+	return decimal.Zero
+}
+
+// Equity is the account's equity
+func (c *liveContext) Equity() decimal.Decimal {
+	if account := c.loadAccount(); account != nil {
+		return account.Equity
+	}
+	return decimal.Zero
+}
+
+// Position is the account's quantity of a symbol
+func (c *liveContext) Position(symbol string) decimal.Decimal {
+	if c.positions == nil {
+		positions, err := trading.GetPositions(c.inst.broker)
+		if err != nil {
+			c.fail(fmt.Errorf("load positions: %w", err))
+			return decimal.Zero
+		}
+		c.positions = make(map[string]decimal.Decimal, len(positions))
+		for _, p := range positions {
+			c.positions[p.Symbol] = p.Qty
+		}
+	}
+	return c.positions[symbol]
+}
+
+// PlaceOrder places an order through the account's broker, unless a fetch
+// earlier in the call failed
+func (c *liveContext) PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("order not placed: %w", c.err)
+	}
+	order, err := trading.PlaceOrder(c.inst.broker, req)
+	if err != nil {
+		return nil, err
+	}
+	c.inst.track(order)
+	c.account, c.positions = nil, nil
+	return order, nil
+}
+
+// CancelOrder cancels an order through the account's broker
+func (c *liveContext) CancelOrder(orderID string) error {
+	return trading.CancelOrder(c.inst.broker, orderID)
+}
+
+func (c *liveContext) loadAccount() *alpaca.Account {
+	if c.account == nil {
+		account, err := trading.GetAccount(c.inst.broker)
+		if err != nil {
+			c.fail(fmt.Errorf("load account: %w", err))
+			return nil
+		}
+		c.account = account
+	}
+	return c.account
+}
+
+func (c *liveContext) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
@@ -0,0 +1,262 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/trading"
+	"github.com/shopspring/decimal"
+)
+
+// flakyBroker is a simulated broker whose account and position reads can
+// be made to fail
+type flakyBroker struct {
+	*trading.SimBroker
+	failAccount, failPositions bool
+}
+
+func (b *flakyBroker) GetAccount() (*alpaca.Account, error) {
+	if b.failAccount {
+		return nil, errors.New("connection reset")
+	}
+	return b.SimBroker.GetAccount()
+}
+
+func (b *flakyBroker) GetPositions() ([]alpaca.Position, error) {
+	if b.failPositions {
+		return nil, errors.New("connection reset")
+	}
+	return b.SimBroker.GetPositions()
+}
+
+// hooks is a strategy running the given functions
+type hooks struct {
+	Base
+	onBar  func(ctx Context, bar Bar) error
+	onFill func(ctx Context, fill Fill) error
+}
+
+func (h *hooks) OnBar(ctx Context, bar Bar) error {
+	return h.onBar(ctx, bar)
+}
+
+func (h *hooks) OnFill(ctx Context, fill Fill) error {
+	if h.onFill == nil {
+		return nil
+	}
+	return h.onFill(ctx, fill)
+}
+
+func newTestInstance(strat Strategy, broker trading.Broker) *instance {
+	return &instance{
+		strat:  strat,
+		broker: broker,
+		done:   make(chan struct{}),
+		orders: make(map[string]bool),
+		info: Instance{
+			Name:    "test",
+			Status:  StatusRunning,
+			Request: StartRequest{Name: "test", Account: "paper"},
+		},
+	}
+}
+
+func newFlakyBroker() *flakyBroker {
+	feed := trading.NewStaticPriceFeed(map[string]decimal.Decimal{"AAPL": decimal.NewFromInt(100)})
+	return &flakyBroker{SimBroker: trading.NewSimBroker(feed, decimal.NewFromInt(10000))}
+}
+
+func TestLiveContextRefusesOrdersAfterFailedReads(t *testing.T) {
+	tests := []struct {
+		name          string
+		failAccount   bool
+		failPositions bool
+		wantErr       string
+	}{
+		{name: "reads succeed"},
+		{name: "positions fail", failPositions: true, wantErr: "load positions: connection reset"},
+		{name: "account fails", failAccount: true, wantErr: "load account: connection reset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFlakyBroker()
+			broker.failAccount, broker.failPositions = tt.failAccount, tt.failPositions
+
+			// Size an order from the account and position, which read as zero
+			// when their fetch fails
+			var placeErr error
+			strat := &hooks{onBar: func(ctx Context, bar Bar) error {
+				qty := affordableQty(ctx, 0.1, 100).Sub(ctx.Position("AAPL"))
+				_, placeErr = ctx.PlaceOrder(marketOrder("AAPL", alpaca.Buy, qty.Add(decimal.NewFromInt(1))))
+				return nil
+			}}
+			inst := newTestInstance(strat, broker)
+
+			err := inst.call("OnBar", time.Now(), func(ctx Context) error { return strat.OnBar(ctx, Bar{Symbol: "AAPL"}) })
+
+			orders, _ := broker.SimBroker.GetOrders(alpaca.GetOrdersRequest{Status: "all"})
+			info := inst.view()
+			if tt.wantErr == "" {
+				if err != nil || placeErr != nil {
+					t.Fatalf("hook error = %v, place error = %v, want none", err, placeErr)
+				}
+				if len(orders) != 1 || info.Stats.Orders != 1 || len(inst.orders) != 1 {
+					t.Errorf("%d orders placed and %d counted, want 1 tracked order", len(orders), info.Stats.Orders)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("hook error = %v, want %q", err, tt.wantErr)
+			}
+			if placeErr == nil || !strings.Contains(placeErr.Error(), "order not placed") {
+				t.Errorf("PlaceOrder() error = %v, want the order refused", placeErr)
+			}
+			if len(orders) != 0 {
+				t.Errorf("%d orders reached the broker, want none", len(orders))
+			}
+			if info.Stats.Errors != 1 || !strings.Contains(info.LastError, "OnBar: ") {
+				t.Errorf("stats = %+v, last error %q, want the OnBar error recorded", info.Stats, info.LastError)
+			}
+		})
+	}
+}
+
+func TestInstanceHookPanic(t *testing.T) {
+	strat := &hooks{onBar: func(ctx Context, bar Bar) error { panic("index out of range") }}
+	inst := newTestInstance(strat, newFlakyBroker())
+
+	err := inst.call("OnBar", time.Now(), func(ctx Context) error { return strat.OnBar(ctx, Bar{Symbol: "AAPL"}) })
+	if !errors.As(err, new(hookPanic)) || err.Error() != "panic: index out of range" {
+		t.Errorf("hook error = %v, want the panic", err)
+	}
+}
+
+func TestInstanceHandleEvent(t *testing.T) {
+	var fills []Fill
+	strat := &hooks{onFill: func(ctx Context, fill Fill) error {
+		fills = append(fills, fill)
+		return nil
+	}}
+	inst := newTestInstance(strat, newFlakyBroker())
+	inst.orders["mine"] = true
+
+	price, qty := decimal.NewFromInt(100), decimal.NewFromInt(4)
+	events := []trading.OrderEvent{
+		{Account: "paper", Event: trading.EventFill, Order: alpaca.Order{ID: "other"}, Price: &price, Qty: &qty},
+		{Account: "live", Event: trading.EventFill, Order: alpaca.Order{ID: "mine"}, Price: &price, Qty: &qty},
+		{Account: "paper", Event: trading.EventNew, Order: alpaca.Order{ID: "mine"}},
+		{Account: "paper", Event: trading.EventPartialFill, Order: alpaca.Order{ID: "mine"}, Price: &price, Qty: &qty},
+		{Account: "paper", Event: trading.EventFill, Order: alpaca.Order{ID: "mine"}, Price: &price, Qty: &qty},
+		// A fill reported twice is only delivered once
+		{Account: "paper", Event: trading.EventFill, Order: alpaca.Order{ID: "mine"}, Price: &price, Qty: &qty},
+	}
+	for _, event := range events {
+		if err := inst.handleEvent(event); err != nil {
+			t.Fatalf("handleEvent() error = %v", err)
+		}
+	}
+
+	if len(fills) != 2 || !fills[0].Price.Equal(price) || !fills[1].Qty.Equal(qty) {
+		t.Errorf("fills = %+v, want the partial fill and the fill of the instance's order", fills)
+	}
+	if inst.orders["mine"] || inst.view().Stats.Fills != 2 {
+		t.Errorf("order still tracked = %t, fills counted = %d, want untracked and 2", inst.orders["mine"], inst.view().Stats.Fills)
+	}
+}
+
+func TestInstanceReceivesEveryFill(t *testing.T) {
+	const fills = 2000
+
+	// The strategy handles nothing until every fill has been published
+	release := make(chan struct{})
+	strat := &hooks{onFill: func(ctx Context, fill Fill) error {
+		<-release
+		return nil
+	}}
+	inst := newTestInstance(strat, newFlakyBroker())
+	inst.orders["mine"] = true
+
+	bus := trading.NewEventBus()
+	in, unsubscribe := bus.SubscribeBlocking(eventBuffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	go inst.run(ctx, nil, queueEvents(in, "paper"))
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		price, qty := decimal.NewFromInt(100), decimal.NewFromInt(1)
+		for range fills {
+			bus.Publish(trading.OrderEvent{Account: "live", Event: trading.EventPartialFill, Order: alpaca.Order{ID: "mine"}, Price: &price, Qty: &qty})
+			bus.Publish(trading.OrderEvent{Account: "paper", Event: trading.EventPartialFill, Order: alpaca.Order{ID: "mine"}, Price: &price, Qty: &qty})
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish() waited on a strategy busy in OnFill")
+	}
+	close(release)
+
+	for deadline := time.Now().Add(5 * time.Second); inst.view().Stats.Fills < fills && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-inst.done
+	unsubscribe()
+
+	if got := inst.view().Stats.Fills; got != fills {
+		t.Errorf("strategy received %d fills, want %d", got, fills)
+	}
+}
+
+func TestRunnerNormalize(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         StartRequest
+		wantName    string
+		wantSymbols []string
+		wantErr     string
+	}{
+		{
+			name:        "symbols are upper cased and deduplicated",
+			req:         StartRequest{Name: "spy-trend", Strategy: "sma_crossover", Account: "paper", Symbols: []string{"spy", " SPY ", ""}},
+			wantName:    "spy-trend",
+			wantSymbols: []string{"SPY"},
+		},
+		{
+			name:        "generated name",
+			req:         StartRequest{Strategy: "buy_and_hold", Account: "paper", Symbols: []string{"AAPL"}},
+			wantName:    "buy-and-hold-",
+			wantSymbols: []string{"AAPL"},
+		},
+		{name: "no strategy", req: StartRequest{Account: "paper", Symbols: []string{"AAPL"}}, wantErr: "strategy is required"},
+		{name: "no account", req: StartRequest{Strategy: "buy_and_hold", Symbols: []string{"AAPL"}}, wantErr: "account is required"},
+		{name: "bad name", req: StartRequest{Name: "My Bot", Strategy: "buy_and_hold", Account: "paper", Symbols: []string{"AAPL"}}, wantErr: `instance name "My Bot"`},
+		{name: "no symbols", req: StartRequest{Strategy: "buy_and_hold", Account: "paper"}, wantErr: "at least one symbol is required"},
+	}
+
+	runner := &Runner{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := runner.normalize(tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("normalize() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalize() error = %v", err)
+			}
+			if !strings.HasPrefix(req.Name, tt.wantName) || strings.Join(req.Symbols, ",") != strings.Join(tt.wantSymbols, ",") {
+				t.Errorf("normalize() = %+v, want name %q… and symbols %v", req, tt.wantName, tt.wantSymbols)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+)
+
+// Bar is a bar of one symbol as strategies receive it
+type Bar struct {
+	Symbol string `json:"symbol"`
+	marketdata.Bar
+}
+
+// Quote is a quote of one symbol as strategies receive it
+type Quote struct {
+	Symbol string `json:"symbol"`
+	marketdata.Quote
+}
+
+// Fill is an execution of one of the strategy's orders. Price and Qty are of
+// this execution; the order holds the totals filled so far.
+type Fill struct {
+	Order alpaca.Order    `json:"order"`
+	Price decimal.Decimal `json:"price"`
+	Qty   decimal.Decimal `json:"qty"`
+	Time  time.Time       `json:"time"`
+}
+
+// Context is the account a strategy trades, as seen while it handles an
+// event. The backtester provides a simulated one and the live runner one
+// backed by the instance's broker.
+type Context interface {
+	// Now is the time of the event being handled
+	Now() time.Time
+	Cash() decimal.Decimal
+	Equity() decimal.Decimal
+	// Position is the quantity held of a symbol, zero when there is none
+	Position(symbol string) decimal.Decimal
+	// PlaceOrder fails when the account or positions read earlier in the
+	// event could not be fetched, since they read as zero
+	PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error)
+	CancelOrder(orderID string) error
+}
+
+// Strategy turns market data into orders. The hooks of one instance are
+// never called concurrently, so a strategy needs no locking of its own state.
+type Strategy interface {
+	// OnStart is called once before any other hook
+	OnStart(ctx Context) error
+	// OnBar is called with each bar of the strategy's symbols in time order
+	OnBar(ctx Context, bar Bar) error
+	// OnQuote is called with each quote of the strategy's symbols when the
+	// instance streams quotes. Backtests replay bars only.
+	OnQuote(ctx Context, quote Quote) error
+	// OnFill is called when one of the strategy's orders fills in full or
+	// in part
+	OnFill(ctx Context, fill Fill) error
+	// OnStop is called once after the last event
+	OnStop(ctx Context) error
+}
+
+// Inspector is implemented by strategies that report their state, such as
+// their indicator values, for inspection
+type Inspector interface {
+	State() any
+}
+
+// Base implements every hook as a no-op. Strategies embed it and override the
+// hooks they need.
+type Base struct{}
+
+// OnStart does nothing
+func (Base) OnStart(ctx Context) error { return nil }
+
+// OnBar does nothing
+func (Base) OnBar(ctx Context, bar Bar) error { return nil }
+
+// OnQuote does nothing
+func (Base) OnQuote(ctx Context, quote Quote) error { return nil }
+
+// OnFill does nothing
+func (Base) OnFill(ctx Context, fill Fill) error { return nil }
+
+// OnStop does nothing
+func (Base) OnStop(ctx Context) error { return nil }
+
+// Params are the numeric parameters a strategy is created with
+type Params map[string]float64
+
+// Float returns a parameter, or def when it is not set
+func (p Params) Float(name string, def float64) float64 {
+	if v, ok := p[name]; ok {
+		return v
+	}
+	return def
+}
+
+// Int returns a parameter as a whole number, or def when it is not set
+func (p Params) Int(name string, def int) (int, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	if v != float64(int(v)) {
+		return 0, fmt.Errorf("parameter %s must be a whole number", name)
+	}
+	return int(v), nil
+}
+
+// Factory creates a strategy from its parameters
+type Factory func(params Params) (Strategy, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a strategy available by name
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("strategy %q is registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// New creates an instance of the strategy registered under name
+func New(name string, params Params) (Strategy, error) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, must be one of %v", name, Names())
+	}
+
+	s, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("strategy %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Names returns the registered strategy names in sorted order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// affordableQty is the number of whole shares worth fraction of the
+// context's equity at price
+func affordableQty(ctx Context, fraction float64, price float64) decimal.Decimal {
+	if price <= 0 {
+		return decimal.Zero
+	}
+	budget := ctx.Equity().Mul(decimal.NewFromFloat(fraction))
+	return budget.Div(decimal.NewFromFloat(price)).Floor()
+}
+
+// marketOrder builds a day market order
+func marketOrder(symbol string, side alpaca.Side, qty decimal.Decimal) alpaca.PlaceOrderRequest {
+	return alpaca.PlaceOrderRequest{
+		Symbol:      symbol,
+		Qty:         &qty,
+		Side:        side,
+		Type:        alpaca.Market,
+		TimeInForce: alpaca.Day,
+	}
+}
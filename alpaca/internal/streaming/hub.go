@@ -0,0 +1,414 @@
+package streaming
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+)
+
+// subscriberBuffer is how many messages a subscriber may fall behind before
+// further messages are dropped for it
+const subscriberBuffer = 256
+
+// ErrSubscriberRemoved is returned when subscribing a subscriber that has
+// already been removed from the hub
+var ErrSubscriberRemoved = errors.New("subscriber has been removed")
+
+// Subscriptions lists the symbols subscribed to on each channel
+type Subscriptions struct {
+	Trades []string `json:"trades"`
+	Quotes []string `json:"quotes"`
+	Bars   []string `json:"bars"`
+}
+
+func (s Subscriptions) byChannel() map[string][]string {
+	return map[string][]string{
+		Trades: s.Trades,
+		Quotes: s.Quotes,
+		Bars:   s.Bars,
+	}
+}
+
+// Subscriber is a single downstream client of the hub
+type Subscriber struct {
+	ID string
+	// Owner names the API key the subscriber was opened with
+	Owner string
+
+	messages chan Message
+	done     chan struct{}
+
+	// mu guards subs and removed and is held across the matching reference
+	// count changes, so a removed subscriber can hold no references
+	mu      sync.Mutex
+	subs    map[string]map[string]bool
+	removed bool
+}
+
+// Messages returns the channel the subscriber's market data is delivered on
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Done is closed once the subscriber has been removed from the hub
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Subscriptions returns the symbols the subscriber currently receives
+func (s *Subscriber) Subscriptions() Subscriptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Subscriptions{
+		Trades: sortedKeys(s.subs[Trades]),
+		Quotes: sortedKeys(s.subs[Quotes]),
+		Bars:   sortedKeys(s.subs[Bars]),
+	}
+}
+
+func (s *Subscriber) subscribed(channel, symbol string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.subs[channel][symbol]
+}
+
+// Hub holds a single upstream Alpaca stock data stream and fans it out to any
+// number of subscribers. Upstream subscriptions are reference counted so a
+// symbol stays subscribed while at least one subscriber wants it.
+type Hub struct {
+	apiKey    string
+	apiSecret string
+	feed      marketdata.Feed
+
+	// mu guards refs and client and is held across upstream subscription
+	// changes, which the Alpaca client only allows one at a time
+	mu     sync.Mutex
+	refs   map[string]map[string]int
+	client *stream.StocksClient
+
+	subsMu      sync.RWMutex
+	subscribers map[string]*Subscriber
+}
+
+// NewHub creates a hub for the given credentials and data feed
+func NewHub(apiKey, apiSecret string, feed marketdata.Feed) *Hub {
+	return &Hub{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		feed:      feed,
+		refs: map[string]map[string]int{
+			Trades: {},
+			Quotes: {},
+			Bars:   {},
+		},
+		subscribers: make(map[string]*Subscriber),
+	}
+}
+
+// Run maintains the upstream connection until ctx is cancelled. Whenever the
+// connection is lost for good it reconnects with backoff and resubscribes to
+// every symbol that still has subscribers.
+func (h *Hub) Run(ctx context.Context) {
+	if !h.Enabled() {
+		log.Println("Warning: API key or secret not found, market data streaming is disabled")
+		return
+	}
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		h.mu.Lock()
+		initial := h.upstreamSymbols()
+		h.mu.Unlock()
+
+		client := stream.NewStocksClient(h.feed,
+			stream.WithCredentials(h.apiKey, h.apiSecret),
+			stream.WithTrades(h.onTrade, initial.Trades...),
+			stream.WithQuotes(h.onQuote, initial.Quotes...),
+			stream.WithBars(h.onBar, initial.Bars...),
+		)
+		if err := client.Connect(ctx); err != nil {
+			log.Printf("Warning: market data stream failed to connect: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		log.Println("Market data stream connected")
+
+		// Catch up on subscription changes made while connecting
+		h.mu.Lock()
+		h.client = client
+		h.resync(initial)
+		h.mu.Unlock()
+
+		err := <-client.Terminated()
+		log.Printf("Market data stream terminated: %v", err)
+
+		h.mu.Lock()
+		h.client = nil
+		h.mu.Unlock()
+	}
+}
+
+// Enabled reports whether the hub has credentials to stream market data
+func (h *Hub) Enabled() bool {
+	return h.apiKey != "" && h.apiSecret != ""
+}
+
+// Connected reports whether the upstream stream is connected
+func (h *Hub) Connected() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.client != nil
+}
+
+// NewSubscriber registers a subscriber with no subscriptions, owned by the
+// named API key
+func (h *Hub) NewSubscriber(owner string) *Subscriber {
+	s := &Subscriber{
+		ID:       newSubscriberID(),
+		Owner:    owner,
+		messages: make(chan Message, subscriberBuffer),
+		done:     make(chan struct{}),
+		subs: map[string]map[string]bool{
+			Trades: {},
+			Quotes: {},
+			Bars:   {},
+		},
+	}
+
+	h.subsMu.Lock()
+	h.subscribers[s.ID] = s
+	h.subsMu.Unlock()
+
+	return s
+}
+
+// Subscriber looks up a registered subscriber by ID
+func (h *Hub) Subscriber(id string) (*Subscriber, error) {
+	h.subsMu.RLock()
+	defer h.subsMu.RUnlock()
+
+	s, ok := h.subscribers[id]
+	if !ok {
+		return nil, fmt.Errorf("subscriber %q not found", id)
+	}
+	return s, nil
+}
+
+// Subscribe adds symbols to a subscriber's channels. A subscriber that has
+// been removed cannot subscribe again.
+func (h *Hub) Subscribe(s *Subscriber, subs Subscriptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.removed {
+		return ErrSubscriberRemoved
+	}
+	for channel, symbols := range subs.byChannel() {
+		var added []string
+		for _, symbol := range symbols {
+			if !s.subs[channel][symbol] {
+				s.subs[channel][symbol] = true
+				added = append(added, symbol)
+			}
+		}
+		h.retain(channel, added)
+	}
+	return nil
+}
+
+// Unsubscribe removes symbols from a subscriber's channels
+func (h *Hub) Unsubscribe(s *Subscriber, subs Subscriptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for channel, symbols := range subs.byChannel() {
+		var removed []string
+		for _, symbol := range symbols {
+			if s.subs[channel][symbol] {
+				delete(s.subs[channel], symbol)
+				removed = append(removed, symbol)
+			}
+		}
+		h.release(channel, removed)
+	}
+}
+
+// Remove unsubscribes a subscriber from everything and drops it from the hub
+func (h *Hub) Remove(s *Subscriber) {
+	h.subsMu.Lock()
+	_, ok := h.subscribers[s.ID]
+	delete(h.subscribers, s.ID)
+	h.subsMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.removed = true
+	for channel, symbols := range s.subs {
+		h.release(channel, sortedKeys(symbols))
+		s.subs[channel] = map[string]bool{}
+	}
+	s.mu.Unlock()
+
+	close(s.done)
+}
+
+// retain increments the reference count of each symbol, subscribing upstream
+// to the ones that had no subscribers
+func (h *Hub) retain(channel string, symbols []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var added []string
+	for _, symbol := range symbols {
+		h.refs[channel][symbol]++
+		if h.refs[channel][symbol] == 1 {
+			added = append(added, symbol)
+		}
+	}
+
+	h.changeUpstream(true, channel, added)
+}
+
+// release decrements the reference count of each symbol, unsubscribing
+// upstream from the ones that have no subscribers left
+func (h *Hub) release(channel string, symbols []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var removed []string
+	for _, symbol := range symbols {
+		h.refs[channel][symbol]--
+		if h.refs[channel][symbol] <= 0 {
+			delete(h.refs[channel], symbol)
+			removed = append(removed, symbol)
+		}
+	}
+
+	h.changeUpstream(false, channel, removed)
+}
+
+// resync brings the upstream subscriptions from the given snapshot in line
+// with the current reference counts
+func (h *Hub) resync(from Subscriptions) {
+	for channel, symbols := range from.byChannel() {
+		had := make(map[string]bool)
+		for _, symbol := range symbols {
+			had[symbol] = true
+		}
+
+		var added, removed []string
+		for symbol := range h.refs[channel] {
+			if !had[symbol] {
+				added = append(added, symbol)
+			}
+		}
+		for symbol := range had {
+			if h.refs[channel][symbol] == 0 {
+				removed = append(removed, symbol)
+			}
+		}
+
+		h.changeUpstream(true, channel, added)
+		h.changeUpstream(false, channel, removed)
+	}
+}
+
+// changeUpstream applies a subscription change to the live connection. When
+// there is no connection the change is picked up on the next connect.
+func (h *Hub) changeUpstream(subscribe bool, channel string, symbols []string) {
+	if h.client == nil || len(symbols) == 0 {
+		return
+	}
+
+	var err error
+	switch {
+	case subscribe && channel == Trades:
+		err = h.client.SubscribeToTrades(h.onTrade, symbols...)
+	case subscribe && channel == Quotes:
+		err = h.client.SubscribeToQuotes(h.onQuote, symbols...)
+	case subscribe && channel == Bars:
+		err = h.client.SubscribeToBars(h.onBar, symbols...)
+	case channel == Trades:
+		err = h.client.UnsubscribeFromTrades(symbols...)
+	case channel == Quotes:
+		err = h.client.UnsubscribeFromQuotes(symbols...)
+	case channel == Bars:
+		err = h.client.UnsubscribeFromBars(symbols...)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to update %s stream subscription for %v: %v", channel, symbols, err)
+	}
+}
+
+// upstreamSymbols lists every symbol with at least one subscriber
+func (h *Hub) upstreamSymbols() Subscriptions {
+	return Subscriptions{
+		Trades: sortedKeys(h.refs[Trades]),
+		Quotes: sortedKeys(h.refs[Quotes]),
+		Bars:   sortedKeys(h.refs[Bars]),
+	}
+}
+
+func (h *Hub) onTrade(t stream.Trade) {
+	h.publish(Trades, tradeMessage(t))
+}
+
+func (h *Hub) onQuote(q stream.Quote) {
+	h.publish(Quotes, quoteMessage(q))
+}
+
+func (h *Hub) onBar(b stream.Bar) {
+	h.publish(Bars, barMessage(b))
+}
+
+// publish delivers a message to every subscriber of its channel and symbol,
+// dropping it for subscribers that are too far behind
+func (h *Hub) publish(channel string, msg Message) {
+	h.subsMu.RLock()
+	defer h.subsMu.RUnlock()
+
+	for _, s := range h.subscribers {
+		if !s.subscribed(channel, msg.Symbol) {
+			continue
+		}
+		select {
+		case s.messages <- msg:
+		default:
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func newSubscriberID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
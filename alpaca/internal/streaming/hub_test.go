@@ -0,0 +1,162 @@
+package streaming
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+)
+
+func TestHubReferenceCounts(t *testing.T) {
+	h := NewHub("", "", "iex")
+	a, b := h.NewSubscriber("alice"), h.NewSubscriber("bob")
+
+	h.Subscribe(a, Subscriptions{Trades: []string{"AAPL", "MSFT"}, Bars: []string{"SPY"}})
+	h.Subscribe(b, Subscriptions{Trades: []string{"AAPL"}, Quotes: []string{"TSLA"}})
+	// Subscribing twice does not count twice
+	h.Subscribe(a, Subscriptions{Trades: []string{"AAPL"}})
+
+	want := Subscriptions{Trades: []string{"AAPL", "MSFT"}, Quotes: []string{"TSLA"}, Bars: []string{"SPY"}}
+	if got := h.upstreamSymbols(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("upstream = %+v, want %+v", got, want)
+	}
+
+	// AAPL stays subscribed upstream while bob still wants it
+	h.Unsubscribe(a, Subscriptions{Trades: []string{"AAPL", "NVDA"}})
+	if got := h.refs[Trades]; !reflect.DeepEqual(got, map[string]int{"AAPL": 1, "MSFT": 1}) {
+		t.Errorf("trade refs = %v, want AAPL and MSFT once each", got)
+	}
+
+	h.Remove(b)
+	want = Subscriptions{Trades: []string{"MSFT"}, Quotes: []string{}, Bars: []string{"SPY"}}
+	if got := h.upstreamSymbols(); !reflect.DeepEqual(got, want) {
+		t.Errorf("upstream after removing bob = %+v, want %+v", got, want)
+	}
+	select {
+	case <-b.Done():
+	default:
+		t.Error("Done() is open after Remove")
+	}
+	if _, err := h.Subscriber(b.ID); err == nil {
+		t.Error("Subscriber() found a removed subscriber")
+	}
+
+	// Removing again leaves the counts alone
+	h.Remove(b)
+	h.Remove(a)
+	want = Subscriptions{Trades: []string{}, Quotes: []string{}, Bars: []string{}}
+	if got := h.upstreamSymbols(); !reflect.DeepEqual(got, want) {
+		t.Errorf("upstream after removing everyone = %+v, want none", got)
+	}
+}
+
+func TestHubSubscribeAfterRemove(t *testing.T) {
+	h := NewHub("", "", "iex")
+	s := h.NewSubscriber("alice")
+	h.Remove(s)
+
+	if err := h.Subscribe(s, Subscriptions{Trades: []string{"AAPL"}}); !errors.Is(err, ErrSubscriberRemoved) {
+		t.Errorf("Subscribe() after Remove error = %v, want %v", err, ErrSubscriberRemoved)
+	}
+	if got := s.Subscriptions(); len(got.Trades) != 0 {
+		t.Errorf("Subscriptions() after Remove = %+v, want none", got)
+	}
+	if got := h.refs[Trades]; len(got) != 0 {
+		t.Errorf("trade refs = %v, want none", got)
+	}
+}
+
+func TestHubSubscribeRacingRemove(t *testing.T) {
+	h := NewHub("", "", "iex")
+	symbols := []string{"AAPL", "MSFT", "SPY", "TSLA"}
+
+	for i := 0; i < 50; i++ {
+		s := h.NewSubscriber("alice")
+		var wg sync.WaitGroup
+		for _, symbol := range symbols {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.Subscribe(s, Subscriptions{Trades: []string{symbol}, Bars: []string{symbol}})
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.Remove(s)
+		}()
+		wg.Wait()
+	}
+
+	// Whichever side wins, nothing stays subscribed upstream once every
+	// subscriber is gone
+	want := Subscriptions{Trades: []string{}, Quotes: []string{}, Bars: []string{}}
+	if got := h.upstreamSymbols(); !reflect.DeepEqual(got, want) {
+		t.Errorf("upstream = %+v, want none", got)
+	}
+}
+
+func TestHubPublish(t *testing.T) {
+	h := NewHub("", "", "iex")
+	a, b := h.NewSubscriber("alice"), h.NewSubscriber("bob")
+	h.Subscribe(a, Subscriptions{Trades: []string{"AAPL"}})
+	h.Subscribe(b, Subscriptions{Quotes: []string{"AAPL"}, Trades: []string{"MSFT"}})
+
+	h.onTrade(stream.Trade{Symbol: "AAPL", ID: 1, Price: 190.5, Size: 10})
+	h.onTrade(stream.Trade{Symbol: "MSFT", ID: 2, Price: 410})
+	h.onQuote(stream.Quote{Symbol: "AAPL", BidPrice: 190.4, AskPrice: 190.6})
+	h.onBar(stream.Bar{Symbol: "AAPL", Close: 190.5})
+
+	tests := []struct {
+		name string
+		s    *Subscriber
+		want []Message
+	}{
+		{
+			name: "alice",
+			s:    a,
+			want: []Message{
+				{Type: "trade", Symbol: "AAPL", Data: Trade{ID: 1, Price: 190.5, Size: 10}},
+			},
+		},
+		{
+			name: "bob",
+			s:    b,
+			want: []Message{
+				{Type: "trade", Symbol: "MSFT", Data: Trade{ID: 2, Price: 410}},
+				{Type: "quote", Symbol: "AAPL", Data: Quote{BidPrice: 190.4, AskPrice: 190.6}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Message
+			for len(tt.s.Messages()) > 0 {
+				got = append(got, <-tt.s.Messages())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("messages = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHubDropsForSlowSubscribers(t *testing.T) {
+	h := NewHub("", "", "iex")
+	s := h.NewSubscriber("alice")
+	h.Subscribe(s, Subscriptions{Trades: []string{"AAPL"}})
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		h.onTrade(stream.Trade{Symbol: "AAPL", ID: int64(i)})
+	}
+	if n := len(s.Messages()); n != subscriberBuffer {
+		t.Fatalf("buffered %d messages, want %d", n, subscriberBuffer)
+	}
+	// The oldest messages are kept and the newest dropped
+	if msg := <-s.Messages(); msg.Data.(Trade).ID != 0 {
+		t.Errorf("first message = %+v, want trade 0", msg)
+	}
+}
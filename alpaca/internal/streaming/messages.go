@@ -0,0 +1,108 @@
+package streaming
+
+import (
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+)
+
+// Channels clients can subscribe to
+const (
+	Trades = "trades"
+	Quotes = "quotes"
+	Bars   = "bars"
+)
+
+// Message is a single market data event delivered to subscribers
+type Message struct {
+	Type   string `json:"type"` // "trade", "quote" or "bar"
+	Symbol string `json:"symbol"`
+	Data   any    `json:"data"`
+}
+
+// Trade is the JSON form of a streamed trade
+type Trade struct {
+	ID         int64     `json:"id"`
+	Exchange   string    `json:"exchange"`
+	Price      float64   `json:"price"`
+	Size       uint32    `json:"size"`
+	Timestamp  time.Time `json:"timestamp"`
+	Conditions []string  `json:"conditions"`
+	Tape       string    `json:"tape"`
+}
+
+// Quote is the JSON form of a streamed quote
+type Quote struct {
+	BidExchange string    `json:"bid_exchange"`
+	BidPrice    float64   `json:"bid_price"`
+	BidSize     uint32    `json:"bid_size"`
+	AskExchange string    `json:"ask_exchange"`
+	AskPrice    float64   `json:"ask_price"`
+	AskSize     uint32    `json:"ask_size"`
+	Timestamp   time.Time `json:"timestamp"`
+	Conditions  []string  `json:"conditions"`
+	Tape        string    `json:"tape"`
+}
+
+// Bar is the JSON form of a streamed minute bar
+type Bar struct {
+	Open       float64   `json:"open"`
+	High       float64   `json:"high"`
+	Low        float64   `json:"low"`
+	Close      float64   `json:"close"`
+	Volume     uint64    `json:"volume"`
+	Timestamp  time.Time `json:"timestamp"`
+	TradeCount uint64    `json:"trade_count"`
+	VWAP       float64   `json:"vwap"`
+}
+
+func tradeMessage(t stream.Trade) Message {
+	return Message{
+		Type:   "trade",
+		Symbol: t.Symbol,
+		Data: Trade{
+			ID:         t.ID,
+			Exchange:   t.Exchange,
+			Price:      t.Price,
+			Size:       t.Size,
+			Timestamp:  t.Timestamp,
+			Conditions: t.Conditions,
+			Tape:       t.Tape,
+		},
+	}
+}
+
+func quoteMessage(q stream.Quote) Message {
+	return Message{
+		Type:   "quote",
+		Symbol: q.Symbol,
+		Data: Quote{
+			BidExchange: q.BidExchange,
+			BidPrice:    q.BidPrice,
+			BidSize:     q.BidSize,
+			AskExchange: q.AskExchange,
+			AskPrice:    q.AskPrice,
+			AskSize:     q.AskSize,
+			Timestamp:   q.Timestamp,
+			Conditions:  q.Conditions,
+			Tape:        q.Tape,
+		},
+	}
+}
+
+func barMessage(b stream.Bar) Message {
+	return Message{
+		Type:   "bar",
+		Symbol: b.Symbol,
+		Data: Bar{
+			Open:       b.Open,
+			High:       b.High,
+			Low:        b.Low,
+			Close:      b.Close,
+			Volume:     b.Volume,
+			Timestamp:  b.Timestamp,
+			TradeCount: b.TradeCount,
+			VWAP:       b.VWAP,
+		},
+	}
+}
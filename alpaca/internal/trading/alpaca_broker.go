@@ -0,0 +1,139 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// requestTimeout bounds each call to the trading API, the Alpaca client's own
+// default
+const requestTimeout = 10 * time.Second
+
+// AlpacaBroker implements Broker on top of an Alpaca trading API client
+type AlpacaBroker struct {
+	client *alpaca.Client
+	opts   alpaca.ClientOpts
+}
+
+// NewAlpacaBroker creates a broker for the Alpaca account behind the given keys
+func NewAlpacaBroker(apiKey, apiSecret, baseURL string) *AlpacaBroker {
+	opts := alpaca.ClientOpts{
+		APIKey:    apiKey,
+		APISecret: apiSecret,
+		BaseURL:   baseURL,
+		// Also used for the calls the client has no method for
+		HTTPClient: &http.Client{Timeout: requestTimeout},
+	}
+
+	return &AlpacaBroker{
+		client: alpaca.NewClient(opts),
+		opts:   opts,
+	}
+}
+
+func (b *AlpacaBroker) GetAccount() (*alpaca.Account, error) {
+	return b.client.GetAccount()
+}
+
+func (b *AlpacaBroker) PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error) {
+	return b.client.PlaceOrder(req)
+}
+
+func (b *AlpacaBroker) GetOrders(req alpaca.GetOrdersRequest) ([]alpaca.Order, error) {
+	return b.client.GetOrders(req)
+}
+
+func (b *AlpacaBroker) GetOrder(orderID string, nested bool) (*alpaca.Order, error) {
+	if !nested {
+		return b.client.GetOrder(orderID)
+	}
+
+	// The client has no nested option for single orders, so call the
+	// endpoint directly to have the legs rolled up under the parent
+	u := fmt.Sprintf("%s/v2/orders/%s?nested=true", b.opts.BaseURL, url.PathEscape(orderID))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("APCA-API-KEY-ID", b.opts.APIKey)
+	req.Header.Set("APCA-API-SECRET-KEY", b.opts.APISecret)
+
+	resp, err := b.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, alpaca.APIErrorFromResponse(resp)
+	}
+
+	var order alpaca.Order
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (b *AlpacaBroker) GetOrderByClientOrderID(clientOrderID string) (*alpaca.Order, error) {
+	return b.client.GetOrderByClientOrderID(clientOrderID)
+}
+
+func (b *AlpacaBroker) ReplaceOrder(orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error) {
+	return b.client.ReplaceOrder(orderID, req)
+}
+
+func (b *AlpacaBroker) CancelOrder(orderID string) error {
+	return b.client.CancelOrder(orderID)
+}
+
+func (b *AlpacaBroker) CancelAllOrders() error {
+	return b.client.CancelAllOrders()
+}
+
+func (b *AlpacaBroker) GetPositions() ([]alpaca.Position, error) {
+	return b.client.GetPositions()
+}
+
+func (b *AlpacaBroker) GetPosition(symbol string) (*alpaca.Position, error) {
+	return b.client.GetPosition(symbol)
+}
+
+func (b *AlpacaBroker) ClosePosition(symbol string, req alpaca.ClosePositionRequest) (*alpaca.Order, error) {
+	return b.client.ClosePosition(symbol, req)
+}
+
+func (b *AlpacaBroker) CloseAllPositions(req alpaca.CloseAllPositionsRequest) ([]alpaca.Order, error) {
+	return b.client.CloseAllPositions(req)
+}
+
+func (b *AlpacaBroker) GetAssets(req alpaca.GetAssetsRequest) ([]alpaca.Asset, error) {
+	return b.client.GetAssets(req)
+}
+
+func (b *AlpacaBroker) GetAsset(symbol string) (*alpaca.Asset, error) {
+	return b.client.GetAsset(symbol)
+}
+
+func (b *AlpacaBroker) GetClock() (*alpaca.Clock, error) {
+	return b.client.GetClock()
+}
+
+func (b *AlpacaBroker) GetCalendar(req alpaca.GetCalendarRequest) ([]alpaca.CalendarDay, error) {
+	return b.client.GetCalendar(req)
+}
+
+func (b *AlpacaBroker) GetPortfolioHistory(req alpaca.GetPortfolioHistoryRequest) (*alpaca.PortfolioHistory, error) {
+	return b.client.GetPortfolioHistory(req)
+}
+
+func (b *AlpacaBroker) StreamTradeUpdates(ctx context.Context, handler func(alpaca.TradeUpdate), req alpaca.StreamTradeUpdatesRequest) error {
+	return b.client.StreamTradeUpdates(ctx, handler, req)
+}
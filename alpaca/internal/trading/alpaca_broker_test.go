@@ -0,0 +1,71 @@
+package trading
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlpacaBrokerGetNestedOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantLegs int
+		wantErr  string
+	}{
+		{
+			name: "legs are rolled up",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/orders/parent" || r.URL.Query().Get("nested") != "true" {
+					t.Errorf("request = %s, want /v2/orders/parent?nested=true", r.URL)
+				}
+				if r.Header.Get("APCA-API-KEY-ID") != "key" {
+					t.Errorf("key header = %q, want %q", r.Header.Get("APCA-API-KEY-ID"), "key")
+				}
+				w.Write([]byte(`{"id":"parent","legs":[{"id":"take-profit"},{"id":"stop-loss"}]}`))
+			},
+			wantLegs: 2,
+		},
+		{
+			name: "api error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code":40410000,"message":"order not found"}`))
+			},
+			wantErr: "order not found",
+		},
+		{
+			name: "slow api times out",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			wantErr: "Timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			b := NewAlpacaBroker("key", "secret", server.URL)
+			b.opts.HTTPClient.Timeout = 50 * time.Millisecond
+
+			order, err := b.GetOrder("parent", true)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetOrder() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetOrder() error = %v", err)
+			}
+			if len(order.Legs) != tt.wantLegs {
+				t.Errorf("GetOrder() has %d legs, want %d", len(order.Legs), tt.wantLegs)
+			}
+		})
+	}
+}
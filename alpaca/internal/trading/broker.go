@@ -0,0 +1,92 @@
+package trading
+
+import (
+	"errors"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// Broker is the set of brokerage operations the API relies on. Alpaca is the
+// reference implementation, but anything that can place and track orders for
+// an account can satisfy it.
+type Broker interface {
+	// Account
+	GetAccount() (*alpaca.Account, error)
+
+	// Orders
+	PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error)
+	GetOrders(req alpaca.GetOrdersRequest) ([]alpaca.Order, error)
+	GetOrder(orderID string, nested bool) (*alpaca.Order, error)
+	GetOrderByClientOrderID(clientOrderID string) (*alpaca.Order, error)
+	ReplaceOrder(orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error)
+	CancelOrder(orderID string) error
+	CancelAllOrders() error
+
+	// Positions
+	GetPositions() ([]alpaca.Position, error)
+	GetPosition(symbol string) (*alpaca.Position, error)
+	ClosePosition(symbol string, req alpaca.ClosePositionRequest) (*alpaca.Order, error)
+	CloseAllPositions(req alpaca.CloseAllPositionsRequest) ([]alpaca.Order, error)
+
+	// Assets
+	GetAssets(req alpaca.GetAssetsRequest) ([]alpaca.Asset, error)
+	GetAsset(symbol string) (*alpaca.Asset, error)
+
+	// Market info
+	GetClock() (*alpaca.Clock, error)
+	GetCalendar(req alpaca.GetCalendarRequest) ([]alpaca.CalendarDay, error)
+}
+
+// Wrapper is implemented by brokers that decorate another broker, so optional
+// capabilities of the underlying broker can still be found
+type Wrapper interface {
+	Unwrap() Broker
+}
+
+// PortfolioHistorian is implemented by brokers that keep a history of the
+// account's equity
+type PortfolioHistorian interface {
+	GetPortfolioHistory(req alpaca.GetPortfolioHistoryRequest) (*alpaca.PortfolioHistory, error)
+}
+
+// ErrNoPortfolioHistory is returned for accounts whose broker keeps no
+// history of their equity
+var ErrNoPortfolioHistory = errors.New("the account's broker keeps no portfolio history")
+
+// GetPortfolioHistory retrieves the history of an account's equity, looking
+// through any decorators wrapped around its broker
+func GetPortfolioHistory(broker Broker, req alpaca.GetPortfolioHistoryRequest) (*alpaca.PortfolioHistory, error) {
+	for {
+		if historian, ok := broker.(PortfolioHistorian); ok {
+			return historian.GetPortfolioHistory(req)
+		}
+		wrapper, ok := broker.(Wrapper)
+		if !ok {
+			return nil, ErrNoPortfolioHistory
+		}
+		broker = wrapper.Unwrap()
+	}
+}
+
+// DuplicateObserver is implemented by brokers that want to know of order
+// requests answered with the order an earlier request with the same client
+// order ID placed, which never reach the broker
+type DuplicateObserver interface {
+	ObserveDuplicate(req alpaca.PlaceOrderRequest, existing *alpaca.Order)
+}
+
+// observeDuplicate tells the outermost observer among broker and the
+// decorators it wraps that req was answered with existing
+func observeDuplicate(broker Broker, req alpaca.PlaceOrderRequest, existing *alpaca.Order) {
+	for {
+		if observer, ok := broker.(DuplicateObserver); ok {
+			observer.ObserveDuplicate(req, existing)
+			return
+		}
+		wrapper, ok := broker.(Wrapper)
+		if !ok {
+			return
+		}
+		broker = wrapper.Unwrap()
+	}
+}
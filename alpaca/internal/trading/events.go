@@ -0,0 +1,111 @@
+package trading
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+)
+
+// Order lifecycle events reported by the trade updates stream
+const (
+	EventNew         = "new"
+	EventPartialFill = "partial_fill"
+	EventFill        = "fill"
+	EventCanceled    = "canceled"
+	EventExpired     = "expired"
+	EventRejected    = "rejected"
+	EventReplaced    = "replaced"
+)
+
+// OrderEvent is a trade update tagged with the account it happened on
+type OrderEvent struct {
+	Account     string           `json:"account"`
+	Event       string           `json:"event"`
+	At          time.Time        `json:"at"`
+	Order       alpaca.Order     `json:"order"`
+	Price       *decimal.Decimal `json:"price,omitempty"`
+	Qty         *decimal.Decimal `json:"qty,omitempty"`
+	PositionQty *decimal.Decimal `json:"position_qty,omitempty"`
+}
+
+// EventBus fans order events out to in-process subscribers
+type EventBus struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]*eventSubscription
+}
+
+type eventSubscription struct {
+	ch chan OrderEvent
+	// blocking subscriptions hold up Publish until they take the event or
+	// unsubscribe, which closes done
+	blocking bool
+	done     chan struct{}
+}
+
+// NewEventBus creates an event bus with no subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[int]*eventSubscription)}
+}
+
+// Subscribe returns a channel receiving every published event and a function
+// that unsubscribes and closes it. Events are dropped for subscribers whose
+// buffer is full, so consumers should keep up or use a generous buffer.
+func (b *EventBus) Subscribe(buffer int) (<-chan OrderEvent, func()) {
+	return b.subscribe(buffer, false)
+}
+
+// SubscribeBlocking is Subscribe for consumers that must see every event.
+// Once the buffer is full Publish waits for the subscriber, so it must keep
+// reading until it unsubscribes.
+func (b *EventBus) SubscribeBlocking(buffer int) (<-chan OrderEvent, func()) {
+	return b.subscribe(buffer, true)
+}
+
+func (b *EventBus) subscribe(buffer int, blocking bool) (<-chan OrderEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	sub := &eventSubscription{ch: make(chan OrderEvent, buffer), blocking: blocking, done: make(chan struct{})}
+	b.subs[id] = sub
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			// Release a Publish waiting on this subscriber before taking
+			// the lock it holds
+			close(sub.done)
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subs, id)
+			close(sub.ch)
+		})
+	}
+}
+
+// Publish delivers an event to every subscriber, waiting for blocking
+// subscribers to take it
+func (b *EventBus) Publish(event OrderEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subs {
+		if sub.blocking {
+			select {
+			case sub.ch <- event:
+			case <-sub.done:
+			}
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package trading
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusSubscribeBlocking(t *testing.T) {
+	bus := NewEventBus()
+	dropping, unsubscribeDropping := bus.Subscribe(1)
+	defer unsubscribeDropping()
+	blocking, unsubscribe := bus.SubscribeBlocking(1)
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for _, event := range []string{EventNew, EventPartialFill, EventPartialFill, EventFill} {
+			bus.Publish(OrderEvent{Event: event})
+		}
+	}()
+
+	// The blocking subscriber receives events as it reads them, with one in
+	// its buffer and the last still waiting, while the full dropping
+	// subscriber misses every event after the first
+	for _, want := range []string{EventNew, EventPartialFill} {
+		if got := (<-blocking).Event; got != want {
+			t.Errorf("blocking subscriber received %q, want %q", got, want)
+		}
+	}
+	select {
+	case <-published:
+		t.Fatal("Publish() returned before the blocking subscriber took every event")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Unsubscribing releases a waiting Publish
+	unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish() still waiting after the blocking subscriber unsubscribed")
+	}
+	if got := len(dropping); got != 1 {
+		t.Errorf("dropping subscriber buffered %d events, want 1", got)
+	}
+}
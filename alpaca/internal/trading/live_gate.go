@@ -0,0 +1,61 @@
+package trading
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+)
+
+var (
+	// ErrLiveTradingDisabled is returned for live account changes while the
+	// server was started without live trading enabled
+	ErrLiveTradingDisabled = errors.New("live trading is disabled, start the server with LIVE_TRADING_ENABLED=true to enable it")
+	// ErrLiveTokenInvalid is returned for live account changes that do not
+	// carry the live trading token
+	ErrLiveTokenInvalid = errors.New("live trading requires a valid live trading token")
+)
+
+// LiveGate guards every change to an account that is not a paper account:
+// orders, cancels and position closes. Live trading must be switched on at
+// startup and each request must present a token separate from any other
+// credential, so a request aimed at the wrong account cannot reach real money
+// by accident.
+type LiveGate struct {
+	enabled bool
+	token   string
+}
+
+// NewLiveGate creates a gate that allows live changes only when enabled and
+// only to callers presenting token
+func NewLiveGate(enabled bool, token string) *LiveGate {
+	switch {
+	case !enabled:
+		log.Println("Live trading is disabled, live account changes will be rejected")
+	case token == "":
+		log.Println("Warning: live trading token is not set, live account changes will be rejected")
+	default:
+		log.Println("Warning: live trading is enabled")
+	}
+
+	return &LiveGate{enabled: enabled, token: token}
+}
+
+// Enabled reports whether live trading was switched on at startup
+func (g *LiveGate) Enabled() bool {
+	return g.enabled
+}
+
+// Authorize checks whether a change to an account may go ahead with the
+// given token. Paper accounts are always allowed.
+func (g *LiveGate) Authorize(account AccountInfo, token string) error {
+	if account.Paper {
+		return nil
+	}
+	if !g.enabled {
+		return ErrLiveTradingDisabled
+	}
+	if g.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) != 1 {
+		return ErrLiveTokenInvalid
+	}
+	return nil
+}
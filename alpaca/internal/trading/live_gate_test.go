@@ -0,0 +1,37 @@
+package trading
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLiveGateAuthorize(t *testing.T) {
+	paper := AccountInfo{Name: "paper", Paper: true}
+	live := AccountInfo{Name: "live"}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		secret  string
+		account AccountInfo
+		token   string
+		wantErr error
+	}{
+		{name: "paper account with live trading disabled", account: paper},
+		{name: "paper account without a token", enabled: true, secret: "s3cret", account: paper},
+		{name: "live account with live trading disabled", secret: "s3cret", account: live, token: "s3cret", wantErr: ErrLiveTradingDisabled},
+		{name: "live account with the token", enabled: true, secret: "s3cret", account: live, token: "s3cret"},
+		{name: "live account without a token", enabled: true, secret: "s3cret", account: live, wantErr: ErrLiveTokenInvalid},
+		{name: "live account with the wrong token", enabled: true, secret: "s3cret", account: live, token: "s3cret2", wantErr: ErrLiveTokenInvalid},
+		{name: "live account when no token is configured", enabled: true, account: live, wantErr: ErrLiveTokenInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := NewLiveGate(tt.enabled, tt.secret)
+			if err := gate.Authorize(tt.account, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
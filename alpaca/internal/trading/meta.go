@@ -0,0 +1,27 @@
+package trading
+
+// OrderMeta describes where an order came from. It travels with the calls
+// made through a tagged broker so decorators such as the journal can record
+// it alongside the order.
+type OrderMeta struct {
+	Strategy  string `json:"strategy,omitempty"`
+	Source    string `json:"source,omitempty"` // "api", "strategy", ...
+	RequestID string `json:"request_id,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// MetaTagger is implemented by brokers that can carry order metadata
+type MetaTagger interface {
+	// WithMeta returns a copy of the broker whose calls are tagged with meta
+	WithMeta(meta OrderMeta) Broker
+}
+
+// WithMeta tags the calls made through the returned broker with meta. Brokers
+// that do not record metadata are returned unchanged.
+func WithMeta(broker Broker, meta OrderMeta) Broker {
+	if tagger, ok := broker.(MetaTagger); ok {
+		return tagger.WithMeta(meta)
+	}
+	return broker
+}
@@ -0,0 +1,222 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// TradeUpdateStreamer is implemented by brokers that can push order updates
+type TradeUpdateStreamer interface {
+	// StreamTradeUpdates blocks calling handler for every update until ctx
+	// is cancelled or the stream fails
+	StreamTradeUpdates(ctx context.Context, handler func(alpaca.TradeUpdate), req alpaca.StreamTradeUpdatesRequest) error
+}
+
+// Orders that are filled, canceled, expired, rejected or replaced are
+// forgotten once they have not changed for retainFinished. The journal keeps
+// their history.
+const (
+	retainFinished = 24 * time.Hour
+	pruneInterval  = time.Hour
+)
+
+// OrderTracker follows the trade updates of every registered account, keeps
+// the latest state of each order it has seen and republishes the updates on
+// an EventBus
+type OrderTracker struct {
+	brokers *Registry
+	bus     *EventBus
+
+	mu     sync.RWMutex
+	orders map[string]map[string]alpaca.Order
+}
+
+// NewOrderTracker creates a tracker for the accounts in a registry
+func NewOrderTracker(brokers *Registry) *OrderTracker {
+	return &OrderTracker{
+		brokers: brokers,
+		bus:     NewEventBus(),
+		orders:  make(map[string]map[string]alpaca.Order),
+	}
+}
+
+// Events returns the bus order events are published on
+func (t *OrderTracker) Events() *EventBus {
+	return t.bus
+}
+
+// Run streams trade updates for every account whose broker supports it until
+// ctx is cancelled, reconnecting from the last update seen on failure.
+// Finished orders are pruned meanwhile.
+func (t *OrderTracker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				t.prune(now)
+			}
+		}
+	}()
+
+	for _, name := range t.brokers.Names() {
+		broker, err := t.brokers.Get(name)
+		if err != nil {
+			continue
+		}
+		streamer, ok := tradeUpdateStreamer(broker)
+		if !ok {
+			log.Printf("Warning: account %q does not support trade updates", name)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.follow(ctx, name, streamer)
+		}()
+	}
+	wg.Wait()
+}
+
+// tradeUpdateStreamer finds the trade update stream of a broker, looking
+// through any decorators wrapped around it
+func tradeUpdateStreamer(broker Broker) (TradeUpdateStreamer, bool) {
+	for {
+		if streamer, ok := broker.(TradeUpdateStreamer); ok {
+			return streamer, true
+		}
+		wrapper, ok := broker.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		broker = wrapper.Unwrap()
+	}
+}
+
+// Order returns the latest known state of an order
+func (t *OrderTracker) Order(account, orderID string) (alpaca.Order, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	order, ok := t.orders[account][orderID]
+	return order, ok
+}
+
+// Orders returns the latest known state of every order seen on an account,
+// oldest first
+func (t *OrderTracker) Orders(account string) []alpaca.Order {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	orders := make([]alpaca.Order, 0, len(t.orders[account]))
+	for _, order := range t.orders[account] {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].SubmittedAt.Before(orders[j].SubmittedAt)
+	})
+
+	return orders
+}
+
+// Restore seeds the tracker with orders known from before a restart. Orders
+// already tracked are kept since they are at least as recent, and orders
+// that finished long ago are skipped.
+func (t *OrderTracker) Restore(account string, orders []alpaca.Order) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.orders[account] == nil {
+		t.orders[account] = make(map[string]alpaca.Order)
+	}
+	cutoff := time.Now().Add(-retainFinished)
+	for _, order := range orders {
+		if _, ok := t.orders[account][order.ID]; !ok && !finishedBefore(order, cutoff) {
+			t.orders[account][order.ID] = order
+		}
+	}
+}
+
+// prune forgets the orders that finished more than retainFinished before now
+func (t *OrderTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-retainFinished)
+	for _, orders := range t.orders {
+		for id, order := range orders {
+			if finishedBefore(order, cutoff) {
+				delete(orders, id)
+			}
+		}
+	}
+}
+
+// finishedBefore reports whether an order finished before cutoff
+func finishedBefore(order alpaca.Order, cutoff time.Time) bool {
+	switch order.Status {
+	case "filled", "canceled", "expired", "rejected", "replaced":
+		return order.UpdatedAt.Before(cutoff)
+	default:
+		return false
+	}
+}
+
+func (t *OrderTracker) follow(ctx context.Context, account string, streamer TradeUpdateStreamer) {
+	var last time.Time
+	backoff := time.Second
+	for ctx.Err() == nil {
+		req := alpaca.StreamTradeUpdatesRequest{}
+		if !last.IsZero() {
+			req.Since = last.Add(time.Nanosecond)
+		}
+
+		err := streamer.StreamTradeUpdates(ctx, func(tu alpaca.TradeUpdate) {
+			last = tu.At
+			backoff = time.Second
+			t.handle(account, tu)
+		}, req)
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return
+		}
+		log.Printf("Warning: trade updates stream for account %q ended: %v", account, err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func (t *OrderTracker) handle(account string, tu alpaca.TradeUpdate) {
+	t.mu.Lock()
+	if t.orders[account] == nil {
+		t.orders[account] = make(map[string]alpaca.Order)
+	}
+	t.orders[account][tu.Order.ID] = tu.Order
+	t.mu.Unlock()
+
+	t.bus.Publish(OrderEvent{
+		Account:     account,
+		Event:       tu.Event,
+		At:          tu.At,
+		Order:       tu.Order,
+		Price:       tu.Price,
+		Qty:         tu.Qty,
+		PositionQty: tu.PositionQty,
+	})
+}
@@ -0,0 +1,119 @@
+package trading
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// wrapped hides a broker's trade update stream behind a decorator
+type wrapped struct {
+	Broker
+}
+
+func (w wrapped) Unwrap() Broker { return w.Broker }
+
+func TestOrderTrackerRun(t *testing.T) {
+	sim := newTestSim("10000")
+	r := NewRegistry()
+	r.Register(AccountInfo{Name: "paper", Paper: true}, wrapped{sim})
+
+	tracker := NewOrderTracker(r)
+	events, unsubscribe := tracker.Events().Subscribe(16)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tracker.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The stream is found through the decorator once it is listening
+	for deadline := time.Now().Add(time.Second); ; {
+		sim.mu.Lock()
+		listening := len(sim.listeners) > 0
+		sim.mu.Unlock()
+		if listening {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the tracker never followed the account's trade updates")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	order, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("5"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day})
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if event.Account != "paper" || event.Order.ID != order.ID {
+				t.Fatalf("event = %+v, want one for order %s on paper", event, order.ID)
+			}
+			if event.Event != "fill" {
+				continue
+			}
+			if !event.Price.Equal(dec("100")) || !event.Qty.Equal(dec("5")) || !event.PositionQty.Equal(dec("5")) {
+				t.Errorf("fill = %s at %s holding %s, want 5 at 100 holding 5", event.Qty, event.Price, event.PositionQty)
+			}
+			if tracked, ok := tracker.Order("paper", order.ID); !ok || tracked.Status != OrderStatusFilled {
+				t.Errorf("Order() = %+v, %t, want the filled order", tracked, ok)
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatal("no fill event was published")
+		}
+	}
+}
+
+func TestOrderTrackerRestoreAndPrune(t *testing.T) {
+	now := time.Now()
+	order := func(id, status string, submitted, updated time.Time) alpaca.Order {
+		return alpaca.Order{ID: id, Status: status, SubmittedAt: submitted, UpdatedAt: updated}
+	}
+	tracker := NewOrderTracker(NewRegistry())
+
+	// An update seen before the restore is newer than the journal's copy
+	tracker.handle("paper", alpaca.TradeUpdate{Event: "fill", Order: order("b", OrderStatusFilled, now.Add(-time.Hour), now)})
+	tracker.Restore("paper", []alpaca.Order{
+		order("a", OrderStatusNew, now.Add(-3*time.Hour), now.Add(-3*time.Hour)),
+		order("b", OrderStatusNew, now.Add(-time.Hour), now.Add(-time.Hour)),
+		order("c", OrderStatusCanceled, now.Add(-2*time.Hour), now.Add(-2*time.Hour)),
+		order("old", OrderStatusFilled, now.Add(-48*time.Hour), now.Add(-47*time.Hour)),
+	})
+
+	ids := func() []string {
+		var ids []string
+		for _, o := range tracker.Orders("paper") {
+			ids = append(ids, o.ID+":"+o.Status)
+		}
+		return ids
+	}
+	want := []string{"a:new", "c:canceled", "b:filled"}
+	if got := ids(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("Orders() = %v, want %v", got, want)
+	}
+
+	// Open orders are kept however old they are
+	tracker.prune(now.Add(retainFinished - time.Minute))
+	if got := ids(); len(got) != 2 || got[0] != "a:new" || got[1] != "b:filled" {
+		t.Errorf("Orders() after prune = %v, want a:new and b:filled", got)
+	}
+	tracker.prune(now.Add(2 * retainFinished))
+	if got := ids(); len(got) != 1 || got[0] != "a:new" {
+		t.Errorf("Orders() after a later prune = %v, want a:new", got)
+	}
+	if _, ok := tracker.Order("live", "a"); ok {
+		t.Error("Order() found an order on another account")
+	}
+}
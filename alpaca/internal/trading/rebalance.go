@@ -0,0 +1,90 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+)
+
+// Rebalance trades an account towards target weights of its equity, in whole
+// shares, with market orders. Sells are placed before buys so they free the
+// cash the buys need. Symbols without a target are left alone. price supplies
+// the price of symbols the account does not hold. The orders placed before
+// any failure are returned with the error.
+func Rebalance(broker Broker, targets map[string]decimal.Decimal, price func(symbol string) (decimal.Decimal, error)) ([]alpaca.Order, error) {
+	total := decimal.Zero
+	for symbol, weight := range targets {
+		if !weight.IsPositive() {
+			return nil, fmt.Errorf("target weight of %s must be greater than zero", symbol)
+		}
+		total = total.Add(weight)
+	}
+	if total.GreaterThan(decimal.NewFromInt(1)) {
+		return nil, errors.New("target weights must add up to at most 1")
+	}
+
+	account, err := GetAccount(broker)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := GetPositions(broker)
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string]alpaca.Position, len(positions))
+	for _, p := range positions {
+		held[p.Symbol] = p
+	}
+
+	symbols := make([]string, 0, len(targets))
+	for symbol := range targets {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	var sells, buys []alpaca.PlaceOrderRequest
+	for _, symbol := range symbols {
+		position, ok := held[symbol]
+		var last decimal.Decimal
+		if ok && position.CurrentPrice != nil {
+			last = *position.CurrentPrice
+		} else if last, err = price(symbol); err != nil {
+			return nil, fmt.Errorf("price %s: %w", symbol, err)
+		}
+		if !last.IsPositive() {
+			return nil, fmt.Errorf("no price for %s", symbol)
+		}
+
+		want := account.Equity.Mul(targets[symbol]).Div(last).Floor()
+		diff := want.Sub(position.Qty)
+		switch {
+		case diff.IsNegative():
+			sells = append(sells, rebalanceOrder(symbol, alpaca.Sell, diff.Neg()))
+		case diff.IsPositive():
+			buys = append(buys, rebalanceOrder(symbol, alpaca.Buy, diff))
+		}
+	}
+
+	var orders []alpaca.Order
+	for _, req := range append(sells, buys...) {
+		order, err := PlaceOrder(broker, req)
+		if err != nil {
+			return orders, fmt.Errorf("%s %s %s: %w", req.Side, req.Qty, req.Symbol, err)
+		}
+		orders = append(orders, *order)
+	}
+	return orders, nil
+}
+
+func rebalanceOrder(symbol string, side alpaca.Side, qty decimal.Decimal) alpaca.PlaceOrderRequest {
+	return alpaca.PlaceOrderRequest{
+		Symbol:      symbol,
+		Qty:         &qty,
+		Side:        side,
+		Type:        alpaca.Market,
+		TimeInForce: alpaca.Day,
+	}
+}
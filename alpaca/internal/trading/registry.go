@@ -0,0 +1,144 @@
+package trading
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Account names used for the accounts configured from the legacy paper and
+// live environment variables
+const (
+	PaperAccount = "paper"
+	LiveAccount  = "live"
+)
+
+// AccountInfo describes a registered account
+type AccountInfo struct {
+	Name string `json:"name"`
+	// Paper is set for accounts that trade no real money. Changes to every
+	// other account pass the live gate.
+	Paper bool `json:"paper"`
+}
+
+// Registry holds the brokers available to the API keyed by account name
+type Registry struct {
+	mu       sync.RWMutex
+	brokers  map[string]Broker
+	accounts map[string]AccountInfo
+}
+
+// NewRegistry creates an empty broker registry
+func NewRegistry() *Registry {
+	return &Registry{
+		brokers:  make(map[string]Broker),
+		accounts: make(map[string]AccountInfo),
+	}
+}
+
+// Register adds or replaces the broker for an account
+func (r *Registry) Register(account AccountInfo, broker Broker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.brokers[account.Name] = broker
+	r.accounts[account.Name] = account
+}
+
+// Wrap replaces every registered broker with the result of wrap, so
+// decorators such as risk checks sit in front of each account
+func (r *Registry) Wrap(wrap func(name string, broker Broker) Broker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, broker := range r.brokers {
+		r.brokers[name] = wrap(name, broker)
+	}
+}
+
+// Get returns the broker registered for an account
+func (r *Registry) Get(name string) (Broker, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	broker, ok := r.brokers[name]
+	if !ok {
+		return nil, fmt.Errorf("account %q is not configured", name)
+	}
+
+	return broker, nil
+}
+
+// Info returns the description of a registered account
+func (r *Registry) Info(name string) (AccountInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	account, ok := r.accounts[name]
+	if !ok {
+		return AccountInfo{}, fmt.Errorf("account %q is not configured", name)
+	}
+
+	return account, nil
+}
+
+// Accounts returns every registered account in name order
+func (r *Registry) Accounts() []AccountInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := make([]AccountInfo, 0, len(r.accounts))
+	for _, account := range r.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+
+	return accounts
+}
+
+// Resolve maps the legacy is_paper flag to an account name for requests that
+// do not name an account: the account called paper or live when there is
+// one, otherwise the first paper or live account by name
+func (r *Registry) Resolve(isPaper bool) string {
+	name := LiveAccount
+	if isPaper {
+		name = PaperAccount
+	}
+	if account, err := r.Info(name); err == nil && account.Paper == isPaper {
+		return name
+	}
+
+	for _, account := range r.Accounts() {
+		if account.Paper == isPaper {
+			return account.Name
+		}
+	}
+	return name
+}
+
+// Default returns the broker used for account-independent queries such as
+// assets, clock and calendar. Paper accounts are preferred.
+func (r *Registry) Default() (Broker, error) {
+	if broker, err := r.Get(r.Resolve(true)); err == nil {
+		return broker, nil
+	}
+	if broker, err := r.Get(r.Resolve(false)); err == nil {
+		return broker, nil
+	}
+
+	return nil, fmt.Errorf("no trading account is configured")
+}
+
+// Names returns the registered account names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.brokers))
+	for name := range r.brokers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,90 @@
+package trading
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRegistryResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		accounts  []AccountInfo
+		wantPaper string
+		wantLive  string
+	}{
+		{
+			name:      "legacy paper and live accounts",
+			accounts:  []AccountInfo{{Name: "paper", Paper: true}, {Name: "live"}},
+			wantPaper: "paper",
+			wantLive:  "live",
+		},
+		{
+			name:      "named accounts",
+			accounts:  []AccountInfo{{Name: "sandbox", Paper: true}, {Name: "ira"}, {Name: "brokerage"}},
+			wantPaper: "sandbox",
+			wantLive:  "brokerage",
+		},
+		{
+			name:      "account called live that trades paper",
+			accounts:  []AccountInfo{{Name: "live", Paper: true}, {Name: "real"}},
+			wantPaper: "live",
+			wantLive:  "real",
+		},
+		{
+			name:      "no live account",
+			accounts:  []AccountInfo{{Name: "paper", Paper: true}},
+			wantPaper: "paper",
+			wantLive:  "live",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			for _, account := range tt.accounts {
+				r.Register(account, newTestSim("1000"))
+			}
+			if got := r.Resolve(true); got != tt.wantPaper {
+				t.Errorf("Resolve(true) = %q, want %q", got, tt.wantPaper)
+			}
+			if got := r.Resolve(false); got != tt.wantLive {
+				t.Errorf("Resolve(false) = %q, want %q", got, tt.wantLive)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if _, err := r.Default(); err == nil {
+		t.Error("Default() of an empty registry succeeded, want an error")
+	}
+
+	live := NewAlpacaBroker("key", "secret", "http://127.0.0.1")
+	paper := NewAlpacaBroker("key", "secret", "http://127.0.0.1")
+	r.Register(AccountInfo{Name: "live"}, live)
+	r.Register(AccountInfo{Name: "paper", Paper: true}, paper)
+
+	if got := r.Names(); !slices.Equal(got, []string{"live", "paper"}) {
+		t.Errorf("Names() = %v, want [live paper]", got)
+	}
+	if broker, err := r.Default(); err != nil || broker != Broker(paper) {
+		t.Errorf("Default() = %v, %v, want the paper broker", broker, err)
+	}
+	if _, err := r.Get("ira"); err == nil {
+		t.Error(`Get("ira") succeeded, want an error`)
+	}
+
+	var wrapped []string
+	r.Wrap(func(name string, broker Broker) Broker {
+		wrapped = append(wrapped, name)
+		return WithMeta(broker, OrderMeta{Source: name})
+	})
+	slices.Sort(wrapped)
+	if !slices.Equal(wrapped, []string{"live", "paper"}) {
+		t.Errorf("Wrap() visited %v, want every account", wrapped)
+	}
+	if info, err := r.Info("live"); err != nil || info.Paper {
+		t.Errorf(`Info("live") = %+v, %v, want a live account`, info, err)
+	}
+}
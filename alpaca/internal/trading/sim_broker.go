@@ -0,0 +1,1246 @@
+package trading
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+)
+
+// PriceFeed supplies the prices the simulated broker fills orders against
+type PriceFeed interface {
+	LastPrice(symbol string) (decimal.Decimal, bool)
+	Symbols() []string
+}
+
+// StaticPriceFeed is a PriceFeed holding prices set by the caller
+type StaticPriceFeed struct {
+	mu     sync.RWMutex
+	prices map[string]decimal.Decimal
+}
+
+// NewStaticPriceFeed creates a price feed seeded with the given prices
+func NewStaticPriceFeed(prices map[string]decimal.Decimal) *StaticPriceFeed {
+	feed := &StaticPriceFeed{prices: make(map[string]decimal.Decimal)}
+	for symbol, price := range prices {
+		feed.prices[strings.ToUpper(symbol)] = price
+	}
+	return feed
+}
+
+// SetPrice updates the last price for a symbol
+func (f *StaticPriceFeed) SetPrice(symbol string, price decimal.Decimal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.prices[strings.ToUpper(symbol)] = price
+}
+
+// LastPrice returns the last price for a symbol
+func (f *StaticPriceFeed) LastPrice(symbol string) (decimal.Decimal, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	price, ok := f.prices[strings.ToUpper(symbol)]
+	return price, ok
+}
+
+// Symbols returns the symbols the feed has prices for in sorted order
+func (f *StaticPriceFeed) Symbols() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	symbols := make([]string, 0, len(f.prices))
+	for symbol := range f.prices {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	return symbols
+}
+
+// Order statuses used by the simulated broker, matching Alpaca's values
+const (
+	OrderStatusNew      = "new"
+	OrderStatusHeld     = "held"
+	OrderStatusFilled   = "filled"
+	OrderStatusCanceled = "canceled"
+	OrderStatusExpired  = "expired"
+	OrderStatusReplaced = "replaced"
+)
+
+type simOrder struct {
+	order     alpaca.Order
+	triggered bool
+
+	// legs are the exit orders of a bracket, oco or oto order. peer links the
+	// two exits that cancel each other; shadow marks the second of the pair,
+	// which shares the first one's reservation of shares.
+	parent *simOrder
+	legs   []*simOrder
+	peer   *simOrder
+	shadow bool
+}
+
+type simPosition struct {
+	qty       decimal.Decimal
+	costBasis decimal.Decimal
+}
+
+// SimBroker is an in-memory Broker that keeps cash, positions and orders
+// locally and fills orders against a PriceFeed. Orders are filled in full at
+// the feed's last price once they become marketable, even outside the NYSE
+// sessions its clock and calendar report. Day orders expire at the close while
+// Run is running, and short selling is not supported. Bracket, oco and oto
+// orders are supported for long positions.
+type SimBroker struct {
+	mu          sync.Mutex
+	feed        PriceFeed
+	accountID   string
+	createdAt   time.Time
+	initialCash decimal.Decimal
+	cash        decimal.Decimal
+	positions   map[string]*simPosition
+	orders      []*simOrder
+	ordersByID  map[string]*simOrder
+
+	// Trade updates are queued while the lock is held and delivered to the
+	// listeners once it is released
+	listeners    map[int]func(alpaca.TradeUpdate)
+	nextListener int
+	pending      []alpaca.TradeUpdate
+}
+
+// NewSimBroker creates a simulated broker funded with the given cash
+func NewSimBroker(feed PriceFeed, cash decimal.Decimal) *SimBroker {
+	return &SimBroker{
+		feed:        feed,
+		accountID:   newSimID(),
+		createdAt:   time.Now(),
+		initialCash: cash,
+		cash:        cash,
+		positions:   make(map[string]*simPosition),
+		ordersByID:  make(map[string]*simOrder),
+		listeners:   make(map[int]func(alpaca.TradeUpdate)),
+	}
+}
+
+// Simulator finds the simulated broker behind broker, looking through any
+// decorators wrapped around it
+func Simulator(broker Broker) (*SimBroker, bool) {
+	for {
+		if sim, ok := broker.(*SimBroker); ok {
+			return sim, true
+		}
+		wrapper, ok := broker.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		broker = wrapper.Unwrap()
+	}
+}
+
+// Tick re-evaluates working orders against the latest feed prices
+func (b *SimBroker) Tick() {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+}
+
+// SetPrice moves a symbol's price on the broker's feed and fills the working
+// orders that become marketable. The feed must accept price updates.
+func (b *SimBroker) SetPrice(symbol string, price decimal.Decimal) error {
+	setter, ok := b.feed.(interface {
+		SetPrice(symbol string, price decimal.Decimal)
+	})
+	if !ok {
+		return fmt.Errorf("the simulated broker's price feed does not accept updates")
+	}
+	if !price.IsPositive() {
+		return fmt.Errorf("price of %s must be positive", strings.ToUpper(symbol))
+	}
+
+	setter.SetPrice(symbol, price)
+	b.Tick()
+	return nil
+}
+
+// Run expires the working day orders at every regular session close until ctx
+// is cancelled
+func (b *SimBroker) Run(ctx context.Context) {
+	for {
+		clock, _ := b.GetClock()
+		timer := time.NewTimer(time.Until(clock.NextClose))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			b.ExpireDayOrders()
+		}
+	}
+}
+
+// ExpireDayOrders expires every working order that is only valid for the day,
+// mirroring what happens at the close
+func (b *SimBroker) ExpireDayOrders() {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for _, o := range b.orders {
+		if isOpenStatus(o.order.Status) && o.order.Status != OrderStatusHeld && o.order.TimeInForce != alpaca.GTC {
+			o.order.Status = OrderStatusExpired
+			o.order.ExpiredAt = &now
+			o.order.UpdatedAt = now
+			b.emit(EventExpired, o, nil, nil)
+
+			for _, leg := range o.legs {
+				b.cancel(leg)
+			}
+			if o.peer != nil {
+				b.cancel(o.peer)
+			}
+		}
+	}
+}
+
+// StreamTradeUpdates delivers the simulator's order updates to handler until
+// ctx is cancelled
+func (b *SimBroker) StreamTradeUpdates(ctx context.Context, handler func(alpaca.TradeUpdate), req alpaca.StreamTradeUpdatesRequest) error {
+	b.mu.Lock()
+	id := b.nextListener
+	b.nextListener++
+	b.listeners[id] = handler
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.listeners, id)
+	b.mu.Unlock()
+
+	return ctx.Err()
+}
+
+// LastPrice returns the simulated price of a symbol
+func (b *SimBroker) LastPrice(symbol string) (decimal.Decimal, bool) {
+	return b.feed.LastPrice(strings.ToUpper(symbol))
+}
+
+func (b *SimBroker) GetAccount() (*alpaca.Account, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	marketValue := decimal.Zero
+	for symbol, p := range b.positions {
+		marketValue = marketValue.Add(p.qty.Mul(b.markPrice(symbol, p)))
+	}
+	equity := b.cash.Add(marketValue)
+	buyingPower := b.buyingPower()
+
+	return &alpaca.Account{
+		ID:                   b.accountID,
+		AccountNumber:        "SIM",
+		Status:               "ACTIVE",
+		Currency:             "USD",
+		BuyingPower:          buyingPower,
+		RegTBuyingPower:      buyingPower,
+		EffectiveBuyingPower: buyingPower,
+		NonMarginBuyingPower: buyingPower,
+		Cash:                 b.cash,
+		PortfolioValue:       equity,
+		CreatedAt:            b.createdAt,
+		Multiplier:           decimal.NewFromInt(1),
+		Equity:               equity,
+		LastEquity:           b.initialCash,
+		LongMarketValue:      marketValue,
+		PositionMarketValue:  marketValue,
+	}, nil
+}
+
+func (b *SimBroker) PlaceOrder(req alpaca.PlaceOrderRequest) (*alpaca.Order, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	o, err := b.newOrder(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.tryFill(o) && (o.order.TimeInForce == alpaca.IOC || o.order.TimeInForce == alpaca.FOK) {
+		// Fills are all-or-nothing, so ioc and fok both cancel when the order
+		// is not immediately marketable
+		b.cancel(o)
+	}
+
+	order := b.view(o, true)
+	return &order, nil
+}
+
+func (b *SimBroker) GetOrders(req alpaca.GetOrdersRequest) ([]alpaca.Order, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	status := req.Status
+	if status == "" {
+		status = "open"
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 50
+	}
+
+	symbols := make(map[string]bool)
+	for _, symbol := range req.Symbols {
+		symbols[strings.ToUpper(symbol)] = true
+	}
+
+	orders := []alpaca.Order{}
+	for _, o := range b.orders {
+		// Nested listings roll legs up under their parent
+		if req.Nested && o.parent != nil {
+			continue
+		}
+
+		open := isOpenStatus(o.order.Status)
+		if (status == "open" && !open) || (status == "closed" && open) {
+			continue
+		}
+		if req.Side != "" && string(o.order.Side) != req.Side {
+			continue
+		}
+		if len(symbols) > 0 && !symbols[o.order.Symbol] {
+			continue
+		}
+		if !req.After.IsZero() && !o.order.SubmittedAt.After(req.After) {
+			continue
+		}
+		if !req.Until.IsZero() && !o.order.SubmittedAt.Before(req.Until) {
+			continue
+		}
+		orders = append(orders, b.view(o, req.Nested))
+	}
+
+	if req.Direction != "asc" {
+		for i, j := 0, len(orders)-1; i < j; i, j = i+1, j-1 {
+			orders[i], orders[j] = orders[j], orders[i]
+		}
+	}
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+
+	return orders, nil
+}
+
+func (b *SimBroker) GetOrder(orderID string, nested bool) (*alpaca.Order, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	o, ok := b.ordersByID[orderID]
+	if !ok {
+		return nil, simError(http.StatusNotFound, "order not found")
+	}
+
+	order := b.view(o, nested)
+	return &order, nil
+}
+
+func (b *SimBroker) GetOrderByClientOrderID(clientOrderID string) (*alpaca.Order, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	o := b.findClientOrder(clientOrderID)
+	if o == nil {
+		return nil, simError(http.StatusNotFound, "order not found")
+	}
+
+	order := b.view(o, false)
+	return &order, nil
+}
+
+func (b *SimBroker) ReplaceOrder(orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	o, ok := b.ordersByID[orderID]
+	if !ok {
+		return nil, simError(http.StatusNotFound, "order not found")
+	}
+	if !isOpenStatus(o.order.Status) {
+		return nil, simError(http.StatusUnprocessableEntity, fmt.Sprintf("order is already %s", o.order.Status))
+	}
+
+	if req.ClientOrderID != "" && b.findClientOrder(req.ClientOrderID) != nil {
+		return nil, simError(http.StatusUnprocessableEntity, "client_order_id must be unique")
+	}
+
+	r := b.replacement(o, req)
+
+	// Put the replacement in place of the original, then undo the swap if
+	// the replacement needs more cash or shares than the account has free
+	bpBefore, qtyBefore := b.buyingPower(), b.availableQty(o.order.Symbol)
+	status := o.order.Status
+	o.order.Status = OrderStatusReplaced
+	b.relink(o, r)
+	b.orders = append(b.orders, r)
+	b.ordersByID[r.order.ID] = r
+
+	if bp := b.buyingPower(); bp.IsNegative() && bp.LessThan(bpBefore) {
+		b.undoReplace(o, r, status)
+		return nil, simError(http.StatusForbidden, "insufficient buying power")
+	}
+	if available := b.availableQty(o.order.Symbol); available.IsNegative() && available.LessThan(qtyBefore) {
+		b.undoReplace(o, r, status)
+		return nil, simError(http.StatusForbidden, "insufficient qty available for order")
+	}
+
+	now := time.Now()
+	o.order.ReplacedAt = &now
+	o.order.ReplacedBy = &r.order.ID
+	o.order.UpdatedAt = now
+	b.emit(EventReplaced, r, nil, nil)
+
+	if r.order.Status != OrderStatusHeld {
+		b.tryFill(r)
+	}
+
+	order := r.order
+	return &order, nil
+}
+
+func (b *SimBroker) CancelOrder(orderID string) error {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	o, ok := b.ordersByID[orderID]
+	if !ok {
+		return simError(http.StatusNotFound, "order not found")
+	}
+	if !isOpenStatus(o.order.Status) {
+		return simError(http.StatusUnprocessableEntity, fmt.Sprintf("order is already %s", o.order.Status))
+	}
+
+	b.cancel(o)
+	return nil
+}
+
+func (b *SimBroker) CancelAllOrders() error {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	for _, o := range b.orders {
+		b.cancel(o)
+	}
+
+	return nil
+}
+
+func (b *SimBroker) GetPositions() ([]alpaca.Position, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	symbols := make([]string, 0, len(b.positions))
+	for symbol := range b.positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	positions := make([]alpaca.Position, 0, len(symbols))
+	for _, symbol := range symbols {
+		positions = append(positions, b.position(symbol))
+	}
+
+	return positions, nil
+}
+
+func (b *SimBroker) GetPosition(symbol string) (*alpaca.Position, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	symbol = strings.ToUpper(symbol)
+	if _, ok := b.positions[symbol]; !ok {
+		return nil, simError(http.StatusNotFound, "position does not exist")
+	}
+
+	position := b.position(symbol)
+	return &position, nil
+}
+
+func (b *SimBroker) ClosePosition(symbol string, req alpaca.ClosePositionRequest) (*alpaca.Order, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	symbol = strings.ToUpper(symbol)
+	p, ok := b.positions[symbol]
+	if !ok {
+		return nil, simError(http.StatusNotFound, "position does not exist")
+	}
+
+	qty := p.qty
+	switch {
+	case !req.Qty.IsZero():
+		qty = req.Qty
+	case !req.Percentage.IsZero():
+		qty = p.qty.Mul(req.Percentage).Div(decimal.NewFromInt(100))
+	}
+
+	return b.closeOrder(symbol, qty)
+}
+
+func (b *SimBroker) CloseAllPositions(req alpaca.CloseAllPositionsRequest) ([]alpaca.Order, error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.match()
+
+	if req.CancelOrders {
+		for _, o := range b.orders {
+			b.cancel(o)
+		}
+	}
+
+	symbols := make([]string, 0, len(b.positions))
+	for symbol := range b.positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	orders := []alpaca.Order{}
+	for _, symbol := range symbols {
+		order, err := b.closeOrder(symbol, b.positions[symbol].qty)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, *order)
+	}
+
+	return orders, nil
+}
+
+func (b *SimBroker) GetAssets(req alpaca.GetAssetsRequest) ([]alpaca.Asset, error) {
+	if req.Status == string(alpaca.AssetInactive) || (req.AssetClass != "" && req.AssetClass != string(alpaca.USEquity)) {
+		return []alpaca.Asset{}, nil
+	}
+
+	assets := []alpaca.Asset{}
+	for _, symbol := range b.feed.Symbols() {
+		assets = append(assets, simAsset(symbol))
+	}
+
+	return assets, nil
+}
+
+func (b *SimBroker) GetAsset(symbol string) (*alpaca.Asset, error) {
+	symbol = strings.ToUpper(symbol)
+	if _, ok := b.feed.LastPrice(symbol); !ok {
+		return nil, simError(http.StatusNotFound, "asset not found")
+	}
+
+	asset := simAsset(symbol)
+	return &asset, nil
+}
+
+func (b *SimBroker) GetClock() (*alpaca.Clock, error) {
+	clock := simClock(time.Now())
+	return &clock, nil
+}
+
+func (b *SimBroker) GetCalendar(req alpaca.GetCalendarRequest) ([]alpaca.CalendarDay, error) {
+	start := req.Start
+	if start.IsZero() {
+		start = time.Now()
+	}
+	end := req.End
+	if end.IsZero() {
+		end = start.AddDate(0, 0, 30)
+	}
+
+	return simCalendar(start, end), nil
+}
+
+// newOrder validates a request and records it as a working order
+func (b *SimBroker) newOrder(req alpaca.PlaceOrderRequest) (*simOrder, error) {
+	symbol := strings.ToUpper(req.Symbol)
+	if symbol == "" {
+		return nil, simError(http.StatusUnprocessableEntity, "symbol is required")
+	}
+	if (req.Qty == nil) == (req.Notional == nil) {
+		return nil, simError(http.StatusUnprocessableEntity, "exactly one of qty or notional is required")
+	}
+	if req.Qty != nil && !req.Qty.IsPositive() {
+		return nil, simError(http.StatusUnprocessableEntity, "qty must be greater than zero")
+	}
+	if req.Notional != nil && !req.Notional.IsPositive() {
+		return nil, simError(http.StatusUnprocessableEntity, "notional must be greater than zero")
+	}
+	if req.Side != alpaca.Buy && req.Side != alpaca.Sell {
+		return nil, simError(http.StatusUnprocessableEntity, fmt.Sprintf("invalid side %q", req.Side))
+	}
+
+	orderClass := req.OrderClass
+	if orderClass == "" {
+		orderClass = alpaca.Simple
+	}
+	switch orderClass {
+	case alpaca.Simple:
+	case alpaca.Bracket, alpaca.OTO:
+		if req.Side != alpaca.Buy {
+			return nil, simError(http.StatusUnprocessableEntity, "short selling is not supported by the simulated broker")
+		}
+	case alpaca.OCO:
+		if req.Side != alpaca.Sell {
+			return nil, simError(http.StatusUnprocessableEntity, "short selling is not supported by the simulated broker")
+		}
+		if req.TakeProfit == nil || req.TakeProfit.LimitPrice == nil {
+			return nil, simError(http.StatusUnprocessableEntity, "take_profit.limit_price is required for oco orders")
+		}
+		// The take-profit leg is the parent order of an oco
+		req.LimitPrice = req.TakeProfit.LimitPrice
+	default:
+		return nil, simError(http.StatusUnprocessableEntity, fmt.Sprintf("order class %q is not supported by the simulated broker", req.OrderClass))
+	}
+
+	switch req.Type {
+	case alpaca.Market:
+	case alpaca.Limit:
+		if req.LimitPrice == nil {
+			return nil, simError(http.StatusUnprocessableEntity, "limit_price is required for limit orders")
+		}
+	case alpaca.Stop:
+		if req.StopPrice == nil {
+			return nil, simError(http.StatusUnprocessableEntity, "stop_price is required for stop orders")
+		}
+	case alpaca.StopLimit:
+		if req.LimitPrice == nil || req.StopPrice == nil {
+			return nil, simError(http.StatusUnprocessableEntity, "limit_price and stop_price are required for stop_limit orders")
+		}
+	case alpaca.TrailingStop:
+		if (req.TrailPrice == nil) == (req.TrailPercent == nil) {
+			return nil, simError(http.StatusUnprocessableEntity, "exactly one of trail_price or trail_percent is required for trailing_stop orders")
+		}
+	default:
+		return nil, simError(http.StatusUnprocessableEntity, fmt.Sprintf("order type %q is not supported by the simulated broker", req.Type))
+	}
+
+	switch req.TimeInForce {
+	case alpaca.Day, alpaca.GTC, alpaca.OPG, alpaca.CLS, alpaca.IOC, alpaca.FOK:
+	default:
+		return nil, simError(http.StatusUnprocessableEntity, fmt.Sprintf("invalid time_in_force %q", req.TimeInForce))
+	}
+
+	price, ok := b.feed.LastPrice(symbol)
+	if !ok {
+		return nil, simError(http.StatusUnprocessableEntity, fmt.Sprintf("no price available for %s", symbol))
+	}
+
+	// Notional orders are sized at the last price, to the nine decimal
+	// places Alpaca supports for fractional quantities
+	var qty decimal.Decimal
+	if req.Notional != nil {
+		qty = req.Notional.DivRound(price, 9)
+		if !qty.IsPositive() {
+			return nil, simError(http.StatusUnprocessableEntity, "notional is too small to buy any shares")
+		}
+	} else {
+		qty = *req.Qty
+	}
+	if req.Side == alpaca.Buy {
+		cost := qty.Mul(reservePrice(req.Type, req.LimitPrice, req.StopPrice, price))
+		if cost.GreaterThan(b.buyingPower()) {
+			return nil, simError(http.StatusForbidden, "insufficient buying power")
+		}
+	} else if qty.GreaterThan(b.availableQty(symbol)) {
+		return nil, simError(http.StatusForbidden, fmt.Sprintf("insufficient qty available for order (requested: %s, available: %s)", qty, b.availableQty(symbol)))
+	}
+
+	clientOrderID := req.ClientOrderID
+	if clientOrderID == "" {
+		clientOrderID = newSimID()
+	} else if b.findClientOrder(clientOrderID) != nil {
+		return nil, simError(http.StatusUnprocessableEntity, "client_order_id must be unique")
+	}
+
+	now := time.Now()
+	o := &simOrder{
+		order: alpaca.Order{
+			ID:            newSimID(),
+			ClientOrderID: clientOrderID,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			SubmittedAt:   now,
+			AssetID:       simAssetID(symbol),
+			Symbol:        symbol,
+			AssetClass:    alpaca.USEquity,
+			OrderClass:    orderClass,
+			Type:          req.Type,
+			Side:          req.Side,
+			TimeInForce:   req.TimeInForce,
+			Status:        OrderStatusNew,
+			Qty:           &qty,
+			Notional:      req.Notional,
+			FilledQty:     decimal.Zero,
+			LimitPrice:    req.LimitPrice,
+			StopPrice:     req.StopPrice,
+			TrailPrice:    req.TrailPrice,
+			TrailPercent:  req.TrailPercent,
+			ExtendedHours: req.ExtendedHours,
+		},
+	}
+	if req.Type == alpaca.TrailingStop {
+		trail(o, price)
+	}
+	b.orders = append(b.orders, o)
+	b.ordersByID[o.order.ID] = o
+	b.emit(EventNew, o, nil, nil)
+
+	b.attachLegs(o, req)
+
+	return o, nil
+}
+
+// attachLegs creates the exit orders of a bracket, oco or oto order. Bracket
+// and oto exits are held until the entry fills; the oco stop leg works
+// alongside its take-profit parent straight away.
+func (b *SimBroker) attachLegs(o *simOrder, req alpaca.PlaceOrderRequest) {
+	var takeProfit, stopLoss *simOrder
+	switch o.order.OrderClass {
+	case alpaca.Bracket, alpaca.OTO:
+		if req.TakeProfit != nil {
+			takeProfit = b.newLeg(o, alpaca.Limit, req.TakeProfit.LimitPrice, nil, OrderStatusHeld)
+		}
+		if req.StopLoss != nil {
+			stopLoss = b.newLeg(o, stopLossType(req.StopLoss), req.StopLoss.LimitPrice, req.StopLoss.StopPrice, OrderStatusHeld)
+		}
+	case alpaca.OCO:
+		takeProfit = o
+		stopLoss = b.newLeg(o, stopLossType(req.StopLoss), req.StopLoss.LimitPrice, req.StopLoss.StopPrice, OrderStatusNew)
+	}
+
+	if takeProfit != nil && stopLoss != nil {
+		takeProfit.peer = stopLoss
+		stopLoss.peer = takeProfit
+		stopLoss.shadow = true
+	}
+}
+
+// newLeg records an exit order for a parent
+func (b *SimBroker) newLeg(parent *simOrder, orderType alpaca.OrderType, limitPrice, stopPrice *decimal.Decimal, status string) *simOrder {
+	side := parent.order.Side
+	if parent.order.OrderClass != alpaca.OCO {
+		side = alpaca.Sell
+		if parent.order.Side == alpaca.Sell {
+			side = alpaca.Buy
+		}
+	}
+
+	qty := *parent.order.Qty
+	now := time.Now()
+	leg := &simOrder{
+		order: alpaca.Order{
+			ID:            newSimID(),
+			ClientOrderID: newSimID(),
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			SubmittedAt:   now,
+			AssetID:       parent.order.AssetID,
+			Symbol:        parent.order.Symbol,
+			AssetClass:    parent.order.AssetClass,
+			OrderClass:    parent.order.OrderClass,
+			Type:          orderType,
+			Side:          side,
+			TimeInForce:   parent.order.TimeInForce,
+			Status:        status,
+			Qty:           &qty,
+			FilledQty:     decimal.Zero,
+			LimitPrice:    limitPrice,
+			StopPrice:     stopPrice,
+		},
+		parent: parent,
+	}
+	parent.legs = append(parent.legs, leg)
+	b.orders = append(b.orders, leg)
+	b.ordersByID[leg.order.ID] = leg
+	if status == OrderStatusNew {
+		b.emit(EventNew, leg, nil, nil)
+	}
+
+	return leg
+}
+
+// replacement builds the order that replaces o with the changes in req
+func (b *SimBroker) replacement(o *simOrder, req alpaca.ReplaceOrderRequest) *simOrder {
+	r := &simOrder{
+		order:     o.order,
+		triggered: o.triggered,
+		parent:    o.parent,
+		legs:      o.legs,
+		peer:      o.peer,
+		shadow:    o.shadow,
+	}
+
+	now := time.Now()
+	r.order.ID = newSimID()
+	r.order.ClientOrderID = req.ClientOrderID
+	if r.order.ClientOrderID == "" {
+		r.order.ClientOrderID = newSimID()
+	}
+	r.order.CreatedAt = now
+	r.order.UpdatedAt = now
+	r.order.SubmittedAt = now
+	r.order.Replaces = &o.order.ID
+	r.order.Legs = nil
+
+	if req.Qty != nil {
+		qty := *req.Qty
+		r.order.Qty = &qty
+	}
+	if req.LimitPrice != nil {
+		r.order.LimitPrice = req.LimitPrice
+	}
+	if req.StopPrice != nil {
+		r.order.StopPrice = req.StopPrice
+	}
+	if req.TimeInForce != "" {
+		r.order.TimeInForce = req.TimeInForce
+	}
+	if req.Trail != nil {
+		if r.order.TrailPercent != nil {
+			r.order.TrailPercent = req.Trail
+		} else {
+			r.order.TrailPrice = req.Trail
+		}
+		price, _ := b.feed.LastPrice(r.order.Symbol)
+		trail(r, price)
+	}
+
+	return r
+}
+
+// relink moves the parent, leg and peer links of from onto to
+func (b *SimBroker) relink(from, to *simOrder) {
+	if from.parent != nil {
+		for i, leg := range from.parent.legs {
+			if leg == from {
+				from.parent.legs[i] = to
+			}
+		}
+	}
+	for _, leg := range from.legs {
+		leg.parent = to
+	}
+	if from.peer != nil {
+		from.peer.peer = to
+	}
+}
+
+// undoReplace restores an order whose replacement was rejected
+func (b *SimBroker) undoReplace(o, r *simOrder, status string) {
+	b.relink(r, o)
+	b.orders = b.orders[:len(b.orders)-1]
+	delete(b.ordersByID, r.order.ID)
+	o.order.Status = status
+}
+
+// findClientOrder looks up an order by its client order ID
+func (b *SimBroker) findClientOrder(clientOrderID string) *simOrder {
+	for _, o := range b.orders {
+		if o.order.ClientOrderID == clientOrderID {
+			return o
+		}
+	}
+	return nil
+}
+
+// view returns an order as the API reports it, with its legs when nested
+func (b *SimBroker) view(o *simOrder, nested bool) alpaca.Order {
+	order := o.order
+	if nested && len(o.legs) > 0 {
+		order.Legs = make([]alpaca.Order, 0, len(o.legs))
+		for _, leg := range o.legs {
+			order.Legs = append(order.Legs, leg.order)
+		}
+	}
+	return order
+}
+
+// match tries to fill every working order at the current feed prices
+func (b *SimBroker) match() {
+	for _, o := range b.orders {
+		if isOpenStatus(o.order.Status) && o.order.Status != OrderStatusHeld {
+			b.tryFill(o)
+		}
+	}
+}
+
+// tryFill fills an order in full if it is marketable at the last price
+func (b *SimBroker) tryFill(o *simOrder) bool {
+	price, ok := b.feed.LastPrice(o.order.Symbol)
+	if !ok {
+		return false
+	}
+
+	buy := o.order.Side == alpaca.Buy
+	stopHit := func() bool {
+		if buy {
+			return price.GreaterThanOrEqual(*o.order.StopPrice)
+		}
+		return price.LessThanOrEqual(*o.order.StopPrice)
+	}
+	limitOK := func() bool {
+		if buy {
+			return price.LessThanOrEqual(*o.order.LimitPrice)
+		}
+		return price.GreaterThanOrEqual(*o.order.LimitPrice)
+	}
+
+	switch o.order.Type {
+	case alpaca.Market:
+	case alpaca.Limit:
+		if !limitOK() {
+			return false
+		}
+	case alpaca.Stop:
+		if !stopHit() {
+			return false
+		}
+	case alpaca.TrailingStop:
+		trail(o, price)
+		if !stopHit() {
+			return false
+		}
+	case alpaca.StopLimit:
+		if !o.triggered && stopHit() {
+			o.triggered = true
+		}
+		if !o.triggered || !limitOK() {
+			return false
+		}
+	default:
+		return false
+	}
+
+	b.fill(o, price)
+	return true
+}
+
+// fill executes an order at the given price and updates cash and positions
+func (b *SimBroker) fill(o *simOrder, price decimal.Decimal) {
+	qty := *o.order.Qty
+	notional := qty.Mul(price)
+	symbol := o.order.Symbol
+
+	p, ok := b.positions[symbol]
+	if !ok {
+		p = &simPosition{qty: decimal.Zero, costBasis: decimal.Zero}
+		b.positions[symbol] = p
+	}
+
+	if o.order.Side == alpaca.Buy {
+		b.cash = b.cash.Sub(notional)
+		p.qty = p.qty.Add(qty)
+		p.costBasis = p.costBasis.Add(notional)
+	} else {
+		b.cash = b.cash.Add(notional)
+		p.costBasis = p.costBasis.Sub(p.costBasis.Div(p.qty).Mul(qty))
+		p.qty = p.qty.Sub(qty)
+	}
+	if p.qty.IsZero() {
+		delete(b.positions, symbol)
+	}
+
+	now := time.Now()
+	o.order.Status = OrderStatusFilled
+	o.order.FilledQty = qty
+	o.order.FilledAvgPrice = &price
+	o.order.FilledAt = &now
+	o.order.UpdatedAt = now
+	b.emit(EventFill, o, &price, &qty)
+
+	// Release held exits once the entry fills, and retire the other side of
+	// a one-cancels-other pair
+	for _, leg := range o.legs {
+		if leg.order.Status == OrderStatusHeld {
+			leg.order.Status = OrderStatusNew
+			leg.order.UpdatedAt = now
+			b.emit(EventNew, leg, nil, nil)
+		}
+	}
+	if o.peer != nil {
+		b.cancel(o.peer)
+	}
+}
+
+// cancel cancels a working order together with its legs and peer
+func (b *SimBroker) cancel(o *simOrder) {
+	if !isOpenStatus(o.order.Status) {
+		return
+	}
+
+	now := time.Now()
+	o.order.Status = OrderStatusCanceled
+	o.order.CanceledAt = &now
+	o.order.UpdatedAt = now
+	b.emit(EventCanceled, o, nil, nil)
+
+	for _, leg := range o.legs {
+		b.cancel(leg)
+	}
+	if o.peer != nil {
+		b.cancel(o.peer)
+	}
+}
+
+// emit queues a trade update for an order
+func (b *SimBroker) emit(event string, o *simOrder, price, qty *decimal.Decimal) {
+	positionQty := decimal.Zero
+	if p, ok := b.positions[o.order.Symbol]; ok {
+		positionQty = p.qty
+	}
+
+	now := time.Now()
+	b.pending = append(b.pending, alpaca.TradeUpdate{
+		At:          now,
+		Event:       event,
+		Order:       o.order,
+		PositionQty: &positionQty,
+		Price:       price,
+		Qty:         qty,
+		Timestamp:   &now,
+	})
+}
+
+// notify delivers queued trade updates outside the lock
+func (b *SimBroker) notify() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	listeners := make([]func(alpaca.TradeUpdate), 0, len(b.listeners))
+	for _, listener := range b.listeners {
+		listeners = append(listeners, listener)
+	}
+	b.mu.Unlock()
+
+	for _, tu := range pending {
+		for _, listener := range listeners {
+			listener(tu)
+		}
+	}
+}
+
+// closeOrder submits a market order that sells qty of a position
+func (b *SimBroker) closeOrder(symbol string, qty decimal.Decimal) (*alpaca.Order, error) {
+	o, err := b.newOrder(alpaca.PlaceOrderRequest{
+		Symbol:      symbol,
+		Qty:         &qty,
+		Side:        alpaca.Sell,
+		Type:        alpaca.Market,
+		TimeInForce: alpaca.Day,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.tryFill(o)
+
+	order := o.order
+	return &order, nil
+}
+
+// buyingPower is cash less what working buy orders have reserved
+func (b *SimBroker) buyingPower() decimal.Decimal {
+	reserved := decimal.Zero
+	for _, o := range b.orders {
+		if o.order.Side != alpaca.Buy || !reserves(o) {
+			continue
+		}
+		price, _ := b.feed.LastPrice(o.order.Symbol)
+		reserved = reserved.Add(o.order.Qty.Mul(reservePrice(o.order.Type, o.order.LimitPrice, o.order.StopPrice, price)))
+	}
+	return b.cash.Sub(reserved)
+}
+
+// availableQty is the position quantity not already held for working sells
+func (b *SimBroker) availableQty(symbol string) decimal.Decimal {
+	p, ok := b.positions[symbol]
+	if !ok {
+		return decimal.Zero
+	}
+
+	available := p.qty
+	for _, o := range b.orders {
+		if o.order.Symbol == symbol && o.order.Side == alpaca.Sell && reserves(o) {
+			available = available.Sub(*o.order.Qty)
+		}
+	}
+	return available
+}
+
+// markPrice values a position at the feed price, falling back to its average cost
+func (b *SimBroker) markPrice(symbol string, p *simPosition) decimal.Decimal {
+	if price, ok := b.feed.LastPrice(symbol); ok {
+		return price
+	}
+	return p.costBasis.Div(p.qty)
+}
+
+func (b *SimBroker) position(symbol string) alpaca.Position {
+	p := b.positions[symbol]
+	price := b.markPrice(symbol, p)
+	marketValue := p.qty.Mul(price)
+	unrealizedPL := marketValue.Sub(p.costBasis)
+	unrealizedPLPC := decimal.Zero
+	if !p.costBasis.IsZero() {
+		unrealizedPLPC = unrealizedPL.Div(p.costBasis)
+	}
+
+	return alpaca.Position{
+		AssetID:        simAssetID(symbol),
+		Symbol:         symbol,
+		Exchange:       "SIM",
+		AssetClass:     alpaca.USEquity,
+		Qty:            p.qty,
+		QtyAvailable:   b.availableQty(symbol),
+		AvgEntryPrice:  p.costBasis.Div(p.qty),
+		Side:           "long",
+		MarketValue:    &marketValue,
+		CostBasis:      p.costBasis,
+		UnrealizedPL:   &unrealizedPL,
+		UnrealizedPLPC: &unrealizedPLPC,
+		CurrentPrice:   &price,
+	}
+}
+
+// trail moves a trailing stop's high-water mark (the low for a buy) to the
+// given price when it is more favourable and re-derives the stop price from it
+func trail(o *simOrder, price decimal.Decimal) {
+	buy := o.order.Side == alpaca.Buy
+	if o.order.HWM == nil || (buy && price.LessThan(*o.order.HWM)) || (!buy && price.GreaterThan(*o.order.HWM)) {
+		hwm := price
+		o.order.HWM = &hwm
+	}
+
+	offset := decimal.Zero
+	if o.order.TrailPrice != nil {
+		offset = *o.order.TrailPrice
+	} else if o.order.TrailPercent != nil {
+		offset = o.order.HWM.Mul(*o.order.TrailPercent).Div(decimal.NewFromInt(100))
+	}
+
+	stopPrice := o.order.HWM.Sub(offset)
+	if buy {
+		stopPrice = o.order.HWM.Add(offset)
+	}
+	stopPrice = stopPrice.Round(2)
+	o.order.StopPrice = &stopPrice
+}
+
+// reservePrice is the price used to reserve buying power for a working order
+func reservePrice(orderType alpaca.OrderType, limitPrice, stopPrice *decimal.Decimal, lastPrice decimal.Decimal) decimal.Decimal {
+	switch {
+	case limitPrice != nil && (orderType == alpaca.Limit || orderType == alpaca.StopLimit):
+		return *limitPrice
+	case stopPrice != nil && orderType == alpaca.Stop:
+		return *stopPrice
+	default:
+		return lastPrice
+	}
+}
+
+// reserves reports whether a working order holds cash or shares. Held exits
+// reserve nothing until released, and the second order of a peer pair shares
+// the first one's reservation.
+func reserves(o *simOrder) bool {
+	if !isOpenStatus(o.order.Status) || o.order.Status == OrderStatusHeld {
+		return false
+	}
+	return !o.shadow || o.peer == nil || !isOpenStatus(o.peer.order.Status)
+}
+
+func stopLossType(stopLoss *alpaca.StopLoss) alpaca.OrderType {
+	if stopLoss.LimitPrice != nil {
+		return alpaca.StopLimit
+	}
+	return alpaca.Stop
+}
+
+func isOpenStatus(status string) bool {
+	switch status {
+	case OrderStatusNew, OrderStatusHeld, "accepted", "partially_filled", "pending_new":
+		return true
+	default:
+		return false
+	}
+}
+
+func simAsset(symbol string) alpaca.Asset {
+	return alpaca.Asset{
+		ID:           simAssetID(symbol),
+		Class:        alpaca.USEquity,
+		Exchange:     "SIM",
+		Symbol:       symbol,
+		Name:         symbol,
+		Status:       alpaca.AssetActive,
+		Tradable:     true,
+		Fractionable: true,
+	}
+}
+
+func simAssetID(symbol string) string {
+	return "sim-" + strings.ToLower(symbol)
+}
+
+// simError reports failures the same way the Alpaca client does
+func simError(statusCode int, message string) error {
+	return &alpaca.APIError{StatusCode: statusCode, Message: message}
+}
+
+func newSimID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,370 @@
+package trading
+
+import (
+	"testing"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func decPtr(s string) *decimal.Decimal {
+	d := dec(s)
+	return &d
+}
+
+func newTestSim(cash string) *SimBroker {
+	feed := NewStaticPriceFeed(map[string]decimal.Decimal{"AAPL": dec("100")})
+	return NewSimBroker(feed, dec(cash))
+}
+
+func TestSimBrokerPlaceOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        alpaca.PlaceOrderRequest
+		wantStatus string
+		wantErr    bool
+	}{
+		{
+			name:       "market buy fills at the last price",
+			req:        alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day},
+			wantStatus: OrderStatusFilled,
+		},
+		{
+			name:       "limit buy below the price works",
+			req:        alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("95"), TimeInForce: alpaca.Day},
+			wantStatus: OrderStatusNew,
+		},
+		{
+			name:       "limit buy at the price fills",
+			req:        alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("100"), TimeInForce: alpaca.Day},
+			wantStatus: OrderStatusFilled,
+		},
+		{
+			name:       "stop buy above the price works",
+			req:        alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Stop, StopPrice: decPtr("105"), TimeInForce: alpaca.GTC},
+			wantStatus: OrderStatusNew,
+		},
+		{
+			name:       "ioc limit that cannot fill is canceled",
+			req:        alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("95"), TimeInForce: alpaca.IOC},
+			wantStatus: OrderStatusCanceled,
+		},
+		{
+			name:       "notional buy is sized at the last price",
+			req:        alpaca.PlaceOrderRequest{Symbol: "AAPL", Notional: decPtr("250"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day},
+			wantStatus: OrderStatusFilled,
+		},
+		{
+			name:    "buy beyond buying power",
+			req:     alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1000"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day},
+			wantErr: true,
+		},
+		{
+			name:    "sell without a position",
+			req:     alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Sell, Type: alpaca.Market, TimeInForce: alpaca.Day},
+			wantErr: true,
+		},
+		{
+			name:    "symbol without a price",
+			req:     alpaca.PlaceOrderRequest{Symbol: "MSFT", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day},
+			wantErr: true,
+		},
+		{
+			name:    "limit order without a limit price",
+			req:     alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Limit, TimeInForce: alpaca.Day},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newTestSim("10000")
+			order, err := sim.PlaceOrder(tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("PlaceOrder = %+v, want an error", order)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlaceOrder: %v", err)
+			}
+			if order.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", order.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSimBrokerFillsUpdateAccount(t *testing.T) {
+	sim := newTestSim("10000")
+	if _, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.SetPrice("AAPL", dec("110")); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := sim.GetAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !account.Cash.Equal(dec("9000")) {
+		t.Errorf("cash = %s, want 9000", account.Cash)
+	}
+	if !account.Equity.Equal(dec("10100")) {
+		t.Errorf("equity = %s, want 10100", account.Equity)
+	}
+
+	position, err := sim.GetPosition("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !position.Qty.Equal(dec("10")) || !position.AvgEntryPrice.Equal(dec("100")) {
+		t.Errorf("position = %s at %s, want 10 at 100", position.Qty, position.AvgEntryPrice)
+	}
+}
+
+func TestSimBrokerSetPrice(t *testing.T) {
+	tests := []struct {
+		name       string
+		price      string
+		wantStatus string
+		wantErr    bool
+	}{
+		{name: "above the limit", price: "96", wantStatus: OrderStatusNew},
+		{name: "at the limit", price: "95", wantStatus: OrderStatusFilled},
+		{name: "through the limit", price: "90", wantStatus: OrderStatusFilled},
+		{name: "zero", price: "0", wantStatus: OrderStatusNew, wantErr: true},
+		{name: "negative", price: "-1", wantStatus: OrderStatusNew, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newTestSim("10000")
+			order, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("95"), TimeInForce: alpaca.GTC})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = sim.SetPrice("aapl", dec(tt.price))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetPrice error = %v, want error %t", err, tt.wantErr)
+			}
+			got, err := sim.GetOrder(order.ID, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSimBrokerExpireDayOrders(t *testing.T) {
+	sim := newTestSim("10000")
+	day, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("90"), TimeInForce: alpaca.Day})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gtc, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("90"), TimeInForce: alpaca.GTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filled, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim.ExpireDayOrders()
+
+	for _, tt := range []struct {
+		name string
+		id   string
+		want string
+	}{
+		{name: "working day order", id: day.ID, want: OrderStatusExpired},
+		{name: "working gtc order", id: gtc.ID, want: OrderStatusNew},
+		{name: "filled day order", id: filled.ID, want: OrderStatusFilled},
+	} {
+		got, err := sim.GetOrder(tt.id, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.name, got.Status, tt.want)
+		}
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	sim := newTestSim("10000")
+	if got, ok := Simulator(WithMeta(sim, OrderMeta{Source: "test"})); !ok || got != sim {
+		t.Errorf("Simulator of a wrapped sim broker = %v, %t, want the sim broker", got, ok)
+	}
+	if _, ok := Simulator(NewAlpacaBroker("key", "secret", "http://localhost")); ok {
+		t.Error("Simulator of an Alpaca broker found a sim broker")
+	}
+}
+
+func TestSimBrokerBracket(t *testing.T) {
+	tests := []struct {
+		name           string
+		exitPrice      string
+		wantTakeProfit string
+		wantStopLoss   string
+	}{
+		{name: "take profit", exitPrice: "110", wantTakeProfit: OrderStatusFilled, wantStopLoss: OrderStatusCanceled},
+		{name: "stop loss", exitPrice: "90", wantTakeProfit: OrderStatusCanceled, wantStopLoss: OrderStatusFilled},
+		{name: "between the exits", exitPrice: "100", wantTakeProfit: OrderStatusNew, wantStopLoss: OrderStatusNew},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newTestSim("10000")
+			entry, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{
+				Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("95"), TimeInForce: alpaca.GTC,
+				OrderClass: alpaca.Bracket,
+				TakeProfit: &alpaca.TakeProfit{LimitPrice: decPtr("105")},
+				StopLoss:   &alpaca.StopLoss{StopPrice: decPtr("91")},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entry.Legs) != 2 || entry.Legs[0].Status != OrderStatusHeld || entry.Legs[1].Status != OrderStatusHeld {
+				t.Fatalf("legs = %+v, want two held legs", entry.Legs)
+			}
+
+			// The exits work once the entry fills
+			if err := sim.SetPrice("AAPL", dec("95")); err != nil {
+				t.Fatal(err)
+			}
+			if err := sim.SetPrice("AAPL", dec(tt.exitPrice)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := sim.GetOrder(entry.ID, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != OrderStatusFilled {
+				t.Errorf("entry status = %s, want filled", got.Status)
+			}
+			if got.Legs[0].Status != tt.wantTakeProfit {
+				t.Errorf("take profit status = %s, want %s", got.Legs[0].Status, tt.wantTakeProfit)
+			}
+			if got.Legs[1].Status != tt.wantStopLoss {
+				t.Errorf("stop loss status = %s, want %s", got.Legs[1].Status, tt.wantStopLoss)
+			}
+		})
+	}
+}
+
+func TestSimBrokerTrailingStop(t *testing.T) {
+	tests := []struct {
+		name       string
+		trail      func(*alpaca.PlaceOrderRequest)
+		prices     []string
+		wantStop   string
+		wantStatus string
+	}{
+		{
+			name:       "trail price follows the high",
+			trail:      func(r *alpaca.PlaceOrderRequest) { r.TrailPrice = decPtr("5") },
+			prices:     []string{"110", "107"},
+			wantStop:   "105",
+			wantStatus: OrderStatusNew,
+		},
+		{
+			name:       "trail price fills on the drop",
+			trail:      func(r *alpaca.PlaceOrderRequest) { r.TrailPrice = decPtr("5") },
+			prices:     []string{"110", "105"},
+			wantStop:   "105",
+			wantStatus: OrderStatusFilled,
+		},
+		{
+			name:       "trail percent of the high",
+			trail:      func(r *alpaca.PlaceOrderRequest) { r.TrailPercent = decPtr("10") },
+			prices:     []string{"120", "110"},
+			wantStop:   "108",
+			wantStatus: OrderStatusNew,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newTestSim("10000")
+			if _, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day}); err != nil {
+				t.Fatal(err)
+			}
+			req := alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Sell, Type: alpaca.TrailingStop, TimeInForce: alpaca.GTC}
+			tt.trail(&req)
+			order, err := sim.PlaceOrder(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, price := range tt.prices {
+				if err := sim.SetPrice("AAPL", dec(price)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := sim.GetOrder(order.ID, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			if got.StopPrice == nil || !got.StopPrice.Equal(dec(tt.wantStop)) {
+				t.Errorf("stop price = %v, want %s", got.StopPrice, tt.wantStop)
+			}
+		})
+	}
+}
+
+func TestSimBrokerReplaceOrder(t *testing.T) {
+	sim := newTestSim("10000")
+	order, err := sim.PlaceOrder(alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("95"), TimeInForce: alpaca.Day})
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+
+	if _, err := ReplaceOrder(sim, order.ID, alpaca.ReplaceOrderRequest{StopPrice: decPtr("90")}); err == nil {
+		t.Fatal("ReplaceOrder() with a stop price on a limit order succeeded, want an error")
+	}
+	if _, err := sim.ReplaceOrder(order.ID, alpaca.ReplaceOrderRequest{Qty: decPtr("1000")}); err == nil {
+		t.Fatal("ReplaceOrder() beyond buying power succeeded, want an error")
+	}
+
+	replaced, err := ReplaceOrder(sim, order.ID, alpaca.ReplaceOrderRequest{LimitPrice: decPtr("100")})
+	if err != nil {
+		t.Fatalf("ReplaceOrder() error = %v", err)
+	}
+	if replaced.ID == order.ID {
+		t.Fatal("ReplaceOrder() returned the original order, want a new one")
+	}
+	if replaced.Status != OrderStatusFilled {
+		t.Errorf("replacement status = %s, want %s", replaced.Status, OrderStatusFilled)
+	}
+
+	original, err := sim.GetOrder(order.ID, false)
+	if err != nil {
+		t.Fatalf("GetOrder() error = %v", err)
+	}
+	if original.Status != OrderStatusReplaced {
+		t.Errorf("original status = %s, want %s", original.Status, OrderStatusReplaced)
+	}
+	if original.ReplacedBy == nil || *original.ReplacedBy != replaced.ID {
+		t.Errorf("original replaced_by = %v, want %s", original.ReplacedBy, replaced.ID)
+	}
+	if _, err := sim.ReplaceOrder(order.ID, alpaca.ReplaceOrderRequest{LimitPrice: decPtr("99")}); err == nil {
+		t.Error("ReplaceOrder() of a replaced order succeeded, want an error")
+	}
+}
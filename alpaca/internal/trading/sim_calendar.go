@@ -0,0 +1,166 @@
+package trading
+
+import (
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+// The simulated market keeps the NYSE's regular sessions: 9:30 to 16:00 New
+// York time on weekdays, closing at 13:00 on the usual early close days and
+// shut on the exchange's recurring holidays. One-off closures, such as days
+// of mourning, are not known to it.
+
+// simSession returns the regular session on the New York date of day. ok is
+// false on weekends and holidays.
+func simSession(day time.Time) (open, close time.Time, ok bool) {
+	date := nyDate(day)
+	if isWeekend(date) || isHoliday(date) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	y, m, d := date.Date()
+	open = time.Date(y, m, d, 9, 30, 0, 0, utils.NewYork)
+	close = time.Date(y, m, d, 16, 0, 0, 0, utils.NewYork)
+	if isEarlyClose(date) {
+		close = time.Date(y, m, d, 13, 0, 0, 0, utils.NewYork)
+	}
+	return open, close, true
+}
+
+// simClock reports whether the simulated market is open at now and when its
+// next session opens and closes
+func simClock(now time.Time) alpaca.Clock {
+	now = now.In(utils.NewYork)
+	clock := alpaca.Clock{Timestamp: now}
+
+	for day := now; clock.NextOpen.IsZero() || clock.NextClose.IsZero(); day = day.AddDate(0, 0, 1) {
+		open, close, ok := simSession(day)
+		if !ok {
+			continue
+		}
+		if day.Equal(now) && !now.Before(open) && now.Before(close) {
+			clock.IsOpen = true
+		}
+		if clock.NextOpen.IsZero() && open.After(now) {
+			clock.NextOpen = open
+		}
+		if clock.NextClose.IsZero() && close.After(now) {
+			clock.NextClose = close
+		}
+	}
+
+	return clock
+}
+
+// simCalendar lists the sessions between the New York dates of start and end
+func simCalendar(start, end time.Time) []alpaca.CalendarDay {
+	days := []alpaca.CalendarDay{}
+	last := nyDate(end)
+	for day := nyDate(start); !day.After(last); day = day.AddDate(0, 0, 1) {
+		open, close, ok := simSession(day)
+		if !ok {
+			continue
+		}
+		days = append(days, alpaca.CalendarDay{
+			Date:  day.Format("2006-01-02"),
+			Open:  open.Format("15:04"),
+			Close: close.Format("15:04"),
+		})
+	}
+	return days
+}
+
+// nyDate returns midnight in New York on the New York date of t
+func nyDate(t time.Time) time.Time {
+	y, m, d := t.In(utils.NewYork).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, utils.NewYork)
+}
+
+// isHoliday reports whether the exchange is shut for a holiday on date, a New
+// York midnight
+func isHoliday(date time.Time) bool {
+	y := date.Year()
+	holidays := []time.Time{
+		// A New Year's Day on a Saturday is not made up on the Friday before
+		observedHoliday(y, time.January, 1),
+		nthWeekday(y, time.January, time.Monday, 3),
+		nthWeekday(y, time.February, time.Monday, 3),
+		easter(y).AddDate(0, 0, -2),
+		// Memorial Day, the last Monday of May
+		nthWeekday(y, time.June, time.Monday, 1).AddDate(0, 0, -7),
+		observedHoliday(y, time.July, 4),
+		nthWeekday(y, time.September, time.Monday, 1),
+		nthWeekday(y, time.November, time.Thursday, 4),
+		observedHoliday(y, time.December, 25),
+	}
+	if y >= 2022 {
+		holidays = append(holidays, observedHoliday(y, time.June, 19))
+	}
+
+	for _, holiday := range holidays {
+		if date.Equal(holiday) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEarlyClose reports whether the exchange closes at 13:00 on date: the day
+// after Thanksgiving, and the 3rd of July and Christmas Eve when they fall on
+// a weekday before the holiday
+func isEarlyClose(date time.Time) bool {
+	y, m, d := date.Date()
+	weekdayBefore := date.Weekday() >= time.Monday && date.Weekday() <= time.Thursday
+
+	switch {
+	case date.Equal(nthWeekday(y, time.November, time.Thursday, 4).AddDate(0, 0, 1)):
+		return true
+	case m == time.July && d == 3:
+		return weekdayBefore
+	case m == time.December && d == 24:
+		return weekdayBefore
+	}
+	return false
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// observedHoliday returns the weekday a fixed date holiday is observed on:
+// the Friday before when it falls on a Saturday, the Monday after on a Sunday
+func observedHoliday(year int, month time.Month, day int) time.Time {
+	date := time.Date(year, month, day, 0, 0, 0, 0, utils.NewYork)
+	switch date.Weekday() {
+	case time.Saturday:
+		return date.AddDate(0, 0, -1)
+	case time.Sunday:
+		return date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// nthWeekday returns the nth weekday of a month, counting from 1
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, utils.NewYork)
+	offset := (int(weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+(n-1)*7)
+}
+
+// easter returns Easter Sunday of the Gregorian calendar year
+func easter(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, utils.NewYork)
+}
@@ -0,0 +1,181 @@
+package trading
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/nathgoh/investment-trader/alpaca/internal/utils"
+)
+
+func TestSimCalendar(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, utils.NewYork)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []alpaca.CalendarDay
+	}{
+		{
+			name:  "thanksgiving week",
+			start: date(2024, time.November, 27),
+			end:   date(2024, time.December, 2),
+			want: []alpaca.CalendarDay{
+				{Date: "2024-11-27", Open: "09:30", Close: "16:00"},
+				{Date: "2024-11-29", Open: "09:30", Close: "13:00"},
+				{Date: "2024-12-02", Open: "09:30", Close: "16:00"},
+			},
+		},
+		{
+			name:  "christmas eve closes early",
+			start: date(2024, time.December, 24),
+			end:   date(2024, time.December, 26),
+			want: []alpaca.CalendarDay{
+				{Date: "2024-12-24", Open: "09:30", Close: "13:00"},
+				{Date: "2024-12-26", Open: "09:30", Close: "16:00"},
+			},
+		},
+		{
+			name:  "independence day on a saturday is observed on friday",
+			start: date(2026, time.July, 2),
+			end:   date(2026, time.July, 6),
+			want: []alpaca.CalendarDay{
+				{Date: "2026-07-02", Open: "09:30", Close: "16:00"},
+				{Date: "2026-07-06", Open: "09:30", Close: "16:00"},
+			},
+		},
+		{
+			name:  "third of july closes early",
+			start: date(2025, time.July, 3),
+			end:   date(2025, time.July, 4),
+			want:  []alpaca.CalendarDay{{Date: "2025-07-03", Open: "09:30", Close: "13:00"}},
+		},
+		{
+			name:  "good friday",
+			start: date(2025, time.April, 17),
+			end:   date(2025, time.April, 18),
+			want:  []alpaca.CalendarDay{{Date: "2025-04-17", Open: "09:30", Close: "16:00"}},
+		},
+		{
+			name:  "memorial day",
+			start: date(2025, time.May, 23),
+			end:   date(2025, time.May, 27),
+			want: []alpaca.CalendarDay{
+				{Date: "2025-05-23", Open: "09:30", Close: "16:00"},
+				{Date: "2025-05-27", Open: "09:30", Close: "16:00"},
+			},
+		},
+		{
+			name:  "juneteenth",
+			start: date(2025, time.June, 18),
+			end:   date(2025, time.June, 20),
+			want: []alpaca.CalendarDay{
+				{Date: "2025-06-18", Open: "09:30", Close: "16:00"},
+				{Date: "2025-06-20", Open: "09:30", Close: "16:00"},
+			},
+		},
+		{
+			name:  "new year's day on a saturday is not observed",
+			start: date(2021, time.December, 31),
+			end:   date(2022, time.January, 3),
+			want: []alpaca.CalendarDay{
+				{Date: "2021-12-31", Open: "09:30", Close: "16:00"},
+				{Date: "2022-01-03", Open: "09:30", Close: "16:00"},
+			},
+		},
+		{
+			name:  "new year's day on a sunday is observed on monday",
+			start: date(2023, time.January, 2),
+			end:   date(2023, time.January, 3),
+			want:  []alpaca.CalendarDay{{Date: "2023-01-03", Open: "09:30", Close: "16:00"}},
+		},
+		{
+			name:  "dates are taken in new york",
+			start: time.Date(2024, time.March, 12, 2, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, time.March, 12, 2, 0, 0, 0, time.UTC),
+			want:  []alpaca.CalendarDay{{Date: "2024-03-11", Open: "09:30", Close: "16:00"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := simCalendar(tt.start, tt.end)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("simCalendar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimClock(t *testing.T) {
+	at := func(y int, m time.Month, d, hour, min int) time.Time {
+		return time.Date(y, m, d, hour, min, 0, 0, utils.NewYork)
+	}
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		wantOpen      bool
+		wantNextOpen  time.Time
+		wantNextClose time.Time
+	}{
+		{
+			name:          "before the open",
+			now:           at(2024, time.November, 26, 8, 0),
+			wantNextOpen:  at(2024, time.November, 26, 9, 30),
+			wantNextClose: at(2024, time.November, 26, 16, 0),
+		},
+		{
+			name:          "during the session",
+			now:           at(2024, time.November, 26, 12, 0),
+			wantOpen:      true,
+			wantNextOpen:  at(2024, time.November, 27, 9, 30),
+			wantNextClose: at(2024, time.November, 26, 16, 0),
+		},
+		{
+			name:          "after the close skips the holiday",
+			now:           at(2024, time.November, 27, 17, 0),
+			wantNextOpen:  at(2024, time.November, 29, 9, 30),
+			wantNextClose: at(2024, time.November, 29, 13, 0),
+		},
+		{
+			name:          "after an early close",
+			now:           at(2024, time.November, 29, 14, 0),
+			wantNextOpen:  at(2024, time.December, 2, 9, 30),
+			wantNextClose: at(2024, time.December, 2, 16, 0),
+		},
+		{
+			name:          "on a holiday",
+			now:           at(2024, time.December, 25, 12, 0),
+			wantNextOpen:  at(2024, time.December, 26, 9, 30),
+			wantNextClose: at(2024, time.December, 26, 16, 0),
+		},
+		{
+			name:          "on a weekend",
+			now:           at(2024, time.November, 30, 12, 0),
+			wantNextOpen:  at(2024, time.December, 2, 9, 30),
+			wantNextClose: at(2024, time.December, 2, 16, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := simClock(tt.now.UTC())
+			if clock.IsOpen != tt.wantOpen {
+				t.Errorf("IsOpen = %v, want %v", clock.IsOpen, tt.wantOpen)
+			}
+			if !clock.NextOpen.Equal(tt.wantNextOpen) {
+				t.Errorf("NextOpen = %v, want %v", clock.NextOpen, tt.wantNextOpen)
+			}
+			if !clock.NextClose.Equal(tt.wantNextClose) {
+				t.Errorf("NextClose = %v, want %v", clock.NextClose, tt.wantNextClose)
+			}
+			if clock.Timestamp.Location() != utils.NewYork {
+				t.Errorf("Timestamp is in %v, want America/New_York", clock.Timestamp.Location())
+			}
+		})
+	}
+}
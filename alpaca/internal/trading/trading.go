@@ -1,80 +1,54 @@
 package trading
 
 import (
-	"log"
-	"os"
+	"errors"
+	"net/http"
 	"time"
 
 	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
-	"github.com/joho/godotenv"
 	"github.com/shopspring/decimal"
 )
 
-var (
-	paperClient *alpaca.Client
-	liveClient  *alpaca.Client
-)
-
-// Initialize clients
-func init() {
-	// Load .env file
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Println("Warning: Error loading .env file")
-	}
-
-	// Initialize paper trading client
-	paperAPIKey := os.Getenv("ALPACA_PAPER_API_KEY")
-	paperAPISecret := os.Getenv("ALPACA_PAPER_SECRET_KEY")
-	if paperAPIKey != "" && paperAPISecret != "" {
-		paperClient = alpaca.NewClient(alpaca.ClientOpts{
-			APIKey:    paperAPIKey,
-			APISecret: paperAPISecret,
-			BaseURL:   "https://paper-api.alpaca.markets",
-		})
-	}
-
-	// Initialize live trading client
-	liveAPIKey := os.Getenv("ALPACA_LIVE_API_KEY")
-	liveAPISecret := os.Getenv("ALPACA_LIVE_API_SECRET_KEY")
-	if liveAPIKey != "" && liveAPISecret != "" {
-		liveClient = alpaca.NewClient(alpaca.ClientOpts{
-			APIKey:    liveAPIKey,
-			APISecret: liveAPISecret,
-			BaseURL:   "https://api.alpaca.markets",
-		})
-	}
-}
-
-// GetClient returns the appropriate client based on the isPaper flag
-func GetClient(isPaper bool) *alpaca.Client {
-	if isPaper {
-		return paperClient
+// PlaceOrder validates and places a new order
+func PlaceOrder(broker Broker, req alpaca.PlaceOrderRequest) (*alpaca.Order, error) {
+	if err := ValidateOrder(req); err != nil {
+		return nil, err
 	}
-	return liveClient
-}
 
-// PlaceOrder places a new order
-func PlaceOrder(isPaper bool, symbol string, qty decimal.Decimal, side alpaca.Side, orderType alpaca.OrderType, timeInForce alpaca.TimeInForce, limitPrice, stopPrice *decimal.Decimal) (*alpaca.Order, error) {
-	client := GetClient(isPaper)
-	
-	req := alpaca.PlaceOrderRequest{
-		Symbol:      symbol,
-		Qty:         &qty,
-		Side:        side,
-		Type:        orderType,
-		TimeInForce: timeInForce,
+	// Only notional and fractional orders depend on the asset
+	if req.Notional != nil || IsFractional(*req.Qty) {
+		asset, err := broker.GetAsset(req.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateFractionable(req, asset); err != nil {
+			return nil, err
+		}
 	}
 
-	if limitPrice != nil {
-		req.LimitPrice = limitPrice
-	}
-	if stopPrice != nil {
-		req.StopPrice = stopPrice
+	// A client order ID makes submission idempotent: a retry returns the
+	// order the first attempt placed instead of placing another one
+	if req.ClientOrderID != "" {
+		existing, err := GetOrderByClientOrderID(broker, req.ClientOrderID)
+		if err == nil {
+			observeDuplicate(broker, req, existing)
+			return existing, nil
+		}
+		if !isNotFound(err) {
+			return nil, err
+		}
 	}
 
-	order, err := client.PlaceOrder(req)
+	order, err := broker.PlaceOrder(req)
 	if err != nil {
+		// A concurrent retry may have won the race to place the order, in
+		// which case the broker rejects this one as a duplicate
+		if req.ClientOrderID != "" {
+			if existing, lookupErr := GetOrderByClientOrderID(broker, req.ClientOrderID); lookupErr == nil {
+				observeDuplicate(broker, req, existing)
+				return existing, nil
+			}
+		}
 		return nil, err
 	}
 
@@ -82,11 +56,9 @@ func PlaceOrder(isPaper bool, symbol string, qty decimal.Decimal, side alpaca.Si
 }
 
 // GetOrders retrieves orders with optional filters
-func GetOrders(isPaper bool, status *string, limit *int, after, until *time.Time, direction *string, nested *bool, symbols *string) ([]alpaca.Order, error) {
-	client := GetClient(isPaper)
-	
+func GetOrders(broker Broker, status *string, limit *int, after, until *time.Time, direction *string, nested *bool, symbols *string) ([]alpaca.Order, error) {
 	req := alpaca.GetOrdersRequest{}
-	
+
 	if status != nil {
 		req.Status = *status
 	}
@@ -107,7 +79,7 @@ func GetOrders(isPaper bool, status *string, limit *int, after, until *time.Time
 	}
 	// Note: Symbols filter not supported in this version
 
-	orders, err := client.GetOrders(req)
+	orders, err := broker.GetOrders(req)
 	if err != nil {
 		return nil, err
 	}
@@ -115,11 +87,49 @@ func GetOrders(isPaper bool, status *string, limit *int, after, until *time.Time
 	return orders, nil
 }
 
-// GetOrder retrieves a single order by ID
-func GetOrder(isPaper bool, orderID string, nested bool) (*alpaca.Order, error) {
-	client := GetClient(isPaper)
-	
-	order, err := client.GetOrder(orderID)
+// GetOrder retrieves a single order by ID, including its legs when nested
+func GetOrder(broker Broker, orderID string, nested bool) (*alpaca.Order, error) {
+	order, err := broker.GetOrder(orderID, nested)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetOrderByClientOrderID retrieves a single order by the client order ID it
+// was submitted with
+func GetOrderByClientOrderID(broker Broker, clientOrderID string) (*alpaca.Order, error) {
+	order, err := broker.GetOrderByClientOrderID(clientOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// ReplaceOrder changes the quantity, prices or time in force of a working
+// order. The broker cancels the original and returns the order replacing it.
+func ReplaceOrder(broker Broker, orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error) {
+	original, err := broker.GetOrder(orderID, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateReplace(original, req); err != nil {
+		return nil, err
+	}
+
+	if req.Qty != nil && IsFractional(*req.Qty) {
+		asset, err := broker.GetAsset(original.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateFractionable(alpaca.PlaceOrderRequest{Qty: req.Qty}, asset); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err := broker.ReplaceOrder(orderID, req)
 	if err != nil {
 		return nil, err
 	}
@@ -128,10 +138,8 @@ func GetOrder(isPaper bool, orderID string, nested bool) (*alpaca.Order, error)
 }
 
 // CancelOrder cancels an order by ID
-func CancelOrder(isPaper bool, orderID string) error {
-	client := GetClient(isPaper)
-	
-	err := client.CancelOrder(orderID)
+func CancelOrder(broker Broker, orderID string) error {
+	err := broker.CancelOrder(orderID)
 	if err != nil {
 		return err
 	}
@@ -140,10 +148,8 @@ func CancelOrder(isPaper bool, orderID string) error {
 }
 
 // CancelAllOrders cancels all open orders
-func CancelAllOrders(isPaper bool) error {
-	client := GetClient(isPaper)
-	
-	err := client.CancelAllOrders()
+func CancelAllOrders(broker Broker) error {
+	err := broker.CancelAllOrders()
 	if err != nil {
 		return err
 	}
@@ -152,10 +158,8 @@ func CancelAllOrders(isPaper bool) error {
 }
 
 // GetPositions retrieves all positions
-func GetPositions(isPaper bool) ([]alpaca.Position, error) {
-	client := GetClient(isPaper)
-	
-	positions, err := client.GetPositions()
+func GetPositions(broker Broker) ([]alpaca.Position, error) {
+	positions, err := broker.GetPositions()
 	if err != nil {
 		return nil, err
 	}
@@ -164,10 +168,8 @@ func GetPositions(isPaper bool) ([]alpaca.Position, error) {
 }
 
 // GetPosition retrieves a single position by symbol
-func GetPosition(isPaper bool, symbol string) (*alpaca.Position, error) {
-	client := GetClient(isPaper)
-	
-	position, err := client.GetPosition(symbol)
+func GetPosition(broker Broker, symbol string) (*alpaca.Position, error) {
+	position, err := broker.GetPosition(symbol)
 	if err != nil {
 		return nil, err
 	}
@@ -176,9 +178,7 @@ func GetPosition(isPaper bool, symbol string) (*alpaca.Position, error) {
 }
 
 // ClosePosition closes a position for a symbol
-func ClosePosition(isPaper bool, symbol string, qty *decimal.Decimal, percentage *decimal.Decimal) (*alpaca.Order, error) {
-	client := GetClient(isPaper)
-	
+func ClosePosition(broker Broker, symbol string, qty *decimal.Decimal, percentage *decimal.Decimal) (*alpaca.Order, error) {
 	req := alpaca.ClosePositionRequest{}
 	if qty != nil {
 		req.Qty = *qty
@@ -187,7 +187,7 @@ func ClosePosition(isPaper bool, symbol string, qty *decimal.Decimal, percentage
 		req.Percentage = *percentage
 	}
 
-	order, err := client.ClosePosition(symbol, req)
+	order, err := broker.ClosePosition(symbol, req)
 	if err != nil {
 		return nil, err
 	}
@@ -196,14 +196,12 @@ func ClosePosition(isPaper bool, symbol string, qty *decimal.Decimal, percentage
 }
 
 // CloseAllPositions closes all positions
-func CloseAllPositions(isPaper bool, cancelOrders bool) ([]alpaca.Order, error) {
-	client := GetClient(isPaper)
-	
+func CloseAllPositions(broker Broker, cancelOrders bool) ([]alpaca.Order, error) {
 	req := alpaca.CloseAllPositionsRequest{
 		CancelOrders: cancelOrders,
 	}
-	
-	responses, err := client.CloseAllPositions(req)
+
+	responses, err := broker.CloseAllPositions(req)
 	if err != nil {
 		return nil, err
 	}
@@ -211,14 +209,18 @@ func CloseAllPositions(isPaper bool, cancelOrders bool) ([]alpaca.Order, error)
 	return responses, nil
 }
 
-// GetAssets retrieves all assets
-func GetAssets(status, assetClass *string) ([]alpaca.Asset, error) {
-	// Use paper client for asset queries (same for both)
-	client := paperClient
-	if client == nil {
-		client = liveClient
+// GetAccount retrieves the account behind a broker
+func GetAccount(broker Broker) (*alpaca.Account, error) {
+	account, err := broker.GetAccount()
+	if err != nil {
+		return nil, err
 	}
-	
+
+	return account, nil
+}
+
+// GetAssets retrieves all assets
+func GetAssets(broker Broker, status, assetClass *string) ([]alpaca.Asset, error) {
 	req := alpaca.GetAssetsRequest{}
 	if status != nil {
 		req.Status = *status
@@ -227,7 +229,7 @@ func GetAssets(status, assetClass *string) ([]alpaca.Asset, error) {
 		req.AssetClass = *assetClass
 	}
 
-	assets, err := client.GetAssets(req)
+	assets, err := broker.GetAssets(req)
 	if err != nil {
 		return nil, err
 	}
@@ -236,14 +238,8 @@ func GetAssets(status, assetClass *string) ([]alpaca.Asset, error) {
 }
 
 // GetAsset retrieves a single asset by symbol
-func GetAsset(symbol string) (*alpaca.Asset, error) {
-	// Use paper client for asset queries (same for both)
-	client := paperClient
-	if client == nil {
-		client = liveClient
-	}
-	
-	asset, err := client.GetAsset(symbol)
+func GetAsset(broker Broker, symbol string) (*alpaca.Asset, error) {
+	asset, err := broker.GetAsset(symbol)
 	if err != nil {
 		return nil, err
 	}
@@ -252,14 +248,8 @@ func GetAsset(symbol string) (*alpaca.Asset, error) {
 }
 
 // GetClock retrieves the market clock
-func GetClock() (*alpaca.Clock, error) {
-	// Use paper client for clock queries (same for both)
-	client := paperClient
-	if client == nil {
-		client = liveClient
-	}
-	
-	clock, err := client.GetClock()
+func GetClock(broker Broker) (*alpaca.Clock, error) {
+	clock, err := broker.GetClock()
 	if err != nil {
 		return nil, err
 	}
@@ -268,13 +258,7 @@ func GetClock() (*alpaca.Clock, error) {
 }
 
 // GetCalendar retrieves the market calendar
-func GetCalendar(start, end *time.Time) ([]alpaca.CalendarDay, error) {
-	// Use paper client for calendar queries (same for both)
-	client := paperClient
-	if client == nil {
-		client = liveClient
-	}
-	
+func GetCalendar(broker Broker, start, end *time.Time) ([]alpaca.CalendarDay, error) {
 	req := alpaca.GetCalendarRequest{}
 	if start != nil {
 		req.Start = *start
@@ -283,10 +267,17 @@ func GetCalendar(start, end *time.Time) ([]alpaca.CalendarDay, error) {
 		req.End = *end
 	}
 
-	calendar, err := client.GetCalendar(req)
+	calendar, err := broker.GetCalendar(req)
 	if err != nil {
 		return nil, err
 	}
 
 	return calendar, nil
 }
+
+// isNotFound reports whether a broker error means the requested resource
+// does not exist
+func isNotFound(err error) bool {
+	var apiErr *alpaca.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,98 @@
+package trading
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// racingBroker misses the first client order ID lookup, as if a concurrent
+// retry placed its order between the lookup and the submission
+type racingBroker struct {
+	*SimBroker
+	lookups int
+}
+
+func (b *racingBroker) GetOrderByClientOrderID(clientOrderID string) (*alpaca.Order, error) {
+	b.lookups++
+	if b.lookups == 1 {
+		return nil, simError(http.StatusNotFound, "order not found")
+	}
+	return b.SimBroker.GetOrderByClientOrderID(clientOrderID)
+}
+
+func TestPlaceOrderIdempotency(t *testing.T) {
+	buy := func(clientOrderID string) alpaca.PlaceOrderRequest {
+		return alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("95"), TimeInForce: alpaca.Day, ClientOrderID: clientOrderID}
+	}
+
+	tests := []struct {
+		name      string
+		first     string
+		second    string
+		wantSame  bool
+		wantCount int
+	}{
+		{name: "retry with the same client order id", first: "retry-1", second: "retry-1", wantSame: true, wantCount: 1},
+		{name: "different client order ids", first: "order-1", second: "order-2", wantCount: 2},
+		{name: "no client order id", wantCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newTestSim("10000")
+			first, err := PlaceOrder(sim, buy(tt.first))
+			if err != nil {
+				t.Fatalf("first PlaceOrder() error = %v", err)
+			}
+			second, err := PlaceOrder(sim, buy(tt.second))
+			if err != nil {
+				t.Fatalf("second PlaceOrder() error = %v", err)
+			}
+			if same := first.ID == second.ID; same != tt.wantSame {
+				t.Errorf("same order = %t, want %t", same, tt.wantSame)
+			}
+
+			orders, err := sim.GetOrders(alpaca.GetOrdersRequest{Status: "all"})
+			if err != nil {
+				t.Fatalf("GetOrders() error = %v", err)
+			}
+			if len(orders) != tt.wantCount {
+				t.Errorf("placed %d orders, want %d", len(orders), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderConcurrentRetry(t *testing.T) {
+	req := alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Limit, LimitPrice: decPtr("95"), TimeInForce: alpaca.Day, ClientOrderID: "retry-1"}
+
+	broker := &racingBroker{SimBroker: newTestSim("10000")}
+	existing, err := broker.SimBroker.PlaceOrder(req)
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+
+	order, err := PlaceOrder(broker, req)
+	if err != nil {
+		t.Fatalf("PlaceOrder() retry error = %v", err)
+	}
+	if order.ID != existing.ID {
+		t.Errorf("retry returned order %s, want the existing %s", order.ID, existing.ID)
+	}
+}
+
+func TestPlaceOrderClientOrderIDLength(t *testing.T) {
+	req := alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("1"), Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day}
+
+	req.ClientOrderID = strings.Repeat("a", maxClientOrderIDLength)
+	if _, err := PlaceOrder(newTestSim("10000"), req); err != nil {
+		t.Fatalf("PlaceOrder() with a %d character client order id error = %v", maxClientOrderIDLength, err)
+	}
+
+	req.ClientOrderID = strings.Repeat("a", maxClientOrderIDLength+1)
+	_, err := PlaceOrder(newTestSim("10000"), req)
+	checkValidation(t, err, "client_order_id must be at most 128 characters")
+}
@@ -0,0 +1,290 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+)
+
+// maxClientOrderIDLength is the longest client order ID Alpaca accepts
+const maxClientOrderIDLength = 128
+
+// ErrInvalidOrder is wrapped by every order validation failure
+var ErrInvalidOrder = errors.New("invalid order")
+
+func invalidOrder(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidOrder, fmt.Sprintf(format, args...))
+}
+
+// ValidateOrder checks an order request against Alpaca's rules before it is
+// sent, so obviously malformed orders fail fast with a clear reason
+func ValidateOrder(req alpaca.PlaceOrderRequest) error {
+	if len(req.ClientOrderID) > maxClientOrderIDLength {
+		return invalidOrder("client_order_id must be at most %d characters", maxClientOrderIDLength)
+	}
+	if err := validateQuantity(req); err != nil {
+		return err
+	}
+	if err := validateTrailingStop(req); err != nil {
+		return err
+	}
+	return validateOrderClass(req)
+}
+
+// validateQuantity checks that an order is sized by exactly one of qty or
+// notional, and that notional and fractional orders stick to the order types
+// and time in force Alpaca allows for them
+func validateQuantity(req alpaca.PlaceOrderRequest) error {
+	if (req.Qty == nil) == (req.Notional == nil) {
+		return invalidOrder("exactly one of qty or notional is required")
+	}
+	if req.Qty != nil && !req.Qty.IsPositive() {
+		return invalidOrder("qty must be greater than zero")
+	}
+	if req.Notional != nil && !req.Notional.IsPositive() {
+		return invalidOrder("notional must be greater than zero")
+	}
+
+	var kind string
+	switch {
+	case req.Notional != nil:
+		kind = "notional"
+		if req.Type != alpaca.Market {
+			return invalidOrder("notional orders must be of type market")
+		}
+	case IsFractional(*req.Qty):
+		kind = "fractional"
+		switch req.Type {
+		case alpaca.Market, alpaca.Limit, alpaca.Stop, alpaca.StopLimit:
+		default:
+			return invalidOrder("fractional orders must be market, limit, stop or stop_limit")
+		}
+	default:
+		return nil
+	}
+
+	if req.TimeInForce != alpaca.Day {
+		return invalidOrder("%s orders only support day time_in_force", kind)
+	}
+	if req.OrderClass != "" && req.OrderClass != alpaca.Simple {
+		return invalidOrder("%s orders must use the simple order_class", kind)
+	}
+
+	return nil
+}
+
+// ValidateFractionable rejects notional and fractional orders for assets
+// Alpaca does not trade in fractions
+func ValidateFractionable(req alpaca.PlaceOrderRequest, asset *alpaca.Asset) error {
+	if req.Notional == nil && (req.Qty == nil || !IsFractional(*req.Qty)) {
+		return nil
+	}
+	if !asset.Fractionable {
+		return invalidOrder("%s is not fractionable, orders must use a whole share qty", asset.Symbol)
+	}
+	return nil
+}
+
+// IsFractional reports whether qty is not a whole number of shares
+func IsFractional(qty decimal.Decimal) bool {
+	return !qty.Equal(qty.Truncate(0))
+}
+
+// validateTrailingStop checks the trail of trailing_stop orders and that no
+// other order type sets one
+func validateTrailingStop(req alpaca.PlaceOrderRequest) error {
+	if req.Type != alpaca.TrailingStop {
+		if req.TrailPrice != nil || req.TrailPercent != nil {
+			return invalidOrder("trail_price and trail_percent are only valid for trailing_stop orders")
+		}
+		return nil
+	}
+
+	if (req.TrailPrice == nil) == (req.TrailPercent == nil) {
+		return invalidOrder("trailing_stop orders require exactly one of trail_price or trail_percent")
+	}
+	if req.TrailPrice != nil && !req.TrailPrice.IsPositive() {
+		return invalidOrder("trail_price must be greater than zero")
+	}
+	if req.TrailPercent != nil && (!req.TrailPercent.IsPositive() || req.TrailPercent.GreaterThanOrEqual(decimal.NewFromInt(100))) {
+		return invalidOrder("trail_percent must be greater than zero and less than 100")
+	}
+	if req.LimitPrice != nil || req.StopPrice != nil {
+		return invalidOrder("trailing_stop orders cannot set limit_price or stop_price")
+	}
+	if req.OrderClass != "" && req.OrderClass != alpaca.Simple {
+		return invalidOrder("trailing_stop orders must use the simple order_class")
+	}
+	if req.TimeInForce != alpaca.Day && req.TimeInForce != alpaca.GTC {
+		return invalidOrder("trailing_stop orders only support day or gtc time_in_force")
+	}
+	if req.ExtendedHours {
+		return invalidOrder("trailing_stop orders cannot trade in extended hours")
+	}
+
+	return nil
+}
+
+// validateOrderClass checks the take-profit and stop-loss legs of bracket,
+// oco and oto orders
+func validateOrderClass(req alpaca.PlaceOrderRequest) error {
+	if req.TakeProfit != nil && req.TakeProfit.LimitPrice == nil {
+		return invalidOrder("take_profit.limit_price is required")
+	}
+	if req.StopLoss != nil && req.StopLoss.StopPrice == nil {
+		return invalidOrder("stop_loss.stop_price is required")
+	}
+
+	switch req.OrderClass {
+	case "", alpaca.Simple:
+		if req.TakeProfit != nil || req.StopLoss != nil {
+			return invalidOrder("take_profit and stop_loss require a bracket, oco or oto order_class")
+		}
+		return nil
+	case alpaca.Bracket:
+		if req.TakeProfit == nil || req.StopLoss == nil {
+			return invalidOrder("bracket orders require both take_profit and stop_loss")
+		}
+		if req.Type != alpaca.Market && req.Type != alpaca.Limit {
+			return invalidOrder("bracket entry orders must be market or limit")
+		}
+	case alpaca.OCO:
+		if req.TakeProfit == nil || req.StopLoss == nil {
+			return invalidOrder("oco orders require both take_profit and stop_loss")
+		}
+		if req.Type != alpaca.Limit {
+			return invalidOrder("oco orders must be of type limit")
+		}
+	case alpaca.OTO:
+		if (req.TakeProfit == nil) == (req.StopLoss == nil) {
+			return invalidOrder("oto orders require exactly one of take_profit or stop_loss")
+		}
+		if req.Type != alpaca.Market && req.Type != alpaca.Limit {
+			return invalidOrder("oto entry orders must be market or limit")
+		}
+	default:
+		return invalidOrder("invalid order_class %q", req.OrderClass)
+	}
+
+	if req.TimeInForce != alpaca.Day && req.TimeInForce != alpaca.GTC {
+		return invalidOrder("%s orders only support day or gtc time_in_force", req.OrderClass)
+	}
+	if req.ExtendedHours {
+		return invalidOrder("%s orders cannot trade in extended hours", req.OrderClass)
+	}
+
+	// The exit legs sit on the opposite side of the entry, except for oco
+	// where both legs are themselves exits on the order's side
+	exitSide := alpaca.Sell
+	if req.Side == alpaca.Sell {
+		exitSide = alpaca.Buy
+	}
+	if req.OrderClass == alpaca.OCO {
+		exitSide = req.Side
+	}
+
+	if req.TakeProfit != nil && req.StopLoss != nil {
+		takeProfit, stopPrice := *req.TakeProfit.LimitPrice, *req.StopLoss.StopPrice
+		if exitSide == alpaca.Sell && !takeProfit.GreaterThan(stopPrice) {
+			return invalidOrder("take_profit.limit_price must be above stop_loss.stop_price when exiting a long position")
+		}
+		if exitSide == alpaca.Buy && !takeProfit.LessThan(stopPrice) {
+			return invalidOrder("take_profit.limit_price must be below stop_loss.stop_price when exiting a short position")
+		}
+	}
+
+	if req.StopLoss != nil && req.StopLoss.LimitPrice != nil {
+		limitPrice, stopPrice := *req.StopLoss.LimitPrice, *req.StopLoss.StopPrice
+		if exitSide == alpaca.Sell && limitPrice.GreaterThan(stopPrice) {
+			return invalidOrder("stop_loss.limit_price must not be above stop_loss.stop_price when exiting a long position")
+		}
+		if exitSide == alpaca.Buy && limitPrice.LessThan(stopPrice) {
+			return invalidOrder("stop_loss.limit_price must not be below stop_loss.stop_price when exiting a short position")
+		}
+	}
+
+	// A limit entry has to sit between the exits for the bracket to make sense
+	if req.OrderClass == alpaca.Bracket && req.LimitPrice != nil {
+		entry := *req.LimitPrice
+		if req.Side == alpaca.Buy && (!req.TakeProfit.LimitPrice.GreaterThan(entry) || !req.StopLoss.StopPrice.LessThan(entry)) {
+			return invalidOrder("buy bracket requires take_profit above and stop_loss below the limit_price")
+		}
+		if req.Side == alpaca.Sell && (!req.TakeProfit.LimitPrice.LessThan(entry) || !req.StopLoss.StopPrice.GreaterThan(entry)) {
+			return invalidOrder("sell bracket requires take_profit below and stop_loss above the limit_price")
+		}
+	}
+
+	return nil
+}
+
+// ValidateReplace checks the changes to a working order against the order's
+// type, since only the prices the type uses can be changed
+func ValidateReplace(order *alpaca.Order, req alpaca.ReplaceOrderRequest) error {
+	if req.Qty == nil && req.LimitPrice == nil && req.StopPrice == nil && req.Trail == nil && req.TimeInForce == "" {
+		return invalidOrder("at least one of qty, limit_price, stop_price, trail or time_in_force is required")
+	}
+	if !isOpenStatus(order.Status) {
+		return invalidOrder("order is %s and can no longer be replaced", order.Status)
+	}
+	if order.Notional != nil {
+		return invalidOrder("notional orders cannot be replaced")
+	}
+
+	if req.Qty != nil {
+		if !req.Qty.IsPositive() {
+			return invalidOrder("qty must be greater than zero")
+		}
+		if !req.Qty.GreaterThan(order.FilledQty) {
+			return invalidOrder("qty must be greater than the %s already filled", order.FilledQty)
+		}
+	}
+
+	if req.LimitPrice != nil {
+		if order.Type != alpaca.Limit && order.Type != alpaca.StopLimit {
+			return invalidOrder("limit_price can only be changed on limit and stop_limit orders")
+		}
+		if !req.LimitPrice.IsPositive() {
+			return invalidOrder("limit_price must be greater than zero")
+		}
+	}
+	if req.StopPrice != nil {
+		if order.Type != alpaca.Stop && order.Type != alpaca.StopLimit {
+			return invalidOrder("stop_price can only be changed on stop and stop_limit orders")
+		}
+		if !req.StopPrice.IsPositive() {
+			return invalidOrder("stop_price must be greater than zero")
+		}
+	}
+	if req.Trail != nil {
+		if order.Type != alpaca.TrailingStop {
+			return invalidOrder("trail can only be changed on trailing_stop orders")
+		}
+		if !req.Trail.IsPositive() {
+			return invalidOrder("trail must be greater than zero")
+		}
+		if order.TrailPercent != nil && req.Trail.GreaterThanOrEqual(decimal.NewFromInt(100)) {
+			return invalidOrder("trail must be less than 100 for orders trailing by percent")
+		}
+	}
+
+	tif := order.TimeInForce
+	if req.TimeInForce != "" {
+		tif = req.TimeInForce
+	}
+	qty := order.Qty
+	if req.Qty != nil {
+		qty = req.Qty
+	}
+	switch {
+	case qty != nil && IsFractional(*qty) && tif != alpaca.Day:
+		return invalidOrder("fractional orders only support day time_in_force")
+	case order.Type == alpaca.TrailingStop && tif != alpaca.Day && tif != alpaca.GTC:
+		return invalidOrder("trailing_stop orders only support day or gtc time_in_force")
+	case order.OrderClass != "" && order.OrderClass != alpaca.Simple && tif != alpaca.Day && tif != alpaca.GTC:
+		return invalidOrder("%s orders only support day or gtc time_in_force", order.OrderClass)
+	}
+
+	return nil
+}
@@ -0,0 +1,456 @@
+package trading
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// checkValidation checks err is nil when wantErr is empty, and otherwise an
+// ErrInvalidOrder containing wantErr
+func checkValidation(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	if wantErr == "" {
+		if err != nil {
+			t.Fatalf("error = %v, want none", err)
+		}
+		return
+	}
+	if !errors.Is(err, ErrInvalidOrder) || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("error = %v, want an invalid order containing %q", err, wantErr)
+	}
+}
+
+func TestValidateOrderClass(t *testing.T) {
+	buy := func(class alpaca.OrderClass, typ alpaca.OrderType) alpaca.PlaceOrderRequest {
+		return alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Buy, Type: typ, TimeInForce: alpaca.GTC, OrderClass: class}
+	}
+	takeProfit := func(price string) *alpaca.TakeProfit { return &alpaca.TakeProfit{LimitPrice: decPtr(price)} }
+	stopLoss := func(stop string) *alpaca.StopLoss { return &alpaca.StopLoss{StopPrice: decPtr(stop)} }
+	with := func(req alpaca.PlaceOrderRequest, edit func(*alpaca.PlaceOrderRequest)) alpaca.PlaceOrderRequest {
+		edit(&req)
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     alpaca.PlaceOrderRequest
+		wantErr string
+	}{
+		{
+			name: "simple market order",
+			req:  buy("", alpaca.Market),
+		},
+		{
+			name:    "legs without an order class",
+			req:     with(buy("", alpaca.Market), func(r *alpaca.PlaceOrderRequest) { r.TakeProfit = takeProfit("110") }),
+			wantErr: "require a bracket, oco or oto order_class",
+		},
+		{
+			name: "bracket",
+			req: with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+		},
+		{
+			name: "bracket with a stop limit exit",
+			req: with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.TakeProfit = takeProfit("110")
+				r.StopLoss = &alpaca.StopLoss{StopPrice: decPtr("90"), LimitPrice: decPtr("89")}
+			}),
+		},
+		{
+			name: "bracket stop limit exit limit above its stop",
+			req: with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.TakeProfit = takeProfit("110")
+				r.StopLoss = &alpaca.StopLoss{StopPrice: decPtr("90"), LimitPrice: decPtr("91")}
+			}),
+			wantErr: "stop_loss.limit_price must not be above stop_loss.stop_price",
+		},
+		{
+			name:    "bracket without a stop loss",
+			req:     with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) { r.TakeProfit = takeProfit("110") }),
+			wantErr: "bracket orders require both take_profit and stop_loss",
+		},
+		{
+			name: "bracket with a stop entry",
+			req: with(buy(alpaca.Bracket, alpaca.Stop), func(r *alpaca.PlaceOrderRequest) {
+				r.StopPrice = decPtr("100")
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+			wantErr: "bracket entry orders must be market or limit",
+		},
+		{
+			name: "long bracket take profit below the stop",
+			req: with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.TakeProfit, r.StopLoss = takeProfit("90"), stopLoss("110")
+			}),
+			wantErr: "must be above stop_loss.stop_price",
+		},
+		{
+			name: "short bracket take profit above the stop",
+			req: with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.Side = alpaca.Sell
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+			wantErr: "must be below stop_loss.stop_price",
+		},
+		{
+			name: "limit bracket with the entry outside the exits",
+			req: with(buy(alpaca.Bracket, alpaca.Limit), func(r *alpaca.PlaceOrderRequest) {
+				r.LimitPrice = decPtr("115")
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+			wantErr: "take_profit above and stop_loss below the limit_price",
+		},
+		{
+			name: "bracket with ioc",
+			req: with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.TimeInForce = alpaca.IOC
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+			wantErr: "only support day or gtc time_in_force",
+		},
+		{
+			name: "bracket in extended hours",
+			req: with(buy(alpaca.Bracket, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.ExtendedHours = true
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+			wantErr: "cannot trade in extended hours",
+		},
+		{
+			name: "oco exiting a long position",
+			req: with(buy(alpaca.OCO, alpaca.Limit), func(r *alpaca.PlaceOrderRequest) {
+				r.Side = alpaca.Sell
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+		},
+		{
+			name: "oco of type market",
+			req: with(buy(alpaca.OCO, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.Side = alpaca.Sell
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+			wantErr: "oco orders must be of type limit",
+		},
+		{
+			name: "oto with a stop loss",
+			req:  with(buy(alpaca.OTO, alpaca.Market), func(r *alpaca.PlaceOrderRequest) { r.StopLoss = stopLoss("90") }),
+		},
+		{
+			name: "oto with both legs",
+			req: with(buy(alpaca.OTO, alpaca.Market), func(r *alpaca.PlaceOrderRequest) {
+				r.TakeProfit, r.StopLoss = takeProfit("110"), stopLoss("90")
+			}),
+			wantErr: "oto orders require exactly one of take_profit or stop_loss",
+		},
+		{
+			name:    "take profit without a limit price",
+			req:     with(buy(alpaca.OTO, alpaca.Market), func(r *alpaca.PlaceOrderRequest) { r.TakeProfit = &alpaca.TakeProfit{} }),
+			wantErr: "take_profit.limit_price is required",
+		},
+		{
+			name:    "unknown order class",
+			req:     buy("trailing", alpaca.Market),
+			wantErr: `invalid order_class "trailing"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, ValidateOrder(tt.req), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateTrailingStop(t *testing.T) {
+	trailing := func(edit func(*alpaca.PlaceOrderRequest)) alpaca.PlaceOrderRequest {
+		req := alpaca.PlaceOrderRequest{Symbol: "AAPL", Qty: decPtr("10"), Side: alpaca.Sell, Type: alpaca.TrailingStop, TimeInForce: alpaca.GTC}
+		edit(&req)
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     alpaca.PlaceOrderRequest
+		wantErr string
+	}{
+		{
+			name: "trail price",
+			req:  trailing(func(r *alpaca.PlaceOrderRequest) { r.TrailPrice = decPtr("2.5") }),
+		},
+		{
+			name: "trail percent",
+			req:  trailing(func(r *alpaca.PlaceOrderRequest) { r.TrailPercent = decPtr("5") }),
+		},
+		{
+			name:    "no trail",
+			req:     trailing(func(*alpaca.PlaceOrderRequest) {}),
+			wantErr: "exactly one of trail_price or trail_percent",
+		},
+		{
+			name: "both trails",
+			req: trailing(func(r *alpaca.PlaceOrderRequest) {
+				r.TrailPrice, r.TrailPercent = decPtr("2.5"), decPtr("5")
+			}),
+			wantErr: "exactly one of trail_price or trail_percent",
+		},
+		{
+			name:    "zero trail price",
+			req:     trailing(func(r *alpaca.PlaceOrderRequest) { r.TrailPrice = decPtr("0") }),
+			wantErr: "trail_price must be greater than zero",
+		},
+		{
+			name:    "trail percent of 100",
+			req:     trailing(func(r *alpaca.PlaceOrderRequest) { r.TrailPercent = decPtr("100") }),
+			wantErr: "trail_percent must be greater than zero and less than 100",
+		},
+		{
+			name: "with a stop price",
+			req: trailing(func(r *alpaca.PlaceOrderRequest) {
+				r.TrailPrice, r.StopPrice = decPtr("2.5"), decPtr("95")
+			}),
+			wantErr: "cannot set limit_price or stop_price",
+		},
+		{
+			name: "ioc",
+			req: trailing(func(r *alpaca.PlaceOrderRequest) {
+				r.TrailPrice, r.TimeInForce = decPtr("2.5"), alpaca.IOC
+			}),
+			wantErr: "only support day or gtc time_in_force",
+		},
+		{
+			name: "extended hours",
+			req: trailing(func(r *alpaca.PlaceOrderRequest) {
+				r.TrailPrice, r.ExtendedHours = decPtr("2.5"), true
+			}),
+			wantErr: "cannot trade in extended hours",
+		},
+		{
+			name: "trail on a limit order",
+			req: trailing(func(r *alpaca.PlaceOrderRequest) {
+				r.Type, r.LimitPrice, r.TrailPrice = alpaca.Limit, decPtr("95"), decPtr("2.5")
+			}),
+			wantErr: "only valid for trailing_stop orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, ValidateOrder(tt.req), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateQuantity(t *testing.T) {
+	order := func(edit func(*alpaca.PlaceOrderRequest)) alpaca.PlaceOrderRequest {
+		req := alpaca.PlaceOrderRequest{Symbol: "AAPL", Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day}
+		edit(&req)
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     alpaca.PlaceOrderRequest
+		wantErr string
+	}{
+		{
+			name: "whole share qty with gtc",
+			req:  order(func(r *alpaca.PlaceOrderRequest) { r.Qty, r.TimeInForce = decPtr("10"), alpaca.GTC }),
+		},
+		{
+			name: "notional market order",
+			req:  order(func(r *alpaca.PlaceOrderRequest) { r.Notional = decPtr("250.50") }),
+		},
+		{
+			name: "fractional limit order",
+			req: order(func(r *alpaca.PlaceOrderRequest) {
+				r.Qty, r.Type, r.LimitPrice = decPtr("0.5"), alpaca.Limit, decPtr("100")
+			}),
+		},
+		{
+			name:    "neither qty nor notional",
+			req:     order(func(*alpaca.PlaceOrderRequest) {}),
+			wantErr: "exactly one of qty or notional is required",
+		},
+		{
+			name:    "both qty and notional",
+			req:     order(func(r *alpaca.PlaceOrderRequest) { r.Qty, r.Notional = decPtr("1"), decPtr("100") }),
+			wantErr: "exactly one of qty or notional is required",
+		},
+		{
+			name:    "zero qty",
+			req:     order(func(r *alpaca.PlaceOrderRequest) { r.Qty = decPtr("0") }),
+			wantErr: "qty must be greater than zero",
+		},
+		{
+			name:    "negative notional",
+			req:     order(func(r *alpaca.PlaceOrderRequest) { r.Notional = decPtr("-5") }),
+			wantErr: "notional must be greater than zero",
+		},
+		{
+			name: "notional limit order",
+			req: order(func(r *alpaca.PlaceOrderRequest) {
+				r.Notional, r.Type, r.LimitPrice = decPtr("100"), alpaca.Limit, decPtr("100")
+			}),
+			wantErr: "notional orders must be of type market",
+		},
+		{
+			name:    "notional with gtc",
+			req:     order(func(r *alpaca.PlaceOrderRequest) { r.Notional, r.TimeInForce = decPtr("100"), alpaca.GTC }),
+			wantErr: "notional orders only support day time_in_force",
+		},
+		{
+			name: "fractional trailing stop",
+			req: order(func(r *alpaca.PlaceOrderRequest) {
+				r.Qty, r.Type, r.TrailPrice = decPtr("0.5"), alpaca.TrailingStop, decPtr("1")
+			}),
+			wantErr: "fractional orders must be market, limit, stop or stop_limit",
+		},
+		{
+			name:    "fractional with gtc",
+			req:     order(func(r *alpaca.PlaceOrderRequest) { r.Qty, r.TimeInForce = decPtr("0.5"), alpaca.GTC }),
+			wantErr: "fractional orders only support day time_in_force",
+		},
+		{
+			name: "fractional bracket",
+			req: order(func(r *alpaca.PlaceOrderRequest) {
+				r.Qty, r.OrderClass = decPtr("0.5"), alpaca.Bracket
+				r.TakeProfit = &alpaca.TakeProfit{LimitPrice: decPtr("110")}
+				r.StopLoss = &alpaca.StopLoss{StopPrice: decPtr("90")}
+			}),
+			wantErr: "fractional orders must use the simple order_class",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, ValidateOrder(tt.req), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateFractionable(t *testing.T) {
+	tests := []struct {
+		name         string
+		qty          string
+		notional     string
+		fractionable bool
+		wantErr      string
+	}{
+		{name: "whole shares of a non fractionable asset", qty: "10"},
+		{name: "fractional shares of a fractionable asset", qty: "0.5", fractionable: true},
+		{name: "notional of a fractionable asset", notional: "100", fractionable: true},
+		{name: "fractional shares of a non fractionable asset", qty: "0.5", wantErr: "BRK.A is not fractionable"},
+		{name: "notional of a non fractionable asset", notional: "100", wantErr: "BRK.A is not fractionable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := alpaca.PlaceOrderRequest{Symbol: "BRK.A", Side: alpaca.Buy, Type: alpaca.Market, TimeInForce: alpaca.Day}
+			if tt.qty != "" {
+				req.Qty = decPtr(tt.qty)
+			}
+			if tt.notional != "" {
+				req.Notional = decPtr(tt.notional)
+			}
+			asset := &alpaca.Asset{Symbol: "BRK.A", Fractionable: tt.fractionable}
+			checkValidation(t, ValidateFractionable(req, asset), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateReplace(t *testing.T) {
+	limit := alpaca.Order{Status: OrderStatusNew, Type: alpaca.Limit, Qty: decPtr("10"), FilledQty: dec("4"), LimitPrice: decPtr("95"), TimeInForce: alpaca.GTC}
+	trailing := alpaca.Order{Status: OrderStatusNew, Type: alpaca.TrailingStop, Qty: decPtr("10"), TrailPercent: decPtr("5"), TimeInForce: alpaca.GTC}
+	with := func(order alpaca.Order, edit func(*alpaca.Order)) alpaca.Order {
+		edit(&order)
+		return order
+	}
+
+	tests := []struct {
+		name    string
+		order   alpaca.Order
+		req     alpaca.ReplaceOrderRequest
+		wantErr string
+	}{
+		{
+			name:  "limit price and qty",
+			order: limit,
+			req:   alpaca.ReplaceOrderRequest{Qty: decPtr("12"), LimitPrice: decPtr("96")},
+		},
+		{
+			name:  "trail percent",
+			order: trailing,
+			req:   alpaca.ReplaceOrderRequest{Trail: decPtr("3")},
+		},
+		{
+			name:    "no changes",
+			order:   limit,
+			wantErr: "at least one of qty, limit_price, stop_price, trail or time_in_force is required",
+		},
+		{
+			name:    "filled order",
+			order:   with(limit, func(o *alpaca.Order) { o.Status = OrderStatusFilled }),
+			req:     alpaca.ReplaceOrderRequest{LimitPrice: decPtr("96")},
+			wantErr: "order is filled and can no longer be replaced",
+		},
+		{
+			name:    "notional order",
+			order:   with(limit, func(o *alpaca.Order) { o.Type, o.Qty, o.Notional = alpaca.Market, nil, decPtr("100") }),
+			req:     alpaca.ReplaceOrderRequest{TimeInForce: alpaca.Day},
+			wantErr: "notional orders cannot be replaced",
+		},
+		{
+			name:    "qty at the filled qty",
+			order:   limit,
+			req:     alpaca.ReplaceOrderRequest{Qty: decPtr("4")},
+			wantErr: "qty must be greater than the 4 already filled",
+		},
+		{
+			name:    "stop price on a limit order",
+			order:   limit,
+			req:     alpaca.ReplaceOrderRequest{StopPrice: decPtr("90")},
+			wantErr: "stop_price can only be changed on stop and stop_limit orders",
+		},
+		{
+			name:    "zero limit price",
+			order:   limit,
+			req:     alpaca.ReplaceOrderRequest{LimitPrice: decPtr("0")},
+			wantErr: "limit_price must be greater than zero",
+		},
+		{
+			name:    "trail on a limit order",
+			order:   limit,
+			req:     alpaca.ReplaceOrderRequest{Trail: decPtr("3")},
+			wantErr: "trail can only be changed on trailing_stop orders",
+		},
+		{
+			name:    "trail percent of 100",
+			order:   trailing,
+			req:     alpaca.ReplaceOrderRequest{Trail: decPtr("100")},
+			wantErr: "trail must be less than 100 for orders trailing by percent",
+		},
+		{
+			name:    "fractional qty on a gtc order",
+			order:   limit,
+			req:     alpaca.ReplaceOrderRequest{Qty: decPtr("10.5")},
+			wantErr: "fractional orders only support day time_in_force",
+		},
+		{
+			name:    "trailing stop to ioc",
+			order:   trailing,
+			req:     alpaca.ReplaceOrderRequest{TimeInForce: alpaca.IOC},
+			wantErr: "trailing_stop orders only support day or gtc time_in_force",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, ValidateReplace(&tt.order, tt.req), tt.wantErr)
+		})
+	}
+}
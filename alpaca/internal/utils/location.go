@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// NewYork is the time zone US equity sessions, trading days and reports are
+// counted in. The server embeds the zone database, so it loads even on hosts
+// without one; failing to load it is a broken build, not something to run
+// through in UTC.
+var NewYork = mustLoadLocation("America/New_York")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("load %s time zone: %v", name, err))
+	}
+	return loc
+}
@@ -1,65 +0,0 @@
-package utils
-
-import (
-	"log"
-	"os"
-
-	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
-	"github.com/joho/godotenv"
-)
-
-func GetPaperAccount() *alpaca.Account {
-	// Load .env file
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Get API keys from environment variables
-	apiKey := os.Getenv("ALPACA_PAPER_API_KEY")
-	apiSecret := os.Getenv("ALPACA_PAPER_SECRET_KEY")
-
-	if apiKey == "" || apiSecret == "" {
-		log.Fatal("API key or secret not found in .env file")
-	}
-
-	client := alpaca.NewClient(alpaca.ClientOpts{
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-		BaseURL:   PAPER_BASE_URL,
-	})
-	account, err := client.GetAccount()
-	if err != nil {
-		panic(err)
-	}
-
-	return account
-}
-
-func GetLiveAccount() *alpaca.Account {
-	// Load .env file
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Get API keys from environment variables
-	apiKey := os.Getenv("ALPACA_LIVE_API_KEY")
-	apiSecret := os.Getenv("ALPACA_LIVE_API_SECRET_KEY")
-
-	if apiKey == "" || apiSecret == "" {
-		log.Fatal("API key or secret not found in .env file")
-	}
-
-	client := alpaca.NewClient(alpaca.ClientOpts{
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-		BaseURL:   LIVE_BASE_URL,
-	})
-	account, err := client.GetAccount()
-	if err != nil {
-		panic(err)
-	}
-
-	return account
-}